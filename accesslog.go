@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Форматы журнала доступа
+const (
+	accessLogLogrus   = "logrus"   // запись logrus "request completed", как остальные логи
+	accessLogJSON     = "json"     // JSON-строка на запрос
+	accessLogCombined = "combined" // Apache/nginx combined log format
+)
+
+// AccessLogConfig - формат и место журнала доступа
+type AccessLogConfig struct {
+	Format     string // logrus, json или combined
+	File       string // пусто или stdout - стандартный вывод, stderr, иначе путь к файлу
+	MaxSizeMB  int    // размер файла, после которого он ротируется
+	MaxBackups int    // сколько старых файлов хранить; 0 - все
+	MaxAgeDays int    // сколько дней хранить старые файлы; 0 - не удалять по возрасту
+	Compress   bool   // сжимать старые файлы gzip
+}
+
+// AccessLog пишет журнал доступа в отдельный поток в формате для внешних
+// сборщиков логов
+type AccessLog struct {
+	format string
+	out    io.Writer
+	closer io.Closer
+}
+
+// Журнал доступа в отдельном формате; nil - записи идут через logrus
+var accessLog *AccessLog
+
+// NewAccessLog открывает журнал доступа; nil - формат logrus
+func NewAccessLog(cfg AccessLogConfig) (*AccessLog, error) {
+	switch cfg.Format {
+	case "", accessLogLogrus:
+		return nil, nil
+	case accessLogJSON, accessLogCombined:
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", cfg.Format)
+	}
+	l := &AccessLog{format: cfg.Format}
+	switch cfg.File {
+	case "", "stdout":
+		l.out = os.Stdout
+	case "stderr":
+		l.out = os.Stderr
+	default:
+		// Файл ротируется по размеру; открывается при первой записи
+		file := &lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAgeDays,
+			Compress:   cfg.Compress,
+			LocalTime:  true,
+		}
+		l.out, l.closer = file, file
+	}
+	return l, nil
+}
+
+// Close закрывает файл журнала
+func (l *AccessLog) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// accessRecord - строка журнала доступа в формате json
+type accessRecord struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Query     string    `json:"query,omitempty"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	LatencyMs float64   `json:"latency_ms"`
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Referer   string    `json:"referer,omitempty"`
+	RequestID string    `json:"request_id"`
+	Route     string    `json:"route,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	APIKeyID  string    `json:"api_key_id,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	Queries   int64     `json:"queries"`
+	StmtHits  int64     `json:"stmt_hits"`
+	StmtMiss  int64     `json:"stmt_misses"`
+	Errors    string    `json:"errors,omitempty"`
+}
+
+// FormattedAccessLogger пишет журнал доступа в формате json или combined
+// вместо записей logrus от AccessLogger
+func FormattedAccessLogger(l *AccessLog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		counter := requestQueryCounter(c)
+		c.Next()
+
+		rec := accessRecord{
+			Time:      start,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Query:     c.Request.URL.RawQuery,
+			Proto:     c.Request.Proto,
+			Status:    c.Writer.Status(),
+			Bytes:     max(c.Writer.Size(), 0),
+			LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			ClientIP:  c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Referer:   c.Request.Referer(),
+			RequestID: c.GetString(fieldRequestID),
+			Route:     c.FullPath(),
+			Queries:   counter.n.Load(),
+			StmtHits:  counter.stmtHits.Load(),
+			StmtMiss:  counter.stmtMisses.Load(),
+		}
+		if userID, ok := c.Get(fieldUserID); ok {
+			rec.UserID = fmt.Sprint(userID)
+		}
+		if keyID, ok := c.Get(fieldAPIKeyID); ok {
+			rec.APIKeyID = fmt.Sprint(keyID)
+		}
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+			rec.TraceID = sc.TraceID().String()
+		}
+		if len(c.Errors) > 0 {
+			rec.Errors = c.Errors.String()
+		}
+		l.write(rec)
+	}
+}
+
+func (l *AccessLog) write(rec accessRecord) {
+	var line []byte
+	if l.format == accessLogCombined {
+		line = appendCombined(nil, rec)
+	} else {
+		var err error
+		if line, err = json.Marshal(rec); err != nil {
+			return
+		}
+	}
+	// Строка пишется одним вызовом, чтобы записи параллельных запросов не
+	// перемешивались
+	l.out.Write(append(line, '\n'))
+}
+
+// appendCombined форматирует запись как
+// %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+func appendCombined(dst []byte, rec accessRecord) []byte {
+	dst = append(dst, rec.ClientIP...)
+	dst = append(dst, " - "...)
+	dst = append(dst, combinedField(rec.UserID)...)
+	dst = append(dst, " ["...)
+	dst = rec.Time.AppendFormat(dst, "02/Jan/2006:15:04:05 -0700")
+	dst = append(dst, `] "`...)
+	target := rec.Path
+	if rec.Query != "" {
+		target += "?" + rec.Query
+	}
+	dst = append(dst, combinedQuote(rec.Method+" "+target+" "+rec.Proto)...)
+	dst = append(dst, `" `...)
+	dst = strconv.AppendInt(dst, int64(rec.Status), 10)
+	dst = append(dst, ' ')
+	if rec.Bytes > 0 {
+		dst = strconv.AppendInt(dst, int64(rec.Bytes), 10)
+	} else {
+		dst = append(dst, '-')
+	}
+	dst = append(dst, ` "`...)
+	dst = append(dst, combinedQuote(combinedField(rec.Referer))...)
+	dst = append(dst, `" "`...)
+	dst = append(dst, combinedQuote(combinedField(rec.UserAgent))...)
+	return append(dst, '"')
+}
+
+// combinedField - пустое поле в combined записывается дефисом
+func combinedField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// combinedQuote экранирует кавычки, обратную косую черту и управляющие
+// символы, как это делает Apache, чтобы клиент не мог подделать строку
+func combinedQuote(s string) string {
+	if !strings.ContainsFunc(s, func(r rune) bool { return r == '"' || r == '\\' || r < 0x20 || r == 0x7f }) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '"' || ch == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case ch < 0x20 || ch == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
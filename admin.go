@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Тело запроса на смену уровня логирования
+type LogLevelRequest struct {
+	Level     string `json:"level" binding:"required"`
+	Component string `json:"component"`
+}
+
+// @Summary Set log level
+// @Description Change the global or per-component log level at runtime.
+// @ID set-log-level
+// @Accept  json
+// @Produce  json
+// @Param request body LogLevelRequest true "Level and optional component"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Router /admin/log-level [put]
+func SetLogLevel(c *gin.Context) {
+	var req LogLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+
+	level, err := logrus.ParseLevel(req.Level)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid log level")
+		return
+	}
+
+	setLogLevel(req.Component, level)
+	logEntry(c).WithFields(logrus.Fields{"new_level": level.String(), "component": req.Component}).Warn("Log level changed")
+
+	global, components := logLevels()
+	c.JSON(http.StatusOK, gin.H{"level": global, "components": components})
+}
+
+// @Summary List panics
+// @Description List recovered panics grouped by fingerprint.
+// @ID list-panics
+// @Produce  json
+// @Success 200 {array} PanicStat
+// @Failure 401 {object} APIError
+// @Router /admin/panics [get]
+func GetPanics(c *gin.Context) {
+	c.JSON(http.StatusOK, PanicStats())
+}
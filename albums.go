@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const auditEntityAlbum = "album"
+
+// Структура Album (Альбом)
+type Album struct {
+	ID          int       `json:"id" gorm:"primaryKey"`
+	Group       string    `json:"group" binding:"required" gorm:"not null;uniqueIndex:idx_album_group_title"`
+	Title       string    `json:"title" binding:"required" gorm:"not null;uniqueIndex:idx_album_group_title"`
+	ReleaseDate string    `json:"releaseDate"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Песни альбома, только в GET /albums/:id
+	Songs []Song `json:"songs,omitempty" gorm:"foreignKey:AlbumID;constraint:OnDelete:SET NULL"`
+}
+
+// AlbumTrack - трек из трек-листа источника
+type AlbumTrack struct {
+	Position   int    `json:"position"` // сквозной номер с учетом дисков
+	Title      string `json:"title"`
+	DurationMs int    `json:"durationMs,omitempty"`
+}
+
+// AlbumDetail - альбом по данным источника
+type AlbumDetail struct {
+	ReleaseDate string
+	Tracks      []AlbumTrack
+}
+
+// AlbumTracklistProvider - источник, умеющий отдавать трек-лист альбома.
+// Ошибки те же, что у SongInfoProvider.
+type AlbumTracklistProvider interface {
+	AlbumDetail(ctx context.Context, group, album string) (AlbumDetail, error)
+}
+
+// Результат обработки трека
+const (
+	trackCreated = "created" // песни не было, создана
+	trackLinked  = "linked"  // песня была, привязана к альбому
+	trackExists  = "exists"  // песня уже в альбоме
+)
+
+// TrackResult - строка отчета POST /albums/:id/enrich
+type TrackResult struct {
+	Position int      `json:"position"`
+	Title    string   `json:"title"`
+	Status   string   `json:"status"`
+	SongID   PublicID `json:"songId" extensions:"x-public-id"`
+}
+
+// @Summary Create album
+// @Description Create an album to attach songs to.
+// @ID create-album
+// @Accept  json
+// @Produce  json
+// @Param album body Album true "Album"
+// @Success 201 {object} Album
+// @Failure 400 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /albums [post]
+func CreateAlbum(c *gin.Context) {
+	var album Album
+	if err := c.ShouldBindJSON(&album); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	album.ID = 0
+	album.Songs = nil
+
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&Album{}).Where(`"group" = ? AND title = ?`, album.Group, album.Title).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return gorm.ErrDuplicatedKey
+		}
+		if err := tx.Create(&album).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, auditEntityAlbum, album.ID, auditActionCreate, nil, album)
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		abortWithError(c, http.StatusConflict, codeConflict, "Album already exists")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to create album")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to create album")
+		return
+	}
+	c.JSON(http.StatusCreated, album)
+}
+
+// @Summary Get album
+// @Description Get an album with its songs.
+// @ID get-album
+// @Produce  json
+// @Param id path int true "Album ID"
+// @Success 200 {object} Album
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /albums/{id} [get]
+func GetAlbum(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid album ID")
+		return
+	}
+	var album Album
+	err = dbFor(c).Preload("Songs", func(db *gorm.DB) *gorm.DB {
+		return db.Order("album_position, id")
+	}).First(&album, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Album not found")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch album")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch album")
+		return
+	}
+	album.Songs = restrictSongs(c, album.Songs)
+	if publicIDs != nil {
+		c.JSON(http.StatusOK, struct {
+			Album
+			Songs []songView `json:"songs,omitempty"`
+		}{album, songViews(album.Songs)})
+		return
+	}
+	c.JSON(http.StatusOK, album)
+}
+
+// @Summary Enrich album
+// @Description Fetch the album's tracklist from the enrichment providers and create missing songs linked to the album in one transaction.
+// @ID enrich-album
+// @Produce  json
+// @Param id path int true "Album ID"
+// @Success 200 {array} TrackResult
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Failure 501 {object} APIError
+// @Failure 502 {object} APIError
+// @Failure 503 {object} APIError
+// @Router /albums/{id}/enrich [post]
+func EnrichAlbum(info SongInfoProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid album ID")
+			return
+		}
+		tracklists, ok := info.(AlbumTracklistProvider)
+		if !ok {
+			abortWithError(c, http.StatusNotImplemented, codeNotImplemented, "Enrichment provider does not support tracklists")
+			return
+		}
+
+		var album Album
+		if err := dbFor(c).First(&album, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				abortWithError(c, http.StatusNotFound, codeNotFound, "Album not found")
+				return
+			}
+			logEntry(c).WithError(err).Error("Failed to fetch album")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch album")
+			return
+		}
+
+		// Внешний запрос - до транзакции, чтобы не держать ее открытой
+		detail, err := tracklists.AlbumDetail(c.Request.Context(), album.Group, album.Title)
+		switch {
+		case errors.Is(err, errTracklistsUnsupported):
+			abortWithError(c, http.StatusNotImplemented, codeNotImplemented, "Enrichment provider does not support tracklists")
+			return
+		case errors.Is(err, ErrInfoNotFound):
+			abortWithError(c, http.StatusNotFound, codeNotFound, "Album tracklist not found")
+			return
+		case errors.Is(err, ErrInfoUnavailable):
+			componentEntry(c, componentEnrichment).WithError(err).Warn("Tracklist provider unavailable")
+			abortWithError(c, http.StatusServiceUnavailable, codeEnrichmentFailed, "Enrichment provider unavailable")
+			return
+		case err != nil:
+			componentEntry(c, componentEnrichment).WithError(err).Error("Failed to fetch album tracklist")
+			abortWithError(c, http.StatusBadGateway, codeEnrichmentFailed, "Failed to fetch album tracklist")
+			return
+		}
+
+		var report []TrackResult
+		err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+			if album.ReleaseDate == "" && detail.ReleaseDate != "" {
+				album.ReleaseDate = detail.ReleaseDate
+				if err := tx.Model(&album).Update("release_date", album.ReleaseDate).Error; err != nil {
+					return err
+				}
+			}
+			var err error
+			report, err = linkAlbumTracks(tx, c, album, detail.Tracks)
+			return err
+		})
+		if err != nil {
+			logEntry(c).WithError(err).Error("Failed to populate album tracklist")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to populate album")
+			return
+		}
+		purgeCacheFor(c, albumCacheKey(album.ID), cacheKeySongs)
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// linkAlbumTracks создает недостающие песни альбома и привязывает существующие
+func linkAlbumTracks(tx *gorm.DB, c *gin.Context, album Album, tracks []AlbumTrack) ([]TrackResult, error) {
+	var existing []Song
+	if err := tx.Where(`"group" = ?`, album.Group).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byTitle := make(map[string]Song, len(existing))
+	for _, song := range existing {
+		byTitle[strings.ToLower(song.SongName)] = song
+	}
+
+	var ownerID *int
+	if userID, ok := currentUserID(c); ok {
+		ownerID = &userID
+	}
+
+	report := make([]TrackResult, 0, len(tracks))
+	for _, track := range tracks {
+		result := TrackResult{Position: track.Position, Title: track.Title}
+		song, found := byTitle[strings.ToLower(track.Title)]
+		switch {
+		case found && song.AlbumID != nil && *song.AlbumID == album.ID:
+			result.Status = trackExists
+		case found:
+			err := tx.Model(&song).Updates(map[string]interface{}{
+				"album_id": album.ID, "album_position": track.Position, "album": album.Title,
+				"version": gorm.Expr("version + 1"),
+			}).Error
+			if err != nil {
+				return nil, err
+			}
+			result.Status = trackLinked
+		default:
+			// Текста и ссылки в трек-листе нет - песня ждет обогащения
+			song = Song{
+				Group: album.Group, SongName: track.Title, ReleaseDate: providerReleaseDate(album.ReleaseDate),
+				Album: album.Title, DurationMs: track.DurationMs, OwnerID: ownerID,
+				AlbumID: &album.ID, AlbumPosition: track.Position, EnrichmentPending: true,
+			}
+			if err := tx.Create(&song).Error; err != nil {
+				return nil, err
+			}
+			if err := recordAudit(tx, c, auditEntitySong, song.ID, auditActionCreate, nil, song); err != nil {
+				return nil, err
+			}
+			byTitle[strings.ToLower(track.Title)] = song
+			result.Status = trackCreated
+		}
+		result.SongID = PublicID(song.ID)
+		report = append(report, result)
+	}
+	return report, nil
+}
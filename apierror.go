@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Стабильные коды ошибок. Текст ошибки может меняться, код - нет: клиенты
+// ветвятся по нему.
+const (
+	codeValidation         = "VALIDATION_ERROR"
+	codeUnauthenticated    = "UNAUTHENTICATED"
+	codeInvalidCredentials = "INVALID_CREDENTIALS"
+	codeInvalidToken       = "INVALID_TOKEN"
+	codeForbidden          = "FORBIDDEN"
+	codeNotOwner           = "NOT_OWNER"
+	codeCaptchaRequired    = "CAPTCHA_REQUIRED"
+	codeBlocked            = "BLOCKED"
+	codeNotFound           = "NOT_FOUND"
+	codeSongNotFound       = "SONG_NOT_FOUND"
+	codeSongInfoNotFound   = "SONG_INFO_NOT_FOUND"
+	codeConflict           = "CONFLICT"
+	codeSongExists         = "SONG_EXISTS"
+	codeVersionConflict    = "VERSION_CONFLICT"
+	codePrecondition       = "PRECONDITION_REQUIRED"
+	codeGone               = "GONE"
+	codePayloadTooLarge    = "PAYLOAD_TOO_LARGE"
+	codeUnsupportedMedia   = "UNSUPPORTED_MEDIA_TYPE"
+	codeRateLimited        = "RATE_LIMITED"
+	codeRegionRestricted   = "REGION_RESTRICTED"
+	codeInternal           = "INTERNAL_ERROR"
+	codeNotImplemented     = "NOT_IMPLEMENTED"
+	codeEnrichmentFailed   = "ENRICHMENT_FAILED"
+	codeUpstream           = "UPSTREAM_ERROR"
+	codeUnavailable        = "SERVICE_UNAVAILABLE"
+	codeServerBusy         = "SERVER_BUSY"
+	codeTimeout            = "TIMEOUT"
+	codeClientError        = "CLIENT_ERROR"
+)
+
+// APIError - тело любого ответа с ошибкой
+type APIError struct {
+	Code string `json:"code" example:"SONG_NOT_FOUND" enums:"VALIDATION_ERROR,UNAUTHENTICATED,INVALID_CREDENTIALS,INVALID_TOKEN,FORBIDDEN,NOT_OWNER,CAPTCHA_REQUIRED,BLOCKED,NOT_FOUND,SONG_NOT_FOUND,SONG_INFO_NOT_FOUND,CONFLICT,SONG_EXISTS,VERSION_CONFLICT,PRECONDITION_REQUIRED,GONE,PAYLOAD_TOO_LARGE,UNSUPPORTED_MEDIA_TYPE,RATE_LIMITED,REGION_RESTRICTED,INTERNAL_ERROR,NOT_IMPLEMENTED,ENRICHMENT_FAILED,UPSTREAM_ERROR,SERVICE_UNAVAILABLE,SERVER_BUSY,TIMEOUT,CLIENT_ERROR"`
+	// Текст для человека; поле называется error ради старых клиентов
+	Message   string      `json:"error" example:"Song not found"`
+	Details   interface{} `json:"details,omitempty" swaggertype:"array,object"`         // для VALIDATION_ERROR - список FieldError
+	RequestID string      `json:"requestId" example:"3f2b9c1e8d7a4f60b5e2c9d8a7f6e5d4"` // тот же, что в X-Request-ID
+	// Для SONG_EXISTS - песня, которая уже есть в каталоге
+	ExistingID *PublicID `json:"existingId,omitempty" extensions:"x-public-id"`
+}
+
+// FieldError - поле тела запроса, не прошедшее проверку
+type FieldError struct {
+	Field string `json:"field" example:"songName"`
+	Rule  string `json:"rule" example:"required"`
+	Param string `json:"param,omitempty"`
+	// Что не так с полем, для человека
+	Message string `json:"message" example:"is required"`
+}
+
+// Код по умолчанию для тел с ошибкой без "code": ответы gin и сторонних
+// обработчиков. Обработчики сервиса задают код сами, см. abortWithError.
+var errorCodesByStatus = map[int]string{
+	http.StatusBadRequest:                   codeValidation,
+	http.StatusUnauthorized:                 codeUnauthenticated,
+	http.StatusForbidden:                    codeForbidden,
+	http.StatusNotFound:                     codeNotFound,
+	http.StatusConflict:                     codeConflict,
+	http.StatusPreconditionRequired:         codePrecondition,
+	http.StatusGone:                         codeGone,
+	http.StatusRequestEntityTooLarge:        codePayloadTooLarge,
+	http.StatusUnsupportedMediaType:         codeUnsupportedMedia,
+	http.StatusUnprocessableEntity:          codeValidation,
+	http.StatusTooManyRequests:              codeRateLimited,
+	http.StatusUnavailableForLegalReasons:   codeRegionRestricted,
+	http.StatusInternalServerError:          codeInternal,
+	http.StatusNotImplemented:               codeNotImplemented,
+	http.StatusBadGateway:                   codeUpstream,
+	http.StatusServiceUnavailable:           codeUnavailable,
+	http.StatusGatewayTimeout:               codeTimeout,
+	http.StatusRequestHeaderFieldsTooLarge:  codePayloadTooLarge,
+	http.StatusRequestedRangeNotSatisfiable: codeValidation,
+}
+
+// statusErrorCode - код ошибки по статусу ответа
+func statusErrorCode(status int) string {
+	if code, ok := errorCodesByStatus[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return codeInternal
+	}
+	return codeClientError
+}
+
+// apiErrorBody дополняет тело {"error": ...} кодом и ID запроса. Прочие
+// поля тела, например details, сохраняются. false - тело не ошибка API.
+func apiErrorBody(status int, body []byte, requestID string) ([]byte, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, false
+	}
+	var message string
+	if err := json.Unmarshal(fields["error"], &message); err != nil {
+		return nil, false
+	}
+	if _, ok := fields["code"]; !ok {
+		fields["code"], _ = json.Marshal(statusErrorCode(status))
+	}
+	fields["requestId"], _ = json.Marshal(requestID)
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// abortWithError отвечает ошибкой с кодом из списка выше и прерывает
+// обработку запроса
+func abortWithError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"code": code, "error": message})
+}
+
+// errorBody - тело ответа на ошибку разбора или проверки запроса; для
+// ошибок валидатора в details перечисляются поля
+func errorBody(err error) gin.H {
+	body := gin.H{"code": codeValidation, "error": err.Error()}
+	var invalid validator.ValidationErrors
+	if errors.As(err, &invalid) {
+		details := make([]FieldError, len(invalid))
+		for i, fe := range invalid {
+			details[i] = FieldError{Field: fieldPath(fe), Rule: fe.Tag(), Param: fe.Param(), Message: fieldMessage(fe)}
+		}
+		body["details"] = details
+	}
+	return body
+}
+
+// fieldPath - путь к полю без имени корневой структуры: items[0].songName
+func fieldPath(fe validator.FieldError) string {
+	path := fe.Namespace()
+	if i := strings.IndexByte(path, '.'); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+func init() {
+	// Поля в ошибках валидации называются так же, как в JSON
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(jsonFieldName)
+		for tag, fn := range customValidations {
+			if err := v.RegisterValidation(tag, fn); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	// Пустое имя - валидатор оставит имя поля Go
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
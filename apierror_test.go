@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestErrorCodes(t *testing.T) {
+	setupTestDB(t)
+	seedGoldenSongs(t)
+	useTestJWTKeys(t)
+	router := newTestRouter()
+	createTestUser(t, "alice", "correct-horse", RoleEditor)
+
+	cases := []struct {
+		method, target, body, token string
+		status                      int
+		code                        string
+	}{
+		{http.MethodGet, "/songs/" + encodeSongID(999) + "/text", "", testAdminToken, http.StatusNotFound, codeSongNotFound},
+		{http.MethodPost, "/auth/login", `{"username":"alice","password":"wrong"}`, "", http.StatusUnauthorized, codeInvalidCredentials},
+		{http.MethodGet, "/songs?page=0", "", testAdminToken, http.StatusBadRequest, codeValidation},
+		{http.MethodPost, "/songs", `{"group":"Muse"}`, testAdminToken, http.StatusBadRequest, codeValidation},
+	}
+	for _, tc := range cases {
+		w := doRequestAs(router, tc.method, tc.target, tc.body, tc.token)
+		var body APIError
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: %v", tc.method, tc.target, err)
+		}
+		if w.Code != tc.status || body.Code != tc.code || body.RequestID == "" {
+			t.Errorf("%s %s: status %d, body %s, want %d %s", tc.method, tc.target, w.Code, w.Body, tc.status, tc.code)
+		}
+	}
+}
+
+func TestErrorCodeNotTakenFromMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID())
+	// Тот же текст, что у SONG_NOT_FOUND, но код задает обработчик или статус
+	router.GET("/explicit", func(c *gin.Context) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Song not found")
+	})
+	router.GET("/plain", func(c *gin.Context) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Song not found"})
+	})
+
+	for target, want := range map[string]string{"/explicit": codeNotFound, "/plain": codeInternal} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var body APIError
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Code != want || body.Message != "Song not found" {
+			t.Errorf("%s: body %s, want code %s", target, w.Body, want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	apiKeyHeader    = "X-API-Key"
+	fieldAPIKeyID   = "api_key_id"
+	apiKeyPrefixLen = 8
+	// Результат проверки ключа в контексте запроса: ключ проверяют
+	// ограничение частоты, обнаружение парсеров и Authenticate
+	ctxAPIKey = "api_key"
+)
+
+// Структура APIKey (ключ доступа машинного клиента). Хранится только хеш ключа.
+type APIKey struct {
+	ID         int        `json:"id" gorm:"primaryKey"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null"`
+	KeyHash    string     `json:"-" gorm:"uniqueIndex;not null"`
+	Role       Role       `json:"role" gorm:"not null;default:reader"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticateAPIKey ищет действующий ключ по значению заголовка X-API-Key
+func authenticateAPIKey(ctx context.Context, raw string) (*APIKey, error) {
+	var key APIKey
+	db := GetDB().WithContext(ctx)
+	err := db.Where("key_hash = ? AND revoked_at IS NULL", hashAPIKey(raw)).First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	db.Model(&key).UpdateColumn("last_used_at", now)
+	return &key, nil
+}
+
+// apiKeyLookup - результат authenticateAPIKey для заголовка запроса
+type apiKeyLookup struct {
+	key *APIKey
+	err error
+}
+
+// resolveAPIKey проверяет ключ из заголовка X-API-Key один раз за запрос.
+// gorm.ErrRecordNotFound - ключа нет или он отозван.
+func resolveAPIKey(c *gin.Context) (*APIKey, error) {
+	if v, ok := c.Get(ctxAPIKey); ok {
+		lookup := v.(apiKeyLookup)
+		return lookup.key, lookup.err
+	}
+	key, err := authenticateAPIKey(c.Request.Context(), c.GetHeader(apiKeyHeader))
+	c.Set(ctxAPIKey, apiKeyLookup{key, err})
+	return key, err
+}
+
+// Тело запроса на создание ключа
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+	Role Role   `json:"role" binding:"omitempty,oneof=admin editor reader"`
+}
+
+// Ответ с новым ключом; сам ключ показывается только один раз
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// @Summary Create API key
+// @Description Create an API key for a machine client. The key is returned only once. Keys have no owner: an editor key may change any song, while editor users change only their own.
+// @ID create-api-key
+// @Accept  json
+// @Produce  json
+// @Param key body CreateAPIKeyRequest true "Key name"
+// @Success 201 {object} CreatedAPIKey
+// @Failure 400 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/api-keys [post]
+func CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		logEntry(c).WithError(err).Error("Failed to generate API key")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to create API key")
+		return
+	}
+	raw := hex.EncodeToString(b)
+
+	if req.Role == "" {
+		req.Role = RoleReader
+	}
+	key := APIKey{Name: req.Name, Prefix: raw[:apiKeyPrefixLen], KeyHash: hashAPIKey(raw), Role: req.Role}
+	if err := dbFor(c).Create(&key).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to create API key in database")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to create API key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreatedAPIKey{APIKey: key, Key: raw})
+}
+
+// @Summary List API keys
+// @Description List API keys, including revoked ones.
+// @ID list-api-keys
+// @Produce  json
+// @Success 200 {array} APIKey
+// @Failure 500 {object} APIError
+// @Router /admin/api-keys [get]
+func GetAPIKeys(c *gin.Context) {
+	var keys []APIKey
+	if err := dbFor(c).Order("id").Find(&keys).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch API keys")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch API keys")
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// @Summary Revoke API key
+// @Description Revoke an API key.
+// @ID revoke-api-key
+// @Produce  json
+// @Param id path int true "API key ID"
+// @Success 200 {object} APIKey
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/api-keys/{id} [delete]
+func RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid API key ID")
+		return
+	}
+
+	var key APIKey
+	db := dbFor(c)
+	if err := db.First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithError(c, http.StatusNotFound, codeNotFound, "API key not found")
+		} else {
+			logEntry(c).WithError(err).Error("Failed to fetch API key")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to revoke API key")
+		}
+		return
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		if err := db.Model(&key).Update("revoked_at", now).Error; err != nil {
+			logEntry(c).WithError(err).Error("Failed to revoke API key")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to revoke API key")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, key)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Холодное хранилище текстов. Тексты песен, которые давно не открывали,
+// переносятся сжатыми в archived_lyrics, а songs.text очищается: таблица
+// songs становится меньше, и списки быстрее читаются из кеша. GetSongText
+// и выгрузка подгружают архивный текст при обращении. Поиск по тексту
+// (GET /songs?text=, фильтр text выгрузки) архивные тексты не находит:
+// база не может разобрать сжатые данные. Чтобы песня снова находилась,
+// текст возвращают через POST /admin/songs/{id}/lyrics/restore.
+
+const defaultArchiveBatch = 100
+
+// Структура ArchivedLyrics (сжатый текст песни)
+type ArchivedLyrics struct {
+	SongID     int       `gorm:"primaryKey;autoIncrement:false"`
+	Data       []byte    `gorm:"not null"` // текст в gzip
+	ArchivedAt time.Time `gorm:"not null"`
+}
+
+func (ArchivedLyrics) TableName() string {
+	return "archived_lyrics"
+}
+
+func compressText(text string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(text)); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompressText(data []byte) (string, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	text, err := io.ReadAll(zr)
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+// archiveLyrics переносит текст песни в архив
+func archiveLyrics(tx *gorm.DB, song *Song) error {
+	data, err := compressText(song.Text)
+	if err != nil {
+		return fmt.Errorf("compress lyrics: %w", err)
+	}
+	if err := tx.Save(&ArchivedLyrics{SongID: song.ID, Data: data, ArchivedAt: time.Now()}).Error; err != nil {
+		return fmt.Errorf("store archived lyrics: %w", err)
+	}
+	err = tx.Model(song).Updates(map[string]interface{}{"text": "", "archived": true}).Error
+	if err != nil {
+		return fmt.Errorf("clear song text: %w", err)
+	}
+	song.Text = ""
+	song.Archived = true
+	return nil
+}
+
+// loadArchivedLyrics возвращает архивный текст песни
+func loadArchivedLyrics(db *gorm.DB, songID int) (string, error) {
+	var archived ArchivedLyrics
+	if err := db.First(&archived, "song_id = ?", songID).Error; err != nil {
+		return "", err
+	}
+	return decompressText(archived.Data)
+}
+
+// restoreLyrics возвращает текст из архива в songs
+func restoreLyrics(tx *gorm.DB, song *Song) error {
+	text, err := loadArchivedLyrics(tx, song.ID)
+	if err != nil {
+		return err
+	}
+	err = tx.Model(song).Updates(map[string]interface{}{"text": text, "archived": false}).Error
+	if err != nil {
+		return err
+	}
+	song.Text = text
+	song.Archived = false
+	return dropArchivedLyrics(tx, song.ID)
+}
+
+// dropArchivedLyrics удаляет архивную копию (песня удалена или получила новый текст)
+func dropArchivedLyrics(tx *gorm.DB, songID int) error {
+	return tx.Where("song_id = ?", songID).Delete(&ArchivedLyrics{}).Error
+}
+
+// Тело запроса на архивацию
+type ArchiveRequest struct {
+	IdleFor string `json:"idleFor" binding:"required"` // например 2160h: текст не открывали 90 дней
+	Limit   int    `json:"limit"`
+}
+
+// @Summary Archive idle lyrics
+// @Description Move lyrics of songs not viewed for the given period into compressed cold storage.
+// @ID archive-lyrics
+// @Accept  json
+// @Produce  json
+// @Param request body ArchiveRequest true "Idle period and batch size"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/lyrics/archive [post]
+func ArchiveIdleLyrics(c *gin.Context) {
+	var req ArchiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	idle, err := time.ParseDuration(req.IdleFor)
+	if err != nil || idle <= 0 {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid idleFor duration")
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultArchiveBatch
+	}
+
+	// Песни, текст которых не открывали с cutoff (или не открывали вовсе)
+	cutoff := time.Now().Add(-idle)
+	recentViews := dbFor(c).Model(&PlayEvent{}).Select("song_id").
+		Where("kind = ? AND created_at >= ?", eventLyricsView, cutoff)
+	var songs []Song
+	err = dbFor(c).Where("archived = ? AND text <> ''", false).
+		Where("id NOT IN (?)", recentViews).
+		Order("id").Limit(req.Limit).Find(&songs).Error
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to find idle songs")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to archive lyrics")
+		return
+	}
+
+	archived := 0
+	for i := range songs {
+		err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+			return archiveLyrics(tx, &songs[i])
+		})
+		if err != nil {
+			logEntry(c).WithError(err).WithField(fieldSongID, songs[i].ID).Error("Failed to archive lyrics")
+			continue
+		}
+		archived++
+	}
+	if archived > 0 {
+		purgeCacheFor(c, cacheKeySongs)
+	}
+	c.JSON(http.StatusOK, gin.H{"archived": archived})
+}
+
+// @Summary Restore archived lyrics
+// @Description Move a song's lyrics back from cold storage into the songs table.
+// @ID restore-lyrics
+// @Produce  json
+// @Produce  xml
+// @Produce  application/vnd.api+json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Success 200 {object} Song
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/songs/{id}/lyrics/restore [post]
+func RestoreLyrics(c *gin.Context) {
+	id, err := parseSongID(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
+		return
+	}
+
+	var song Song
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&song, id).Error; err != nil {
+			return err
+		}
+		if !song.Archived {
+			return nil
+		}
+		return restoreLyrics(tx, &song)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to restore lyrics")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to restore lyrics")
+		return
+	}
+	purgeCacheFor(c, cacheKeySongs)
+	writeSong(c, http.StatusOK, song)
+}
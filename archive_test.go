@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+const archiveTestText = "Ooh baby, don't you know I suffer?\n\nOoh baby, can you hear me moan?"
+
+// archiveSong переносит в архив текст песни, которую не открывали
+func archiveSong(t *testing.T, router http.Handler) {
+	t.Helper()
+	w := doRequestAs(router, http.MethodPost, "/admin/lyrics/archive", `{"idleFor":"1h"}`, testAdminToken)
+	var res struct{ Archived int }
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || w.Code != http.StatusOK || res.Archived != 1 {
+		t.Fatalf("archive: status %d, body %s", w.Code, w.Body)
+	}
+}
+
+func TestArchiveRestoreRoundTrip(t *testing.T) {
+	conn := setupTestDB(t)
+	router := newTestRouter()
+	song := Song{Group: "Muse", SongName: "Supermassive Black Hole", Text: archiveTestText}
+	if err := conn.Create(&song).Error; err != nil {
+		t.Fatal(err)
+	}
+	archiveSong(t, router)
+
+	var stored Song
+	if err := conn.First(&stored, song.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !stored.Archived || stored.Text != "" {
+		t.Fatalf("after archive: archived=%t, text %q", stored.Archived, stored.Text)
+	}
+
+	// Текст по-прежнему отдается, из архива
+	w := doRequest(router, http.MethodGet, "/songs/"+encodeSongID(song.ID)+"/text?limit=1000", "")
+	var page LyricsPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("text: status %d, body %s", w.Code, w.Body)
+	}
+	if page.Text != archiveTestText {
+		t.Errorf("archived text = %q, want %q", page.Text, archiveTestText)
+	}
+
+	w = doRequestAs(router, http.MethodPost, "/admin/songs/"+encodeSongID(song.ID)+"/lyrics/restore", "", testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("restore: status %d, body %s", w.Code, w.Body)
+	}
+	if err := conn.First(&stored, song.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Archived || stored.Text != archiveTestText {
+		t.Errorf("after restore: archived=%t, text %q", stored.Archived, stored.Text)
+	}
+	var left int64
+	conn.Model(&ArchivedLyrics{}).Count(&left)
+	if left != 0 {
+		t.Errorf("%d archived copies left after restore", left)
+	}
+}
+
+func TestTextSearchSkipsArchivedLyrics(t *testing.T) {
+	conn := setupTestDB(t)
+	router := newTestRouter()
+	song := Song{Group: "Muse", SongName: "Supermassive Black Hole", Text: archiveTestText}
+	if err := conn.Create(&song).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Поиск по словам песни в GET /songs?text= работает только в
+	// PostgreSQL; выгрузка ищет подстроку и проверяется на SQLite
+	found := func() int {
+		t.Helper()
+		w := doRequest(router, http.MethodGet, "/songs/export?format=json&text=suffer", "")
+		var songs []Song
+		if err := json.Unmarshal(w.Body.Bytes(), &songs); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("export: status %d, body %s", w.Code, w.Body)
+		}
+		return len(songs)
+	}
+	if n := found(); n != 1 {
+		t.Fatalf("before archive: found %d songs, want 1", n)
+	}
+	archiveSong(t, router)
+	if n := found(); n != 0 {
+		t.Errorf("archived song found %d times, want it excluded", n)
+	}
+	doRequestAs(router, http.MethodPost, "/admin/songs/"+encodeSongID(song.ID)+"/lyrics/restore", "", testAdminToken)
+	if n := found(); n != 1 {
+		t.Errorf("after restore: found %d songs, want 1", n)
+	}
+
+	// Без поиска архивная песня выгружается с текстом
+	archiveSong(t, router)
+	w := doRequest(router, http.MethodGet, "/songs/export?format=json", "")
+	var songs []Song
+	if err := json.Unmarshal(w.Body.Bytes(), &songs); err != nil || len(songs) != 1 || songs[0].Text != archiveTestText {
+		t.Errorf("export: status %d, body %s", w.Code, w.Body)
+	}
+}
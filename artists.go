@@ -0,0 +1,559 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const auditEntityArtist = "artist"
+
+// Способы подтверждения заявки
+const (
+	claimMethodLink  = "link"  // код размещается на официальном сайте
+	claimMethodEmail = "email" // код приходит на почту в домене сайта
+)
+
+// Статусы заявки
+const (
+	claimStatusPending  = "pending"
+	claimStatusVerified = "verified"
+)
+
+// Сколько действует код подтверждения
+const artistClaimTTL = 72 * time.Hour
+
+var errArtistVerified = errors.New("artist is already verified")
+
+// Сколько байт страницы читается при поиске кода
+const artistPageLimit = 1 << 20
+
+// HTTP-клиент для загрузки официальной страницы артиста
+var artistVerifyHTTP = &http.Client{Timeout: 10 * time.Second}
+
+// Структура Artist (профиль артиста). Песни связаны с профилем по полю
+// group без учета регистра.
+type Artist struct {
+	ID           int        `json:"id" gorm:"primaryKey"`
+	Name         string     `json:"name" gorm:"uniqueIndex;not null"`
+	Bio          string     `json:"bio"`
+	Images       []string   `json:"images" gorm:"serializer:json"`
+	OfficialLink string     `json:"officialLink"`
+	Verified     bool       `json:"verified" gorm:"not null;default:false"`
+	VerifiedAt   *time.Time `json:"verifiedAt,omitempty"`
+	// Пользователь, подтвердивший профиль; он может менять профиль и ссылки песен
+	OwnerID   *int      `json:"ownerId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Структура ArtistClaim (заявка пользователя на профиль артиста)
+type ArtistClaim struct {
+	ID       int    `json:"id" gorm:"primaryKey"`
+	ArtistID int    `json:"artistId" gorm:"not null;index"`
+	UserID   int    `json:"userId" gorm:"not null;index"`
+	Method   string `json:"method" gorm:"not null"`
+	Link     string `json:"link" gorm:"not null"`
+	Email    string `json:"email,omitempty"`
+	// Код для способа link показывается в ответе, для email - только в письме
+	Code       string     `json:"-" gorm:"not null"`
+	Status     string     `json:"status" gorm:"not null;default:pending"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	VerifiedAt *time.Time `json:"verifiedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// canEditArtist: профиль меняет подтвердивший его пользователь; администратор - любой
+func canEditArtist(c *gin.Context, artist Artist) bool {
+	if currentRole(c) == RoleAdmin {
+		return true
+	}
+	userID, ok := currentUserID(c)
+	return ok && artist.Verified && artist.OwnerID != nil && *artist.OwnerID == userID
+}
+
+// emailMatchesLink проверяет, что почта в домене официального сайта или его поддомене
+func emailMatchesLink(email, link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	domain := strings.ToLower(email[at+1:])
+	return host == domain || strings.HasSuffix(domain, "."+host)
+}
+
+// pageContainsCode загружает страницу и ищет в ней код подтверждения
+func pageContainsCode(c *gin.Context, link, code string) (bool, error) {
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, link, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := artistVerifyHTTP.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, artistPageLimit))
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(string(body), code), nil
+}
+
+// Тело запроса на заявку
+type ArtistClaimRequest struct {
+	Artist string `json:"artist" binding:"required"`
+	Method string `json:"method" binding:"required,oneof=link email"`
+	Link   string `json:"link" binding:"required"` // официальный сайт артиста
+	Email  string `json:"email"`                   // для способа email, в домене сайта
+}
+
+// Ответ с новой заявкой; код есть только у способа link
+type CreatedArtistClaim struct {
+	ArtistClaim
+	Code string `json:"code,omitempty"`
+}
+
+// @Summary Claim artist profile
+// @Description Start verifying that the current user represents an artist. With method "link" the returned code must be placed on the official link; with method "email" the code is sent to an address on the official link's domain. The profile is created if it does not exist yet.
+// @ID create-artist-claim
+// @Accept  json
+// @Produce  json
+// @Param claim body ArtistClaimRequest true "Artist name, verification method and official link"
+// @Success 201 {object} CreatedArtistClaim
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 500 {object} APIError
+// @Failure 503 {object} APIError
+// @Router /me/artist-claims [post]
+func CreateArtistClaim(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		abortWithError(c, http.StatusForbidden, codeForbidden, "Only users can claim artist profiles")
+		return
+	}
+	var req ArtistClaimRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	req.Artist = strings.TrimSpace(req.Artist)
+	if u, err := url.Parse(req.Link); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid official link")
+		return
+	}
+	var email NotificationSender
+	if req.Method == claimMethodEmail {
+		if _, err := mail.ParseAddress(req.Email); err != nil {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid email address")
+			return
+		}
+		if !emailMatchesLink(req.Email, req.Link) {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Email must be on the official link's domain")
+			return
+		}
+		if notifier == nil || notifier.senders[channelEmail] == nil {
+			abortWithError(c, http.StatusServiceUnavailable, codeUnavailable, "Email verification is not configured")
+			return
+		}
+		email = notifier.senders[channelEmail]
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to generate claim code")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to create claim")
+		return
+	}
+	claim := ArtistClaim{
+		UserID: userID, Method: req.Method, Link: req.Link, Email: req.Email,
+		Code: "musik-verify-" + code, Status: claimStatusPending, ExpiresAt: time.Now().Add(artistClaimTTL),
+	}
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		var artist Artist
+		err := tx.Where("LOWER(name) = LOWER(?)", req.Artist).First(&artist).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			artist = Artist{Name: req.Artist, Images: []string{}}
+			err = tx.Create(&artist).Error
+		}
+		if err != nil {
+			return err
+		}
+		if artist.Verified {
+			return errArtistVerified
+		}
+		claim.ArtistID = artist.ID
+		return tx.Create(&claim).Error
+	})
+	if errors.Is(err, errArtistVerified) {
+		abortWithError(c, http.StatusConflict, codeConflict, "Artist profile is already verified")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to create artist claim")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to create claim")
+		return
+	}
+
+	if email != nil {
+		n := Notification{
+			Event: "artist.claim",
+			Title: "Verify your artist profile",
+			Body:  fmt.Sprintf("Your verification code for %s: %s", req.Artist, claim.Code),
+		}
+		if err := email.Send(c.Request.Context(), claim.Email, n); err != nil {
+			logEntry(c).WithError(err).Error("Failed to send claim code")
+			abortWithError(c, http.StatusServiceUnavailable, codeUnavailable, "Failed to send verification email")
+			return
+		}
+		c.JSON(http.StatusCreated, CreatedArtistClaim{ArtistClaim: claim})
+		return
+	}
+	c.JSON(http.StatusCreated, CreatedArtistClaim{ArtistClaim: claim, Code: claim.Code})
+}
+
+// Тело запроса на подтверждение; код нужен только для способа email
+type VerifyClaimRequest struct {
+	Code string `json:"code"`
+}
+
+// @Summary Verify artist claim
+// @Description Complete an artist claim. For method "link" the official link is fetched and must contain the code; for method "email" the code from the email must be sent. A verified profile gets the verified badge and the user can edit it.
+// @ID verify-artist-claim
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Claim ID"
+// @Param verification body VerifyClaimRequest false "Code from the email"
+// @Success 200 {object} Artist
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 410 {object} APIError
+// @Failure 422 {object} APIError
+// @Failure 500 {object} APIError
+// @Failure 502 {object} APIError
+// @Router /me/artist-claims/{id}/verify [post]
+func VerifyArtistClaim(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		abortWithError(c, http.StatusForbidden, codeForbidden, "Only users can claim artist profiles")
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid claim ID")
+		return
+	}
+	var req VerifyClaimRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, errorBody(err))
+			return
+		}
+	}
+
+	var claim ArtistClaim
+	if err := dbFor(c).First(&claim, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithError(c, http.StatusNotFound, codeNotFound, "Claim not found")
+			return
+		}
+		logEntry(c).WithError(err).Error("Failed to fetch artist claim")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to verify claim")
+		return
+	}
+	if claim.Status != claimStatusPending {
+		abortWithError(c, http.StatusConflict, codeConflict, "Claim is already verified")
+		return
+	}
+	if time.Now().After(claim.ExpiresAt) {
+		abortWithError(c, http.StatusGone, codeGone, "Claim has expired")
+		return
+	}
+
+	switch claim.Method {
+	case claimMethodLink:
+		found, err := pageContainsCode(c, claim.Link, claim.Code)
+		if err != nil {
+			logEntry(c).WithError(err).Warn("Failed to fetch official link")
+			abortWithError(c, http.StatusBadGateway, codeUpstream, "Failed to fetch official link")
+			return
+		}
+		if !found {
+			abortWithError(c, http.StatusUnprocessableEntity, codeValidation, "Verification code not found on official link")
+			return
+		}
+	case claimMethodEmail:
+		if subtle.ConstantTimeCompare([]byte(req.Code), []byte(claim.Code)) != 1 {
+			abortWithError(c, http.StatusUnprocessableEntity, codeValidation, "Invalid verification code")
+			return
+		}
+	}
+
+	var after Artist
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		var before Artist
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&before, claim.ArtistID).Error; err != nil {
+			return err
+		}
+		if before.Verified {
+			return errArtistVerified
+		}
+		now := time.Now()
+		err := tx.Model(&Artist{}).Where("id = ?", before.ID).Updates(map[string]interface{}{
+			"verified": true, "verified_at": now, "owner_id": userID, "official_link": claim.Link,
+		}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&ArtistClaim{}).Where("id = ?", claim.ID).Updates(map[string]interface{}{
+			"status": claimStatusVerified, "verified_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&after, before.ID).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, auditEntityArtist, after.ID, auditActionUpdate, before, after)
+	})
+	if errors.Is(err, errArtistVerified) {
+		abortWithError(c, http.StatusConflict, codeConflict, "Artist profile is already verified")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to verify artist claim")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to verify claim")
+		return
+	}
+	purgeCacheFor(c, artistCacheKey(after.ID))
+	c.JSON(http.StatusOK, after)
+}
+
+// @Summary Get artist
+// @Description Get an artist profile. Verified profiles carry "verified": true.
+// @ID get-artist
+// @Produce  json
+// @Param id path int true "Artist ID"
+// @Success 200 {object} Artist
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /artists/{id} [get]
+func GetArtist(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid artist ID")
+		return
+	}
+	var artist Artist
+	if err := dbFor(c).First(&artist, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithError(c, http.StatusNotFound, codeNotFound, "Artist not found")
+			return
+		}
+		logEntry(c).WithError(err).Error("Failed to fetch artist")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch artist")
+		return
+	}
+	c.JSON(http.StatusOK, artist)
+}
+
+// Тело запроса на изменение профиля
+type ArtistProfile struct {
+	Bio    string   `json:"bio"`
+	Images []string `json:"images"`
+}
+
+func (p ArtistProfile) validate() error {
+	for _, image := range p.Images {
+		if u, err := url.Parse(image); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid image URL %q", image)
+		}
+	}
+	return nil
+}
+
+// @Summary Update artist profile
+// @Description Replace the bio and images of an artist. Allowed for the user who verified the profile and for administrators.
+// @ID update-artist
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Artist ID"
+// @Param profile body ArtistProfile true "Bio and image URLs"
+// @Success 200 {object} Artist
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /artists/{id} [put]
+func UpdateArtist(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid artist ID")
+		return
+	}
+	var req ArtistProfile
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	if req.Images == nil {
+		req.Images = []string{}
+	}
+
+	var after Artist
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		var before Artist
+		if err := tx.First(&before, id).Error; err != nil {
+			return err
+		}
+		if !canEditArtist(c, before) {
+			return errNotOwner
+		}
+		after = before
+		after.Bio = req.Bio
+		after.Images = req.Images
+		if err := tx.Save(&after).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, auditEntityArtist, id, auditActionUpdate, before, after)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Artist not found")
+		return
+	}
+	if errors.Is(err, errNotOwner) {
+		abortWithError(c, http.StatusForbidden, codeForbidden, "Only the verified artist can edit this profile")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to update artist")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to update artist")
+		return
+	}
+	purgeCacheFor(c, artistCacheKey(after.ID))
+	c.JSON(http.StatusOK, after)
+}
+
+// Тело запроса на ссылку песни на площадке; пустой url удаляет ссылку
+type SongPlatformLink struct {
+	URL string `json:"url"`
+}
+
+// @Summary Set song streaming link
+// @Description Set or remove the link to a song on one streaming platform. Allowed for the verified artist of the song and for administrators.
+// @ID set-song-platform-link
+// @Accept  json
+// @Produce  json
+// @Produce  xml
+// @Produce  application/vnd.api+json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Param platform path string true "Platform, e.g. spotify, appleMusic, deezer, youtube"
+// @Param link body SongPlatformLink true "Link URL; empty removes the link"
+// @Success 200 {object} Song
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /artists/songs/{id}/links/{platform} [put]
+func SetSongPlatformLink(c *gin.Context) {
+	id, err := parseSongID(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
+		return
+	}
+	platform := c.Param("platform")
+	var req SongPlatformLink
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	if req.URL != "" {
+		if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid link")
+			return
+		}
+	}
+
+	var song Song
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Links").First(&song, id).Error; err != nil {
+			return err
+		}
+		if currentRole(c) != RoleAdmin {
+			var artist Artist
+			err := tx.Where("LOWER(name) = LOWER(?)", song.Group).First(&artist).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errNotOwner
+			}
+			if err != nil {
+				return err
+			}
+			if !canEditArtist(c, artist) {
+				return errNotOwner
+			}
+		}
+		before := song.Links
+		if req.URL == "" {
+			err = tx.Where("song_id = ? AND platform = ?", id, platform).Delete(&SongLink{}).Error
+		} else {
+			err = tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "song_id"}, {Name: "platform"}},
+				DoUpdates: clause.AssignmentColumns([]string{"url"}),
+			}).Create(&SongLink{SongID: id, Platform: platform, URL: req.URL}).Error
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("song_id = ?", id).Order("id").Find(&song.Links).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, auditEntitySong, id, auditActionUpdate,
+			gin.H{"links": before}, gin.H{"links": song.Links})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
+	if errors.Is(err, errNotOwner) {
+		abortWithError(c, http.StatusForbidden, codeForbidden, "Only the verified artist can edit this song's links")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to set song link")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to set link")
+		return
+	}
+	purgeCacheFor(c, cacheKeySongs)
+	writeSong(c, http.StatusOK, song)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Поля песни, которые не хранятся в songs и не восстанавливаются по журналу
+var unversionedSongFields = []string{"owner", "tags", "links"}
+
+// parseAsOf читает ?as_of= в формате RFC 3339; nil - текущее состояние.
+// При ошибке отвечает клиенту сам и возвращает false.
+func parseAsOf(c *gin.Context) (*time.Time, bool) {
+	raw := c.Query("as_of")
+	if raw == "" {
+		return nil, true
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid as_of timestamp, expected RFC 3339")
+		return nil, false
+	}
+	return &t, true
+}
+
+// changedSongIDs возвращает песни, которые менялись после t: только их
+// состояние на момент t отличается от текущего
+func changedSongIDs(db *gorm.DB, t time.Time) ([]int, error) {
+	var ids []int
+	err := db.Model(&AuditEntry{}).Where("entity = ? AND created_at > ?", auditEntitySong, t).
+		Distinct("entity_id").Pluck("entity_id", &ids).Error
+	return ids, err
+}
+
+// songsAsOf восстанавливает песни ids на момент t: к текущему состоянию
+// применяются записи журнала после t в обратном порядке. Песен, которых
+// тогда не было, в результате нет. Статистика Last.fm, теги и ссылки на
+// площадки в журнал не пишутся и остаются текущими.
+func songsAsOf(db *gorm.DB, ids []int, t time.Time) (map[int]Song, error) {
+	states := make(map[int]map[string]interface{}, len(ids))
+	if len(ids) == 0 {
+		return map[int]Song{}, nil
+	}
+	var current []Song
+	if err := db.Where("id IN ?", ids).Find(&current).Error; err != nil {
+		return nil, err
+	}
+	for _, song := range current {
+		fields, err := auditFields(song)
+		if err != nil {
+			return nil, err
+		}
+		states[song.ID] = fields
+	}
+
+	var entries []AuditEntry
+	err := db.Where("entity = ? AND entity_id IN ? AND created_at > ?", auditEntitySong, ids, t).
+		Order("id DESC").Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		var changes map[string]auditChange
+		if err := json.Unmarshal(entry.Changes, &changes); err != nil {
+			return nil, err
+		}
+		switch entry.Action {
+		case auditActionCreate:
+			delete(states, entry.EntityID)
+		case auditActionDelete:
+			fields := map[string]interface{}{}
+			for name, change := range changes {
+				fields[name] = change.Before
+			}
+			states[entry.EntityID] = fields
+		case auditActionUpdate:
+			fields, ok := states[entry.EntityID]
+			if !ok {
+				continue
+			}
+			for name, change := range changes {
+				fields[name] = change.Before
+			}
+		}
+	}
+
+	songs := make(map[int]Song, len(states))
+	for id, fields := range states {
+		for _, name := range unversionedSongFields {
+			delete(fields, name)
+		}
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		var song Song
+		if err := json.Unmarshal(data, &song); err != nil {
+			return nil, err
+		}
+		song.ID = id
+		songs[id] = song
+	}
+	return songs, nil
+}
+
+// songAsOf восстанавливает одну песню; gorm.ErrRecordNotFound, если ее тогда не было
+func songAsOf(db *gorm.DB, id int, t time.Time) (Song, error) {
+	changed, err := songsAsOf(db, []int{id}, t)
+	if err != nil {
+		return Song{}, err
+	}
+	song, ok := changed[id]
+	if !ok {
+		return Song{}, gorm.ErrRecordNotFound
+	}
+	return song, nil
+}
+
+// songMatchesFilter - то же, что songFilterSet, для восстановленных песен
+func songMatchesFilter(song Song, f SongFilter) bool {
+	switch {
+	case f.Group != "" && song.Group != f.Group,
+		f.SongName != "" && song.SongName != f.SongName,
+		!f.ReleaseDate.IsZero() && !song.ReleaseDate.Time().Equal(f.ReleaseDate.Time()),
+		f.Link != "" && song.Link != f.Link,
+		f.Explicit != nil && song.Explicit != *f.Explicit,
+		f.OwnerID != nil && (song.OwnerID == nil || *song.OwnerID != *f.OwnerID):
+		return false
+	}
+	return true
+}
+
+// listSongsAsOf отдает страницу каталога на момент t. Песни без изменений
+// после t читаются из songs, измененные восстанавливаются по журналу.
+func listSongsAsOf(db *gorm.DB, filter SongFilter, t time.Time, afterID, offset, limit int) ([]Song, error) {
+	offset = max(offset, 0)
+	changed, err := changedSongIDs(db, t)
+	if err != nil {
+		return nil, err
+	}
+	var songs []Song
+	q := songFilterSet(filter, "").Apply(db.Model(&Song{})).Where("id > ?", afterID)
+	if len(changed) > 0 {
+		q = q.Where("id NOT IN ?", changed)
+	}
+	// Первые offset+limit строк итога берутся не больше чем из offset+limit строк songs
+	if err := q.Order("id").Limit(offset + limit).Find(&songs).Error; err != nil {
+		return nil, err
+	}
+	restored, err := songsAsOf(db, changed, t)
+	if err != nil {
+		return nil, err
+	}
+	for _, song := range restored {
+		if song.ID > afterID && songMatchesFilter(song, filter) {
+			songs = append(songs, song)
+		}
+	}
+	sort.Slice(songs, func(i, j int) bool { return songs[i].ID < songs[j].ID })
+	if offset >= len(songs) {
+		return nil, nil
+	}
+	return songs[offset:min(offset+limit, len(songs))], nil
+}
+
+// getSongsAsOf - GET /songs?as_of=: список на прошлый момент. Поиск по
+// тексту и include работают только с текущим состоянием.
+func getSongsAsOf(c *gin.Context, filter SongFilter, t time.Time, offset, limit int) {
+	if filter.Text != "" || c.Query("include") != "" || len(filter.Conds) > 0 {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "text, include and filter operators cannot be combined with as_of")
+		return
+	}
+	afterID := 0
+	if after := c.Query("after"); after != "" {
+		var err error
+		if afterID, err = parseSongID(after); err != nil {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid cursor")
+			return
+		}
+		offset = 0
+	}
+	songs, err := listSongsAsOf(dbFor(c), filter, t, afterID, offset, limit)
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to reconstruct songs")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch songs")
+		return
+	}
+	if len(songs) == 0 {
+		writeNoSongs(c)
+		return
+	}
+	if len(songs) == limit {
+		c.Header("X-Next-Cursor", encodeSongID(songs[len(songs)-1].ID))
+	}
+	writeSongs(c, http.StatusOK, songs)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Файлы, встроенные в бинарник: спецификация для Swagger UI, SQL-миграции
+// и фикстуры. Спецификация пересобирается командой make docs.
+
+//go:embed assets/swagger/swagger.json
+var swaggerSpec string
+
+//go:embed assets/migrations/*.sql
+var migrationFiles embed.FS
+
+//go:embed assets/seed/*.json
+var seedFiles embed.FS
+
+// SchemaMigration - примененная SQL-миграция
+type SchemaMigration struct {
+	Version   string    `gorm:"primaryKey"` // имя файла без .sql
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// applySQLMigrations выполняет еще не примененные файлы из assets/migrations
+// по порядку имен, каждый в своей транзакции. Таблицы создает AutoMigrate,
+// в SQL - только то, что GORM описать не умеет (расширения, GIN-индексы),
+// поэтому миграции только для PostgreSQL.
+func applySQLMigrations(db *gorm.DB, files fs.FS) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(files, "assets/migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	var applied []string
+	if err := db.Model(&SchemaMigration{}).Pluck("version", &applied).Error; err != nil {
+		return err
+	}
+	done := make(map[string]bool, len(applied))
+	for _, v := range applied {
+		done[v] = true
+	}
+
+	for _, name := range names {
+		version := path.Base(name[:len(name)-len(".sql")])
+		if done[version] {
+			continue
+		}
+		script, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(string(script)).Error; err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: version, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// seedSongs добавляет песни из JSON-массива; уже существующие (та же группа
+// и название) пропускаются, поэтому команду можно запускать повторно
+func seedSongs(db *gorm.DB, data []byte) (int, error) {
+	var songs []Song
+	if err := json.Unmarshal(data, &songs); err != nil {
+		return 0, fmt.Errorf("parse seed file: %w", err)
+	}
+	added := 0
+	for _, song := range songs {
+		song.ID = 0
+		song.Explicit = profanity.Contains(song.Text)
+		_, err := songByName(db, song.Group, song.SongName)
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = db.Create(&song).Error
+		}
+		if err != nil {
+			return added, fmt.Errorf("seed %s - %s: %w", song.Group, song.SongName, err)
+		}
+		added++
+	}
+	return added, nil
+}
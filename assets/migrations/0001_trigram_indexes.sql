@@ -0,0 +1,5 @@
+-- Фильтры group и song ищут по подстроке (LIKE '%...%'); обычный B-tree
+-- индекс здесь не помогает, нужен триграммный
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_songs_group_trgm ON songs USING gin ("group" gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_songs_song_name_trgm ON songs USING gin (song_name gin_trgm_ops);
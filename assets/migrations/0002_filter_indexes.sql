@@ -0,0 +1,8 @@
+-- Равенство в фильтрах group, song и releaseDate; триграммные индексы из
+-- 0001 рассчитаны на поиск подстроки
+CREATE INDEX IF NOT EXISTS idx_songs_group ON songs ("group");
+CREATE INDEX IF NOT EXISTS idx_songs_song_name ON songs (song_name);
+CREATE INDEX IF NOT EXISTS idx_songs_release_date ON songs (release_date);
+-- Поиск по тексту: searchLyrics отбирает песни по этому выражению и только
+-- потом делит найденные тексты на куплеты
+CREATE INDEX IF NOT EXISTS idx_songs_text_fts ON songs USING gin (to_tsvector('simple', text));
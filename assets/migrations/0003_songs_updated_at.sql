@@ -0,0 +1,2 @@
+-- Песням, добавленным до колонки updated_at, нужна версия для ETag
+UPDATE songs SET updated_at = now() WHERE updated_at IS NULL;
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Сущности и действия в журнале аудита
+const (
+	auditEntitySong = "song"
+
+	auditActionCreate = "create"
+	auditActionUpdate = "update"
+	auditActionDelete = "delete"
+
+	// Автор изменений фонового обогащения
+	auditActorEnrichment = "job:enrichment"
+)
+
+const defaultAuditLimit = 100
+
+// Поля фильтров GET /admin/audit
+var auditFilterFields = FilterFields{
+	"entity":    {Column: "entity", Ops: filterOpsEq},
+	"id":        {Column: "entity_id", Ops: filterOpsEq, Parse: parseIntFilter},
+	"action":    {Column: "action", Ops: filterOpsEq},
+	"actor":     {Column: "actor", Ops: filterOpsText},
+	"createdAt": {Column: "created_at", Ops: filterOpsOrdered, Parse: parseTimeFilter},
+}
+
+// Структура AuditEntry (запись журнала изменений)
+type AuditEntry struct {
+	ID        int             `json:"id" gorm:"primaryKey"`
+	Entity    string          `json:"entity" gorm:"not null;index:idx_audit_entity"`
+	EntityID  int             `json:"entityId" gorm:"not null;index:idx_audit_entity"`
+	Action    string          `json:"action" gorm:"not null"`
+	Actor     string          `json:"actor" gorm:"not null"`
+	RequestID string          `json:"requestId"`
+	Changes   json.RawMessage `json:"changes" gorm:"type:jsonb" swaggertype:"object"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
+
+// Изменение одного поля: before пусто при создании, after - при удалении
+type auditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// auditActor описывает, кто выполнил запрос
+func auditActor(c *gin.Context) string {
+	if userID, ok := c.Get(fieldUserID); ok {
+		return fmt.Sprintf("user:%v", userID)
+	}
+	if keyID, ok := c.Get(fieldAPIKeyID); ok {
+		return fmt.Sprintf("api_key:%v", keyID)
+	}
+	if currentRole(c) == RoleAdmin {
+		return "admin_token"
+	}
+	return "anonymous"
+}
+
+// auditDiff возвращает поля, которые отличаются в before и after
+func auditDiff(before, after interface{}) (json.RawMessage, error) {
+	b, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]auditChange{}
+	for name, value := range b {
+		if !reflect.DeepEqual(value, a[name]) {
+			changes[name] = auditChange{Before: value, After: a[name]}
+		}
+	}
+	for name, value := range a {
+		if _, ok := b[name]; !ok {
+			changes[name] = auditChange{After: value}
+		}
+	}
+	return json.Marshal(changes)
+}
+
+func auditFields(v interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if v == nil {
+		return fields, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// recordAudit пишет запись журнала в той же транзакции, что и изменение
+func recordAudit(tx *gorm.DB, c *gin.Context, entity string, id int, action string, before, after interface{}) error {
+	return recordAuditAs(tx, auditActor(c), c.GetString(fieldRequestID), entity, id, action, before, after)
+}
+
+// recordAuditAs - то же для изменений вне HTTP-запроса, например отложенных
+func recordAuditAs(tx *gorm.DB, actor, requestID, entity string, id int, action string, before, after interface{}) error {
+	entry, err := newAuditEntry(actor, requestID, entity, id, action, before, after)
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("write audit entry: %w", err)
+	}
+	return nil
+}
+
+// newAuditEntry собирает запись журнала, не сохраняя ее; массовые вставки
+// пишут записи пачкой
+func newAuditEntry(actor, requestID, entity string, id int, action string, before, after interface{}) (AuditEntry, error) {
+	changes, err := auditDiff(before, after)
+	if err != nil {
+		return AuditEntry{}, fmt.Errorf("build audit diff: %w", err)
+	}
+	return AuditEntry{
+		Entity:    entity,
+		EntityID:  id,
+		Action:    action,
+		Actor:     actor,
+		RequestID: requestID,
+		Changes:   changes,
+	}, nil
+}
+
+// @Summary Get audit log
+// @Description List recorded mutations, newest first, optionally filtered by entity and ID. Filters take an operator in brackets, e.g. actor[contains]=user or createdAt[gte]=2024-01-01T00:00:00Z.
+// @ID get-audit-log
+// @Produce  json
+// @Param entity query string false "Entity type, e.g. song"
+// @Param id query int false "Entity ID"
+// @Param action query string false "create, update or delete"
+// @Param actor query string false "Actor, e.g. user:1"
+// @Param createdAt[gte] query string false "Only entries recorded at or after this RFC 3339 time"
+// @Param limit query int false "Maximum number of entries"
+// @Success 200 {array} AuditEntry
+// @Failure 400 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/audit [get]
+func GetAuditLog(c *gin.Context) {
+	conds, err := auditFilterFields.Parse(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	fs := NewFilterSet("").Conds(conds)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultAuditLimit)))
+	if err != nil || limit < 1 {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid limit")
+		return
+	}
+
+	entries := []AuditEntry{}
+	if err := fs.Apply(dbFor(c).Model(&AuditEntry{})).Order("id DESC").Limit(limit).Find(&entries).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch audit log")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch audit log")
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
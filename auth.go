@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// JWTKeys - набор ключей подписи. Токены подписываются активным ключом,
+// а проверяются любым ключом из набора, что позволяет менять ключи
+// без разлогинивания пользователей.
+type JWTKeys struct {
+	ActiveID string
+	Keys     map[string][]byte
+	TTL      time.Duration
+}
+
+// AccessClaims - содержимое access-токена
+type AccessClaims struct {
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
+	jwt.RegisteredClaims
+}
+
+var jwtKeys *JWTKeys
+
+var errNoSigningKey = errors.New("no active JWT signing key configured")
+
+// ParseJWTKeys разбирает строку вида "kid1:secret1,kid2:secret2"
+func ParseJWTKeys(raw, activeID string, ttl time.Duration) (*JWTKeys, error) {
+	keys := &JWTKeys{ActiveID: activeID, Keys: map[string][]byte{}, TTL: ttl}
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("invalid JWT key entry %q", pair)
+		}
+		keys.Keys[id] = []byte(secret)
+	}
+	if keys.ActiveID == "" && len(keys.Keys) == 1 {
+		for id := range keys.Keys {
+			keys.ActiveID = id
+		}
+	}
+	if len(keys.Keys) > 0 {
+		if _, ok := keys.Keys[keys.ActiveID]; !ok {
+			return nil, fmt.Errorf("active JWT key %q is not configured", keys.ActiveID)
+		}
+	}
+	return keys, nil
+}
+
+// Issue выпускает access-токен для пользователя
+func (k *JWTKeys) Issue(user User) (string, time.Time, error) {
+	secret, ok := k.Keys[k.ActiveID]
+	if !ok {
+		return "", time.Time{}, errNoSigningKey
+	}
+	now := time.Now()
+	expires := now.Add(k.TTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, AccessClaims{
+		Username: user.Username,
+		Role:     user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	})
+	token.Header["kid"] = k.ActiveID
+	signed, err := token.SignedString(secret)
+	return signed, expires, err
+}
+
+// Verify проверяет подпись и срок действия токена
+func (k *JWTKeys) Verify(raw string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		secret, ok := k.Keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return header[7:]
+	}
+	return ""
+}
+
+// Authenticate проверяет API-ключ, токен администратора или access-токен,
+// если они переданы, и сохраняет клиента и его роль в контексте.
+// Анонимные запросы пропускаются дальше.
+func Authenticate(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader(apiKeyHeader) != "" {
+			key, err := resolveAPIKey(c)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				abortWithError(c, http.StatusUnauthorized, codeInvalidToken, "Invalid or revoked API key")
+				return
+			}
+			if err != nil {
+				logEntry(c).WithError(err).Error("Failed to check API key")
+				abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to authenticate")
+				return
+			}
+			c.Set(fieldAPIKeyID, key.ID)
+			c.Set(fieldRole, key.Role)
+			c.Next()
+			return
+		}
+
+		raw := bearerToken(c)
+		if raw == "" {
+			c.Next()
+			return
+		}
+		// Статический токен администратора нужен для первоначальной настройки
+		if adminToken != "" && subtle.ConstantTimeCompare([]byte(raw), []byte(adminToken)) == 1 {
+			c.Set(fieldRole, RoleAdmin)
+			c.Next()
+			return
+		}
+		claims, err := jwtKeys.Verify(raw)
+		if err != nil && oidcAuth != nil {
+			// Токен мог быть выпущен внешним провайдером
+			if user, oidcErr := oidcAuth.verifyBearer(c.Request.Context(), raw); oidcErr == nil {
+				c.Set(fieldUserID, user.ID)
+				c.Set(fieldRole, user.Role)
+				c.Next()
+				return
+			}
+		}
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
+			return
+		}
+		userID, _ := strconv.Atoi(claims.Subject)
+		c.Set(fieldUserID, userID)
+		c.Set(fieldRole, claims.Role)
+		c.Next()
+	}
+}
+
+// Тело запроса на вход
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Ответ с access-токеном
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// @Summary Login
+// @Description Exchange username and password for an access token. If the request carries an anonymous session (X-Session-Token header or session cookie), its favorites and listening history are moved into the account.
+// @ID login
+// @Accept  json
+// @Produce  json
+// @Param credentials body LoginRequest true "Credentials"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /auth/login [post]
+func Login(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+
+	var user User
+	result := dbFor(c).Where("username = ?", req.Username).First(&user)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		logEntry(c).WithError(result.Error).Error("Failed to fetch user")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to log in")
+		return
+	}
+	if result.Error != nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		abortWithError(c, http.StatusUnauthorized, codeInvalidCredentials, "Invalid username or password")
+		return
+	}
+
+	token, expires, err := jwtKeys.Issue(user)
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to issue access token")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to log in")
+		return
+	}
+	mergeSessionOnLogin(c, user.ID)
+
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(expires).Seconds()),
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// errorCodeOf - код из тела ответа с ошибкой
+func errorCodeOf(t *testing.T, body []byte) string {
+	t.Helper()
+	var apiErr APIError
+	if err := json.Unmarshal(body, &apiErr); err != nil {
+		t.Fatalf("decode error %s: %v", body, err)
+	}
+	return apiErr.Code
+}
+
+func TestLoginAndAccessTokens(t *testing.T) {
+	setupTestDB(t)
+	useTestJWTKeys(t)
+	router := newTestRouter()
+	createTestUser(t, "alice", "correct-horse", RoleEditor)
+
+	w := doRequest(router, http.MethodPost, "/auth/login", `{"username":"alice","password":"wrong"}`)
+	if w.Code != http.StatusUnauthorized || errorCodeOf(t, w.Body.Bytes()) != codeInvalidCredentials {
+		t.Fatalf("wrong password: status %d, body %s", w.Code, w.Body)
+	}
+	w = doRequest(router, http.MethodPost, "/auth/login", `{"username":"nobody","password":"correct-horse"}`)
+	if w.Code != http.StatusUnauthorized || errorCodeOf(t, w.Body.Bytes()) != codeInvalidCredentials {
+		t.Fatalf("unknown user: status %d, body %s", w.Code, w.Body)
+	}
+
+	w = doRequest(router, http.MethodPost, "/auth/login", `{"username":"alice","password":"correct-horse"}`)
+	var token TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &token); err != nil || w.Code != http.StatusOK || token.AccessToken == "" {
+		t.Fatalf("login: status %d, body %s", w.Code, w.Body)
+	}
+
+	// Токен редактора дает писать, но не администрировать
+	w = doRequestAs(router, http.MethodPost, "/songs", `{"group":"Muse","song":"Hysteria"}`, token.AccessToken)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("editor adds song: status %d, body %s", w.Code, w.Body)
+	}
+	w = doRequestAs(router, http.MethodGet, "/admin/api-keys", "", token.AccessToken)
+	if w.Code != http.StatusForbidden || errorCodeOf(t, w.Body.Bytes()) != codeForbidden {
+		t.Fatalf("editor lists API keys: status %d, body %s", w.Code, w.Body)
+	}
+
+	// Просроченный и поддельный токены отклоняются
+	expiredKeys, err := ParseJWTKeys("test:test-jwt-secret", "", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alice User
+	GetDB().First(&alice, "username = ?", "alice")
+	expired, _, err := expiredKeys.Issue(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedKeys, err := ParseJWTKeys("test:other-secret", "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, _, err := forgedKeys.Issue(User{ID: alice.ID, Username: "alice", Role: RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, raw := range map[string]string{"expired": expired, "forged": forged, "garbage": "not-a-token"} {
+		w := doRequestAs(router, http.MethodPost, "/songs", `{"group":"Muse","song":"Starlight"}`, raw)
+		if w.Code != http.StatusUnauthorized || errorCodeOf(t, w.Body.Bytes()) != codeInvalidToken {
+			t.Errorf("%s token: status %d, body %s", name, w.Code, w.Body)
+		}
+	}
+
+	w = doRequest(router, http.MethodPost, "/songs", `{"group":"Muse","song":"Starlight"}`)
+	if w.Code != http.StatusUnauthorized || errorCodeOf(t, w.Body.Bytes()) != codeUnauthenticated {
+		t.Errorf("anonymous write: status %d, body %s", w.Code, w.Body)
+	}
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	setupTestDB(t)
+	router := newTestRouter()
+
+	w := doRequestAs(router, http.MethodPost, "/admin/api-keys", `{"name":"importer","role":"editor"}`, testAdminToken)
+	var created CreatedAPIKey
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated || created.Key == "" {
+		t.Fatalf("create: status %d, body %s", w.Code, w.Body)
+	}
+
+	w = doRequestWithHeader(router, http.MethodPost, "/songs", `{"group":"Muse","song":"Hysteria"}`, apiKeyHeader, created.Key)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("editor key adds song: status %d, body %s", w.Code, w.Body)
+	}
+	w = doRequestWithHeader(router, http.MethodGet, "/admin/api-keys", "", apiKeyHeader, created.Key)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("editor key lists keys: status %d, body %s", w.Code, w.Body)
+	}
+	var stored APIKey
+	GetDB().First(&stored, created.ID)
+	if stored.LastUsedAt == nil {
+		t.Error("last use of the key not recorded")
+	}
+
+	w = doRequestAs(router, http.MethodDelete, fmt.Sprintf("/admin/api-keys/%d", created.ID), "", testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("revoke: status %d, body %s", w.Code, w.Body)
+	}
+	for name, key := range map[string]string{"revoked": created.Key, "unknown": "made-up-key"} {
+		w := doRequestWithHeader(router, http.MethodGet, "/songs", "", apiKeyHeader, key)
+		if w.Code != http.StatusUnauthorized || errorCodeOf(t, w.Body.Bytes()) != codeInvalidToken {
+			t.Errorf("%s key: status %d, body %s", name, w.Code, w.Body)
+		}
+	}
+}
+
+func TestOIDCBearerToken(t *testing.T) {
+	setupTestDB(t)
+	useTestJWTKeys(t)
+	router := newTestRouter()
+
+	const issuer, clientID = "https://idp.example.com", "musik"
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySet := &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{&key.PublicKey}}
+	prev := oidcAuth
+	oidcAuth = &OIDCAuth{verifier: oidc.NewVerifier(issuer, keySet, &oidc.Config{ClientID: clientID})}
+	t.Cleanup(func() { oidcAuth = prev })
+
+	idToken := func(audience string, signer *rsa.PrivateKey) string {
+		t.Helper()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss": issuer, "aud": audience, "sub": "42",
+			"preferred_username": "dave",
+			"iat":                time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+		})
+		signed, err := token.SignedString(signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	// Пользователь провайдера появляется читателем: аутентифицирован, но писать не может
+	for i := 0; i < 2; i++ {
+		w := doRequestAs(router, http.MethodPost, "/songs", `{"group":"Muse","song":"Hysteria"}`, idToken(clientID, key))
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("request %d: status %d, body %s", i+1, w.Code, w.Body)
+		}
+	}
+	var users, identities int64
+	GetDB().Model(&User{}).Where("username = ? AND role = ?", "dave", RoleReader).Count(&users)
+	GetDB().Model(&UserIdentity{}).Where("issuer = ? AND subject = ?", issuer, "42").Count(&identities)
+	if users != 1 || identities != 1 {
+		t.Fatalf("users = %d, identities = %d, want one of each", users, identities)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, raw := range map[string]string{"other audience": idToken("someone-else", key), "other key": idToken(clientID, other)} {
+		w := doRequestAs(router, http.MethodPost, "/songs", `{"group":"Muse","song":"Hysteria"}`, raw)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, body %s", name, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Форматы полной выгрузки базы
+const (
+	backupFormatNDJSON = "ndjson"
+	backupFormatZip    = "zip"
+)
+
+// Таблицы полной выгрузки: каталог и все, что привязано к песням, в порядке
+// внешних ключей - в нем же таблицы восстанавливаются. Пользователи, ключи
+// API, сессии и журналы не выгружаются: в них секреты и служебные данные,
+// не нужные для восстановления каталога.
+var backupModels = []interface{}{&Album{}, &Song{}, &SongTag{}, &SongLink{}, &SongEnrichment{}, &ArchivedLyrics{}, &SongNote{}, &ScheduledChange{}}
+
+// backupTable - таблица выгрузки, ее колонки и порядок строк в ней
+type backupTable struct {
+	name    string
+	orderBy string
+	schema  *schema.Schema
+}
+
+// backupTables переводит модели в имена таблиц так, как их видит GORM
+func backupTables(db *gorm.DB) ([]backupTable, error) {
+	tables := make([]backupTable, len(backupModels))
+	for i, model := range backupModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		tables[i] = backupTable{name: stmt.Schema.Table, orderBy: strings.Join(stmt.Schema.PrimaryFieldDBNames, ", "), schema: stmt.Schema}
+	}
+	return tables, nil
+}
+
+// BackupSummary - последняя строка NDJSON и manifest.json архива: по ней
+// видно, что выгрузка не оборвалась
+type BackupSummary struct {
+	CreatedAt time.Time        `json:"createdAt"`
+	Tables    map[string]int64 `json:"tables"` // строк в каждой таблице
+}
+
+// backupWriter пишет строки таблиц в одном формате
+type backupWriter interface {
+	BeginTable(name string, columns []string) error
+	WriteRow(values []string, row map[string]interface{}) error
+	EndTable() error
+	Close(summary BackupSummary) error
+}
+
+// ndjsonBackup - строка на каждую запись: {"table": ..., "row": {...}}
+type ndjsonBackup struct {
+	out   gin.ResponseWriter
+	w     *bufio.Writer
+	enc   *json.Encoder
+	table string
+	rows  int
+}
+
+func newNDJSONBackup(out gin.ResponseWriter) *ndjsonBackup {
+	w := bufio.NewWriter(out)
+	return &ndjsonBackup{out: out, w: w, enc: json.NewEncoder(w)}
+}
+
+func (b *ndjsonBackup) BeginTable(name string, _ []string) error {
+	b.table = name
+	return nil
+}
+
+func (b *ndjsonBackup) WriteRow(_ []string, row map[string]interface{}) error {
+	if err := b.enc.Encode(struct {
+		Table string                 `json:"table"`
+		Row   map[string]interface{} `json:"row"`
+	}{b.table, row}); err != nil {
+		return err
+	}
+	if b.rows++; b.rows%exportBatchSize == 0 {
+		return b.flush()
+	}
+	return nil
+}
+
+func (b *ndjsonBackup) EndTable() error { return b.flush() }
+
+func (b *ndjsonBackup) Close(summary BackupSummary) error {
+	if err := b.enc.Encode(struct {
+		Summary BackupSummary `json:"summary"`
+	}{summary}); err != nil {
+		return err
+	}
+	return b.flush()
+}
+
+func (b *ndjsonBackup) flush() error {
+	if err := b.w.Flush(); err != nil {
+		return err
+	}
+	b.out.Flush()
+	return nil
+}
+
+// zipBackup - архив с <таблица>.csv на каждую таблицу и manifest.json.
+// Оборванный архив не открывается: оглавление zip пишется последним.
+type zipBackup struct {
+	out  gin.ResponseWriter
+	zw   *zip.Writer
+	w    *csv.Writer
+	rows int
+}
+
+func newZipBackup(out gin.ResponseWriter) *zipBackup {
+	return &zipBackup{out: out, zw: zip.NewWriter(out)}
+}
+
+func (b *zipBackup) BeginTable(name string, columns []string) error {
+	f, err := b.zw.Create(name + ".csv")
+	if err != nil {
+		return err
+	}
+	b.w = csv.NewWriter(f)
+	return b.w.Write(columns)
+}
+
+func (b *zipBackup) WriteRow(values []string, _ map[string]interface{}) error {
+	if err := b.w.Write(values); err != nil {
+		return err
+	}
+	if b.rows++; b.rows%exportBatchSize == 0 {
+		b.w.Flush()
+		b.out.Flush()
+	}
+	return b.w.Error()
+}
+
+func (b *zipBackup) EndTable() error {
+	b.w.Flush()
+	return b.w.Error()
+}
+
+func (b *zipBackup) Close(summary BackupSummary) error {
+	f, err := b.zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(summary); err != nil {
+		return err
+	}
+	return b.zw.Close()
+}
+
+// backupFormats - content type и конструктор для каждого формата
+var backupFormats = map[string]struct {
+	contentType string
+	newWriter   func(w gin.ResponseWriter) backupWriter
+}{
+	backupFormatNDJSON: {"application/x-ndjson", func(w gin.ResponseWriter) backupWriter { return newNDJSONBackup(w) }},
+	backupFormatZip:    {"application/zip", func(w gin.ResponseWriter) backupWriter { return newZipBackup(w) }},
+}
+
+// backupValue приводит значение колонки к JSON и к ячейке CSV. Двоичные
+// колонки (сжатый архив текстов) - base64, время - RFC 3339, NULL - пустая
+// ячейка.
+func backupValue(value interface{}, binary bool) (interface{}, string) {
+	switch v := value.(type) {
+	case nil:
+		return nil, ""
+	case []byte:
+		if binary {
+			s := base64.StdEncoding.EncodeToString(v)
+			return s, s
+		}
+		return string(v), string(v)
+	case time.Time:
+		return v, v.Format(time.RFC3339Nano)
+	case string:
+		return v, v
+	case bool:
+		return v, strconv.FormatBool(v)
+	}
+	return value, fmt.Sprint(value)
+}
+
+// writeBackupTable пишет все строки таблицы, включая удаленные песни
+func writeBackupTable(tx *gorm.DB, table backupTable, w backupWriter) (int64, error) {
+	rows, err := tx.Table(table.name).Order(table.orderBy).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	binary := make([]bool, len(types))
+	for i, t := range types {
+		name := strings.ToUpper(t.DatabaseTypeName())
+		binary[i] = name == "BYTEA" || name == "BLOB"
+	}
+	if err := w.BeginTable(table.name, columns); err != nil {
+		return 0, err
+	}
+
+	raw := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	var count int64
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return count, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			row[column], values[i] = backupValue(raw[i], binary[i])
+		}
+		if err := w.WriteRow(values, row); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	return count, w.EndTable()
+}
+
+// @Summary Export the database
+// @Description Stream a logical backup of the catalog: songs (including deleted ones that have not been purged), albums, tags, platform links, enrichment status, archived lyrics, notes and scheduled changes. All tables are read in one read-only transaction, so the dump is consistent. ndjson writes one {"table", "row"} object per line and ends with a {"summary"} line holding the row count of every table; zip holds one CSV per table with a header row of column names and a manifest.json with the same counts. Binary columns are base64, times RFC 3339, NULL an empty CSV cell. Users, API keys, sessions and logs are not exported. If the dump fails midway the response is cut off: an ndjson dump without the summary line or a zip that does not open is incomplete.
+// @ID export-database
+// @Produce application/x-ndjson
+// @Produce application/zip
+// @Param format query string false "ndjson (default) or zip"
+// @Success 200 {file} file
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/export [get]
+func ExportDatabase(c *gin.Context) {
+	format := c.DefaultQuery("format", backupFormatNDJSON)
+	spec, ok := backupFormats[format]
+	if !ok {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Unsupported export format: "+format)
+		return
+	}
+	db := dbFor(c)
+	tables, err := backupTables(db)
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to export database")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to export database")
+		return
+	}
+
+	opts := &sql.TxOptions{ReadOnly: true}
+	if db.Dialector.Name() == "postgres" {
+		// Снимок на начало транзакции: таблицы согласованы между собой
+		opts.Isolation = sql.LevelRepeatableRead
+	}
+	tx := db.Begin(opts)
+	if tx.Error != nil {
+		logEntry(c).WithError(tx.Error).Error("Failed to export database")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to export database")
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	c.Header("Content-Type", spec.contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="backup-%s.%s"`, now.Format("20060102T150405Z"), format))
+	c.Status(http.StatusOK)
+	w := spec.newWriter(c.Writer)
+	summary := BackupSummary{CreatedAt: now, Tables: map[string]int64{}}
+	for _, table := range tables {
+		count, err := writeBackupTable(tx, table, w)
+		if err != nil {
+			// Ответ уже начат, код не изменить: выгрузка обрывается без итога
+			logEntry(c).WithError(err).WithField("table", table.name).Error("Failed to export database")
+			return
+		}
+		summary.Tables[table.name] = count
+	}
+	if err := w.Close(summary); err != nil {
+		logEntry(c).WithError(err).Error("Failed to export database")
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func TestExportDatabase(t *testing.T) {
+	conn := setupTestDB(t)
+	seedGoldenSongs(t)
+	// Удаленная, но не очищенная песня тоже попадает в выгрузку
+	conn.Delete(&Song{}, 2)
+	router := newTestRouter()
+
+	w := doRequestAs(router, http.MethodGet, "/admin/export", "", testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("ndjson: status %d: %s", w.Code, w.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	var last struct {
+		Summary BackupSummary `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil {
+		t.Fatalf("ndjson: decode summary: %v", err)
+	}
+	if last.Summary.Tables["songs"] != 2 || len(lines) != 3 {
+		t.Errorf("ndjson: got %d lines, summary %+v, want both songs", len(lines), last.Summary)
+	}
+
+	w = doRequestAs(router, http.MethodGet, "/admin/export?format=zip", "", testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("zip: status %d: %s", w.Code, w.Body.String())
+	}
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("zip: open: %v", err)
+	}
+	f, err := archive.Open("songs.csv")
+	if err != nil {
+		t.Fatalf("zip: %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("zip: read songs.csv: %v", err)
+	}
+	if len(records) != 3 || !strings.Contains(strings.Join(records[0], ","), "song_name") {
+		t.Errorf("zip: songs.csv has %d records: %v", len(records), records)
+	}
+	if _, err := archive.Open("manifest.json"); err != nil {
+		t.Errorf("zip: %v", err)
+	}
+
+	if w := doRequest(router, http.MethodGet, "/admin/export", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without token: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+// restoreDump разбирает выгрузку и восстанавливает ее в транзакции
+func restoreDump(t *testing.T, format string, data []byte, mode string) int64 {
+	t.Helper()
+	dump, err := parseBackup(GetDB(), format, data)
+	if err != nil {
+		t.Fatalf("%s: parse: %v", format, err)
+	}
+	var restored int64
+	err = GetDB().Transaction(func(tx *gorm.DB) error {
+		return restoreBackup(tx, dump, mode, func(_ string, rows int64) { restored += rows })
+	})
+	if err != nil {
+		t.Fatalf("%s: restore: %v", format, err)
+	}
+	return restored
+}
+
+func TestRestoreBackup(t *testing.T) {
+	conn := setupTestDB(t)
+	seedGoldenSongs(t)
+	conn.Create(&SongTag{SongID: 1, Name: "rock"})
+	conn.Model(&Song{}).Where("id = ?", 2).Update("owner_id", 42)
+	router := newTestRouter()
+
+	for _, format := range []string{backupFormatNDJSON, backupFormatZip} {
+		w := doRequestAs(router, http.MethodGet, "/admin/export?format="+format, "", testAdminToken)
+		data := w.Body.Bytes()
+
+		// replace: каталог после восстановления такой же, как в выгрузке
+		conn.Exec("DELETE FROM song_tags")
+		conn.Model(&Song{}).Where("id = ?", 1).Update("song_name", "Changed")
+		conn.Create(&Song{Group: "Muse", SongName: "Uprising"})
+		if restored := restoreDump(t, format, data, restoreModeReplace); restored != 3 {
+			t.Errorf("%s replace: restored %d rows, want 3", format, restored)
+		}
+		var songs []Song
+		conn.Order("id").Find(&songs)
+		if len(songs) != 2 || songs[0].SongName != "Supermassive Black Hole" || !songs[0].ReleaseDate.Time().Equal(mustReleaseDate("16.07.2006").Time()) {
+			t.Errorf("%s replace: got %+v", format, songs)
+		}
+		if songs[1].OwnerID != nil {
+			t.Errorf("%s replace: owner %d kept, but there is no such user", format, *songs[1].OwnerID)
+		}
+		var tags int64
+		conn.Model(&SongTag{}).Count(&tags)
+		if tags != 1 {
+			t.Errorf("%s replace: %d tags, want 1", format, tags)
+		}
+
+		// merge: песни из выгрузки перезаписываются, остальные остаются
+		conn.Model(&Song{}).Where("id = ?", 1).Update("song_name", "Changed")
+		conn.Create(&Song{Group: "Muse", SongName: "Uprising"})
+		restoreDump(t, format, data, restoreModeMerge)
+		var count int64
+		conn.Model(&Song{}).Count(&count)
+		var first Song
+		conn.First(&first, 1)
+		if count != 3 || first.SongName != "Supermassive Black Hole" {
+			t.Errorf("%s merge: %d songs, first %q", format, count, first.SongName)
+		}
+		conn.Unscoped().Where("song_name = ?", "Uprising").Delete(&Song{})
+	}
+}
+
+func TestRestoreBackupRejectsIncompleteDump(t *testing.T) {
+	setupTestDB(t)
+	seedGoldenSongs(t)
+	router := newTestRouter()
+	jobs = NewJobQueue(GetDB(), JobQueueConfig{})
+	t.Cleanup(func() { jobs = nil })
+
+	w := doRequestAs(router, http.MethodGet, "/admin/export", "", testAdminToken)
+	lines := strings.SplitAfter(w.Body.String(), "\n")
+
+	restore := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/import?mode=replace", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	// Без строки итога выгрузка оборвана
+	if w := restore(strings.Join(lines[:2], "")); w.Code != http.StatusBadRequest {
+		t.Errorf("without summary: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := restore(strings.Replace(w.Body.String(), `"song_name"`, `"title"`, 1)); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown column: status %d: %s", w.Code, w.Body.String())
+	}
+
+	w = restore(w.Body.String())
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var queued BackupRestore
+	json.Unmarshal(w.Body.Bytes(), &queued)
+	if queued.Status != restoreStatusPending || queued.TotalRows != 2 {
+		t.Errorf("got %+v", queued)
+	}
+	status := doRequestAs(router, http.MethodGet, w.Header().Get("Location"), "", testAdminToken)
+	if status.Code != http.StatusOK || !strings.Contains(status.Body.String(), `"totalRows":2`) {
+		t.Errorf("status: %d %s", status.Code, status.Body.String())
+	}
+}
+
+func TestRestoreBackupMergeRejectsSongNameConflict(t *testing.T) {
+	conn := setupTestDB(t)
+	seedGoldenSongs(t)
+	router := newTestRouter()
+	jobs = NewJobQueue(GetDB(), JobQueueConfig{})
+	t.Cleanup(func() { jobs = nil })
+	data := doRequestAs(router, http.MethodGet, "/admin/export", "", testAdminToken).Body.Bytes()
+
+	// Та же песня добавлена заново под другим ID
+	conn.Unscoped().Delete(&Song{}, 2)
+	conn.Create(&Song{Group: "queen", SongName: "bohemian rhapsody"})
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/import?mode=merge", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "(2 in the backup, 3 in the database)") {
+		t.Errorf("upload: status %d: %s", w.Code, w.Body.String())
+	}
+
+	dump, err := parseBackup(conn, backupFormatNDJSON, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.Transaction(func(tx *gorm.DB) error {
+		return restoreBackup(tx, dump, restoreModeMerge, func(string, int64) {})
+	})
+	var conflict songNameConflictError
+	if !errors.As(err, &conflict) || conflict.total != 1 {
+		t.Errorf("restore error = %v, want a song name conflict", err)
+	}
+	// replace очищает каталог, и конфликта нет
+	if restored := restoreDump(t, backupFormatNDJSON, data, restoreModeReplace); restored != 2 {
+		t.Errorf("replace: restored %d rows, want 2", restored)
+	}
+}
+
+// queueRestore сохраняет восстановление так же, как POST /admin/import,
+// и возвращает payload задачи
+func queueRestore(t *testing.T, mode string, data []byte) (BackupRestore, json.RawMessage) {
+	t.Helper()
+	restore := BackupRestore{Mode: mode, Format: backupFormatNDJSON, Status: restoreStatusPending, Tables: map[string]int64{}, Actor: "test"}
+	if err := GetDB().Create(&restore).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := GetDB().Create(&BackupRestoreData{RestoreID: restore.ID, Data: data}).Error; err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(restorePayload{RestoreID: restore.ID})
+	return restore, payload
+}
+
+func TestRestoreJob(t *testing.T) {
+	conn := setupTestDB(t)
+	seedGoldenSongs(t)
+	router := newTestRouter()
+	data := doRequestAs(router, http.MethodGet, "/admin/export", "", testAdminToken).Body.Bytes()
+
+	var purged []string
+	purger := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		purged = append(purged, r.Header.Get(surrogateKeyHeader))
+	}))
+	t.Cleanup(purger.Close)
+	cachePurger = NewCachePurger(CacheConfig{PurgeURL: purger.URL, Timeout: time.Second})
+	songTextCache = NewSongTextCache(SongTextCacheConfig{MaxBytes: 1 << 20})
+	t.Cleanup(func() { cachePurger, songTextCache = nil, nil })
+
+	t.Run("done", func(t *testing.T) {
+		conn.Model(&Song{}).Where("id = ?", 1).Update("song_name", "Changed")
+		var changed Song
+		conn.First(&changed, 1)
+		songTextCache.Put(changed)
+		restore, payload := queueRestore(t, restoreModeReplace, data)
+
+		if err := restoreJob(context.Background(), payload); err != nil {
+			t.Fatalf("restore job: %v", err)
+		}
+		conn.First(&restore, restore.ID)
+		if restore.Status != restoreStatusDone || restore.FinishedAt == nil || restore.Error != "" {
+			t.Errorf("restore = %+v, want done", restore)
+		}
+		if restore.RestoredRows != 2 || restore.Tables["songs"] != 2 {
+			t.Errorf("progress = %d rows, tables %v, want both songs", restore.RestoredRows, restore.Tables)
+		}
+		var song Song
+		conn.First(&song, 1)
+		if song.SongName != "Supermassive Black Hole" {
+			t.Errorf("song 1 = %q after restore", song.SongName)
+		}
+		var blobs int64
+		conn.Model(&BackupRestoreData{}).Count(&blobs)
+		if blobs != 0 {
+			t.Errorf("%d uploaded files left after the restore", blobs)
+		}
+		// Старое название из кеша текстов не должно пережить восстановление
+		if _, ok := songTextCache.Get(1); ok {
+			t.Error("song text cache still holds song 1")
+		}
+		if len(purged) != 1 || purged[0] != cacheKeySongs {
+			t.Errorf("purged keys = %v, want [%s]", purged, cacheKeySongs)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		purged = nil
+		conn.Model(&Song{}).Where("id = ?", 1).Update("song_name", "Changed")
+		// Песня 1 в выгрузке дважды: вставка нарушает первичный ключ уже
+		// после очистки таблиц, и транзакция откатывается целиком
+		lines := strings.SplitAfter(string(data), "\n")
+		broken := lines[0] + strings.Replace(string(data), `"songs":2`, `"songs":3`, 1)
+		restore, payload := queueRestore(t, restoreModeReplace, []byte(broken))
+
+		if err := restoreJob(context.Background(), payload); err != nil {
+			t.Fatalf("restore job: %v", err)
+		}
+		conn.First(&restore, restore.ID)
+		if restore.Status != restoreStatusFailed || restore.Error == "" || restore.FinishedAt == nil {
+			t.Errorf("restore = %+v, want failed with an error", restore)
+		}
+		var song Song
+		conn.First(&song, 1)
+		if song.SongName != "Changed" {
+			t.Errorf("song 1 = %q, want the database unchanged", song.SongName)
+		}
+		var blobs int64
+		conn.Model(&BackupRestoreData{}).Count(&blobs)
+		if blobs != 0 {
+			t.Errorf("%d uploaded files left after the failed restore", blobs)
+		}
+		if len(purged) != 0 {
+			t.Errorf("purged %v after a failed restore", purged)
+		}
+	})
+}
+
+func TestExportDatabaseHasNoDefaultTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RouteLimits(nil, RouteLimit{Timeout: Duration(time.Second)}))
+	// Срок контекста запроса оборвал бы курсор выгрузки на середине
+	router.GET("/admin/export", func(c *gin.Context) {
+		if deadline, ok := c.Request.Context().Deadline(); ok {
+			t.Errorf("export request has a deadline %v", deadline)
+		}
+		c.Status(http.StatusOK)
+	})
+	doRequest(router, http.MethodGet, "/admin/export", "")
+}
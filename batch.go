@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Режимы POST /songs/batch
+const (
+	batchModeAtomic = "atomic" // все песни одной транзакцией: ошибка одной отменяет пакет
+	batchModeItems  = "items"  // каждая песня отдельно, ошибки не мешают остальным
+)
+
+// Что делать с песней, которая уже есть в каталоге (та же группа и название)
+const (
+	batchDuplicatesSkip    = "skip"
+	batchDuplicatesReplace = "replace"
+	batchDuplicatesError   = "error"
+)
+
+// Итог одной песни пакета
+const (
+	batchItemCreated    = "created"
+	batchItemReplaced   = "replaced"
+	batchItemSkipped    = "skipped"
+	batchItemFailed     = "failed"
+	batchItemRolledBack = "rolledBack" // песня прошла бы, но пакет отменен
+)
+
+// Максимальный размер пакета; задается BATCH_MAX_SONGS
+var batchMaxSongs = 1000
+
+// Сколько строк вставлять одним INSERT при импорте и пакетном добавлении;
+// задается INSERT_BATCH_SIZE. Запрос с пачкой больше упирается в лимит
+// параметров PostgreSQL (65535): у песни их около 20.
+var insertBatchSize = 500
+
+// Результат одной песни; Index - позиция в массиве запроса
+type BatchItemResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	ID     int    `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Итог пакета
+type BatchResult struct {
+	Created  int               `json:"created"`
+	Replaced int               `json:"replaced"`
+	Skipped  int               `json:"skipped"`
+	Failed   int               `json:"failed"`
+	Results  []BatchItemResult `json:"results"`
+}
+
+var (
+	errBatchInvalid    = errors.New("invalid song")
+	errBatchDuplicate  = errors.New("song already exists")
+	errBatchRolledBack = errors.New("batch rolled back")
+	// Дубликат новой песни этого же пакета, которая еще не вставлена:
+	// нужно вызвать flush и повторить save
+	errBatchPending = errors.New("duplicate of a pending song")
+)
+
+// insertSongs добавляет новые песни пачками по insertBatchSize вместо
+// INSERT на каждую строку и так же пачками пишет их аудит. ID песен
+// заполняются в songs.
+func insertSongs(tx *gorm.DB, c *gin.Context, songs []Song) error {
+	if err := tx.CreateInBatches(songs, insertBatchSize).Error; err != nil {
+		return err
+	}
+	actor, requestID := auditActor(c), c.GetString(fieldRequestID)
+	entries := make([]AuditEntry, len(songs))
+	for i := range songs {
+		entry, err := newAuditEntry(actor, requestID, auditEntitySong, songs[i].ID, auditActionCreate, nil, songs[i])
+		if err != nil {
+			return err
+		}
+		entries[i] = entry
+	}
+	if err := tx.CreateInBatches(entries, insertBatchSize).Error; err != nil {
+		return fmt.Errorf("write audit entries: %w", err)
+	}
+	return nil
+}
+
+// batchKey - ключ дубликата: группа и название без учета регистра
+func batchKey(song Song) string {
+	return strings.ToLower(song.Group) + "\x00" + strings.ToLower(song.SongName)
+}
+
+// batchExisting загружает песни каталога с теми же названиями, что в пакете
+func batchExisting(db *gorm.DB, songs []Song) (map[string]Song, error) {
+	names := make([]string, 0, len(songs))
+	for _, song := range songs {
+		names = append(names, strings.ToLower(song.SongName))
+	}
+	var found []Song
+	if err := db.Where("LOWER(song_name) IN ?", names).Order("id").Find(&found).Error; err != nil {
+		return nil, err
+	}
+	existing := make(map[string]Song, len(found))
+	for _, song := range found {
+		if _, ok := existing[batchKey(song)]; !ok {
+			existing[batchKey(song)] = song
+		}
+	}
+	return existing, nil
+}
+
+// batchSaver сохраняет песни пакета и помнит, что уже есть в каталоге,
+// включая песни, добавленные этим же пакетом. Новые песни копятся в
+// pending и вставляются пачками в flush. Задачи и события по песням
+// откладываются до коммита транзакции, в которой они записаны.
+type batchSaver struct {
+	c          *gin.Context
+	duplicates string
+	songs      []Song
+	results    []BatchItemResult
+	existing   map[string]Song // у отложенных песен ID еще 0
+	pending    []int           // индексы новых песен, ждущих вставки
+}
+
+// save обрабатывает песню i в транзакции w. Новая песня только
+// откладывается до flush. Ошибка возвращается, если песня не сохранена и
+// не пропущена; статус результата при этом заполняет вызывающий.
+func (b *batchSaver) save(w *songWrite, i int) (BatchItemResult, error) {
+	song := b.songs[i]
+	if err := validateSong(song); err != nil {
+		return BatchItemResult{}, fmt.Errorf("%w: %v", errBatchInvalid, err)
+	}
+	before, duplicate := b.existing[batchKey(song)]
+	if duplicate && before.ID == 0 {
+		return BatchItemResult{}, errBatchPending
+	}
+	if !duplicate {
+		song.ID = 0
+		song.Explicit = profanity.Contains(song.Text)
+		song.LinkConfidence = nil
+		setSongOwner(b.c, &song)
+		b.songs[i] = song
+		b.existing[batchKey(song)] = song
+		b.pending = append(b.pending, i)
+		return BatchItemResult{Status: batchItemCreated}, nil
+	}
+
+	switch b.duplicates {
+	case batchDuplicatesSkip:
+		return BatchItemResult{Status: batchItemSkipped, ID: before.ID}, nil
+	case batchDuplicatesReplace:
+		if !canModifySong(b.c, before) {
+			return BatchItemResult{ID: before.ID}, errNotOwner
+		}
+		// Как в PUT /songs/:id: владелец и оценка ссылки не меняются
+		song.ID, song.OwnerID, song.LinkConfidence = 0, nil, nil
+		after, err := applySongPatch(w.tx, before, song)
+		if err != nil {
+			return BatchItemResult{ID: before.ID}, err
+		}
+		if err := recordAudit(w.tx, b.c, auditEntitySong, before.ID, auditActionUpdate, before, after); err != nil {
+			return BatchItemResult{ID: before.ID}, err
+		}
+		b.existing[batchKey(song)] = after
+		w.afterCommit(func() { publishSongEventFor(b.c, songEventUpdated, after) })
+		return BatchItemResult{Status: batchItemReplaced, ID: before.ID}, nil
+	}
+	return BatchItemResult{ID: before.ID}, errBatchDuplicate
+}
+
+// flush вставляет отложенные песни в транзакции w и проставляет их ID в
+// результаты. Состояние меняется только после успешной вставки.
+func (b *batchSaver) flush(w *songWrite) error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	songs := make([]Song, len(b.pending))
+	for j, i := range b.pending {
+		songs[j] = b.songs[i]
+	}
+	// Песни пакета не обогащаются: сразу задачи статистики и ссылок
+	if err := w.createSongs(songs, nil, enrichmentQueue{}); err != nil {
+		return err
+	}
+	for j, i := range b.pending {
+		b.songs[i] = songs[j]
+		b.existing[batchKey(songs[j])] = songs[j]
+		b.results[i].ID = songs[j].ID
+	}
+	b.pending = b.pending[:0]
+	return nil
+}
+
+// flushItems - flush режима items: каждая вставка в своей транзакции. Если
+// пачка не вставилась, песни вставляются по одной, чтобы ошибка досталась
+// только своей песне.
+func (b *batchSaver) flushItems() {
+	if len(b.pending) == 0 || inSongTx(b.c, b.flush) == nil {
+		return
+	}
+	pending := b.pending
+	for _, i := range pending {
+		b.pending = []int{i}
+		if err := inSongTx(b.c, b.flush); err != nil {
+			logEntry(b.c).WithError(err).WithField("index", i).Error("Failed to store song from batch")
+			b.results[i] = BatchItemResult{Index: i, Status: batchItemFailed, Error: "Failed to store song"}
+			delete(b.existing, batchKey(b.songs[i]))
+		}
+	}
+	b.pending = nil
+}
+
+// batchItemError - текст ошибки песни для ответа; пустой, если это ошибка
+// базы, а не самой песни
+func batchItemError(err error) string {
+	switch {
+	case errors.Is(err, errBatchInvalid), errors.Is(err, errBatchDuplicate):
+		return err.Error()
+	case errors.Is(err, errNotOwner):
+		return "You can only change your own songs"
+	case errors.Is(err, errVersionConflict):
+		return "Song was changed by someone else"
+	}
+	return ""
+}
+
+// @Summary Add songs in bulk
+// @Description Add up to BATCH_MAX_SONGS songs from a JSON array. In atomic mode (default) all songs are stored in one transaction: if any song fails, nothing is stored, the response is 422 and the other songs are reported as rolledBack. In items mode every song is stored on its own and failures are reported per item. A song with the same group and title as an existing one (or an earlier one in the batch) is skipped, replaces the existing song's fields, or fails, according to the duplicates policy. Songs are not enriched.
+// @ID batch-songs
+// @Accept  json
+// @Produce  json
+// @Param songs body []Song true "Songs"
+// @Param mode query string false "atomic (default) or items"
+// @Param duplicates query string false "skip (default), replace or error"
+// @Success 200 {object} BatchResult "Items mode"
+// @Success 201 {object} BatchResult "Atomic mode, all songs stored"
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 413 {object} APIError
+// @Failure 422 {object} BatchResult "Atomic mode, nothing stored"
+// @Failure 500 {object} APIError
+// @x-skip-body-validation true
+// @Router /songs/batch [post]
+func BatchSongs(c *gin.Context) {
+	mode := c.DefaultQuery("mode", batchModeAtomic)
+	if mode != batchModeAtomic && mode != batchModeItems {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "mode must be atomic or items")
+		return
+	}
+	duplicates := c.DefaultQuery("duplicates", batchDuplicatesSkip)
+	switch duplicates {
+	case batchDuplicatesSkip, batchDuplicatesReplace, batchDuplicatesError:
+	default:
+		abortWithError(c, http.StatusBadRequest, codeValidation, "duplicates must be skip, replace or error")
+		return
+	}
+
+	// Без binding и без проверки по спецификации (x-skip-body-validation):
+	// обязательные поля проверяются по каждой песне отдельно
+	var songs []Song
+	if err := json.NewDecoder(c.Request.Body).Decode(&songs); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	if len(songs) == 0 {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Batch is empty")
+		return
+	}
+	if len(songs) > batchMaxSongs {
+		abortWithError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("Batch is limited to %d songs", batchMaxSongs))
+		return
+	}
+
+	existing, err := batchExisting(dbFor(c), songs)
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch existing songs")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to store songs")
+		return
+	}
+	result := BatchResult{Results: make([]BatchItemResult, len(songs))}
+	saver := &batchSaver{c: c, duplicates: duplicates, songs: songs, results: result.Results, existing: existing}
+
+	if mode == batchModeItems {
+		for i := range songs {
+			var item BatchItemResult
+			save := func() error {
+				return inSongTx(c, func(w *songWrite) error {
+					var err error
+					item, err = saver.save(w, i)
+					return err
+				})
+			}
+			err := save()
+			if errors.Is(err, errBatchPending) {
+				saver.flushItems()
+				err = save()
+			}
+			if err != nil {
+				item.Status, item.Error = batchItemFailed, batchItemError(err)
+				if item.Error == "" {
+					logEntry(c).WithError(err).WithField("index", i).Error("Failed to store song from batch")
+					item.Error = "Failed to store song"
+				}
+			}
+			item.Index = i
+			result.Results[i] = item
+		}
+		saver.flushItems()
+	} else {
+		failed := false
+		err := inSongTx(c, func(w *songWrite) error {
+			for i := range songs {
+				item, err := saver.save(w, i)
+				if errors.Is(err, errBatchPending) {
+					if err := saver.flush(w); err != nil {
+						return err
+					}
+					item, err = saver.save(w, i)
+				}
+				if err != nil {
+					// Ошибки самих песен копятся, чтобы сообщить обо всех сразу;
+					// ошибка базы прерывает пакет - транзакция уже непригодна
+					if item.Error = batchItemError(err); item.Error == "" {
+						return err
+					}
+					item.Status, failed = batchItemFailed, true
+				}
+				item.Index = i
+				result.Results[i] = item
+			}
+			if failed {
+				return errBatchRolledBack
+			}
+			return saver.flush(w)
+		})
+		if err != nil && !errors.Is(err, errBatchRolledBack) {
+			logEntry(c).WithError(err).Error("Failed to store song batch")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to store songs")
+			return
+		}
+		if failed {
+			for i := range result.Results {
+				if result.Results[i].Status == batchItemFailed {
+					result.Failed++
+				} else {
+					// ID созданной песни после отката ни на что не указывает
+					result.Results[i] = BatchItemResult{Index: i, Status: batchItemRolledBack}
+				}
+			}
+			c.JSON(http.StatusUnprocessableEntity, result)
+			return
+		}
+	}
+
+	for _, item := range result.Results {
+		switch item.Status {
+		case batchItemCreated:
+			result.Created++
+		case batchItemReplaced:
+			result.Replaced++
+		case batchItemSkipped:
+			result.Skipped++
+		case batchItemFailed:
+			result.Failed++
+		}
+	}
+	status := http.StatusOK
+	if mode == batchModeAtomic {
+		status = http.StatusCreated
+	}
+	c.JSON(status, result)
+}
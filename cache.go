@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	jobKindCachePurge = "cache_purge"
+
+	surrogateKeyHeader = "Surrogate-Key"
+	// Метод инвалидации, который понимают Varnish, Fastly и nginx proxy_cache_purge
+	methodPurge = "PURGE"
+)
+
+// Ключи кеша: ответ помечается ключами, запись сбрасывает все ответы с ее ключами
+const cacheKeySongs = "songs" // списки песен и ответы, в которые входят песни
+
+func albumCacheKey(id int) string  { return "album-" + strconv.Itoa(id) }
+func artistCacheKey(id int) string { return "artist-" + strconv.Itoa(id) }
+
+// Публичные ответы, которые можно кешировать, и их ключи. Альбом содержит
+// песни, поэтому сбрасывается вместе с ними. Текст песни не кешируется:
+// каждый просмотр пишется в события и влияет на архивацию.
+var cacheableRoutes = map[string]func(c *gin.Context) []string{
+	"/songs": func(c *gin.Context) []string { return []string{cacheKeySongs} },
+	"/albums/:id": func(c *gin.Context) []string {
+		return []string{"album-" + c.Param("id"), cacheKeySongs}
+	},
+	"/artists/:id": func(c *gin.Context) []string { return []string{"artist-" + c.Param("id")} },
+}
+
+// CacheConfig - заголовки для CDN или Varnish перед API
+type CacheConfig struct {
+	MaxAge       time.Duration // max-age публичных ответов для браузеров
+	SharedMaxAge time.Duration // s-maxage для общих кешей; ответы сбрасываются по ключам
+	PurgeURL     string        // адрес кеша, принимающий PURGE с Surrogate-Key; пусто - без инвалидации
+	Timeout      time.Duration
+}
+
+// CacheHeaders выставляет Cache-Control, Vary и Surrogate-Key ответам на
+// чтение. Общий кеш хранит только анонимные успешные ответы маршрутов из
+// cacheableRoutes; запросы с учетными данными и ошибки не кешируются.
+func CacheHeaders(cfg CacheConfig, authReads bool) gin.HandlerFunc {
+	public := "no-cache"
+	if cfg.MaxAge > 0 || cfg.SharedMaxAge > 0 {
+		public = fmt.Sprintf("public, max-age=%d, s-maxage=%d", int(cfg.MaxAge.Seconds()), int(cfg.SharedMaxAge.Seconds()))
+	}
+	return func(c *gin.Context) {
+		keys, ok := cacheableRoutes[c.FullPath()]
+		if !ok || (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) {
+			c.Header("Cache-Control", "no-store")
+			c.Next()
+			return
+		}
+		// Ответ зависит от клиента: роль, фильтр mine, JSON или XML, регион
+		vary := "Accept, Authorization, " + apiKeyHeader
+		if regionRules != nil {
+			vary += ", " + regionRules.header
+		}
+		c.Header("Vary", vary)
+		if authReads || c.GetHeader("Authorization") != "" || c.GetHeader(apiKeyHeader) != "" {
+			c.Header("Cache-Control", "private, no-cache")
+		} else {
+			c.Header("Cache-Control", public)
+			c.Header(surrogateKeyHeader, strings.Join(keys(c), " "))
+		}
+		c.Writer = &cacheWriter{ResponseWriter: c.Writer}
+		c.Next()
+	}
+}
+
+// cacheWriter запрещает кешировать ответы с ошибкой
+type cacheWriter struct {
+	gin.ResponseWriter
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if code >= http.StatusMultipleChoices && code != http.StatusNotModified {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Del(surrogateKeyHeader)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// CachePurger сбрасывает ответы в кеше перед API по ключам
+type CachePurger struct {
+	url  string
+	http *http.Client
+}
+
+// Инвалидация кеша; nil - кеша перед API нет
+var cachePurger *CachePurger
+
+// NewCachePurger возвращает nil, если PurgeURL не задан
+func NewCachePurger(cfg CacheConfig) *CachePurger {
+	if cfg.PurgeURL == "" {
+		return nil
+	}
+	return &CachePurger{url: cfg.PurgeURL, http: trackHTTP(&http.Client{Timeout: cfg.Timeout}, "cdn", dependencyCache)}
+}
+
+// Purge отправляет PURGE с ключами в заголовке Surrogate-Key
+func (p *CachePurger) Purge(ctx context.Context, keys []string) error {
+	req, err := http.NewRequestWithContext(ctx, methodPurge, p.url, nil)
+	if err != nil {
+		return fmt.Errorf("build purge request: %w", err)
+	}
+	req.Header.Set(surrogateKeyHeader, strings.Join(keys, " "))
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("purge cache: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("purge cache: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type cachePurgePayload struct {
+	Keys []string `json:"keys"`
+}
+
+// purgeCache сбрасывает ключи после записи: через очередь, чтобы повторить
+// при недоступном кеше, или сразу, если очереди нет
+func purgeCache(ctx context.Context, keys ...string) error {
+	// Кеш в Redis сбрасывается сразу: следующее чтение должно увидеть запись
+	if responseCache != nil && len(keys) > 0 {
+		if err := responseCache.Invalidate(ctx, keys); err != nil {
+			return err
+		}
+	}
+	if cachePurger == nil || len(keys) == 0 {
+		return nil
+	}
+	if jobs != nil {
+		return jobs.Enqueue(ctx, jobKindCachePurge, cachePurgePayload{Keys: keys}, 1)
+	}
+	return cachePurger.Purge(ctx, keys)
+}
+
+// purgeCacheFor сбрасывает ключи из обработчика; ошибка только пишется в
+// лог, потому что изменение уже сохранено
+func purgeCacheFor(c *gin.Context, keys ...string) {
+	if err := purgeCache(c.Request.Context(), keys...); err != nil {
+		logEntry(c).WithError(err).WithField("keys", keys).Warn("Failed to purge cache")
+	}
+}
+
+// purgeCacheJob - обработчик задачи cache_purge
+func purgeCacheJob(ctx context.Context, payload json.RawMessage) error {
+	var p cachePurgePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	return cachePurger.Purge(ctx, p.Keys)
+}
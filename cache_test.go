@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// purgeRequest - запрос, полученный кешем перед API
+type purgeRequest struct {
+	method, keys string
+}
+
+// usePurgeServer поднимает кеш перед API, который отвечает status на PURGE
+func usePurgeServer(t *testing.T, status int) *[]purgeRequest {
+	t.Helper()
+	var purged []purgeRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		purged = append(purged, purgeRequest{r.Method, r.Header.Get(surrogateKeyHeader)})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	cachePurger = NewCachePurger(CacheConfig{PurgeURL: server.URL, Timeout: time.Second})
+	t.Cleanup(func() { cachePurger = nil })
+	return &purged
+}
+
+func TestCacheHeaders(t *testing.T) {
+	setupTestDB(t)
+	seedGoldenSongs(t)
+	cfg := testConfig()
+	cfg.Cache = CacheConfig{MaxAge: time.Minute, SharedMaxAge: time.Hour}
+	router := newTestRouterWith(cfg)
+
+	cases := []struct {
+		name, method, target, token string
+		cacheControl, surrogateKey  string
+	}{
+		{"anonymous list", http.MethodGet, "/songs", "", "public, max-age=60, s-maxage=3600", cacheKeySongs},
+		{"authenticated list", http.MethodGet, "/songs", testAdminToken, "private, no-cache", ""},
+		{"error", http.MethodGet, "/songs?page=0", "", "no-store", ""},
+		{"not cacheable route", http.MethodGet, "/songs/" + encodeSongID(1) + "/text", "", "no-store", ""},
+	}
+	for _, tc := range cases {
+		w := doRequestAs(router, tc.method, tc.target, "", tc.token)
+		if got := w.Header().Get("Cache-Control"); got != tc.cacheControl {
+			t.Errorf("%s: Cache-Control = %q, want %q", tc.name, got, tc.cacheControl)
+		}
+		if got := w.Header().Get(surrogateKeyHeader); got != tc.surrogateKey {
+			t.Errorf("%s: Surrogate-Key = %q, want %q", tc.name, got, tc.surrogateKey)
+		}
+	}
+
+	// Без max-age общий кеш обязан переспрашивать API
+	w := doRequest(newTestRouter(), http.MethodGet, "/songs", "")
+	if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("default Cache-Control = %q, want no-cache", got)
+	}
+	if vary := w.Header().Get("Vary"); vary != "Accept, Authorization, "+apiKeyHeader {
+		t.Errorf("Vary = %q", vary)
+	}
+}
+
+func TestWritesPurgeCache(t *testing.T) {
+	setupTestDB(t)
+	seedGoldenSongs(t)
+	router := newTestRouter()
+	purged := usePurgeServer(t, http.StatusOK)
+
+	w := doRequestAs(router, http.MethodPut, "/songs/"+encodeSongID(2),
+		`{"group":"Queen","song":"Bohemian Rhapsody","link":"https://example.com/queen","version":1}`, testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: status %d, body %s", w.Code, w.Body)
+	}
+	want := []purgeRequest{{methodPurge, cacheKeySongs}}
+	if len(*purged) != 1 || (*purged)[0] != want[0] {
+		t.Errorf("purge requests = %v, want %v", *purged, want)
+	}
+
+	// Чтение ничего не сбрасывает
+	*purged = nil
+	doRequest(router, http.MethodGet, "/songs", "")
+	if len(*purged) != 0 {
+		t.Errorf("read purged %v", *purged)
+	}
+}
+
+func TestWritePersistsWhenPurgeFails(t *testing.T) {
+	setupTestDB(t)
+	seedGoldenSongs(t)
+	router := newTestRouter()
+	purged := usePurgeServer(t, http.StatusBadGateway)
+
+	// Изменение уже сохранено, поэтому ошибка кеша только пишется в лог
+	w := doRequestAs(router, http.MethodPut, "/songs/"+encodeSongID(2),
+		`{"group":"Queen","song":"Bohemian Rhapsody","link":"https://example.com/queen","version":1}`, testAdminToken)
+	if w.Code != http.StatusOK || len(*purged) != 1 {
+		t.Fatalf("update: status %d, %d purge requests", w.Code, len(*purged))
+	}
+	var song Song
+	GetDB().First(&song, 2)
+	if song.Link != "https://example.com/queen" {
+		t.Errorf("link = %q after a failed purge", song.Link)
+	}
+}
+
+func TestPurgeCacheJob(t *testing.T) {
+	purged := usePurgeServer(t, http.StatusOK)
+	payload, _ := json.Marshal(cachePurgePayload{Keys: []string{cacheKeySongs, albumCacheKey(7)}})
+	if err := purgeCacheJob(context.Background(), payload); err != nil {
+		t.Fatalf("purge job: %v", err)
+	}
+	if len(*purged) != 1 || (*purged)[0].keys != "songs album-7" {
+		t.Errorf("purge requests = %v", *purged)
+	}
+
+	// Ошибка кеша возвращается, чтобы очередь повторила задачу
+	usePurgeServer(t, http.StatusServiceUnavailable)
+	if err := purgeCacheJob(context.Background(), payload); err == nil {
+		t.Error("purge job succeeded against a failing cache")
+	}
+}
@@ -0,0 +1,114 @@
+//go:build chaos
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ChaosRule описывает сбои, которые внедряются в маршрут.
+// Пустой Method подходит для любого метода.
+type ChaosRule struct {
+	Route                 string  `json:"route"`
+	Method                string  `json:"method"`
+	LatencyMs             int     `json:"latencyMs"`
+	LatencyJitterMs       int     `json:"latencyJitterMs"`
+	ErrorRate             float64 `json:"errorRate"`
+	ErrorStatus           int     `json:"errorStatus"`
+	EnrichmentFailureRate float64 `json:"enrichmentFailureRate"`
+	EnrichmentPartialRate float64 `json:"enrichmentPartialRate"`
+}
+
+const chaosRuleKey = "chaos_rule"
+
+var errChaosEnrichment = errors.New("chaos: injected enrichment failure")
+
+// chaosRules читает правила из CHAOS_RULES (JSON-массив ChaosRule)
+func chaosRules() []ChaosRule {
+	raw := os.Getenv("CHAOS_RULES")
+	if raw == "" {
+		return nil
+	}
+	var rules []ChaosRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		logrus.WithError(err).Error("Invalid CHAOS_RULES, fault injection disabled")
+		return nil
+	}
+	logrus.WithField("rules", len(rules)).Warn("Fault injection is enabled")
+	return rules
+}
+
+// Chaos внедряет задержки и ошибки согласно правилам. Доступно только
+// в сборке с тегом chaos.
+func Chaos() gin.HandlerFunc {
+	rules := chaosRules()
+	return func(c *gin.Context) {
+		rule := matchChaosRule(rules, c)
+		if rule == nil {
+			c.Next()
+			return
+		}
+		c.Set(chaosRuleKey, rule)
+
+		if rule.LatencyMs > 0 || rule.LatencyJitterMs > 0 {
+			delay := time.Duration(rule.LatencyMs) * time.Millisecond
+			if rule.LatencyJitterMs > 0 {
+				delay += time.Duration(rand.Intn(rule.LatencyJitterMs)) * time.Millisecond
+			}
+			time.Sleep(delay)
+		}
+
+		if rand.Float64() < rule.ErrorRate {
+			status := rule.ErrorStatus
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			c.Header("X-Chaos-Injected", "error")
+			abortWithError(c, status, statusErrorCode(status), "Injected failure")
+			return
+		}
+		c.Next()
+	}
+}
+
+func matchChaosRule(rules []ChaosRule, c *gin.Context) *ChaosRule {
+	for i := range rules {
+		if rules[i].Route == c.FullPath() && (rules[i].Method == "" || rules[i].Method == c.Request.Method) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// chaosEnrichment портит ответ внешнего API: целиком (ошибка) или частично
+// (случайные поля обнуляются)
+func chaosEnrichment(c *gin.Context, detail *SongDetail) error {
+	value, ok := c.Get(chaosRuleKey)
+	if !ok {
+		return nil
+	}
+	rule := value.(*ChaosRule)
+
+	if rand.Float64() < rule.EnrichmentFailureRate {
+		return errChaosEnrichment
+	}
+	if rand.Float64() < rule.EnrichmentPartialRate {
+		switch rand.Intn(3) {
+		case 0:
+			detail.ReleaseDate = ""
+		case 1:
+			detail.Text = ""
+		default:
+			detail.Link = ""
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !chaos
+
+package main
+
+import "github.com/gin-gonic/gin"
+
+// Chaos в обычной сборке ничего не делает
+func Chaos() gin.HandlerFunc {
+	return func(c *gin.Context) { c.Next() }
+}
+
+func chaosEnrichment(c *gin.Context, detail *SongDetail) error {
+	return nil
+}
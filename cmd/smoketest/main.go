@@ -0,0 +1,205 @@
+// Команда smoketest прогоняет сценарий добавления, поиска, изменения,
+// чтения текста и удаления песни против работающего экземпляра API
+// и завершается с ненулевым кодом при первой ошибке.
+//
+//	smoketest -url https://music.example.com -token $TOKEN
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// songID - ID песни в том виде, в каком его вернул API: число или
+// непрозрачная строка при включенных публичных ID; в путях годится любой
+type songID string
+
+func (id *songID) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	if s == "null" {
+		s = ""
+	}
+	*id = songID(s)
+	return nil
+}
+
+type song struct {
+	ID       songID `json:"id,omitempty"`
+	Group    string `json:"group"`
+	SongName string `json:"song"`
+	Link     string `json:"link"`
+	Version  int    `json:"version"` // PUT отклоняет правку без версии
+}
+
+type client struct {
+	baseURL string
+	token   string
+	apiKey  string
+	http    *http.Client
+}
+
+func (c *client) do(method, path string, body interface{}, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func expectStatus(got, want int, err error) error {
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("status %d, want %d", got, want)
+	}
+	return nil
+}
+
+func main() {
+	baseURL := flag.String("url", os.Getenv("SMOKETEST_URL"), "base URL of the deployment")
+	token := flag.String("token", os.Getenv("SMOKETEST_TOKEN"), "bearer token with editor role")
+	apiKey := flag.String("api-key", os.Getenv("SMOKETEST_API_KEY"), "API key with editor role")
+	timeout := flag.Duration("timeout", 15*time.Second, "per-request timeout")
+	flag.Parse()
+
+	if *baseURL == "" {
+		fmt.Fprintln(os.Stderr, "smoketest: -url is required")
+		os.Exit(2)
+	}
+
+	c := &client{
+		baseURL: strings.TrimSuffix(*baseURL, "/"),
+		token:   *token,
+		apiKey:  *apiKey,
+		http:    &http.Client{Timeout: *timeout},
+	}
+	if !run(c) {
+		os.Exit(1)
+	}
+}
+
+type step struct {
+	name string
+	fn   func() error
+}
+
+func run(c *client) bool {
+	created := song{
+		Group:    "Smoketest",
+		SongName: fmt.Sprintf("smoketest-%d", time.Now().UnixNano()),
+	}
+
+	steps := []step{{"add song", func() error {
+		status, err := c.do(http.MethodPost, "/songs", created, &created)
+		if err != nil {
+			return err
+		}
+		// 202 - песня сохранена, обогащение идет в очереди задач
+		if status != http.StatusCreated && status != http.StatusAccepted {
+			return fmt.Errorf("status %d, want 201 or 202", status)
+		}
+		if created.ID == "" {
+			return fmt.Errorf("response has no song id")
+		}
+		return nil
+	}}, {"search song", func() error {
+		query := url.Values{"group": {created.Group}, "song": {created.SongName}, "limit": {"100"}}
+		var found []song
+		status, err := c.do(http.MethodGet, "/songs?"+query.Encode(), nil, &found)
+		if err := expectStatus(status, http.StatusOK, err); err != nil {
+			return err
+		}
+		for _, s := range found {
+			if s.ID == created.ID {
+				return nil
+			}
+		}
+		return fmt.Errorf("song %s not found in search results", created.ID)
+	}}, {"update song", func() error {
+		update := created
+		update.Link = "https://example.com/smoketest"
+		status, err := c.do(http.MethodPut, fmt.Sprintf("/songs/%s", created.ID), update, nil)
+		return expectStatus(status, http.StatusOK, err)
+	}}, {"paginate lyrics", func() error {
+		for page := 1; page <= 2; page++ {
+			var text struct {
+				Text string `json:"text"`
+			}
+			path := fmt.Sprintf("/songs/%s/text?page=%d&limit=5", created.ID, page)
+			status, err := c.do(http.MethodGet, path, nil, &text)
+			if err := expectStatus(status, http.StatusOK, err); err != nil {
+				return fmt.Errorf("page %d: %w", page, err)
+			}
+		}
+		return nil
+	}}, {"delete song", func() error {
+		status, err := c.do(http.MethodDelete, fmt.Sprintf("/songs/%s", created.ID), nil, nil)
+		if err := expectStatus(status, http.StatusOK, err); err != nil {
+			return err
+		}
+		created.ID = ""
+		return nil
+	}}}
+
+	for _, s := range steps {
+		start := time.Now()
+		err := s.fn()
+		elapsed := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			fmt.Printf("FAIL %-20s %8s  %v\n", s.name, elapsed, err)
+			// Не оставляем тестовые данные после сбоя
+			if created.ID != "" {
+				c.do(http.MethodDelete, fmt.Sprintf("/songs/%s", created.ID), nil, nil)
+			}
+			return false
+		}
+		fmt.Printf("ok   %-20s %8s\n", s.name, elapsed)
+	}
+	return true
+}
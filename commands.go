@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Версия сборки, задается при компиляции: -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// command - подкоманда бинарника: musik_api <команда> [флаги]
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{name: "serve", usage: "run the HTTP API (default)", run: runServe},
+	{name: "migrate", usage: "apply database migrations and exit", run: runMigrate},
+	{name: "seed", usage: "load fixture songs into the database", run: runSeed},
+	{name: "openapi", usage: "print the embedded OpenAPI spec", run: runOpenAPI},
+	{name: "version", usage: "print the build version", run: runVersion},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: musik_api [command] [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+// loadEnvironment читает .env, если он есть, и настраивает логирование.
+// В контейнере настройки приходят из окружения, и .env не нужен.
+func loadEnvironment() (Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Config{}, fmt.Errorf("error loading .env file: %w", err)
+	}
+	cfg := LoadConfig()
+	if err := setupLogging(cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// openDatabase подключается к базе и регистрирует плагины GORM
+func openDatabase(cfg Config) (*gorm.DB, error) {
+	conn, err := gorm.Open(postgres.Open(cfg.DatabaseURL), &gorm.Config{
+		PrepareStmt: cfg.PrepareStmt,
+		Logger:      newSQLLogger(cfg.SQLLog),
+		// Нарушение уникальности приходит как gorm.ErrDuplicatedKey
+		TranslateError: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if cfg.ReplicaURL != "" {
+		if err := useReadReplica(conn, cfg.ReplicaURL); err != nil {
+			return nil, fmt.Errorf("failed to connect to read replica: %w", err)
+		}
+	}
+	if err := conn.Use(stmtCache); err != nil {
+		return nil, err
+	}
+	if err := conn.Use(queryCounting{}); err != nil {
+		return nil, err
+	}
+	if tracerProvider != nil {
+		if err := conn.Use(tracingPlugin{}); err != nil {
+			return nil, err
+		}
+	}
+	postgresDep := dependencies.Track("postgres", dependencyDatabase)
+	if err := conn.Use(dependencyTiming{m: postgresDep}); err != nil {
+		return nil, err
+	}
+	postgresDep.SetProbe(func(ctx context.Context) error {
+		sqlDB, err := conn.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	})
+	return conn, nil
+}
+
+// runServe запускает HTTP API
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	migrate := flags.Bool("migrate", true, "apply migrations before serving")
+	flags.Parse(args)
+
+	gin.SetMode(gin.ReleaseMode)
+	cfg, err := loadEnvironment()
+	if err != nil {
+		return err
+	}
+
+	// Трассировка настраивается первой: база и клиенты внешних API
+	// подключают ее при создании
+	if err := SetupTracing(context.Background(), cfg.Tracing); err != nil {
+		return err
+	}
+	defer func() {
+		if err := ShutdownTracing(context.Background()); err != nil {
+			logrus.WithError(err).Warn("Failed to flush traces")
+		}
+	}()
+
+	if err := SetupErrorTracking(cfg.ErrorTracking); err != nil {
+		return err
+	}
+	defer FlushErrorTracking()
+
+	db, err = openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB() // Получение базового соединения *sql.DB
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	if *migrate {
+		if err := Migrate(db); err != nil {
+			return err
+		}
+	}
+
+	// Песни могут жить в другом хранилище; пользователи, ключи и задачи - всегда в SQL
+	songStore, err = NewSongStore(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to set up song storage: %w", err)
+	}
+	if songStore != nil {
+		defer songStore.Close(context.Background())
+	}
+
+	oidcAuth, err = NewOIDCAuth(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+
+	profanity, err = LoadProfanityFilter(cfg.ProfanityDir)
+	if err != nil {
+		return fmt.Errorf("failed to load profanity wordlists: %w", err)
+	}
+
+	recordings = newRecordingBuffer(cfg.RecordLimit)
+	submissionAudioLimit = cfg.SubmissionAudioMaxBytes
+	restoreMaxBytes = cfg.RestoreMaxBytes
+	if cfg.LyricsPageSize < 1 || cfg.LyricsMaxPageSize < cfg.LyricsPageSize {
+		return fmt.Errorf("invalid lyrics page size: default %d, max %d", cfg.LyricsPageSize, cfg.LyricsMaxPageSize)
+	}
+	lyricsPageSize, lyricsMaxPageSize = cfg.LyricsPageSize, cfg.LyricsMaxPageSize
+	if cfg.BatchMaxSongs < 1 {
+		return fmt.Errorf("invalid batch size limit %d", cfg.BatchMaxSongs)
+	}
+	batchMaxSongs = cfg.BatchMaxSongs
+	if cfg.InsertBatchSize < 1 {
+		return fmt.Errorf("invalid insert batch size %d", cfg.InsertBatchSize)
+	}
+	insertBatchSize = cfg.InsertBatchSize
+	emptySongs404 = cfg.EmptySongs404
+
+	enrichment, err = NewEnrichmentProvider(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to set up enrichment provider: %w", err)
+	}
+
+	lastfm = NewLastFMClient(cfg.LastFM)
+	youtube = NewYouTubeClient(cfg.YouTube)
+	songLinks, err = NewLinkResolver(cfg.LinkProviders)
+	if err != nil {
+		return fmt.Errorf("failed to set up link providers: %w", err)
+	}
+
+	jwtKeys, err = ParseJWTKeys(cfg.JWTKeys, cfg.JWTActiveKey, cfg.JWTTTL)
+	if err != nil {
+		return fmt.Errorf("invalid JWT key configuration: %w", err)
+	}
+
+	trustedProxies, err = ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	rateLimiter, err = NewRateLimiter(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to set up rate limiter: %w", err)
+	}
+	if cfg.ResponseCache.Enabled {
+		client, err := NewRedisClient(cfg.RedisURL)
+		if err != nil {
+			return fmt.Errorf("failed to set up response cache: %w", err)
+		}
+		responseCache = NewResponseCache(client, cfg.ResponseCache)
+	}
+	songTextCache = NewSongTextCache(cfg.SongTextCache)
+	songCountCache = NewSongCountCache(cfg.SongCountTTL)
+
+	scrapers = NewScraperDetector(cfg.Scraper)
+	routeLimits, err = ParseRouteLimits(cfg.RouteLimits)
+	if err != nil {
+		return err
+	}
+	regionRules, err = ParseRegionRules(cfg.RegionRules, cfg.RegionHeader)
+	if err != nil {
+		return err
+	}
+	publicIDs, err = NewIDCodec(cfg.IDCodec, cfg.IDCodecSecret)
+	if err != nil {
+		return err
+	}
+	accessLog, err = NewAccessLog(cfg.AccessLog)
+	if err != nil {
+		return err
+	}
+	defer accessLog.Close()
+	if cfg.OpenAPIValidation {
+		requestSpec, err = LoadRequestSpec(swaggerSpec)
+		if err != nil {
+			return err
+		}
+	}
+
+	// SIGINT/SIGTERM останавливают сервер, воркеры и буфер событий
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobs = NewJobQueue(db, cfg.Jobs)
+	jobs.Register(jobKindEnrichment, enrichSongJob(enrichment))
+	jobs.Register(jobKindScheduledChange, applyScheduledChangeJob)
+	jobs.Register(jobKindSongPurge, purgeDeletedSongsJob(cfg.SongRetention))
+	jobs.Register(jobKindRestore, restoreJob)
+	if cfg.SongRetention > 0 {
+		scheduleSongPurge(ctx, jobs)
+	}
+	if lastfm != nil {
+		jobs.Register(jobKindLastFMRefresh, refreshStatsJob)
+	}
+	if songLinks != nil {
+		jobs.Register(jobKindLinksResolve, resolveLinksJob)
+	}
+	webhookHTTP = &http.Client{Timeout: cfg.WebhookTimeout}
+	jobs.Register(jobKindWebhookDelivery, deliverWebhookJob)
+	notifier = NewNotificationDispatcher(cfg.Notifications)
+	jobs.Register(jobKindNotification, notifier.deliver)
+	cachePurger = NewCachePurger(cfg.Cache)
+	if cachePurger != nil {
+		jobs.Register(jobKindCachePurge, purgeCacheJob)
+	}
+	jobs.Start(ctx)
+
+	events = NewEventBuffer(db, cfg.EventBatchSize, cfg.EventFlushInterval)
+	events.Start(ctx)
+
+	if cfg.GRPCPort != "" {
+		// gRPC работает через тот же репозиторий песен, что и HTTP
+		store := songStore
+		if store == nil {
+			store = newSQLSongStore(db)
+		}
+		grpcServer := newGRPCServer(cfg.AdminToken, store)
+		go func() {
+			if err := serveGRPC(ctx, cfg.GRPCPort, grpcServer); err != nil {
+				logrus.WithError(err).Error("gRPC server stopped")
+				stop()
+			}
+		}()
+	}
+
+	if cfg.DebugAddr != "" {
+		go func() {
+			if err := serveDebug(ctx, cfg.DebugAddr); err != nil {
+				logrus.WithError(err).Error("Debug server stopped")
+			}
+		}()
+	}
+
+	router := setupRouter(cfg)
+	err = serve(ctx, cfg, router)
+	stop()
+	jobs.Wait()
+	events.Wait()
+	return err
+}
+
+// runMigrate применяет миграции; удобно запускать отдельным шагом деплоя
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dedupe := flags.Bool("dedupe-songs", false, "delete all but the earliest of songs with the same group and title before adding the unique index")
+	flags.Parse(args)
+
+	cfg, err := loadEnvironment()
+	if err != nil {
+		return err
+	}
+	db, err = openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	if *dedupe && db.Migrator().HasTable(&Song{}) {
+		deleted, err := dedupeSongs(db)
+		if err != nil {
+			return fmt.Errorf("failed to delete duplicate songs: %w", err)
+		}
+		fmt.Printf("Deleted %d duplicate songs\n", deleted)
+	}
+	if err := Migrate(db); err != nil {
+		return err
+	}
+	fmt.Println("Migrations applied")
+	return nil
+}
+
+// runSeed загружает песни из встроенных фикстур или из файла -file
+func runSeed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	file := flags.String("file", "", "JSON file with songs (default: embedded fixtures)")
+	flags.Parse(args)
+
+	cfg, err := loadEnvironment()
+	if err != nil {
+		return err
+	}
+	db, err = openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	profanity, err = LoadProfanityFilter(cfg.ProfanityDir)
+	if err != nil {
+		return fmt.Errorf("failed to load profanity wordlists: %w", err)
+	}
+
+	var data []byte
+	if *file != "" {
+		data, err = os.ReadFile(*file)
+	} else {
+		data, err = seedFiles.ReadFile("assets/seed/songs.json")
+	}
+	if err != nil {
+		return err
+	}
+	added, err := seedSongs(db, data)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Seeded %d songs\n", added)
+	return nil
+}
+
+// runOpenAPI печатает спецификацию, например для генерации клиентов
+func runOpenAPI(args []string) error {
+	_, err := io.WriteString(os.Stdout, swaggerSpec)
+	return err
+}
+
+func runVersion(args []string) error {
+	fmt.Println(version)
+	return nil
+}
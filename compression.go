@@ -0,0 +1,201 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	encodingGzip   = "gzip"
+	encodingBrotli = "br"
+)
+
+// CompressionConfig - сжатие ответов
+type CompressionConfig struct {
+	Enabled bool
+	MinSize int  // ответы короче отдаются как есть: сжатие их почти не уменьшает
+	Brotli  bool // предлагать br клиентам, которые его принимают
+}
+
+// compressor - общее у gzip.Writer и brotli.Writer
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Сжимающие писатели переиспользуются: у каждого внутренние буферы в
+// десятки килобайт
+var compressorPools = map[string]*sync.Pool{
+	encodingGzip: {New: func() interface{} {
+		zw, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return zw
+	}},
+	encodingBrotli: {New: func() interface{} { return brotli.NewWriterLevel(nil, brotli.DefaultCompression) }},
+}
+
+// Compression сжимает ответы по Accept-Encoding. Тело копится до MinSize,
+// и только потом решается, сжимать ли его, поэтому Content-Length короткого
+// ответа не теряется. Не сжимаются уже сжатые ответы, двоичные типы и
+// потоки событий; соединения WebSocket пропускаются целиком. Подключается
+// первым, чтобы сжимать окончательное тело после всех остальных middleware.
+func Compression(cfg CompressionConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"), cfg.Brotli)
+		if encoding == "" || c.Request.Method == http.MethodHead || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minSize: cfg.MinSize}
+		c.Writer = w
+		defer w.finish()
+		c.Next()
+	}
+}
+
+// negotiateEncoding выбирает кодировку с наибольшим q; при равном q br
+// предпочтительнее gzip, потому что сжимает текст сильнее
+func negotiateEncoding(header string, withBrotli bool) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if raw, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(raw, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch name {
+		case encodingGzip:
+		case encodingBrotli:
+			if !withBrotli {
+				continue
+			}
+		case "*":
+			name = encodingGzip
+		default:
+			continue
+		}
+		if q > bestQ || (q == bestQ && q > 0 && name == encodingBrotli) {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressibleType - текстовые форматы; картинки, аудио, архивы и xlsx
+// уже сжаты. Поток событий не сжимается: сжатие задерживает события.
+func compressibleType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "xml"),
+		mediaType == "application/javascript":
+		return true
+	}
+	return false
+}
+
+// compressWriter копит начало тела и сжимает ответ, если он достаточно
+// длинный и подходящего типа
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+
+	buf     []byte
+	started bool
+	zw      compressor // nil - тело пишется как есть
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minSize {
+			return len(b), nil
+		}
+		if err := w.start(false); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.zw != nil {
+		return w.zw.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written учитывает накопленное тело: для остальных middleware ответ уже
+// начат
+func (w *compressWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+// Flush отправляет накопленное: потоковый ответ сжимается, не дожидаясь
+// MinSize
+func (w *compressWriter) Flush() {
+	if !w.started {
+		if err := w.start(true); err != nil {
+			return
+		}
+	}
+	if w.zw != nil {
+		w.zw.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// start решает, сжимать ли ответ, и отправляет накопленное тело
+func (w *compressWriter) start(flushing bool) error {
+	w.started = true
+	h := w.Header()
+	if compressibleType(h.Get("Content-Type")) {
+		h.Add("Vary", "Accept-Encoding")
+		if (flushing || len(w.buf) >= w.minSize) && h.Get("Content-Encoding") == "" && !w.ResponseWriter.Written() {
+			h.Set("Content-Encoding", w.encoding)
+			h.Del("Content-Length")
+			w.zw = compressorPools[w.encoding].Get().(compressor)
+			w.zw.Reset(w.ResponseWriter)
+		}
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.zw != nil {
+		_, err := w.zw.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish дописывает короткий ответ или закрывает сжатый поток
+func (w *compressWriter) finish() {
+	if !w.started {
+		w.start(false)
+	}
+	if w.zw != nil {
+		w.zw.Close()
+		w.zw.Reset(io.Discard)
+		compressorPools[w.encoding].Put(w.zw)
+		w.zw = nil
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config хранит настройки сервиса, прочитанные из окружения
+type Config struct {
+	Port         string
+	GRPCPort     string // внутренний gRPC SongService; пусто - выключен
+	DatabaseURL  string
+	ReplicaURL   string // реплика для GET /songs и /songs/:id/text; пусто - все запросы к основной базе
+	PrepareStmt  bool   // кешировать подготовленные выражения
+	QueryBudget  int    // больше запросов к базе на один HTTP-запрос - предупреждение в логе; 0 - не считать
+	LogFormat    string // text или json
+	LogLevel     string // начальный уровень; меняется через PUT /admin/log-level
+	AdminToken   string // статический токен с ролью admin для первоначальной настройки
+	ProfanityDir string // каталог со списками слов <язык>.txt
+	RecordLimit  int    // размер буфера записей запросов
+	DebugAddr    string // pprof и expvar без аутентификации, например localhost:6060; пусто - только /admin/debug
+
+	Branding  BrandingConfig  // оформление для GET /meta
+	SQLLog    SQLLogConfig    // журнал SQL-запросов в logrus
+	AccessLog AccessLogConfig // формат и место журнала доступа
+
+	StorageBackend string // sql или mongo (экспериментально, только /songs)
+	Mongo          MongoConfig
+
+	EnrichmentProvider string           // цепочка через запятую в порядке опроса: info, spotify, musicbrainz, genius
+	EnrichmentFallback string           // дописывается в конец цепочки; оставлено для старых конфигураций
+	Info               InfoClientConfig // внешний API с данными о песнях
+	Spotify            SpotifyConfig
+	MusicBrainz        MusicBrainzConfig
+	LyricsProvider     string // genius; дописывается в конец цепочки, если его там нет
+	Genius             GeniusConfig
+	LastFM             LastFMConfig        // теги и слушатели; без LASTFM_API_KEY выключено
+	YouTube            YouTubeConfig       // поиск ссылки, если источник ее не вернул; без YOUTUBE_API_KEY выключен
+	LinkProviders      LinkProvidersConfig // ссылки на Spotify, Apple Music, Deezer и другие площадки
+	Tracing            TracingConfig       // OpenTelemetry; без OTEL_EXPORTER_OTLP_ENDPOINT выключена
+	ErrorTracking      ErrorTrackingConfig // Sentry; без SENTRY_DSN выключено
+
+	JWTKeys      string        // ключи подписи: kid1:secret1,kid2:secret2
+	JWTActiveKey string        // kid ключа, которым подписываются новые токены
+	JWTTTL       time.Duration // время жизни access-токена
+	AuthReadsToo bool          // требовать токен и для чтения
+
+	OIDCIssuer       string // URL провайдера; пустой - вход через OIDC отключен
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string // адрес /auth/oidc/callback этого сервиса
+
+	RedisURL         string
+	TrustedProxies   string // адреса и подсети обратных прокси через запятую; только от них берется X-Forwarded-For, пусто - клиент это адрес соединения
+	RateLimitBackend string // memory или redis
+	RateLimitIP      RateLimit
+	RateLimitKey     RateLimit
+	Scraper          ScraperConfig // обнаружение парсеров; без SCRAPER_DETECTION выключено
+
+	RouteLimits       string     // JSON-массив RouteLimit
+	DefaultRouteLimit RouteLimit // для маршрутов без своих правил
+
+	TLSCertFile      string
+	TLSKeyFile       string
+	AutocertDomains  string // через запятую; включает ACME и порты 80/443
+	AutocertCacheDir string
+	AutocertEmail    string
+
+	Jobs                    JobQueueConfig
+	WebhookTimeout          time.Duration // на одну доставку события подписчику
+	SubmissionAudioMaxBytes int64         // максимальный размер аудио в заявке артиста
+	RestoreMaxBytes         int64         // максимальный размер выгрузки в POST /admin/import
+	LyricsPageSize          int           // символов на странице текста без ?limit=
+	LyricsMaxPageSize       int           // больше ?limit= урезается до этого значения
+	BatchMaxSongs           int           // максимальный размер пакета POST /songs/batch
+	InsertBatchSize         int           // строк в одном INSERT при импорте и пакетном добавлении
+	SongRetention           time.Duration // сколько хранятся удаленные песни до окончательного удаления; 0 - не удалять
+	RegionRules             string        // JSON-массив RegionRule; пусто - без ограничений по регионам
+	RegionHeader            string        // заголовок с регионом клиента, обычно от CDN
+	OpenAPIValidation       bool          // отвечать 400 на запросы, не соответствующие спецификации
+	IDCodec                 string        // none или opaque: форма ID песен в ответах
+	IDCodecSecret           string        // ключ кодека opaque; смена ключа меняет все публичные ID
+	Notifications           NotificationsConfig
+	Cache                   CacheConfig // заголовки для CDN и инвалидация по Surrogate-Key
+
+	ResponseCache ResponseCacheConfig // кеш GET /songs и текстов песен в Redis (REDIS_URL)
+	SongTextCache SongTextCacheConfig // LRU текстов песен в памяти процесса
+	Compression   CompressionConfig   // gzip и br по Accept-Encoding
+	SongCountTTL  time.Duration       // сколько хранится meta.total списка JSON:API; 0 - COUNT(*) на каждой странице
+	EmptySongs404 bool                // прежний ответ 404 на пустой список GET /songs вместо 200 с []
+
+	EventBatchSize     int           // сколько событий писать одной пачкой
+	EventFlushInterval time.Duration // максимальная задержка записи события
+}
+
+func LoadConfig() Config {
+	return Config{
+		Port:         getEnv("PORT", "8080"),
+		GRPCPort:     os.Getenv("GRPC_PORT"),
+		DatabaseURL:  os.Getenv("DATABASE_URL"),
+		ReplicaURL:   os.Getenv("DATABASE_REPLICA_URL"),
+		PrepareStmt:  getEnvBool("DB_PREPARE_STMT", true),
+		QueryBudget:  getEnvInt("QUERY_BUDGET", 0),
+		LogFormat:    getEnv("LOG_FORMAT", "text"),
+		LogLevel:     getEnv("LOG_LEVEL", "info"),
+		AdminToken:   os.Getenv("ADMIN_TOKEN"),
+		ProfanityDir: os.Getenv("PROFANITY_DIR"),
+		RecordLimit:  getEnvInt("RECORD_LIMIT", defaultRecordLimit),
+		DebugAddr:    os.Getenv("DEBUG_ADDR"),
+
+		Branding: BrandingConfig{
+			CatalogName: getEnv("BRANDING_CATALOG_NAME", "Musik"),
+			Operator:    os.Getenv("BRANDING_OPERATOR"),
+			Contact:     os.Getenv("BRANDING_CONTACT"),
+			TermsURL:    os.Getenv("BRANDING_TERMS_URL"),
+			Flags:       os.Getenv("BRANDING_FLAGS"),
+		},
+		SQLLog: SQLLogConfig{
+			SlowThreshold: getEnvDuration("SLOW_QUERY_THRESHOLD", 200*time.Millisecond),
+			LogParams:     getEnvBool("LOG_QUERY_PARAMS", false),
+		},
+		AccessLog: AccessLogConfig{
+			Format:     getEnv("ACCESS_LOG_FORMAT", accessLogLogrus),
+			File:       os.Getenv("ACCESS_LOG_FILE"),
+			MaxSizeMB:  getEnvInt("ACCESS_LOG_MAX_SIZE_MB", 100),
+			MaxBackups: getEnvInt("ACCESS_LOG_MAX_BACKUPS", 7),
+			MaxAgeDays: getEnvInt("ACCESS_LOG_MAX_AGE_DAYS", 0),
+			Compress:   getEnvBool("ACCESS_LOG_COMPRESS", false),
+		},
+
+		StorageBackend: getEnv("STORAGE_BACKEND", storageSQL),
+		Mongo: MongoConfig{
+			URI:      os.Getenv("MONGO_URI"),
+			Database: getEnv("MONGO_DATABASE", "musik"),
+			Timeout:  getEnvDuration("MONGO_CONNECT_TIMEOUT", 10*time.Second),
+		},
+
+		EnrichmentProvider: getEnv("ENRICHMENT_PROVIDER", providerInfo),
+		EnrichmentFallback: os.Getenv("ENRICHMENT_FALLBACK"),
+		Info: InfoClientConfig{
+			BaseURL:          os.Getenv("EXTERNAL_API_URL"),
+			Timeout:          getEnvDuration("EXTERNAL_API_TIMEOUT", 5*time.Second),
+			Deadline:         getEnvDuration("EXTERNAL_API_DEADLINE", 10*time.Second),
+			Retries:          getEnvInt("EXTERNAL_API_RETRIES", 2),
+			RetryBackoff:     getEnvDuration("EXTERNAL_API_RETRY_BACKOFF", 200*time.Millisecond),
+			BreakerThreshold: getEnvInt("EXTERNAL_API_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:  getEnvDuration("EXTERNAL_API_BREAKER_COOLDOWN", 30*time.Second),
+		},
+		Spotify: SpotifyConfig{
+			ClientID:     os.Getenv("SPOTIFY_CLIENT_ID"),
+			ClientSecret: os.Getenv("SPOTIFY_CLIENT_SECRET"),
+			Market:       os.Getenv("SPOTIFY_MARKET"),
+			APIURL:       os.Getenv("SPOTIFY_API_URL"),
+			TokenURL:     os.Getenv("SPOTIFY_TOKEN_URL"),
+			Timeout:      getEnvDuration("SPOTIFY_TIMEOUT", 5*time.Second),
+		},
+		MusicBrainz: MusicBrainzConfig{
+			Contact:  os.Getenv("MUSICBRAINZ_CONTACT"),
+			APIURL:   os.Getenv("MUSICBRAINZ_API_URL"),
+			Interval: getEnvDuration("MUSICBRAINZ_INTERVAL", time.Second),
+			Timeout:  getEnvDuration("MUSICBRAINZ_TIMEOUT", 5*time.Second),
+		},
+		LyricsProvider: os.Getenv("LYRICS_PROVIDER"),
+		Genius: GeniusConfig{
+			Token:     os.Getenv("GENIUS_TOKEN"),
+			APIURL:    os.Getenv("GENIUS_API_URL"),
+			Timeout:   getEnvDuration("GENIUS_TIMEOUT", 5*time.Second),
+			CacheTTL:  getEnvDuration("GENIUS_CACHE_TTL", 24*time.Hour),
+			CacheSize: getEnvInt("GENIUS_CACHE_SIZE", 1000),
+		},
+		LastFM: LastFMConfig{
+			APIKey:  os.Getenv("LASTFM_API_KEY"),
+			APIURL:  os.Getenv("LASTFM_API_URL"),
+			Timeout: getEnvDuration("LASTFM_TIMEOUT", 5*time.Second),
+			MaxTags: getEnvInt("LASTFM_MAX_TAGS", 5),
+		},
+		YouTube: YouTubeConfig{
+			APIKey:        os.Getenv("YOUTUBE_API_KEY"),
+			APIURL:        os.Getenv("YOUTUBE_API_URL"),
+			Timeout:       getEnvDuration("YOUTUBE_TIMEOUT", 5*time.Second),
+			MinConfidence: getEnvFloat("YOUTUBE_MIN_CONFIDENCE", 0.5),
+		},
+		LinkProviders: LinkProvidersConfig{
+			Providers: os.Getenv("LINK_PROVIDERS"),
+			Odesli: OdesliConfig{
+				APIKey: os.Getenv("ODESLI_API_KEY"),
+				APIURL: os.Getenv("ODESLI_API_URL"),
+			},
+			DeezerURL: os.Getenv("DEEZER_API_URL"),
+			ITunesURL: os.Getenv("ITUNES_API_URL"),
+			Country:   os.Getenv("LINK_PROVIDERS_COUNTRY"),
+			Timeout:   getEnvDuration("LINK_PROVIDERS_TIMEOUT", 5*time.Second),
+		},
+		Tracing: TracingConfig{
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "musik_api"),
+			SampleRatio: getEnvFloat("TRACE_SAMPLE_RATIO", 1),
+		},
+		ErrorTracking: ErrorTrackingConfig{
+			DSN:         os.Getenv("SENTRY_DSN"),
+			Environment: os.Getenv("SENTRY_ENVIRONMENT"),
+			SampleRate:  getEnvFloat("SENTRY_SAMPLE_RATE", 1),
+		},
+
+		JWTKeys:      os.Getenv("JWT_KEYS"),
+		JWTActiveKey: os.Getenv("JWT_ACTIVE_KEY"),
+		JWTTTL:       getEnvDuration("JWT_TTL", 15*time.Minute),
+		AuthReadsToo: getEnvBool("AUTH_REQUIRE_READS", false),
+
+		OIDCIssuer:       os.Getenv("OIDC_ISSUER"),
+		OIDCClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+
+		RedisURL:         os.Getenv("REDIS_URL"),
+		TrustedProxies:   os.Getenv("TRUSTED_PROXIES"),
+		RateLimitBackend: getEnv("RATE_LIMIT_BACKEND", "memory"),
+		RateLimitIP: RateLimit{
+			Rate:  getEnvFloat("RATE_LIMIT_IP_RPS", 10),
+			Burst: getEnvInt("RATE_LIMIT_IP_BURST", 20),
+		},
+		RateLimitKey: RateLimit{
+			Rate:  getEnvFloat("RATE_LIMIT_KEY_RPS", 50),
+			Burst: getEnvInt("RATE_LIMIT_KEY_BURST", 100),
+		},
+		Scraper: ScraperConfig{
+			Enabled:    getEnvBool("SCRAPER_DETECTION", false),
+			Window:     getEnvDuration("SCRAPER_WINDOW", time.Minute),
+			BurstLimit: getEnvInt("SCRAPER_BURST_LIMIT", 300),
+			WalkLimit:  getEnvInt("SCRAPER_WALK_LIMIT", 20),
+			ThrottleRate: RateLimit{
+				Rate:  getEnvFloat("SCRAPER_THROTTLE_RPS", 1),
+				Burst: getEnvInt("SCRAPER_THROTTLE_BURST", 5),
+			},
+			BlockFor:         getEnvDuration("SCRAPER_BLOCK_FOR", time.Hour),
+			Cooldown:         getEnvDuration("SCRAPER_COOLDOWN", 15*time.Minute),
+			Whitelist:        os.Getenv("SCRAPER_WHITELIST"),
+			CaptchaVerifyURL: os.Getenv("SCRAPER_CAPTCHA_VERIFY_URL"),
+			CaptchaSecret:    os.Getenv("SCRAPER_CAPTCHA_SECRET"),
+			CaptchaTimeout:   getEnvDuration("SCRAPER_CAPTCHA_TIMEOUT", 5*time.Second),
+		},
+
+		RouteLimits: os.Getenv("ROUTE_LIMITS"),
+		DefaultRouteLimit: RouteLimit{
+			Timeout:       Duration(getEnvDuration("DEFAULT_ROUTE_TIMEOUT", 30*time.Second)),
+			MaxConcurrent: getEnvInt("DEFAULT_ROUTE_MAX_CONCURRENT", 0),
+		},
+
+		TLSCertFile:      os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:       os.Getenv("TLS_KEY_FILE"),
+		AutocertDomains:  os.Getenv("AUTOCERT_DOMAINS"),
+		AutocertCacheDir: getEnv("AUTOCERT_CACHE_DIR", "certs"),
+		AutocertEmail:    os.Getenv("AUTOCERT_EMAIL"),
+
+		Jobs: JobQueueConfig{
+			Workers:      getEnvInt("JOB_WORKERS", 4),
+			Visibility:   getEnvDuration("JOB_VISIBILITY_TIMEOUT", 5*time.Minute),
+			PollInterval: getEnvDuration("JOB_POLL_INTERVAL", time.Second),
+			MaxDepth:     getEnvInt("JOB_MAX_QUEUE", 10000),
+			MaxAttempts:  getEnvInt("JOB_MAX_ATTEMPTS", 5),
+		},
+		WebhookTimeout:          getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		SubmissionAudioMaxBytes: int64(getEnvInt("SUBMISSION_AUDIO_MAX_BYTES", 20<<20)),
+		RestoreMaxBytes:         int64(getEnvInt("RESTORE_MAX_BYTES", 512<<20)),
+		LyricsPageSize:          getEnvInt("LYRICS_PAGE_SIZE", 10),
+		LyricsMaxPageSize:       getEnvInt("LYRICS_MAX_PAGE_SIZE", 10000),
+		BatchMaxSongs:           getEnvInt("BATCH_MAX_SONGS", 1000),
+		InsertBatchSize:         getEnvInt("INSERT_BATCH_SIZE", 500),
+		SongRetention:           getEnvDuration("SONG_RETENTION", 30*24*time.Hour),
+		RegionRules:             os.Getenv("REGION_RULES"),
+		RegionHeader:            getEnv("REGION_HEADER", "X-Region"),
+		OpenAPIValidation:       getEnvBool("OPENAPI_VALIDATION", true),
+		IDCodec:                 getEnv("ID_CODEC", idCodecNone),
+		IDCodecSecret:           os.Getenv("ID_CODEC_SECRET"),
+		Notifications: NotificationsConfig{
+			SMTPAddr:       os.Getenv("SMTP_ADDR"),
+			SMTPFrom:       os.Getenv("SMTP_FROM"),
+			SMTPUsername:   os.Getenv("SMTP_USERNAME"),
+			SMTPPassword:   os.Getenv("SMTP_PASSWORD"),
+			PushGatewayURL: os.Getenv("PUSH_GATEWAY_URL"),
+			TelegramToken:  os.Getenv("TELEGRAM_BOT_TOKEN"),
+			TelegramAPIURL: os.Getenv("TELEGRAM_API_URL"),
+			Timeout:        getEnvDuration("NOTIFICATION_TIMEOUT", 10*time.Second),
+		},
+		Cache: CacheConfig{
+			MaxAge:       getEnvDuration("CACHE_MAX_AGE", 0),
+			SharedMaxAge: getEnvDuration("CACHE_SHARED_MAX_AGE", time.Minute),
+			PurgeURL:     os.Getenv("CACHE_PURGE_URL"),
+			Timeout:      getEnvDuration("CACHE_PURGE_TIMEOUT", 5*time.Second),
+		},
+		ResponseCache: ResponseCacheConfig{
+			Enabled:  getEnvBool("RESPONSE_CACHE_ENABLED", false),
+			SongsTTL: getEnvDuration("RESPONSE_CACHE_SONGS_TTL", time.Minute),
+			SongTTL:  getEnvDuration("RESPONSE_CACHE_SONG_TTL", 10*time.Minute),
+		},
+		SongTextCache: SongTextCacheConfig{
+			MaxBytes: getEnvInt("SONG_TEXT_CACHE_BYTES", 0),
+			TTL:      getEnvDuration("SONG_TEXT_CACHE_TTL", 5*time.Minute),
+		},
+		Compression: CompressionConfig{
+			Enabled: getEnvBool("COMPRESSION_ENABLED", true),
+			MinSize: getEnvInt("COMPRESSION_MIN_SIZE", 1024),
+			Brotli:  getEnvBool("COMPRESSION_BROTLI", false),
+		},
+		SongCountTTL:  getEnvDuration("SONG_COUNT_TTL", 30*time.Second),
+		EmptySongs404: getEnvBool("EMPTY_SONGS_404", false),
+
+		EventBatchSize:     getEnvInt("EVENT_BATCH_SIZE", 500),
+		EventFlushInterval: getEnvDuration("EVENT_FLUSH_INTERVAL", 5*time.Second),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Маршрут профилей pprof в группе /admin
+const debugPprofRoute = "/admin/debug/pprof/*profile"
+
+// @Summary Runtime profiles
+// @Description net/http/pprof under admin auth: the index at /admin/debug/pprof/, CPU profile (profile?seconds=30), execution trace (trace?seconds=5), cmdline, symbol and named profiles such as heap, goroutine, allocs, block and mutex. Profiles and traces run for the requested seconds; the default route timeout does not apply to them.
+// @ID debug-pprof
+// @Produce  octet-stream
+// @Param profile path string true "Profile name; empty for the index"
+// @Param seconds query int false "Duration for profile and trace"
+// @Param debug query int false "1 or 2 for a text profile instead of protobuf"
+// @Success 200 {file} file
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Router /admin/debug/pprof/{profile} [get]
+func DebugPprof(c *gin.Context) {
+	// pprof.Index выводит имя профиля из пути /debug/pprof/..., а у нас
+	// префикс другой, поэтому профиль выбирается здесь
+	switch name := strings.TrimPrefix(c.Param("profile"), "/"); name {
+	case "":
+		pprof.Index(c.Writer, c.Request)
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// @Summary Runtime variables
+// @Description expvar: memstats, cmdline and any published variables as JSON.
+// @ID debug-vars
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Router /admin/debug/vars [get]
+func DebugVars(c *gin.Context) {
+	expvar.Handler().ServeHTTP(c.Writer, c.Request)
+}
+
+// serveDebug отдает pprof и expvar без аутентификации на отдельном адресе,
+// например localhost:6060, недоступном снаружи. Импорт net/http/pprof и
+// expvar регистрирует их в http.DefaultServeMux, основной сервер его не
+// использует.
+func serveDebug(ctx context.Context, addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: http.DefaultServeMux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	logrus.WithField("addr", lis.Addr().String()).Warn("Serving debug endpoints without authentication")
+	if err := server.Serve(lis); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Виды внешних зависимостей в отчете
+const (
+	dependencyDatabase   = "database"
+	dependencyCache      = "cache"
+	dependencyEnrichment = "enrichment"
+	dependencyCaptcha    = "captcha"
+)
+
+// Состояние зависимости в отчете
+const (
+	dependencyOK       = "ok"
+	dependencyDegraded = "degraded"
+	dependencyDown     = "down"
+)
+
+const (
+	// Вызовы старше окна не влияют на отчет
+	dependencyWindow = 5 * time.Minute
+	// Сколько последних вызовов хранится для каждой зависимости
+	dependencySamples = 1024
+	// Доля ошибок, с которой зависимость считается деградировавшей
+	dependencyErrorRate = 0.05
+	// p95 медленнее этого - деградация
+	dependencySlowP95 = time.Second
+	// Время на проверку доступности при построении отчета
+	dependencyProbeTimeout = 2 * time.Second
+)
+
+type dependencySample struct {
+	at      time.Time
+	latency time.Duration
+	failed  bool
+}
+
+// dependencyMetrics копит задержки и ошибки вызовов одной зависимости в
+// кольцевом буфере
+type dependencyMetrics struct {
+	name string
+	kind string
+
+	mu          sync.Mutex
+	samples     []dependencySample
+	next        int
+	lastError   string
+	lastErrorAt time.Time
+	breaker     *circuitBreaker
+	probe       func(ctx context.Context) error
+	// Счетчики за все время работы для /metrics; окно выше - для отчета
+	calls   uint64
+	errors  uint64
+	latency *histogram
+}
+
+// Observe записывает один вызов
+func (m *dependencyMetrics) Observe(latency time.Duration, err error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sample := dependencySample{at: now, latency: latency, failed: err != nil}
+	if len(m.samples) < dependencySamples {
+		m.samples = append(m.samples, sample)
+	} else {
+		m.samples[m.next] = sample
+		m.next = (m.next + 1) % dependencySamples
+	}
+	m.calls++
+	m.latency.observe(latency.Seconds())
+	if err != nil {
+		m.errors++
+		m.lastError, m.lastErrorAt = err.Error(), now
+	}
+}
+
+// SetBreaker подключает автомат размыкания: открытая цепь - зависимость недоступна
+func (m *dependencyMetrics) SetBreaker(b *circuitBreaker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.breaker = b
+}
+
+// SetProbe задает проверку, которая выполняется при каждом построении отчета
+func (m *dependencyMetrics) SetProbe(probe func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.probe = probe
+}
+
+// DependencyLatency - перцентили задержки вызовов за окно, в миллисекундах
+type DependencyLatency struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+// DependencyStatus - строка отчета GET /admin/dependencies
+type DependencyStatus struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Status string `json:"status"` // ok, degraded или down
+	// Оценка 0-100: доля успешных вызовов со штрафами за медленный p95 и автомат
+	Score       int               `json:"score"`
+	Calls       int               `json:"calls"`
+	ErrorRate   float64           `json:"errorRate"`
+	LatencyMs   DependencyLatency `json:"latencyMs"`
+	Breaker     string            `json:"breaker,omitempty"`
+	Probe       string            `json:"probe,omitempty"` // ok или текст ошибки проверки
+	LastError   string            `json:"lastError,omitempty"`
+	LastErrorAt *time.Time        `json:"lastErrorAt,omitempty"`
+}
+
+// DependencyReport - ответ GET /admin/dependencies; Status - худшее состояние
+type DependencyReport struct {
+	Status       string             `json:"status"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// report считает статистику за окно и выставляет состояние
+func (m *dependencyMetrics) report(probeErr error, probed bool) DependencyStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := DependencyStatus{Name: m.name, Kind: m.kind, Status: dependencyOK}
+
+	since := time.Now().Add(-dependencyWindow)
+	var latencies []time.Duration
+	failed := 0
+	for _, s := range m.samples {
+		if s.at.Before(since) {
+			continue
+		}
+		latencies = append(latencies, s.latency)
+		if s.failed {
+			failed++
+		}
+	}
+	st.Calls = len(latencies)
+	if st.Calls > 0 {
+		st.ErrorRate = float64(failed) / float64(st.Calls)
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		st.LatencyMs = DependencyLatency{
+			P50: percentileMs(latencies, 50),
+			P95: percentileMs(latencies, 95),
+			P99: percentileMs(latencies, 99),
+		}
+	}
+	if m.lastError != "" && m.lastErrorAt.After(since) {
+		at := m.lastErrorAt
+		st.LastError, st.LastErrorAt = m.lastError, &at
+	}
+
+	score := 100 * (1 - st.ErrorRate)
+	if st.ErrorRate >= dependencyErrorRate {
+		st.Status = dependencyDegraded
+	}
+	if st.LatencyMs.P95 > float64(dependencySlowP95.Milliseconds()) {
+		st.Status = dependencyDegraded
+		score -= 25
+	}
+	if m.breaker != nil && m.breaker.threshold > 0 {
+		st.Breaker = m.breaker.State()
+		switch st.Breaker {
+		case breakerHalfOpen:
+			st.Status = dependencyDegraded
+			score = math.Min(score, 50)
+		case breakerOpen:
+			st.Status, score = dependencyDown, 0
+		}
+	}
+	if probed {
+		st.Probe = dependencyOK
+		if probeErr != nil {
+			st.Probe = probeErr.Error()
+			st.Status, score = dependencyDown, 0
+		}
+	}
+	st.Score = max(int(score), 0)
+	return st
+}
+
+// percentileMs - перцентиль по ближайшему рангу из отсортированных задержек
+func percentileMs(sorted []time.Duration, p int) float64 {
+	i := (len(sorted)*p + 99) / 100
+	d := sorted[max(i-1, 0)]
+	return float64(d.Microseconds()) / 1000
+}
+
+// dependencyRegistry - зависимости, о которых сообщает отчет
+type dependencyRegistry struct {
+	mu   sync.Mutex
+	deps map[string]*dependencyMetrics
+}
+
+// Зависимости процесса; заводятся при создании клиентов
+var dependencies = &dependencyRegistry{deps: map[string]*dependencyMetrics{}}
+
+// Track возвращает метрики зависимости, заводя их при первом обращении
+func (r *dependencyRegistry) Track(name, kind string) *dependencyMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.deps[name]
+	if !ok {
+		m = &dependencyMetrics{name: name, kind: kind, latency: newHistogram()}
+		r.deps[name] = m
+	}
+	return m
+}
+
+// Report проверяет зависимости с проверкой параллельно и собирает отчет
+func (r *dependencyRegistry) Report(ctx context.Context) DependencyReport {
+	r.mu.Lock()
+	deps := make([]*dependencyMetrics, 0, len(r.deps))
+	for _, m := range r.deps {
+		deps = append(deps, m)
+	}
+	r.mu.Unlock()
+	sort.Slice(deps, func(i, j int) bool { return deps[i].name < deps[j].name })
+
+	ctx, cancel := context.WithTimeout(ctx, dependencyProbeTimeout)
+	defer cancel()
+	report := DependencyReport{Status: dependencyOK, Dependencies: make([]DependencyStatus, len(deps))}
+	var wg sync.WaitGroup
+	for i, m := range deps {
+		m.mu.Lock()
+		probe := m.probe
+		m.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if probe != nil {
+				err = probe(ctx)
+			}
+			report.Dependencies[i] = m.report(err, probe != nil)
+		}()
+	}
+	wg.Wait()
+
+	for _, st := range report.Dependencies {
+		switch {
+		case st.Status == dependencyDown:
+			report.Status = dependencyDown
+		case st.Status == dependencyDegraded && report.Status == dependencyOK:
+			report.Status = dependencyDegraded
+		}
+	}
+	return report
+}
+
+// dependencyTransport замеряет HTTP-вызовы внешнего API. Ошибкой считаются
+// сбои соединения, 5xx и 429 - то же, что размыкает цепь InfoClient.
+type dependencyTransport struct {
+	base http.RoundTripper
+	m    *dependencyMetrics
+}
+
+func (t dependencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	observed := err
+	if err == nil && (resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests) {
+		observed = &InfoStatusError{StatusCode: resp.StatusCode}
+	}
+	t.m.Observe(time.Since(start), observed)
+	return resp, err
+}
+
+// trackHTTP возвращает копию клиента внешнего API с замерами вызовов и,
+// если включена трассировка, со спанами
+func trackHTTP(client *http.Client, name, kind string) *http.Client {
+	tracked := *client
+	if tracked.Transport == nil {
+		tracked.Transport = http.DefaultTransport
+	}
+	tracked.Transport = dependencyTransport{base: traceHTTP(tracked.Transport), m: dependencies.Track(name, kind)}
+	return &tracked
+}
+
+// dependencyTiming - плагин GORM, замеряющий запросы к основной базе
+type dependencyTiming struct {
+	m *dependencyMetrics
+}
+
+func (dependencyTiming) Name() string {
+	return "dependency_timing"
+}
+
+func (p dependencyTiming) Initialize(db *gorm.DB) error {
+	start := func(tx *gorm.DB) {
+		tx.InstanceSet("dependency:start", time.Now())
+	}
+	finish := func(tx *gorm.DB) {
+		if v, ok := tx.InstanceGet("dependency:start"); ok {
+			err := tx.Error
+			// Пустой результат - ответ базы, а не ее сбой
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = nil
+			}
+			p.m.Observe(time.Since(v.(time.Time)), err)
+		}
+	}
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Query().Before("gorm:query").Register("dependency:query_start", start),
+		cb.Query().After("gorm:query").Register("dependency:query_finish", finish),
+		cb.Create().Before("gorm:create").Register("dependency:create_start", start),
+		cb.Create().After("gorm:create").Register("dependency:create_finish", finish),
+		cb.Update().Before("gorm:update").Register("dependency:update_start", start),
+		cb.Update().After("gorm:update").Register("dependency:update_finish", finish),
+		cb.Delete().Before("gorm:delete").Register("dependency:delete_start", start),
+		cb.Delete().After("gorm:delete").Register("dependency:delete_finish", finish),
+		cb.Row().Before("gorm:row").Register("dependency:row_start", start),
+		cb.Row().After("gorm:row").Register("dependency:row_finish", finish),
+		cb.Raw().Before("gorm:raw").Register("dependency:raw_start", start),
+		cb.Raw().After("gorm:raw").Register("dependency:raw_finish", finish),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dependencyRedisHook замеряет команды Redis
+type dependencyRedisHook struct {
+	m *dependencyMetrics
+}
+
+func (h dependencyRedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h dependencyRedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		observed := err
+		if errors.Is(err, redis.Nil) {
+			observed = nil
+		}
+		h.m.Observe(time.Since(start), observed)
+		return err
+	}
+}
+
+func (h dependencyRedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.m.Observe(time.Since(start), err)
+		return err
+	}
+}
+
+// @Summary Get dependency health
+// @Description Report each external dependency (database, Redis, enrichment and link providers, CDN cache) with a live probe where one exists, call latency percentiles, error rate and circuit breaker state over the last five minutes, and a 0-100 health score. The top-level status is the worst one.
+// @ID get-dependencies
+// @Produce  json
+// @Success 200 {object} DependencyReport
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Router /admin/dependencies [get]
+func GetDependencies(c *gin.Context) {
+	c.JSON(http.StatusOK, dependencies.Report(c.Request.Context()))
+}
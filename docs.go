@@ -0,0 +1,19 @@
+package main
+
+import "github.com/swaggo/swag"
+
+// Swagger UI (/swagger/index.html) читает спецификацию, встроенную в бинарник
+type embeddedSpec struct{}
+
+func (embeddedSpec) ReadDoc() string {
+	return swaggerSpec
+}
+
+func init() {
+	swag.Register(swag.Name, embeddedSpec{})
+}
+
+// Message - тело ответа с сообщением об успехе, для документации
+type Message struct {
+	Message string `json:"message" example:"Song deleted"`
+}
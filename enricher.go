@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Поля SongDetail, которые заполняют источники; имена как в JSON песни
+const (
+	fieldReleaseDate = "releaseDate"
+	fieldText        = "text"
+	fieldLink        = "link"
+	fieldAlbum       = "album"
+	fieldDurationMs  = "durationMs"
+)
+
+var detailFields = []string{fieldReleaseDate, fieldText, fieldLink, fieldAlbum, fieldDurationMs}
+
+// Enricher - звено цепочки обогащения: источник с именем и списком полей,
+// которые он умеет заполнять
+type Enricher interface {
+	SongInfoProvider
+	Name() string
+	Fields() []string
+}
+
+// namedEnricher делает звено цепочки из любого SongInfoProvider
+type namedEnricher struct {
+	SongInfoProvider
+	name   string
+	fields []string
+}
+
+func (e namedEnricher) Name() string     { return e.name }
+func (e namedEnricher) Fields() []string { return e.fields }
+
+// errTracklistsUnsupported - ни один источник не отдает трек-листы
+var errTracklistsUnsupported = errors.New("enrichment provider does not support tracklists")
+
+// AlbumDetail доступен, если его поддерживает обернутый источник
+func (e namedEnricher) AlbumDetail(ctx context.Context, group, album string) (AlbumDetail, error) {
+	tracklists, ok := e.SongInfoProvider.(AlbumTracklistProvider)
+	if !ok {
+		return AlbumDetail{}, errTracklistsUnsupported
+	}
+	return tracklists.AlbumDetail(ctx, group, album)
+}
+
+// lyricsEnricher - звено из источника текстов: заполняет только text
+type lyricsEnricher struct {
+	name   string
+	lyrics LyricsProvider
+}
+
+func (e lyricsEnricher) Name() string     { return e.name }
+func (e lyricsEnricher) Fields() []string { return []string{fieldText} }
+
+func (e lyricsEnricher) SongDetail(ctx context.Context, group, song string) (SongDetail, error) {
+	text, err := e.lyrics.Lyrics(ctx, group, song)
+	if errors.Is(err, ErrLyricsNotFound) {
+		return SongDetail{}, ErrInfoNotFound
+	}
+	if err != nil {
+		return SongDetail{}, err
+	}
+	return SongDetail{Text: text}, nil
+}
+
+// enricherChain опрашивает источники по порядку и дополняет результат
+// полями, которых не дали предыдущие. Опрос прекращается, когда все поля
+// заполнены; источник, у которого нет недостающих полей, пропускается.
+type enricherChain struct {
+	steps []Enricher
+}
+
+// SongDetail возвращает объединенный результат; Sources - какой источник
+// дал каждое поле. ErrInfoNotFound - песни нет ни в одном источнике; если
+// ничего не найдено, а часть источников не ответила, возвращается их ошибка.
+func (ch enricherChain) SongDetail(ctx context.Context, group, song string) (SongDetail, error) {
+	merged := SongDetail{Sources: map[string]string{}}
+	found := false
+	var firstErr error
+	for _, step := range ch.steps {
+		if !missingAny(merged, step.Fields()) {
+			continue
+		}
+		detail, err := step.SongDetail(ctx, group, song)
+		if errors.Is(err, ErrInfoNotFound) {
+			continue
+		}
+		if err != nil {
+			componentLogger(componentEnrichment).WithError(err).WithField("provider", step.Name()).
+				Warn("Enrichment provider failed, trying next")
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		found = true
+		mergeDetail(&merged, detail, step.Name())
+		if !missingAny(merged, detailFields) {
+			break
+		}
+	}
+	if !found {
+		if firstErr != nil {
+			return SongDetail{}, firstErr
+		}
+		return SongDetail{}, ErrInfoNotFound
+	}
+	return merged, nil
+}
+
+// AlbumDetail берет трек-лист у первого источника, который знает альбом
+func (ch enricherChain) AlbumDetail(ctx context.Context, group, album string) (AlbumDetail, error) {
+	var firstErr error
+	supported := false
+	for _, step := range ch.steps {
+		tracklists, ok := step.(AlbumTracklistProvider)
+		if !ok {
+			continue
+		}
+		detail, err := tracklists.AlbumDetail(ctx, group, album)
+		if errors.Is(err, errTracklistsUnsupported) {
+			continue
+		}
+		supported = true
+		if err == nil {
+			return detail, nil
+		}
+		if !errors.Is(err, ErrInfoNotFound) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	switch {
+	case !supported:
+		return AlbumDetail{}, errTracklistsUnsupported
+	case firstErr != nil:
+		return AlbumDetail{}, firstErr
+	}
+	return AlbumDetail{}, ErrInfoNotFound
+}
+
+// mergeDetail переносит в dst непустые поля src, которых в dst еще нет
+func mergeDetail(dst *SongDetail, src SongDetail, provider string) {
+	take := func(field string, empty bool, set func()) {
+		if !empty && !detailHas(*dst, field) {
+			set()
+			dst.Sources[field] = provider
+		}
+	}
+	take(fieldReleaseDate, src.ReleaseDate == "", func() { dst.ReleaseDate = src.ReleaseDate })
+	take(fieldText, src.Text == "", func() { dst.Text = src.Text })
+	take(fieldLink, src.Link == "", func() { dst.Link = src.Link })
+	take(fieldAlbum, src.Album == "", func() { dst.Album = src.Album })
+	take(fieldDurationMs, src.DurationMs == 0, func() { dst.DurationMs = src.DurationMs })
+}
+
+func detailHas(d SongDetail, field string) bool {
+	switch field {
+	case fieldReleaseDate:
+		return d.ReleaseDate != ""
+	case fieldText:
+		return d.Text != ""
+	case fieldLink:
+		return d.Link != ""
+	case fieldAlbum:
+		return d.Album != ""
+	case fieldDurationMs:
+		return d.DurationMs != 0
+	}
+	return false
+}
+
+func missingAny(d SongDetail, fields []string) bool {
+	for _, field := range fields {
+		if !detailHas(d, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEnricherNames разбирает ENRICHMENT_PROVIDER (список через запятую)
+// и дописывает ENRICHMENT_FALLBACK и LYRICS_PROVIDER, если их нет в списке
+func parseEnricherNames(cfg Config) []string {
+	var names []string
+	add := func(name string) {
+		name = strings.TrimSpace(name)
+		if name != "" && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, name := range strings.Split(cfg.EnrichmentProvider, ",") {
+		add(name)
+	}
+	add(cfg.EnrichmentFallback)
+	add(cfg.LyricsProvider)
+	if len(names) == 0 {
+		names = []string{providerInfo}
+	}
+	return names
+}
+
+// newEnricher создает звено цепочки по имени источника
+func newEnricher(name string, cfg Config) (Enricher, error) {
+	switch name {
+	case providerInfo:
+		if cfg.Info.BaseURL == "" {
+			return nil, errors.New("EXTERNAL_API_URL is not set")
+		}
+		return namedEnricher{NewInfoClient(cfg.Info, nil), name, detailFields}, nil
+	case providerSpotify:
+		spotify, err := NewSpotifyProvider(cfg.Spotify)
+		if err != nil {
+			return nil, err
+		}
+		return namedEnricher{spotify, name, []string{fieldReleaseDate, fieldLink, fieldAlbum, fieldDurationMs}}, nil
+	case providerMusicBrainz:
+		musicBrainz, err := NewMusicBrainzProvider(cfg.MusicBrainz)
+		if err != nil {
+			return nil, err
+		}
+		return namedEnricher{musicBrainz, name, []string{fieldReleaseDate, fieldLink, fieldAlbum, fieldDurationMs}}, nil
+	case providerGenius:
+		lyrics, err := newLyricsProvider(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return lyricsEnricher{name: name, lyrics: lyrics}, nil
+	default:
+		return nil, fmt.Errorf("unknown enrichment provider %q", name)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// Ошибки внешнего API с данными о песнях
+var (
+	ErrInfoNotFound    = errors.New("song info not found")
+	ErrInfoUnavailable = errors.New("info API unavailable")
+	// Цепь разомкнута: запрос даже не отправлялся
+	ErrInfoCircuitOpen = fmt.Errorf("%w: circuit open", ErrInfoUnavailable)
+)
+
+// InfoStatusError - внешний API ответил неожиданным статусом
+type InfoStatusError struct {
+	StatusCode int
+}
+
+func (e *InfoStatusError) Error() string {
+	return fmt.Sprintf("info API returned status %d", e.StatusCode)
+}
+
+// Ошибки 5xx и 429 временные: upstream перегружен или перезапускается
+func (e *InfoStatusError) Is(target error) bool {
+	return target == ErrInfoUnavailable &&
+		(e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests)
+}
+
+// InfoClientConfig - параметры клиента внешнего API
+type InfoClientConfig struct {
+	BaseURL          string        // без /info
+	Timeout          time.Duration // на одну попытку
+	Deadline         time.Duration // на запрос вместе с повторами
+	Retries          int           // повторов после первой попытки
+	RetryBackoff     time.Duration // пауза перед первым повтором, дальше удваивается
+	BreakerThreshold int           // ошибок подряд до размыкания цепи; 0 - без автомата
+	BreakerCooldown  time.Duration
+}
+
+// InfoClient обращается к внешнему API за датой выхода, текстом и ссылкой
+type InfoClient struct {
+	cfg     InfoClientConfig
+	http    *http.Client
+	breaker *circuitBreaker
+	// Одинаковые одновременные запросы (массовый импорт) схлопываются в один
+	lookups singleflight.Group
+}
+
+// NewInfoClient создает клиента; если httpClient nil, используется клиент
+// с таймаутом cfg.Timeout
+func NewInfoClient(cfg InfoClientConfig, httpClient *http.Client) *InfoClient {
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: cfg.Timeout}
+	}
+	breaker := newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown, func(from, to string) {
+		componentLogger(componentEnrichment).WithFields(logrus.Fields{"from": from, "to": to}).
+			Warn("Info API circuit breaker changed state")
+	})
+	dependencies.Track(providerInfo, dependencyEnrichment).SetBreaker(breaker)
+	httpClient = trackHTTP(httpClient, providerInfo, dependencyEnrichment)
+	return &InfoClient{cfg: cfg, http: httpClient, breaker: breaker}
+}
+
+// SongInfoProvider - источник данных о песне для AddSong. Если источник
+// недоступен, ошибка удовлетворяет errors.Is(err, ErrInfoUnavailable),
+// если песня не найдена - errors.Is(err, ErrInfoNotFound).
+type SongInfoProvider interface {
+	SongDetail(ctx context.Context, group, song string) (SongDetail, error)
+}
+
+// Источник, выбранный ENRICHMENT_PROVIDER
+var enrichment SongInfoProvider
+
+// Значения ENRICHMENT_PROVIDER и ENRICHMENT_FALLBACK
+const (
+	providerInfo        = "info"
+	providerSpotify     = "spotify"
+	providerMusicBrainz = "musicbrainz"
+)
+
+// NewEnrichmentProvider собирает цепочку источников в порядке из конфигурации
+func NewEnrichmentProvider(cfg Config) (SongInfoProvider, error) {
+	var chain enricherChain
+	for _, name := range parseEnricherNames(cfg) {
+		step, err := newEnricher(name, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		chain.steps = append(chain.steps, step)
+	}
+	return chain, nil
+}
+
+// SongDetail получает данные песни; параллельные вызовы для той же пары
+// группа+песня ждут один общий запрос
+func (ic *InfoClient) SongDetail(ctx context.Context, group, song string) (SongDetail, error) {
+	key := group + "\x00" + song
+	v, err, shared := ic.lookups.Do(key, func() (interface{}, error) {
+		// Общий запрос не должен прерываться, если отменен запрос первого вызвавшего
+		return ic.fetchWithRetry(context.WithoutCancel(ctx), group, song)
+	})
+	if shared {
+		componentLogger(componentEnrichment).WithField("group", group).Debug("Shared song info lookup with concurrent request")
+	}
+	if err != nil {
+		return SongDetail{}, err
+	}
+	return v.(SongDetail), nil
+}
+
+func (ic *InfoClient) fetchWithRetry(ctx context.Context, group, song string) (SongDetail, error) {
+	if ic.cfg.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ic.cfg.Deadline)
+		defer cancel()
+	}
+
+	backoff := ic.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		if !ic.breaker.Allow() {
+			return SongDetail{}, ErrInfoCircuitOpen
+		}
+		detail, err := ic.requestSongDetail(ctx, group, song)
+		if err == nil || !errors.Is(err, ErrInfoUnavailable) {
+			// Ответ 404 или 400 - upstream работает
+			ic.breaker.Success()
+			return detail, err
+		}
+		ic.breaker.Failure()
+		if attempt >= ic.cfg.Retries || ic.breaker.State() == breakerOpen {
+			return SongDetail{}, err
+		}
+
+		// Экспоненциальная пауза со случайным разбросом, чтобы повторы не шли волной
+		wait := backoff/2 + rand.N(backoff/2+1)
+		backoff *= 2
+		componentLogger(componentEnrichment).WithError(err).WithFields(logrus.Fields{
+			"attempt": attempt + 1, "retry_in_ms": wait.Milliseconds(),
+		}).Warn("Info API request failed, retrying")
+		select {
+		case <-ctx.Done():
+			return SongDetail{}, fmt.Errorf("%w: %w", ErrInfoUnavailable, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (ic *InfoClient) requestSongDetail(ctx context.Context, group, song string) (SongDetail, error) {
+	var detail SongDetail
+	params := url.Values{"group": {group}, "song": {song}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ic.cfg.BaseURL+"/info?"+params.Encode(), nil)
+	if err != nil {
+		return detail, fmt.Errorf("build song info request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := ic.http.Do(req)
+	if err != nil {
+		return detail, fmt.Errorf("%w: %w", ErrInfoUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return detail, ErrInfoNotFound
+	default:
+		return detail, &InfoStatusError{StatusCode: resp.StatusCode}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&detail); err != nil {
+		return detail, fmt.Errorf("decode song info: %w", err)
+	}
+	return detail, nil
+}
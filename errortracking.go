@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrorTrackingConfig - отправка ошибок в Sentry
+type ErrorTrackingConfig struct {
+	DSN         string  // пусто - отправка выключена
+	Environment string  // production, staging...
+	SampleRate  float64 // доля отправляемых событий
+}
+
+// Клиент Sentry; nil - ошибки никуда не отправляются
+var errorTracker *sentry.Client
+
+// Сколько ждать отправки событий при остановке
+const errorTrackingFlushTimeout = 2 * time.Second
+
+// SetupErrorTracking создает клиент Sentry и подключает хук logrus,
+// отправляющий записи уровня Error и выше
+func SetupErrorTracking(cfg ErrorTrackingConfig) error {
+	if cfg.DSN == "" {
+		return nil
+	}
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:              cfg.DSN,
+		Environment:      cfg.Environment,
+		Release:          version,
+		SampleRate:       cfg.SampleRate,
+		AttachStacktrace: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up error tracking: %w", err)
+	}
+	errorTracker = client
+	logrus.AddHook(errorTrackingHook{client: client})
+	return nil
+}
+
+// FlushErrorTracking дожидается отправки накопленных событий перед выходом
+func FlushErrorTracking() {
+	if errorTracker != nil {
+		errorTracker.Flush(errorTrackingFlushTimeout)
+	}
+}
+
+// ErrorTracking отправляет паники и ответы 5xx с данными запроса. На
+// запрос уходит не больше одного события: если обработчик уже записал
+// ошибку в лог, хук отправил ее, и ответ 5xx повторно не отправляется.
+// Подключается после Recovery: паника отправляется здесь и передается
+// дальше, ответ на нее пишет Recovery.
+func ErrorTracking(client *sentry.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hub := sentry.NewHub(client, sentry.NewScope())
+		hub.Scope().SetRequest(c.Request)
+		hub.Scope().SetTag(fieldRequestID, c.GetString(fieldRequestID))
+		ctx := sentry.SetHubOnContext(c.Request.Context(), hub)
+		c.Request = c.Request.WithContext(ctx)
+
+		defer func() {
+			if rec := recover(); rec != nil {
+				if !isBrokenPipe(rec) {
+					tagRequest(hub, c)
+					// Не hub.Recover: он не запоминает событие, и запись
+					// Recovery в лог ушла бы вторым событием
+					hub.CaptureEvent(panicEvent(client, rec))
+				}
+				panic(rec)
+			}
+		}()
+		c.Next()
+
+		if status := c.Writer.Status(); status >= http.StatusInternalServerError && hub.LastEventID() == "" {
+			tagRequest(hub, c)
+			hub.WithScope(func(scope *sentry.Scope) {
+				scope.SetTag("status", strconv.Itoa(status))
+				if len(c.Errors) > 0 {
+					scope.SetExtra("errors", c.Errors.String())
+				}
+				hub.CaptureMessage(fmt.Sprintf("%s %s returned %d", c.Request.Method, c.FullPath(), status))
+			})
+		}
+	}
+}
+
+// panicEvent - событие паники; стек снимается в отложенной функции, пока
+// кадры паникующего обработчика еще на месте
+func panicEvent(client *sentry.Client, rec interface{}) *sentry.Event {
+	if err, ok := rec.(error); ok {
+		return client.EventFromException(err, sentry.LevelFatal)
+	}
+	return client.EventFromMessage(fmt.Sprint(rec), sentry.LevelFatal)
+}
+
+// tagRequest добавляет в событие маршрут и того, кто сделал запрос
+func tagRequest(hub *sentry.Hub, c *gin.Context) {
+	scope := hub.Scope()
+	scope.SetTag(fieldRoute, c.FullPath())
+	if userID, ok := c.Get(fieldUserID); ok {
+		scope.SetUser(sentry.User{ID: fmt.Sprint(userID)})
+	}
+	if role, ok := c.Get(fieldRole); ok {
+		scope.SetTag(fieldRole, fmt.Sprint(role))
+	}
+}
+
+// errorTrackingHook отправляет записи logrus уровня Error и выше. Записи
+// запроса (logEntry) уходят с его данными и не чаще одного раза на запрос.
+type errorTrackingHook struct {
+	client *sentry.Client
+}
+
+func (errorTrackingHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel}
+}
+
+func (h errorTrackingHook) Fire(entry *logrus.Entry) error {
+	level := sentry.LevelError
+	if entry.Level <= logrus.FatalLevel {
+		level = sentry.LevelFatal
+	}
+	var event *sentry.Event
+	if err, ok := entry.Data[logrus.ErrorKey].(error); ok {
+		event = h.client.EventFromException(err, level)
+	} else {
+		event = h.client.EventFromMessage(entry.Message, level)
+	}
+	event.Message = entry.Message
+	event.Logger = "logrus"
+	event.Extra = map[string]interface{}{}
+	for key, value := range entry.Data {
+		switch key {
+		case logrus.ErrorKey:
+		case fieldRequestID, fieldRoute, "component":
+			event.Tags[key] = fmt.Sprint(value)
+		default:
+			event.Extra[key] = value
+		}
+	}
+
+	if entry.Context != nil {
+		if hub := sentry.GetHubFromContext(entry.Context); hub != nil {
+			if hub.LastEventID() == "" {
+				hub.CaptureEvent(event)
+			}
+			return nil
+		}
+	}
+	h.client.CaptureEvent(event, nil, sentry.NewScope())
+	return nil
+}
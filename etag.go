@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag ответов с песнями считается по времени изменения песен, а не по телу:
+// ответ не нужно собирать, чтобы ответить 304. ETag слабый - одинаковым
+// версиям песен соответствуют равнозначные, но не обязательно побайтно
+// одинаковые ответы.
+
+// songETag - ETag текста песни; пусто, если время изменения неизвестно
+// (песня из журнала as_of или из внешнего хранилища)
+func songETag(song Song) string {
+	if song.UpdatedAt.IsZero() {
+		return ""
+	}
+	return `W/"` + encodeSongID(song.ID) + "-" + strconv.FormatInt(song.UpdatedAt.UnixNano(), 36) + `"`
+}
+
+// songsETag - ETag списка: формат ответа, публичные ID и версии песен в
+// порядке списка, общее число песен в meta JSON:API и вложенные по ?include
+// данные, которые меняются отдельно от песни. Длина текста учитывает текст, скрытый в регионе клиента.
+func songsETag(c *gin.Context, songs []Song) string {
+	h := sha256.New()
+	switch {
+	case wantsJSONAPI(c):
+		h.Write([]byte("jsonapi\n"))
+	case wantsXML(c):
+		h.Write([]byte("xml\n"))
+	default:
+		h.Write([]byte("json\n"))
+	}
+	if total := requestSongsTotal(c); total != nil {
+		fmt.Fprintf(h, "total:%d:%t\n", total.Total, total.Estimated)
+	}
+	for _, song := range songs {
+		if song.UpdatedAt.IsZero() {
+			return ""
+		}
+		fmt.Fprintf(h, "%s:%d:%d\n", encodeSongID(song.ID), song.UpdatedAt.UnixNano(), len(song.Text))
+		if song.Owner != nil || song.Tags != nil || song.Links != nil {
+			if err := json.NewEncoder(h).Encode([]interface{}{song.Owner, song.Tags, song.Links}); err != nil {
+				return ""
+			}
+		}
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// notModified выставляет ETag и отвечает 304, если клиент прислал его в
+// If-None-Match. Пустой etag - ответ без ETag.
+func notModified(c *gin.Context, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	c.Header("ETag", etag)
+	if !etagMatches(c.GetHeader("If-None-Match"), etag) {
+		return false
+	}
+	c.Status(http.StatusNotModified)
+	c.Writer.WriteHeaderNow()
+	return true
+}
+
+// etagMatches сравнивает If-None-Match со слабым ETag; для GET сравнение
+// слабое, префикс W/ не учитывается (RFC 9110, 13.1.2)
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
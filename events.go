@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Виды событий прослушивания и аналитики
+const (
+	eventLyricsView = "lyrics_view"
+)
+
+// Структура PlayEvent (событие просмотра или прослушивания)
+type PlayEvent struct {
+	ID        int64     `json:"id" gorm:"primaryKey"`
+	SongID    int       `json:"songId" gorm:"not null;index"`
+	Kind      string    `json:"kind" gorm:"not null"`
+	UserID    *int      `json:"userId"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+}
+
+// EventBuffer копит события в памяти и пишет их в базу пачками:
+// когда набралось BatchSize событий или прошло FlushInterval
+type EventBuffer struct {
+	db       *gorm.DB
+	size     int
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending []PlayEvent
+	dropped int64
+
+	flush chan struct{}
+	done  chan struct{}
+}
+
+var events *EventBuffer
+
+func NewEventBuffer(db *gorm.DB, size int, interval time.Duration) *EventBuffer {
+	if size < 1 {
+		size = 1
+	}
+	return &EventBuffer{
+		db:       db,
+		size:     size,
+		interval: interval,
+		pending:  make([]PlayEvent, 0, size),
+		flush:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// Record добавляет событие в буфер. Если база не успевает, буфер не растет
+// больше десяти пачек - лишние события отбрасываются.
+func (b *EventBuffer) Record(e PlayEvent) {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	b.mu.Lock()
+	if len(b.pending) >= b.size*10 {
+		b.dropped++
+		b.mu.Unlock()
+		return
+	}
+	b.pending = append(b.pending, e)
+	full := len(b.pending) >= b.size
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Start запускает фоновую запись; после отмены ctx оставшиеся события
+// сбрасываются в базу
+func (b *EventBuffer) Start(ctx context.Context) {
+	go func() {
+		defer close(b.done)
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				b.Flush(context.WithoutCancel(ctx))
+				return
+			case <-ticker.C:
+			case <-b.flush:
+			}
+			b.Flush(ctx)
+		}
+	}()
+}
+
+// Wait ждет последнего сброса после отмены контекста
+func (b *EventBuffer) Wait() {
+	<-b.done
+}
+
+// Flush пишет накопленные события одной пачкой
+func (b *EventBuffer) Flush(ctx context.Context) {
+	b.mu.Lock()
+	batch := b.pending
+	dropped := b.dropped
+	b.pending = make([]PlayEvent, 0, b.size)
+	b.dropped = 0
+	b.mu.Unlock()
+
+	log := componentLogger(componentEvents)
+	if dropped > 0 {
+		log.WithField("dropped", dropped).Warn("Event buffer overflow, events dropped")
+	}
+	if len(batch) == 0 {
+		return
+	}
+	if err := b.db.WithContext(ctx).CreateInBatches(batch, b.size).Error; err != nil {
+		log.WithError(err).WithField("events", len(batch)).Error("Failed to write events")
+	}
+}
+
+// recordEvent регистрирует событие текущего запроса, если буфер включен
+func recordEvent(c *gin.Context, songID int, kind string) {
+	if events == nil {
+		return
+	}
+	e := PlayEvent{SongID: songID, Kind: kind}
+	if userID, ok := currentUserID(c); ok {
+		e.UserID = &userID
+	}
+	events.Record(e)
+}
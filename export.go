@@ -0,0 +1,233 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Форматы выгрузки каталога
+const (
+	exportFormatCSV  = "csv"
+	exportFormatTSV  = "tsv"
+	exportFormatXLSX = "xlsx"
+	exportFormatJSON = "json"
+)
+
+// Сколько песен читается из хранилища или курсора базы за раз
+const exportBatchSize = 500
+
+// exportRecord - строка выгрузки в порядке importColumns, чтобы файл можно
+// было загрузить обратно через POST /songs/import
+func exportRecord(song Song) []string {
+	return []string{song.Group, song.SongName, song.ReleaseDate.String(), song.Link, song.Text}
+}
+
+// songExporter пишет выгрузку в одном формате по мере чтения песен
+type songExporter interface {
+	WriteBatch(songs []Song) error
+	// Close дописывает файл в ответ
+	Close() error
+}
+
+// exportFormats - content type и конструктор для каждого формата
+var exportFormats = map[string]struct {
+	contentType string
+	newExporter func(w gin.ResponseWriter) (songExporter, error)
+}{
+	exportFormatCSV: {"text/csv; charset=utf-8", func(w gin.ResponseWriter) (songExporter, error) {
+		return newCSVExporter(w, ','), nil
+	}},
+	exportFormatTSV: {"text/tab-separated-values; charset=utf-8", func(w gin.ResponseWriter) (songExporter, error) {
+		return newCSVExporter(w, '\t'), nil
+	}},
+	exportFormatXLSX: {xlsxContentType, newXLSXExporter},
+	exportFormatJSON: {jsonContentType, func(w gin.ResponseWriter) (songExporter, error) {
+		return newSongArrayWriter(w), nil
+	}},
+}
+
+// csvExporter отправляет клиенту каждую порцию сразу
+type csvExporter struct {
+	out gin.ResponseWriter
+	w   *csv.Writer
+}
+
+func newCSVExporter(out gin.ResponseWriter, comma rune) *csvExporter {
+	w := csv.NewWriter(out)
+	w.Comma = comma
+	w.Write(importColumns)
+	return &csvExporter{out: out, w: w}
+}
+
+func (e *csvExporter) WriteBatch(songs []Song) error {
+	for _, song := range songs {
+		e.w.Write(exportRecord(song))
+	}
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		return err
+	}
+	e.out.Flush()
+	return nil
+}
+
+func (e *csvExporter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// @Summary Export songs
+// @Description Stream the songs matching the same filters as GET /songs as a CSV, TSV or XLSX attachment with the columns group, song, releaseDate, link and text accepted by POST /songs/import, or as a JSON array of songs. Songs are read from a single database cursor and written as they arrive, so the whole catalog can be exported with flat memory use. The XLSX workbook stores release dates as dates and adds a Summary sheet with song counts per group.
+// @ID export-songs
+// @Produce text/csv
+// @Produce text/tab-separated-values
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce json
+// @Param format query string false "Output format: csv (default), tsv, xlsx or json"
+// @Param group query string false "Group filter"
+// @Param song query string false "Song filter"
+// @Param releaseDate query string false "Release date filter, DD.MM.YYYY or YYYY-MM-DD; releaseDate[gte], releaseDate[lt] and the other comparisons select a range"
+// @Param text query string false "Only songs whose text contains this; archived lyrics are not searched"
+// @Param link query string false "Link filter"
+// @Param explicit query bool false "Explicit lyrics filter"
+// @Param mine query bool false "Only songs owned by the caller"
+// @Success 200 {file} file
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 500 {object} APIError
+// @Failure 501 {object} APIError
+// @Router /songs/export [get]
+func ExportSongs(store SongStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, ok := songFilterFromQuery(c)
+		if !ok {
+			return
+		}
+		format := c.DefaultQuery("format", exportFormatCSV)
+		spec, ok := exportFormats[format]
+		if !ok {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Unsupported export format: "+format)
+			return
+		}
+
+		fail := func(err error) {
+			logEntry(c).WithError(err).Error("Failed to export songs")
+			// Ответ уже начат, код не изменить: файл обрывается, ошибка остается в логе
+			if c.Writer.Written() {
+				return
+			}
+			c.Writer.Header().Del("Content-Disposition")
+			c.Writer.Header().Del("Content-Type")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to export songs")
+		}
+
+		// next возвращает следующую порцию; пустая порция - конец выгрузки
+		var next func() ([]Song, error)
+		if store != nil {
+			// SongStore не ищет по тексту и понимает только равенство
+			if filter.Text != "" || len(filter.Conds) > 0 {
+				abortWithError(c, http.StatusNotImplemented, codeNotImplemented, "Not supported by this storage backend")
+				return
+			}
+			afterID, done := 0, false
+			next = func() ([]Song, error) {
+				if done {
+					return nil, nil
+				}
+				songs, err := store.ListSongs(c.Request.Context(), SongQuery{Filter: filter, AfterID: afterID, Limit: exportBatchSize})
+				if err != nil {
+					return nil, err
+				}
+				done = len(songs) < exportBatchSize
+				if len(songs) > 0 {
+					afterID = songs[len(songs)-1].ID
+				}
+				return songs, nil
+			}
+		} else {
+			// Регион клиента может потребовать запроса к базе; он читается
+			// до открытия курсора, который держит соединение до конца выгрузки
+			regionRestriction(c)
+			rows, err := exportSQLRows(c, filter)
+			if err != nil {
+				fail(err)
+				return
+			}
+			defer rows.Close()
+			next = func() ([]Song, error) {
+				return readSongBatch(rows, func(song *Song) error { return scanExportRow(c, rows, song) })
+			}
+		}
+
+		// Первая порция читается до заголовков, чтобы ошибку базы можно было вернуть кодом
+		songs, err := next()
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		c.Header("Content-Type", spec.contentType)
+		c.Header("Content-Disposition", `attachment; filename="songs.`+format+`"`)
+		c.Status(http.StatusOK)
+		exporter, err := spec.newExporter(c.Writer)
+		if err != nil {
+			fail(err)
+			return
+		}
+		for len(songs) > 0 {
+			if err := exporter.WriteBatch(restrictSongs(c, songs)); err != nil {
+				// Клиент отключился
+				logEntry(c).WithError(err).Debug("Song export aborted")
+				return
+			}
+			if songs, err = next(); err != nil {
+				fail(err)
+				return
+			}
+		}
+		if err := exporter.Close(); err != nil {
+			fail(err)
+		}
+	}
+}
+
+// exportRow - песня и сжатый архивный текст перенесенной в архив песни
+type exportRow struct {
+	Song
+	ArchivedData []byte
+}
+
+// exportSQLRows открывает курсор по песням выгрузки. Архивный текст
+// читается тем же запросом: пока курсор открыт, отдельный запрос на каждую
+// архивную песню занимал бы второе соединение.
+func exportSQLRows(c *gin.Context, filter SongFilter) (*sql.Rows, error) {
+	fs := songFilterSet(filter, "songs")
+	if filter.Text != "" {
+		// Как и поиск в GET /songs, архивные тексты не просматриваются
+		fs.Contains("text", filter.Text).Eq("archived", false)
+	}
+	return fs.Apply(dbFor(c).Model(&Song{})).
+		Select("songs.*, archived_lyrics.data AS archived_data").
+		Joins("LEFT JOIN archived_lyrics ON archived_lyrics.song_id = songs.id AND songs.archived").
+		Order("songs.id").Rows()
+}
+
+// scanExportRow читает песню из курсора и подставляет архивный текст
+func scanExportRow(c *gin.Context, rows *sql.Rows, song *Song) error {
+	var row exportRow
+	if err := dbFor(c).ScanRows(rows, &row); err != nil {
+		return err
+	}
+	*song = row.Song
+	if song.Archived && row.ArchivedData != nil {
+		text, err := decompressText(row.ArchivedData)
+		if err != nil {
+			return err
+		}
+		song.Text = text
+	}
+	return nil
+}
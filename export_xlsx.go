@@ -0,0 +1,155 @@
+package main
+
+import (
+	"io"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Листы книги выгрузки
+const (
+	xlsxSongsSheet   = "Songs"
+	xlsxSummarySheet = "Summary"
+)
+
+// Формат даты выхода в ячейках книги
+const xlsxDateFormat = "dd.mm.yyyy"
+
+// Ширина колонок листа Songs в порядке importColumns
+var xlsxColumnWidths = []float64{24, 32, 12, 40, 60}
+
+// xlsxExporter пишет строки через StreamWriter: excelize держит в памяти
+// только буфер листа и сбрасывает его во временный файл, поэтому каталог
+// целиком в память не загружается. Книга отправляется клиенту в Close,
+// когда все листы готовы - zip нельзя отдать раньше.
+type xlsxExporter struct {
+	out    io.Writer
+	file   *excelize.File
+	songs  *excelize.StreamWriter
+	header int
+	date   int
+	row    int
+	groups map[string]int
+}
+
+func newXLSXExporter(out gin.ResponseWriter) (songExporter, error) {
+	f := excelize.NewFile()
+	e := &xlsxExporter{out: out, file: f, row: 1, groups: map[string]int{}}
+	if err := f.SetSheetName("Sheet1", xlsxSongsSheet); err != nil {
+		f.Close()
+		return nil, err
+	}
+	var err error
+	if e.header, err = f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	dateFormat := xlsxDateFormat
+	if e.date, err = f.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if e.songs, err = e.newSheet(xlsxSongsSheet, importColumns, xlsxColumnWidths); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// newSheet открывает поток листа с закрепленной строкой заголовка
+func (e *xlsxExporter) newSheet(name string, columns []string, widths []float64) (*excelize.StreamWriter, error) {
+	sw, err := e.file.NewStreamWriter(name)
+	if err != nil {
+		return nil, err
+	}
+	// Ширина колонок и закрепление задаются до первой строки
+	for i, width := range widths {
+		if err := sw.SetColWidth(i+1, i+1, width); err != nil {
+			return nil, err
+		}
+	}
+	err = sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+	if err != nil {
+		return nil, err
+	}
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = excelize.Cell{StyleID: e.header, Value: column}
+	}
+	return sw, sw.SetRow("A1", header)
+}
+
+func (e *xlsxExporter) WriteBatch(songs []Song) error {
+	for _, song := range songs {
+		e.row++
+		cell, err := excelize.CoordinatesToCellName(1, e.row)
+		if err != nil {
+			return err
+		}
+		// Неизвестная дата - пустая ячейка
+		var released interface{} = ""
+		if !song.ReleaseDate.IsZero() {
+			released = excelize.Cell{StyleID: e.date, Value: song.ReleaseDate.Time()}
+		}
+		row := []interface{}{song.Group, song.SongName, released, song.Link, song.Text}
+		if err := e.songs.SetRow(cell, row); err != nil {
+			return err
+		}
+		e.groups[song.Group]++
+	}
+	return nil
+}
+
+// Close дописывает лист Summary с числом песен по группам и отправляет книгу
+func (e *xlsxExporter) Close() error {
+	defer e.file.Close()
+	if err := e.songs.Flush(); err != nil {
+		return err
+	}
+	if _, err := e.file.NewSheet(xlsxSummarySheet); err != nil {
+		return err
+	}
+	summary, err := e.newSheet(xlsxSummarySheet, []string{"group", "songs"}, []float64{32, 10})
+	if err != nil {
+		return err
+	}
+	groups := make([]string, 0, len(e.groups))
+	for group := range e.groups {
+		groups = append(groups, group)
+	}
+	// Больше песен - выше, при равенстве по алфавиту
+	sort.Slice(groups, func(i, j int) bool {
+		if e.groups[groups[i]] != e.groups[groups[j]] {
+			return e.groups[groups[i]] > e.groups[groups[j]]
+		}
+		return groups[i] < groups[j]
+	})
+	for i, group := range groups {
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		if err := summary.SetRow(cell, []interface{}{group, e.groups[group]}); err != nil {
+			return err
+		}
+	}
+	total, err := excelize.CoordinatesToCellName(1, len(groups)+2)
+	if err != nil {
+		return err
+	}
+	err = summary.SetRow(total, []interface{}{
+		excelize.Cell{StyleID: e.header, Value: "total"},
+		excelize.Cell{StyleID: e.header, Value: e.row - 1},
+	})
+	if err != nil {
+		return err
+	}
+	if err := summary.Flush(); err != nil {
+		return err
+	}
+	return e.file.Write(e.out)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// Сколько последних прослушиваний хранится у одного владельца
+	historyKeep         = 500
+	historyDefaultLimit = 50
+)
+
+// Структура Favorite (песня в избранном). Владелец - пользователь или
+// сессия гостя, ровно одно из двух.
+type Favorite struct {
+	ID        int       `json:"-" gorm:"primaryKey"`
+	UserID    *int      `json:"-" gorm:"uniqueIndex:idx_favorite_user_song"`
+	SessionID *int      `json:"-" gorm:"uniqueIndex:idx_favorite_session_song"`
+	SongID    PublicID  `json:"songId" extensions:"x-public-id" gorm:"not null;uniqueIndex:idx_favorite_user_song;uniqueIndex:idx_favorite_session_song"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Структура ListenEntry (прослушивание в истории)
+type ListenEntry struct {
+	ID        int64     `json:"id" gorm:"primaryKey"`
+	UserID    *int      `json:"-" gorm:"index"`
+	SessionID *int      `json:"-" gorm:"index"`
+	SongID    PublicID  `json:"songId" extensions:"x-public-id" gorm:"not null"`
+	PlayedAt  time.Time `json:"playedAt" gorm:"index"`
+}
+
+func (ListenEntry) TableName() string {
+	return "listening_history"
+}
+
+// Тело запроса на запись прослушивания
+type ListenRequest struct {
+	SongID PublicID `json:"songId" binding:"required" extensions:"x-public-id"`
+}
+
+// trimHistory удаляет прослушивания владельца сверх historyKeep последних
+func trimHistory(db *gorm.DB, l listener) error {
+	var ids []int64
+	err := l.scope(db.Model(&ListenEntry{})).Order("id DESC").Offset(historyKeep).Limit(1).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return l.scope(db).Where("id <= ?", ids[0]).Delete(&ListenEntry{}).Error
+}
+
+// @Summary List favorites
+// @Description List favorite songs, newest first. Signed-in users get their own favorites; anonymous clients get those of their session (X-Session-Token header or session cookie), or an empty list without one.
+// @ID list-favorites
+// @Produce  json
+// @Param X-Session-Token header string false "Anonymous session token, if not sent as a cookie"
+// @Success 200 {array} Favorite
+// @Failure 500 {object} APIError
+// @Router /favorites [get]
+func GetFavorites(c *gin.Context) {
+	owner, ok := listenerFor(c, false)
+	if !ok {
+		return
+	}
+	favorites := []Favorite{}
+	if owner.empty() {
+		c.JSON(http.StatusOK, favorites)
+		return
+	}
+	if err := owner.scope(dbFor(c)).Order("created_at DESC, id DESC").Find(&favorites).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch favorites")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch favorites")
+		return
+	}
+	c.JSON(http.StatusOK, favorites)
+}
+
+// @Summary Add favorite
+// @Description Add a song to favorites; adding it again is a no-op. An anonymous client without a session gets a new one, returned in the session cookie and the X-Session-Token header.
+// @ID add-favorite
+// @Produce  json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Param X-Session-Token header string false "Anonymous session token, if not sent as a cookie"
+// @Success 200 {object} Favorite
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /favorites/{id} [put]
+func AddFavorite(c *gin.Context) {
+	songID, ok := noteSongID(c)
+	if !ok {
+		return
+	}
+	owner, ok := listenerFor(c, true)
+	if !ok {
+		return
+	}
+	favorite := Favorite{UserID: owner.UserID, SessionID: owner.SessionID, SongID: PublicID(songID)}
+	if err := owner.scope(dbFor(c)).Where("song_id = ?", songID).FirstOrCreate(&favorite).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to add favorite")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to add favorite")
+		return
+	}
+	c.JSON(http.StatusOK, favorite)
+}
+
+// @Summary Remove favorite
+// @Description Remove a song from favorites.
+// @ID remove-favorite
+// @Produce  json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Param X-Session-Token header string false "Anonymous session token, if not sent as a cookie"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /favorites/{id} [delete]
+func RemoveFavorite(c *gin.Context) {
+	songID, err := parseSongID(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
+		return
+	}
+	owner, ok := listenerFor(c, false)
+	if !ok {
+		return
+	}
+	if owner.empty() {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Favorite not found")
+		return
+	}
+	result := owner.scope(dbFor(c)).Where("song_id = ?", songID).Delete(&Favorite{})
+	if result.Error != nil {
+		logEntry(c).WithError(result.Error).Error("Failed to remove favorite")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to remove favorite")
+		return
+	}
+	if result.RowsAffected == 0 {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Favorite not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Favorite removed"})
+}
+
+// @Summary Listening history
+// @Description List recently played songs, newest first. Only the last 500 plays are kept. Anonymous clients see the history of their session.
+// @ID list-history
+// @Produce  json
+// @Param limit query int false "Number of entries, 50 by default, at most 500"
+// @Param X-Session-Token header string false "Anonymous session token, if not sent as a cookie"
+// @Success 200 {array} ListenEntry
+// @Failure 400 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /history [get]
+func GetHistory(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(historyDefaultLimit)))
+	if err != nil || limit < 1 || limit > historyKeep {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid limit")
+		return
+	}
+	owner, ok := listenerFor(c, false)
+	if !ok {
+		return
+	}
+	history := []ListenEntry{}
+	if owner.empty() {
+		c.JSON(http.StatusOK, history)
+		return
+	}
+	if err := owner.scope(dbFor(c)).Order("id DESC").Limit(limit).Find(&history).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch listening history")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch listening history")
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// @Summary Record play
+// @Description Add a song to the listening history. An anonymous client without a session gets a new one, returned in the session cookie and the X-Session-Token header.
+// @ID record-play
+// @Accept  json
+// @Produce  json
+// @Param play body ListenRequest true "Played song"
+// @Param X-Session-Token header string false "Anonymous session token, if not sent as a cookie"
+// @Success 201 {object} ListenEntry
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /history [post]
+func RecordPlay(c *gin.Context) {
+	var req ListenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	if !songExists(c, int(req.SongID)) {
+		return
+	}
+	owner, ok := listenerFor(c, true)
+	if !ok {
+		return
+	}
+	entry := ListenEntry{UserID: owner.UserID, SessionID: owner.SessionID, SongID: req.SongID, PlayedAt: time.Now()}
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		return trimHistory(tx, owner)
+	})
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to record play")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to record play")
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
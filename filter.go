@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FilterSet - набор условий фильтрации. Имена колонок передаются в GORM
+// как clause.Column и экранируются диалектом базы (поэтому колонка group,
+// зарезервированное слово SQL, работает), а значения - только параметрами.
+type FilterSet struct {
+	table string
+	conds []clause.Expression
+}
+
+// NewFilterSet создает пустой набор; table уточняет колонки, если запрос
+// соединяет несколько таблиц
+func NewFilterSet(table string) *FilterSet {
+	return &FilterSet{table: table}
+}
+
+func (fs *FilterSet) column(name string) clause.Column {
+	return clause.Column{Table: fs.table, Name: name}
+}
+
+// Eq добавляет условие column = value
+func (fs *FilterSet) Eq(column string, value interface{}) *FilterSet {
+	fs.conds = append(fs.conds, clause.Eq{Column: fs.column(column), Value: value})
+	return fs
+}
+
+// Op добавляет условие с оператором из параметров запроса; оператор
+// проверяет FilterFields.Parse
+func (fs *FilterSet) Op(column, op string, value interface{}) *FilterSet {
+	col := fs.column(column)
+	switch op {
+	case filterOpEq:
+		fs.conds = append(fs.conds, clause.Eq{Column: col, Value: value})
+	case filterOpNe:
+		fs.conds = append(fs.conds, clause.Neq{Column: col, Value: value})
+	case filterOpLt:
+		fs.conds = append(fs.conds, clause.Lt{Column: col, Value: value})
+	case filterOpLte:
+		fs.conds = append(fs.conds, clause.Lte{Column: col, Value: value})
+	case filterOpGt:
+		fs.conds = append(fs.conds, clause.Gt{Column: col, Value: value})
+	case filterOpGte:
+		fs.conds = append(fs.conds, clause.Gte{Column: col, Value: value})
+	case filterOpContains:
+		fs.Contains(column, value.(string))
+	default:
+		panic("unknown filter operator " + op)
+	}
+	return fs
+}
+
+// Conds добавляет условия, разобранные FilterFields.Parse
+func (fs *FilterSet) Conds(conds []FilterCond) *FilterSet {
+	for _, cond := range conds {
+		fs.Op(cond.Column, cond.Op, cond.Value)
+	}
+	return fs
+}
+
+// Contains добавляет поиск подстроки; символы шаблона LIKE в substr
+// экранируются и совпадают буквально
+func (fs *FilterSet) Contains(column, substr string) *FilterSet {
+	pattern := "%" + likeEscaper.Replace(substr) + "%"
+	fs.conds = append(fs.conds, clause.Expr{
+		SQL:  `? LIKE ? ESCAPE '\'`,
+		Vars: []interface{}{fs.column(column), pattern},
+	})
+	return fs
+}
+
+// Apply добавляет все условия к запросу
+func (fs *FilterSet) Apply(query *gorm.DB) *gorm.DB {
+	if len(fs.conds) == 0 {
+		return query
+	}
+	return query.Where(clause.And(fs.conds...))
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Операторы фильтров в параметрах запроса: field=value - равенство,
+// field[op]=value - остальные
+const (
+	filterOpEq       = "eq"
+	filterOpNe       = "ne"
+	filterOpLt       = "lt"
+	filterOpLte      = "lte"
+	filterOpGt       = "gt"
+	filterOpGte      = "gte"
+	filterOpContains = "contains"
+)
+
+// Наборы операторов для типовых полей
+var (
+	filterOpsText    = []string{filterOpEq, filterOpNe, filterOpContains}
+	filterOpsOrdered = []string{filterOpEq, filterOpNe, filterOpLt, filterOpLte, filterOpGt, filterOpGte}
+	filterOpsEq      = []string{filterOpEq}
+)
+
+// FilterField - поле списка, доступное для фильтрации
+type FilterField struct {
+	Column string
+	Ops    []string
+	// Parse приводит значение к типу колонки; nil - строка
+	Parse func(string) (interface{}, error)
+}
+
+// FilterFields сопоставляет имена полей в JSON с колонками. В SQL попадают
+// только колонки отсюда, поэтому имя из запроса не может стать частью SQL.
+type FilterFields map[string]FilterField
+
+// FilterCond - проверенное условие из параметров запроса
+type FilterCond struct {
+	Field  string // имя в запросе
+	Column string
+	Op     string
+	Value  interface{}
+}
+
+// Parse разбирает параметры вида field=value и field[op]=value. Параметры
+// без скобок с незнакомыми именами пропускаются: это page, limit и другие
+// настройки списка. Условия возвращаются в порядке имен параметров.
+func (fields FilterFields) Parse(query url.Values) ([]FilterCond, error) {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var conds []FilterCond
+	for _, key := range keys {
+		name, op := key, filterOpEq
+		if i := strings.IndexByte(key, '['); i >= 0 && strings.HasSuffix(key, "]") {
+			name, op = key[:i], key[i+1:len(key)-1]
+		}
+		field, ok := fields[name]
+		if !ok {
+			if name != key {
+				return nil, fmt.Errorf("Unknown filter field %q", name)
+			}
+			continue
+		}
+		if !containsString(field.Ops, op) {
+			return nil, fmt.Errorf("Operator %q is not supported for %s", op, name)
+		}
+		for _, raw := range query[key] {
+			// Пустое значение - фильтра нет, как у необязательных параметров
+			if raw == "" {
+				continue
+			}
+			var value interface{} = raw
+			if field.Parse != nil {
+				var err error
+				if value, err = field.Parse(raw); err != nil {
+					return nil, fmt.Errorf("Invalid %s filter", name)
+				}
+			}
+			conds = append(conds, FilterCond{Field: name, Column: field.Column, Op: op, Value: value})
+		}
+	}
+	return conds, nil
+}
+
+// hasFilter сообщает, есть ли среди условий условие на поле name
+func hasFilter(conds []FilterCond, name string) bool {
+	for _, cond := range conds {
+		if cond.Field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Разбор значений фильтров
+func parseIntFilter(s string) (interface{}, error)    { return strconv.Atoi(s) }
+func parseBoolFilter(s string) (interface{}, error)   { return strconv.ParseBool(s) }
+func parseTimeFilter(s string) (interface{}, error)   { return time.Parse(time.RFC3339, s) }
+func parseSongIDFilter(s string) (interface{}, error) { return parseSongID(s) }
+
+// Поля GET /songs. Равенство по group, song, releaseDate, link и explicit
+// переносится в SongFilter, остальные условия - в SongFilter.Conds.
+var songFilterFields = FilterFields{
+	"id":          {Column: "id", Ops: filterOpsOrdered, Parse: parseSongIDFilter},
+	"group":       {Column: "group", Ops: filterOpsText},
+	"song":        {Column: "song_name", Ops: filterOpsText},
+	"releaseDate": {Column: "release_date", Ops: filterOpsOrdered, Parse: parseReleaseDateFilter},
+	"link":        {Column: "link", Ops: filterOpsText},
+	"explicit":    {Column: "explicit", Ops: filterOpsEq, Parse: parseBoolFilter},
+	"albumId":     {Column: "album_id", Ops: filterOpsEq, Parse: parseIntFilter},
+	"listeners":   {Column: "listeners", Ops: filterOpsOrdered, Parse: parseIntFilter},
+	"playcount":   {Column: "playcount", Ops: filterOpsOrdered, Parse: parseIntFilter},
+}
+
+// songFilterSet переводит параметры запроса в условия по колонкам songs.
+// Текст сюда не входит: поиск по нему выполняет searchLyrics.
+func songFilterSet(f SongFilter, table string) *FilterSet {
+	fs := NewFilterSet(table)
+	if f.Group != "" {
+		fs.Eq("group", f.Group)
+	}
+	if f.SongName != "" {
+		fs.Eq("song_name", f.SongName)
+	}
+	if !f.ReleaseDate.IsZero() {
+		fs.Eq("release_date", f.ReleaseDate)
+	}
+	if f.Link != "" {
+		fs.Eq("link", f.Link)
+	}
+	if f.Explicit != nil {
+		fs.Eq("explicit", *f.Explicit)
+	}
+	if f.OwnerID != nil {
+		fs.Eq("owner_id", *f.OwnerID)
+	}
+	return fs.Conds(f.Conds)
+}
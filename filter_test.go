@@ -0,0 +1,279 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var injectionPayloads = []string{
+	`' OR '1'='1`,
+	`Muse' OR 1=1 --`,
+	`Muse"; DROP TABLE songs; --`,
+	`Muse'); DELETE FROM songs; --`,
+	`\' OR 1=1 --`,
+}
+
+// dryRunPostgres возвращает подключение, которое только строит SQL
+func dryRunPostgres(t *testing.T) *gorm.DB {
+	t.Helper()
+	conn, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("open dry-run connection: %v", err)
+	}
+	return conn
+}
+
+func TestFilterSetQuotesReservedColumn(t *testing.T) {
+	conn := dryRunPostgres(t)
+	explicit := true
+	filter := SongFilter{Group: "Muse", SongName: "Uprising", Explicit: &explicit}
+
+	stmt := songFilterSet(filter, "songs").Apply(conn.Model(&Song{})).Find(&[]Song{}).Statement
+	sql := stmt.SQL.String()
+
+	for _, want := range []string{`"songs"."group" = $1`, `"songs"."song_name" = $2`, `"songs"."explicit" = $3`} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("SQL %q does not contain %q", sql, want)
+		}
+	}
+	if len(stmt.Vars) != 3 {
+		t.Errorf("got %d bound vars, want 3", len(stmt.Vars))
+	}
+}
+
+func TestFilterSetKeepsValuesOutOfSQL(t *testing.T) {
+	conn := dryRunPostgres(t)
+	for _, payload := range injectionPayloads {
+		filter := SongFilter{Group: payload, SongName: payload, Link: payload}
+		fs := songFilterSet(filter, "").Contains("text", payload)
+		stmt := fs.Apply(conn.Model(&Song{})).Find(&[]Song{}).Statement
+
+		sql := stmt.SQL.String()
+		if strings.Contains(sql, payload) {
+			t.Errorf("payload %q leaked into SQL: %s", payload, sql)
+		}
+		if len(stmt.Vars) != 4 {
+			t.Errorf("payload %q: got %d bound vars, want 4", payload, len(stmt.Vars))
+		}
+	}
+}
+
+func TestFilterSetAppliesAllFilters(t *testing.T) {
+	conn := setupTestDB(t)
+	seedGoldenSongs(t)
+
+	cases := []struct {
+		filter SongFilter
+		want   []string
+	}{
+		{SongFilter{}, []string{"Supermassive Black Hole", "Bohemian Rhapsody"}},
+		{SongFilter{Group: "Muse"}, []string{"Supermassive Black Hole"}},
+		{SongFilter{SongName: "Bohemian Rhapsody"}, []string{"Bohemian Rhapsody"}},
+		{SongFilter{ReleaseDate: mustReleaseDate("16.07.2006")}, []string{"Supermassive Black Hole"}},
+		{SongFilter{ReleaseDate: mustReleaseDate("2006-07-16")}, []string{"Supermassive Black Hole"}},
+		{SongFilter{Group: "Muse", SongName: "Bohemian Rhapsody"}, nil},
+	}
+	for _, tc := range cases {
+		var songs []Song
+		if err := songFilterSet(tc.filter, "").Apply(conn.Model(&Song{})).Order("id").Find(&songs).Error; err != nil {
+			t.Fatalf("%+v: query failed: %v", tc.filter, err)
+		}
+		var got []string
+		for _, s := range songs {
+			got = append(got, s.SongName)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%+v: got %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+}
+
+func TestFilterSetContainsMatchesLiterally(t *testing.T) {
+	conn := setupTestDB(t)
+	conn.Create(&Song{Group: "A", SongName: "percent", Text: "100% love"})
+	conn.Create(&Song{Group: "B", SongName: "plain", Text: "1000 loves"})
+
+	var songs []Song
+	if err := NewFilterSet("").Contains("text", "0% l").Apply(conn.Model(&Song{})).Find(&songs).Error; err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(songs) != 1 || songs[0].SongName != "percent" {
+		t.Errorf("got %+v, want only the song with a literal %%", songs)
+	}
+}
+
+func TestGetSongsRejectsInjection(t *testing.T) {
+	conn := setupTestDB(t)
+	seedGoldenSongs(t)
+	router := newTestRouter()
+
+	for _, payload := range injectionPayloads {
+		for _, param := range []string{"group", "song", "releaseDate", "link"} {
+			w := doRequest(router, http.MethodGet, "/songs?"+url.Values{param: {payload}}.Encode(), "")
+			// Дата проверяется до запроса: мусор отклоняется как неверный фильтр
+			if param == "releaseDate" {
+				if w.Code != http.StatusBadRequest {
+					t.Errorf("%s=%q: status %d, want %d: %s", param, payload, w.Code, http.StatusBadRequest, w.Body.String())
+				}
+				continue
+			}
+			if w.Code != http.StatusOK || w.Body.String() != "[]" {
+				t.Errorf("%s=%q: status %d: %s, want an empty list", param, payload, w.Code, w.Body.String())
+			}
+		}
+	}
+
+	var count int64
+	if err := conn.Model(&Song{}).Count(&count).Error; err != nil || count != 2 {
+		t.Fatalf("songs table damaged: count=%d err=%v", count, err)
+	}
+}
+
+func TestFilterFieldsParse(t *testing.T) {
+	conds, err := songFilterFields.Parse(url.Values{
+		"group":          {"Muse"},
+		"listeners[gte]": {"100"},
+		"song[contains]": {"Hole"},
+		"page":           {"2"},
+		"explicit":       {""},
+	})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := []FilterCond{
+		{Field: "group", Column: "group", Op: filterOpEq, Value: "Muse"},
+		{Field: "listeners", Column: "listeners", Op: filterOpGte, Value: 100},
+		{Field: "song", Column: "song_name", Op: filterOpContains, Value: "Hole"},
+	}
+	if len(conds) != len(want) {
+		t.Fatalf("got %+v, want %+v", conds, want)
+	}
+	for i := range want {
+		if conds[i] != want[i] {
+			t.Errorf("cond %d: got %+v, want %+v", i, conds[i], want[i])
+		}
+	}
+
+	for _, query := range []url.Values{
+		{"group[lt]": {"Muse"}},
+		{"explicit[ne]": {"true"}},
+		{"listeners[gt]": {"1 OR 1=1"}},
+		{"owner_id[eq]": {"1"}},
+		{`group" OR 1=1 --[eq]`: {"x"}},
+		{"group[eq) OR (1=1]": {"x"}},
+		{"id[gt]": {"1; DROP TABLE songs"}},
+	} {
+		if conds, err := songFilterFields.Parse(query); err == nil {
+			t.Errorf("%v: got %+v, want error", query, conds)
+		}
+	}
+}
+
+func TestFilterSetOperatorsKeepValuesOutOfSQL(t *testing.T) {
+	conn := dryRunPostgres(t)
+	for _, payload := range injectionPayloads {
+		fs := NewFilterSet("songs")
+		for _, op := range []string{filterOpEq, filterOpNe, filterOpLt, filterOpLte, filterOpGt, filterOpGte, filterOpContains} {
+			fs.Op("group", op, payload)
+		}
+		stmt := fs.Apply(conn.Model(&Song{})).Find(&[]Song{}).Statement
+
+		sql := stmt.SQL.String()
+		if strings.Contains(sql, payload) {
+			t.Errorf("payload %q leaked into SQL: %s", payload, sql)
+		}
+		for _, want := range []string{`"songs"."group" <> $2`, `"songs"."group" >= $6`, `"songs"."group" LIKE $7`} {
+			if !strings.Contains(sql, want) {
+				t.Errorf("SQL %q does not contain %q", sql, want)
+			}
+		}
+		if len(stmt.Vars) != 7 {
+			t.Errorf("payload %q: got %d bound vars, want 7", payload, len(stmt.Vars))
+		}
+	}
+}
+
+func TestGetSongsFilterOperators(t *testing.T) {
+	conn := setupTestDB(t)
+	seedGoldenSongs(t)
+	conn.Model(&Song{}).Where("song_name = ?", "Bohemian Rhapsody").Update("listeners", 500)
+	router := newTestRouter()
+
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{"id[gt]=1", "Bohemian Rhapsody"},
+		{"group[ne]=Muse", "Bohemian Rhapsody"},
+		{"song[contains]=Black", "Supermassive Black Hole"},
+		{"listeners[gte]=100", "Bohemian Rhapsody"},
+		{"listeners[lt]=100&group=Muse", "Supermassive Black Hole"},
+	}
+	for _, tc := range cases {
+		w := doRequest(router, http.MethodGet, "/songs?"+tc.query, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status %d: %s", tc.query, w.Code, w.Body.String())
+			continue
+		}
+		if strings.Count(w.Body.String(), `"id"`) != 1 || !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("%s: got %s, want only %q", tc.query, w.Body.String(), tc.want)
+		}
+	}
+}
+
+func TestGetSongsRejectsInjectionInOperators(t *testing.T) {
+	conn := setupTestDB(t)
+	seedGoldenSongs(t)
+	router := newTestRouter()
+
+	for _, payload := range injectionPayloads {
+		for _, param := range []string{"group[contains]", "song[ne]", "link[contains]"} {
+			w := doRequest(router, http.MethodGet, "/songs?"+url.Values{param: {payload}}.Encode(), "")
+			if param == "song[ne]" {
+				// Ни одна песня не называется payload, поэтому возвращаются обе
+				if w.Code != http.StatusOK || strings.Count(w.Body.String(), `"id"`) != 2 {
+					t.Errorf("%s=%q: status %d: %s", param, payload, w.Code, w.Body.String())
+				}
+				continue
+			}
+			if w.Code != http.StatusOK || w.Body.String() != "[]" {
+				t.Errorf("%s=%q: status %d: %s, want an empty list", param, payload, w.Code, w.Body.String())
+			}
+		}
+		for _, param := range []string{"id[gt]", payload + "[eq]", "group[" + payload + "]"} {
+			w := doRequest(router, http.MethodGet, "/songs?"+url.Values{param: {payload}}.Encode(), "")
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s=%q: status %d, want %d: %s", param, payload, w.Code, http.StatusBadRequest, w.Body.String())
+			}
+		}
+	}
+
+	var count int64
+	if err := conn.Model(&Song{}).Count(&count).Error; err != nil || count != 2 {
+		t.Fatalf("songs table damaged: count=%d err=%v", count, err)
+	}
+}
+
+func TestGetSongsEmptyList(t *testing.T) {
+	setupTestDB(t)
+	seedGoldenSongs(t)
+	router := newTestRouter()
+
+	w := doRequest(router, http.MethodGet, "/songs?group=Nobody&format=jsonapi", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"data":[]`) || !strings.Contains(w.Body.String(), `"total":0`) {
+		t.Errorf("JSON:API: status %d: %s, want empty data and total 0", w.Code, w.Body.String())
+	}
+
+	emptySongs404 = true
+	t.Cleanup(func() { emptySongs404 = false })
+	w = doRequest(router, http.MethodGet, "/songs?group=Nobody", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("with EMPTY_SONGS_404: status %d: %s, want 404", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// Фаззинг компонентов, которые получают пользовательский ввод напрямую.
+// Запуск: go test -fuzz=FuzzSplitVerses (без -fuzz прогоняется только корпус).
+
+var lyricsSeeds = []string{
+	"",
+	"\n\n\n\n",
+	"one line",
+	"first\nverse\n\nsecond\nverse",
+	"crlf\r\nverse\r\n\r\nnext",
+	"<script>alert(1)</script>\n\n**bold** _it_ [x](y)",
+	"\xff\xfe invalid utf8 \n\n\x00",
+}
+
+func FuzzSplitVerses(f *testing.F) {
+	for _, seed := range lyricsSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		for i, verse := range splitVerses(text) {
+			if verse == "" {
+				t.Fatalf("verse %d is empty", i)
+			}
+			if strings.Contains(verse, verseSeparator) {
+				t.Fatalf("verse %d contains a separator: %q", i, verse)
+			}
+		}
+	})
+}
+
+func FuzzFormatLyricsHTML(f *testing.F) {
+	for _, seed := range lyricsSeeds {
+		f.Add(seed)
+	}
+	tags := strings.NewReplacer("<p>", "", "</p>", "", "<br>", "")
+	f.Fuzz(func(t *testing.T, text string) {
+		out, err := formatLyrics(text, lyricsFormatHTML)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// Кроме собственной разметки, в выводе не должно быть тегов
+		if rest := tags.Replace(out); strings.ContainsAny(rest, "<>") {
+			t.Fatalf("unescaped markup in %q", out)
+		}
+	})
+}
+
+func FuzzFormatLyricsMarkdown(f *testing.F) {
+	for _, seed := range lyricsSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		if _, err := formatLyrics(text, lyricsFormatMarkdown); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func FuzzProfanityMask(f *testing.F) {
+	for _, seed := range lyricsSeeds {
+		f.Add(seed, "")
+	}
+	f.Add("Badword, BADWORD! badwords", "en")
+	filter := &ProfanityFilter{words: map[string]map[string]struct{}{
+		"en": {"badword": {}},
+		"ru": {"плохое": {}},
+	}}
+	f.Fuzz(func(t *testing.T, text, lang string) {
+		out := filter.Mask(text, lang)
+		if utf8.RuneCountInString(out) != utf8.RuneCountInString(text) {
+			t.Fatalf("mask changed length: %q -> %q", text, out)
+		}
+		if filter.Contains(out) && lang == "" {
+			t.Fatalf("masked text still contains profanity: %q", out)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const geniusAPIURL = "https://api.genius.com"
+
+// GeniusConfig - параметры источника текстов Genius
+type GeniusConfig struct {
+	Token     string // client access token приложения Genius
+	APIURL    string
+	Timeout   time.Duration
+	CacheTTL  time.Duration // 0 - без кеша
+	CacheSize int
+}
+
+// GeniusProvider ищет песню через API Genius и берет текст со страницы
+// песни: в самом API текстов нет.
+type GeniusProvider struct {
+	cfg  GeniusConfig
+	http *http.Client
+}
+
+func NewGeniusProvider(cfg GeniusConfig) (*GeniusProvider, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("GENIUS_TOKEN must be set")
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = geniusAPIURL
+	}
+	cfg.APIURL = strings.TrimSuffix(cfg.APIURL, "/")
+	return &GeniusProvider{cfg: cfg, http: trackHTTP(&http.Client{Timeout: cfg.Timeout}, providerGenius, dependencyEnrichment)}, nil
+}
+
+// Ответ /search, только нужные поля
+type geniusSearchResponse struct {
+	Response struct {
+		Hits []struct {
+			Type   string `json:"type"`
+			Result struct {
+				URL           string `json:"url"`
+				PrimaryArtist struct {
+					Name string `json:"name"`
+				} `json:"primary_artist"`
+			} `json:"result"`
+		} `json:"hits"`
+	} `json:"response"`
+}
+
+func (p *GeniusProvider) Lyrics(ctx context.Context, group, song string) (string, error) {
+	pageURL, err := p.search(ctx, group, song)
+	if err != nil {
+		return "", err
+	}
+	return p.fetchLyrics(ctx, pageURL)
+}
+
+// search возвращает адрес страницы песни исполнителя group
+func (p *GeniusProvider) search(ctx context.Context, group, song string) (string, error) {
+	params := url.Values{"q": {group + " " + song}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.APIURL+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("build genius request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("genius search: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("genius search returned status %d", resp.StatusCode)
+	}
+
+	var result geniusSearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode genius response: %w", err)
+	}
+	// Поиск полнотекстовый: первым может оказаться кавер или пародия
+	for _, hit := range result.Response.Hits {
+		if hit.Type == "song" && strings.EqualFold(hit.Result.PrimaryArtist.Name, group) {
+			return hit.Result.URL, nil
+		}
+	}
+	return "", ErrLyricsNotFound
+}
+
+func (p *GeniusProvider) fetchLyrics(ctx context.Context, pageURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("build genius page request: %w", err)
+	}
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("genius page: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrLyricsNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("genius page returned status %d", resp.StatusCode)
+	}
+
+	text, err := extractGeniusLyrics(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("parse genius page: %w", err)
+	}
+	if text == "" {
+		// Инструментал или текст еще не добавлен
+		return "", ErrLyricsNotFound
+	}
+	return text, nil
+}
+
+// Заголовки частей песни: [Verse 1], [Chorus: Freddie Mercury]
+var geniusSectionHeader = regexp.MustCompile(`^\[[^\]]*\]$`)
+
+// extractGeniusLyrics собирает текст из блоков data-lyrics-container:
+// <br> - перевод строки, остальные теги отбрасываются. Заголовки частей
+// убираются, куплеты разделяются пустой строкой, как в остальных песнях.
+func extractGeniusLyrics(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	var walk func(n *html.Node, inside bool)
+	walk = func(n *html.Node, inside bool) {
+		if n.Type == html.ElementNode {
+			if htmlAttr(n, "data-exclude-from-selection") == "true" {
+				return
+			}
+			if !inside && htmlAttr(n, "data-lyrics-container") == "true" {
+				// Блоки идут подряд, граница между ними - конец строки
+				if b.Len() > 0 {
+					b.WriteString("\n")
+				}
+				inside = true
+			}
+			if inside && n.Data == "br" {
+				b.WriteString("\n")
+			}
+		}
+		if inside && n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child, inside)
+		}
+	}
+	walk(doc, false)
+
+	var lines []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if geniusSectionHeader.MatchString(line) {
+			// Заголовок начинает новый куплет
+			line = ""
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(splitVerses(strings.Join(lines, "\n")), verseSeparator), nil
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Golden-тесты фиксируют форму ответов каждого эндпоинта: переименование
+// поля или изменение обертки сразу видно в диффе testdata/golden.
+// Обновить эталоны: go test -run TestGolden -update
+
+var update = flag.Bool("update", false, "update golden files")
+
+type goldenCase struct {
+	name   string
+	method string
+	target string
+	body   string
+	token  string
+	// Заголовок If-Match запроса
+	ifMatch string
+	// Каталог без seedGoldenSongs: песня из кассеты еще не добавлена
+	emptyCatalog bool
+}
+
+// goldenResponse - то, что сохраняется в эталонном файле
+type goldenResponse struct {
+	Status      int             `json:"status"`
+	ContentType string          `json:"contentType"`
+	Body        json.RawMessage `json:"body"`
+}
+
+func seedGoldenSongs(t *testing.T) {
+	t.Helper()
+	songs := []Song{
+		{Group: "Muse", SongName: "Supermassive Black Hole", ReleaseDate: mustReleaseDate("16.07.2006"),
+			Text: "Ooh baby, don't you know I suffer?\nOoh baby, can you hear me moan?\n\nOoh\nYou set my soul alight",
+			Link: "https://www.youtube.com/watch?v=Xsp3_a-PMTw"},
+		{Group: "Queen", SongName: "Bohemian Rhapsody", ReleaseDate: mustReleaseDate("31.10.1975"),
+			Text: "Is this the real life?\nIs this just fantasy?", Link: "https://www.youtube.com/watch?v=fJ9rUzIMcZQ", Explicit: true},
+	}
+	for i := range songs {
+		if err := GetDB().Create(&songs[i]).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+}
+
+func TestGoldenResponses(t *testing.T) {
+	cases := []goldenCase{
+		{name: "get_songs", method: http.MethodGet, target: "/songs"},
+		{name: "get_songs_explicit", method: http.MethodGet, target: "/songs?explicit=true"},
+		{name: "get_songs_bad_filter", method: http.MethodGet, target: "/songs?explicit=maybe"},
+		{name: "get_songs_empty_page", method: http.MethodGet, target: "/songs?page=5"},
+		{name: "get_songs_mine_unauthenticated", method: http.MethodGet, target: "/songs?mine=true"},
+		{name: "get_song_text", method: http.MethodGet, target: "/songs/1/text?limit=40"},
+		{name: "get_song_text_html", method: http.MethodGet, target: "/songs/1/text?limit=1000&format=html"},
+		{name: "get_song_text_markdown", method: http.MethodGet, target: "/songs/1/text?limit=1000&format=markdown"},
+		{name: "get_song_text_bad_format", method: http.MethodGet, target: "/songs/1/text?format=pdf"},
+		{name: "get_song_text_not_found", method: http.MethodGet, target: "/songs/99/text"},
+		{name: "get_song_text_bad_id", method: http.MethodGet, target: "/songs/abc/text"},
+		{name: "add_song", method: http.MethodPost, target: "/songs", token: testAdminToken,
+			body: `{"group":"Muse","song":"Supermassive Black Hole"}`, emptyCatalog: true},
+		{name: "add_song_duplicate", method: http.MethodPost, target: "/songs", token: testAdminToken,
+			body: `{"group":"muse","song":"supermassive black hole"}`},
+		{name: "add_song_info_not_found", method: http.MethodPost, target: "/songs", token: testAdminToken,
+			body: `{"group":"Nobody","song":"Unknown"}`},
+		{name: "add_song_invalid", method: http.MethodPost, target: "/songs", token: testAdminToken, body: `{}`},
+		{name: "update_song", method: http.MethodPut, target: "/songs/2", token: testAdminToken,
+			body: `{"group":"Queen","song":"Bohemian Rhapsody","link":"https://example.com/queen","version":1}`},
+		{name: "update_song_not_found", method: http.MethodPut, target: "/songs/99", token: testAdminToken,
+			body: `{"group":"Queen","song":"Bohemian Rhapsody","version":1}`},
+		{name: "update_song_invalid", method: http.MethodPut, target: "/songs/2", token: testAdminToken, body: `{}`},
+		{name: "update_song_stale_version", method: http.MethodPut, target: "/songs/2", token: testAdminToken,
+			body: `{"group":"Queen","song":"Bohemian Rhapsody","version":3}`},
+		{name: "update_song_stale_if_match", method: http.MethodPut, target: "/songs/2", token: testAdminToken,
+			body: `{"group":"Queen","song":"Bohemian Rhapsody"}`, ifMatch: `"3"`},
+		{name: "update_song_version_required", method: http.MethodPut, target: "/songs/2", token: testAdminToken,
+			body: `{"group":"Queen","song":"Bohemian Rhapsody"}`},
+		{name: "update_song_bad_if_match", method: http.MethodPut, target: "/songs/2", token: testAdminToken,
+			body: `{"group":"Queen","song":"Bohemian Rhapsody"}`, ifMatch: `1"`},
+		{name: "update_song_unauthenticated", method: http.MethodPut, target: "/songs/2",
+			body: `{"group":"Queen","song":"Bohemian Rhapsody"}`},
+		{name: "delete_song", method: http.MethodDelete, target: "/songs/2", token: testAdminToken},
+		{name: "delete_song_not_found", method: http.MethodDelete, target: "/songs/99", token: testAdminToken},
+		{name: "login_invalid", method: http.MethodPost, target: "/auth/login", body: `{"username":"nobody","password":"wrong-password"}`},
+		{name: "admin_forbidden", method: http.MethodGet, target: "/admin/panics"},
+		{name: "admin_log_level", method: http.MethodPut, target: "/admin/log-level", token: testAdminToken,
+			body: `{"level":"info"}`},
+	}
+
+	cfg := testConfig()
+	cfg.Info.BaseURL = newInfoStub(t).URL
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestDB(t)
+			if !tc.emptyCatalog {
+				seedGoldenSongs(t)
+			}
+			router := newTestRouterWith(cfg)
+			handler := http.Handler(router)
+			if tc.ifMatch != "" {
+				handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					r.Header.Set("If-Match", tc.ifMatch)
+					router.ServeHTTP(w, r)
+				})
+			}
+
+			w := doRequestAs(handler, tc.method, tc.target, tc.body, tc.token)
+			got := goldenResponse{Status: w.Code, ContentType: w.Header().Get("Content-Type"), Body: w.Body.Bytes()}
+			if len(got.Body) == 0 {
+				got.Body = json.RawMessage("null")
+			}
+			assertGolden(t, tc.name, got)
+		})
+	}
+}
+
+func assertGolden(t *testing.T, name string, got goldenResponse) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(got); err != nil {
+		t.Fatalf("encode response: %v", err)
+	}
+	actual := buf.Bytes()
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, actual, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file (run with -update to create): %v", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("response differs from %s\n--- want\n%s\n--- got\n%s", path, expected, actual)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/bubannnnnnn/musik_api/api/songpb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// Методы, которым достаточно роли reader; остальным нужна editor
+var grpcReadMethods = map[string]bool{
+	songpb.SongService_ListSongs_FullMethodName:   true,
+	songpb.SongService_GetSong_FullMethodName:     true,
+	songpb.SongService_GetSongText_FullMethodName: true,
+}
+
+// songGRPCServer реализует SongService поверх того же SongStore, что и HTTP.
+// Новые песни сохраняются как есть, без обогащения: внутренние сервисы
+// присылают уже известные данные.
+type songGRPCServer struct {
+	songpb.UnimplementedSongServiceServer
+	store SongStore
+}
+
+// newGRPCServer создает сервер с проверкой API-ключа или токена из метаданных
+func newGRPCServer(adminToken string, store SongStore) *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(grpcAuth(adminToken)))
+	songpb.RegisterSongServiceServer(server, &songGRPCServer{store: store})
+	return server
+}
+
+// serveGRPC слушает второй порт до отмены ctx
+func serveGRPC(ctx context.Context, port string, server *grpc.Server) error {
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+	logrus.WithField("addr", lis.Addr().String()).Info("Serving gRPC")
+	return server.Serve(lis)
+}
+
+// grpcAuth - аналог Authenticate и RequireRole: x-api-key или
+// authorization: Bearer с токеном администратора или access-токеном
+func grpcAuth(adminToken string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		role, err := grpcRole(ctx, adminToken)
+		if err != nil {
+			return nil, err
+		}
+		required := RoleEditor
+		if grpcReadMethods[info.FullMethod] {
+			required = RoleReader
+		}
+		if !role.Allows(required) {
+			return nil, status.Error(codes.PermissionDenied, "insufficient permissions")
+		}
+		return handler(ctx, req)
+	}
+}
+
+func grpcRole(ctx context.Context, adminToken string) (Role, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get(apiKeyHeader); len(keys) > 0 {
+		key, err := authenticateAPIKey(ctx, keys[0])
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", status.Error(codes.Unauthenticated, "invalid or revoked API key")
+		}
+		if err != nil {
+			return "", status.Error(codes.Internal, "failed to authenticate")
+		}
+		return key.Role, nil
+	}
+	var raw string
+	if values := md.Get("authorization"); len(values) > 0 && len(values[0]) > 7 && strings.EqualFold(values[0][:7], "Bearer ") {
+		raw = values[0][7:]
+	}
+	if raw == "" {
+		return "", status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if adminToken != "" && subtle.ConstantTimeCompare([]byte(raw), []byte(adminToken)) == 1 {
+		return RoleAdmin, nil
+	}
+	claims, err := jwtKeys.Verify(raw)
+	if err != nil {
+		return "", status.Error(codes.Unauthenticated, "invalid or expired token")
+	}
+	return claims.Role, nil
+}
+
+// grpcStoreError переводит ошибку хранилища в статус gRPC
+func grpcStoreError(err error) error {
+	if errors.Is(err, ErrSongNotFound) {
+		return status.Error(codes.NotFound, "song not found")
+	}
+	if errors.Is(err, errVersionConflict) {
+		return status.Error(codes.Aborted, "song was changed by someone else")
+	}
+	logrus.WithError(err).Error("Song store request failed")
+	return status.Error(codes.Internal, "storage error")
+}
+
+func (s *songGRPCServer) ListSongs(ctx context.Context, req *songpb.ListSongsRequest) (*songpb.ListSongsResponse, error) {
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = 10
+	}
+	releaseDate, err := ParseReleaseDate(req.GetReleaseDate())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	q := SongQuery{
+		Filter: SongFilter{Group: req.GetGroup(), SongName: req.GetSong(), ReleaseDate: releaseDate, Link: req.GetLink()},
+		// Без курсора выборка начинается с первой песни
+		AfterID: int(req.GetAfterId()),
+		Limit:   limit,
+	}
+	songs, err := s.store.ListSongs(ctx, q)
+	if err != nil {
+		return nil, grpcStoreError(err)
+	}
+	resp := &songpb.ListSongsResponse{Songs: make([]*songpb.Song, len(songs))}
+	for i, song := range songs {
+		resp.Songs[i] = songToProto(song)
+	}
+	if len(songs) == limit {
+		resp.NextAfterId = int64(songs[len(songs)-1].ID)
+	}
+	return resp, nil
+}
+
+func (s *songGRPCServer) GetSong(ctx context.Context, req *songpb.GetSongRequest) (*songpb.Song, error) {
+	song, err := s.store.GetSong(ctx, int(req.GetId()))
+	if err != nil {
+		return nil, grpcStoreError(err)
+	}
+	return songToProto(song), nil
+}
+
+func (s *songGRPCServer) CreateSong(ctx context.Context, req *songpb.CreateSongRequest) (*songpb.Song, error) {
+	song, err := songFromProto(req.GetSong())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := validateSong(song); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	song.ID = 0
+	song.Explicit = song.Explicit || profanity.Contains(song.Text)
+	if err := s.store.CreateSong(ctx, &song); err != nil {
+		return nil, grpcStoreError(err)
+	}
+	if err := publishSongEvent(ctx, GetDB().WithContext(ctx), songEventCreated, song); err != nil {
+		logrus.WithError(err).Warn("Failed to publish webhook event")
+	}
+	return songToProto(song), nil
+}
+
+func (s *songGRPCServer) UpdateSong(ctx context.Context, req *songpb.UpdateSongRequest) (*songpb.Song, error) {
+	patch, err := songFromProto(req.GetSong())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	patch.OwnerID = nil // владелец не меняется через обновление
+	// Как в PUT /songs/{id}: без версии правка могла бы затереть чужую
+	if req.GetVersion() <= 0 {
+		return nil, status.Error(codes.FailedPrecondition, "version is required")
+	}
+	patch.Version = int(req.GetVersion())
+	song, err := s.store.UpdateSong(ctx, int(req.GetId()), patch)
+	if err != nil {
+		return nil, grpcStoreError(err)
+	}
+	if err := publishSongEvent(ctx, GetDB().WithContext(ctx), songEventUpdated, song); err != nil {
+		logrus.WithError(err).Warn("Failed to publish webhook event")
+	}
+	return songToProto(song), nil
+}
+
+func (s *songGRPCServer) DeleteSong(ctx context.Context, req *songpb.DeleteSongRequest) (*songpb.DeleteSongResponse, error) {
+	song, err := s.store.GetSong(ctx, int(req.GetId()))
+	if err == nil {
+		err = s.store.DeleteSong(ctx, song.ID)
+	}
+	if err != nil {
+		return nil, grpcStoreError(err)
+	}
+	if err := publishSongEvent(ctx, GetDB().WithContext(ctx), songEventDeleted, song); err != nil {
+		logrus.WithError(err).Warn("Failed to publish webhook event")
+	}
+	return &songpb.DeleteSongResponse{}, nil
+}
+
+func (s *songGRPCServer) GetSongText(ctx context.Context, req *songpb.GetSongTextRequest) (*songpb.GetSongTextResponse, error) {
+	song, err := s.store.GetSong(ctx, int(req.GetId()))
+	if err != nil {
+		return nil, grpcStoreError(err)
+	}
+	return &songpb.GetSongTextResponse{Text: song.Text}, nil
+}
+
+func songToProto(s Song) *songpb.Song {
+	out := &songpb.Song{
+		Id: int64(s.ID), Group: s.Group, Song: s.SongName, ReleaseDate: s.ReleaseDate.String(), Text: s.Text,
+		Link: s.Link, Album: s.Album, DurationMs: int64(s.DurationMs), Explicit: s.Explicit,
+		EnrichmentPending: s.EnrichmentPending, Listeners: s.Listeners, Playcount: s.Playcount,
+		Version: int64(s.Version),
+	}
+	if s.OwnerID != nil {
+		owner := int64(*s.OwnerID)
+		out.OwnerId = &owner
+	}
+	return out
+}
+
+func songFromProto(p *songpb.Song) (Song, error) {
+	releaseDate, err := ParseReleaseDate(p.GetReleaseDate())
+	if err != nil {
+		return Song{}, err
+	}
+	s := Song{
+		ID: int(p.GetId()), Group: p.GetGroup(), SongName: p.GetSong(), ReleaseDate: releaseDate,
+		Text: p.GetText(), Link: p.GetLink(), Album: p.GetAlbum(), DurationMs: int(p.GetDurationMs()),
+		Explicit: p.GetExplicit(),
+	}
+	if p != nil && p.OwnerId != nil {
+		owner := int(*p.OwnerId)
+		s.OwnerID = &owner
+	}
+	return s, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testDBSeq atomic.Int64
+
+// setupTestDB подменяет глобальное подключение базой SQLite в памяти
+func setupTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:test%d?mode=memory&cache=shared", testDBSeq.Add(1))
+	conn, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent), TranslateError: true})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	// SQLite в памяти не любит параллельную запись
+	sqlDB.SetMaxOpenConns(1)
+	if err := conn.Use(queryCounting{}); err != nil {
+		t.Fatalf("register query counter: %v", err)
+	}
+	if err := Migrate(conn); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	prev := db
+	db = conn
+	t.Cleanup(func() {
+		db = prev
+		sqlDB.Close()
+	})
+	return conn
+}
+
+const testAdminToken = "test-admin-token"
+
+// Постоянный X-Request-ID, чтобы тела ошибок в эталонах не менялись
+const testRequestID = "test-request-id"
+
+func testConfig() Config {
+	return Config{LogFormat: "json", AdminToken: testAdminToken, Info: InfoClientConfig{Timeout: 5 * time.Second}}
+}
+
+func newTestRouter() *gin.Engine {
+	return newTestRouterWith(testConfig())
+}
+
+func newTestRouterWith(cfg Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	enrichment = NewInfoClient(cfg.Info, nil)
+	return setupRouter(cfg)
+}
+
+// newInfoStub поднимает внешний API, который отвечает из кассеты
+// контрактных тестов; на незаписанные запросы - 404
+func newInfoStub(t *testing.T) *httptest.Server {
+	t.Helper()
+	data, err := os.ReadFile(infoCassettePath)
+	if err != nil {
+		t.Fatalf("read cassette: %v", err)
+	}
+	var recorded cassette
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		t.Fatalf("parse cassette: %v", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, it := range recorded.Interactions {
+			if it.Request.Method == r.Method && it.Request.URL == r.URL.RequestURI() {
+				for k, v := range it.Response.Headers {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(it.Response.Status)
+				io.WriteString(w, it.Response.Body)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func doRequest(router http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	return doRequestAs(router, method, target, body, "")
+}
+
+// doRequestAs выполняет запрос с токеном в заголовке Authorization
+func doRequestAs(router http.Handler, method, target, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(requestIDHeader, testRequestID)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// mustReleaseDate разбирает дату выхода для данных тестов
+func mustReleaseDate(s string) ReleaseDate {
+	d, err := ParseReleaseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// useTestJWTKeys включает выпуск access-токенов на время теста
+func useTestJWTKeys(t *testing.T) {
+	t.Helper()
+	keys, err := ParseJWTKeys("test:test-jwt-secret", "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := jwtKeys
+	jwtKeys = keys
+	t.Cleanup(func() { jwtKeys = prev })
+}
+
+// createTestUser добавляет пользователя с паролем; bcrypt с минимальной
+// стоимостью, чтобы не замедлять тесты
+func createTestUser(t *testing.T, username, password string, role Role) User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := User{Username: username, PasswordHash: string(hash), Role: role}
+	if err := GetDB().Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Кодеки публичных ID песен
+const (
+	idCodecNone   = "none"
+	idCodecOpaque = "opaque"
+)
+
+// Расширение спецификации у полей и параметров с ID песни: значение -
+// число или его публичная форма
+const extPublicID = "x-public-id"
+
+var errInvalidPublicID = errors.New("invalid ID")
+
+// IDCodec переводит ID песни в публичную строку и обратно. Публичная форма
+// не должна выдавать ни число песен в каталоге, ни порядок их добавления.
+type IDCodec interface {
+	Encode(id int) string
+	Decode(s string) (int, error)
+}
+
+// Кодек ID песен в ответах; nil - ID отдаются числами
+var publicIDs IDCodec
+
+// NewIDCodec создает кодек по ID_CODEC; nil - ID не скрываются
+func NewIDCodec(name, secret string) (IDCodec, error) {
+	switch name {
+	case "", idCodecNone:
+		return nil, nil
+	case idCodecOpaque:
+		if secret == "" {
+			return nil, errors.New("ID_CODEC_SECRET is required for the opaque ID codec")
+		}
+		return newOpaqueIDCodec(secret), nil
+	}
+	return nil, fmt.Errorf("unknown ID codec %q", name)
+}
+
+// PublicID - ID песни в JSON и XML: число без кодека и строка с ним. На
+// входе принимаются обе формы.
+type PublicID int
+
+func (id PublicID) MarshalJSON() ([]byte, error) {
+	if publicIDs == nil {
+		return strconv.AppendInt(nil, int64(id), 10), nil
+	}
+	return strconv.AppendQuote(nil, publicIDs.Encode(int(id))), nil
+}
+
+func (id *PublicID) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	if s == "null" {
+		return nil
+	}
+	v, err := parseSongID(s)
+	if err != nil {
+		return err
+	}
+	*id = PublicID(v)
+	return nil
+}
+
+func (id PublicID) MarshalText() ([]byte, error) {
+	return []byte(encodeSongID(int(id))), nil
+}
+
+// encodeSongID - ID песни в публичной форме для заголовков, ссылок и курсоров
+func encodeSongID(id int) string {
+	if publicIDs == nil {
+		return strconv.Itoa(id)
+	}
+	return publicIDs.Encode(id)
+}
+
+// parseSongID принимает и число, и публичную форму ID. Число принимается
+// всегда, чтобы старые клиенты и ссылки продолжали работать.
+func parseSongID(s string) (int, error) {
+	if id, err := strconv.Atoi(s); err == nil {
+		return id, nil
+	}
+	if publicIDs == nil {
+		return 0, errInvalidPublicID
+	}
+	return publicIDs.Decode(s)
+}
+
+// Публичная форма - только буквы, поэтому число с ней не спутать
+const opaqueIDAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// Длина публичного ID: 52^6 > 2^32, шесть букв вмещают любой uint32
+const opaqueIDLength = 6
+
+// opaqueIDCodec переставляет ID как uint32 сетью Фейстеля с ключом из
+// секрета и записывает результат буквами в перемешанном тем же секретом
+// алфавите. Соседние ID дают непохожие строки, а без секрета порядок и
+// число песен по ним не восстановить. ID больше uint32 отдаются числом.
+type opaqueIDCodec struct {
+	key      []byte
+	alphabet string
+}
+
+func newOpaqueIDCodec(secret string) *opaqueIDCodec {
+	c := &opaqueIDCodec{key: []byte(secret)}
+	letters := []byte(opaqueIDAlphabet)
+	// Перемешивание Фишера-Йейтса на байтах HMAC: у каждой установки свой алфавит
+	for i := len(letters) - 1; i > 0; i-- {
+		j := int(c.round(uint32(i), 0xff) % uint32(i+1))
+		letters[i], letters[j] = letters[j], letters[i]
+	}
+	c.alphabet = string(letters)
+	return c
+}
+
+const opaqueIDRounds = 4
+
+// round - функция раунда сети Фейстеля
+func (c *opaqueIDCodec) round(half uint32, n byte) uint32 {
+	mac := hmac.New(sha256.New, c.key)
+	var buf [5]byte
+	buf[0] = n
+	binary.BigEndian.PutUint32(buf[1:], half)
+	mac.Write(buf[:])
+	return binary.BigEndian.Uint32(mac.Sum(nil))
+}
+
+func (c *opaqueIDCodec) permute(v uint32) uint32 {
+	left, right := v>>16, v&0xffff
+	for i := 0; i < opaqueIDRounds; i++ {
+		left, right = right, left^(c.round(right, byte(i))&0xffff)
+	}
+	return left<<16 | right
+}
+
+func (c *opaqueIDCodec) unpermute(v uint32) uint32 {
+	left, right := v>>16, v&0xffff
+	for i := opaqueIDRounds - 1; i >= 0; i-- {
+		left, right = right^(c.round(left, byte(i))&0xffff), left
+	}
+	return left<<16 | right
+}
+
+func (c *opaqueIDCodec) Encode(id int) string {
+	if id < 0 || uint64(id) > 0xffffffff {
+		return strconv.Itoa(id)
+	}
+	v := uint64(c.permute(uint32(id)))
+	out := make([]byte, opaqueIDLength)
+	for i := opaqueIDLength - 1; i >= 0; i-- {
+		out[i] = c.alphabet[v%uint64(len(c.alphabet))]
+		v /= uint64(len(c.alphabet))
+	}
+	return string(out)
+}
+
+func (c *opaqueIDCodec) Decode(s string) (int, error) {
+	if len(s) != opaqueIDLength {
+		return 0, errInvalidPublicID
+	}
+	var v uint64
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(c.alphabet, s[i])
+		if digit < 0 {
+			return 0, errInvalidPublicID
+		}
+		v = v*uint64(len(c.alphabet)) + uint64(digit)
+	}
+	if v > 0xffffffff {
+		return 0, errInvalidPublicID
+	}
+	return int(c.unpermute(uint32(v))), nil
+}
+
+// songFields - поля Song без методов, чтобы songView мог подменить id
+type songFields Song
+
+// songView - песня в ответе с публичным ID
+type songView struct {
+	ID PublicID `json:"id"`
+	songFields
+}
+
+// publicSong подменяет ID песни публичной формой для ответа. Без кодека
+// песня отдается как есть; в журнал аудита и задачи песни пишутся с числом.
+func publicSong(song Song) interface{} {
+	if publicIDs == nil {
+		return song
+	}
+	return songView{ID: PublicID(song.ID), songFields: songFields(song)}
+}
+
+func publicSongs(songs []Song) interface{} {
+	if publicIDs == nil {
+		return songs
+	}
+	return songViews(songs)
+}
+
+func songViews(songs []Song) []songView {
+	views := make([]songView, len(songs))
+	for i, song := range songs {
+		views[i] = songView{ID: PublicID(song.ID), songFields: songFields(song)}
+	}
+	return views
+}
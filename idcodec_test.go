@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// ID песни числом в JSON или в пути ссылки; "id" - ID песни только в
+// ответах с песнями
+var (
+	bareSongID     = regexp.MustCompile(`"(songId|existingId)":\s*\d|/songs/\d`)
+	bareSongItemID = regexp.MustCompile(`"id":\s*\d`)
+)
+
+func TestResponsesHideSongIDs(t *testing.T) {
+	setupTestDB(t)
+	seedGoldenSongs(t)
+	prevCodec, prevJobs := publicIDs, jobs
+	publicIDs = newOpaqueIDCodec("test-secret")
+	jobs = NewJobQueue(GetDB(), JobQueueConfig{})
+	t.Cleanup(func() { publicIDs, jobs = prevCodec, prevJobs })
+	router := newTestRouter()
+	muse := encodeSongID(1)
+
+	requests := []struct {
+		method, target, body string
+		status               int
+		songs                bool // в теле песни
+	}{
+		{http.MethodGet, "/songs", "", http.StatusOK, true},
+		{http.MethodGet, "/songs?group=Muse", "", http.StatusOK, true},
+		{http.MethodPost, "/songs", `{"group":"Radiohead","song":"Creep"}`, http.StatusAccepted, true},
+		{http.MethodPost, "/songs", `{"group":"Muse","song":"Supermassive Black Hole"}`, http.StatusConflict, false},
+		{http.MethodGet, "/songs/" + muse + "/enrichment", "", http.StatusOK, false},
+		{http.MethodPost, "/songs/" + muse + "/notes", `{"body":"check the release date"}`, http.StatusCreated, false},
+		{http.MethodGet, "/songs/" + muse + "/notes", "", http.StatusOK, false},
+		{http.MethodPatch, "/songs/" + muse, `{"album":"Black Holes and Revelations","version":1}`, http.StatusOK, true},
+	}
+	for _, r := range requests {
+		w := doRequestAs(router, r.method, r.target, r.body, testAdminToken)
+		if w.Code != r.status {
+			t.Errorf("%s %s: status %d, want %d: %s", r.method, r.target, w.Code, r.status, w.Body)
+			continue
+		}
+		loc := bareSongID.FindString(w.Body.String())
+		if loc == "" && r.songs {
+			loc = bareSongItemID.FindString(w.Body.String())
+		}
+		if loc != "" {
+			t.Errorf("%s %s: bare song ID %q in body %s", r.method, r.target, loc, w.Body)
+		}
+		for name, values := range w.Header() {
+			for _, v := range values {
+				if bareSongID.MatchString(v) {
+					t.Errorf("%s %s: bare song ID in header %s: %s", r.method, r.target, name, v)
+				}
+			}
+		}
+	}
+
+	// Поиск по тексту работает только в PostgreSQL, поэтому фрагмент
+	// проверяется без запроса
+	out, err := json.Marshal([]LyricMatch{{ID: 1, Group: "Muse", SongName: "Supermassive Black Hole", Verse: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bareSongItemID.Match(out) || !strings.Contains(string(out), strconv.Quote(muse)) {
+		t.Errorf("lyric match = %s, want id %q", out, muse)
+	}
+}
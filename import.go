@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Колонки CSV импорта; group и song обязательны, порядок любой
+var importColumns = []string{"group", "song", "releaseDate", "link", "text"}
+
+// Сколько ошибок строк попадает в ответ; остальные только считаются
+const importMaxErrors = 100
+
+// Ошибка одной строки; Row - номер строки файла, заголовок - строка 1
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// Итог импорта
+type ImportResult struct {
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+func (r *ImportResult) fail(row int, err string) {
+	r.Failed++
+	if len(r.Errors) < importMaxErrors {
+		r.Errors = append(r.Errors, ImportRowError{Row: row, Error: err})
+	}
+}
+
+// importSource возвращает тело CSV: сам запрос с типом text/csv или поле
+// file формы multipart/form-data; файл читается потоком, без буфера на диске
+func importSource(c *gin.Context) (io.Reader, int, error) {
+	mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil {
+		return nil, http.StatusUnsupportedMediaType, errors.New("Content-Type must be text/csv or multipart/form-data")
+	}
+	switch mediaType {
+	case "text/csv":
+		return c.Request.Body, 0, nil
+	case "multipart/form-data":
+		parts, err := c.Request.MultipartReader()
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				return nil, http.StatusBadRequest, errors.New("missing file field")
+			}
+			if err != nil {
+				return nil, http.StatusBadRequest, err
+			}
+			if part.FormName() == "file" {
+				return part, 0, nil
+			}
+		}
+	}
+	return nil, http.StatusUnsupportedMediaType, errors.New("Content-Type must be text/csv or multipart/form-data")
+}
+
+// importHeader сопоставляет колонки заголовка с полями песни
+func importHeader(header []string) (map[string]int, error) {
+	columns := map[string]int{}
+	for i, name := range header {
+		// Excel дописывает BOM перед первой колонкой
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		column := ""
+		for _, known := range importColumns {
+			if strings.EqualFold(name, known) {
+				column = known
+			}
+		}
+		if column == "" {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if _, ok := columns[column]; ok {
+			return nil, fmt.Errorf("duplicate column %q", column)
+		}
+		columns[column] = i
+	}
+	for _, required := range []string{"group", "song"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing column %q", required)
+		}
+	}
+	return columns, nil
+}
+
+// songFromRecord проверяет строку и собирает из нее песню
+func songFromRecord(record []string, columns map[string]int) (Song, error) {
+	value := func(column string) string {
+		if i, ok := columns[column]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	song := Song{
+		Group:    value("group"),
+		SongName: value("song"),
+		Link:     value("link"),
+		Text:     value("text"),
+	}
+	var err error
+	if song.ReleaseDate, err = ParseReleaseDate(value("releaseDate")); err != nil {
+		return song, err
+	}
+	return song, validateSong(song)
+}
+
+// songMissingDetail сообщает, есть ли у песни пустые поля, которые заполняет обогащение
+func songMissingDetail(song Song) bool {
+	return song.ReleaseDate.IsZero() || song.Text == "" || song.Link == ""
+}
+
+// enrichImportedSong дополняет пустые поля сразу, если очереди нет. Ошибка
+// источника не отменяет импорт строки: песня сохраняется с enrichmentPending.
+func enrichImportedSong(c *gin.Context, info SongInfoProvider, song *Song) {
+	detail, err := info.SongDetail(c.Request.Context(), song.Group, song.SongName)
+	switch {
+	case errors.Is(err, ErrInfoNotFound):
+	case err != nil:
+		componentEntry(c, componentEnrichment).WithError(err).Warn("Failed to enrich imported song")
+		song.EnrichmentPending = true
+	default:
+		fillSongDetail(song, detail)
+		resolveYouTubeLink(c, song)
+	}
+}
+
+// importRow - проверенная строка, ждущая вставки
+type importRow struct {
+	row    int
+	song   Song
+	queued bool // обогащение поставлено в очередь
+}
+
+// prepareImportRow заполняет поля строки так же, как POST /songs
+func prepareImportRow(c *gin.Context, info SongInfoProvider, row int, song Song, enrich bool) importRow {
+	enrich = enrich && songMissingDetail(song)
+	queued := enrich && jobs != nil
+	if queued {
+		song.EnrichmentPending = true
+	} else if enrich {
+		enrichImportedSong(c, info, &song)
+	}
+	song.Explicit = profanity.Contains(song.Text)
+	setSongOwner(c, &song)
+	return importRow{row: row, song: song, queued: queued}
+}
+
+// storeImportRows вставляет строки одной транзакцией пачками по
+// insertBatchSize; задачи и события по песням - только после фиксации
+func storeImportRows(c *gin.Context, rows []importRow) error {
+	songs := make([]Song, len(rows))
+	queued := make([]bool, len(rows))
+	for i, r := range rows {
+		songs[i], queued[i] = r.song, r.queued
+	}
+	return inSongTx(c, func(w *songWrite) error {
+		// Импорт не ждет обогащения, поэтому приоритет ниже, чем у POST /songs
+		return w.createSongs(songs, queued, enrichmentQueue{missingOnly: true})
+	})
+}
+
+// importRows сохраняет накопленные строки. Если пачка не вставилась, строки
+// вставляются по одной, чтобы ошибка досталась только своей строке.
+func importRows(c *gin.Context, rows []importRow, result *ImportResult) {
+	if len(rows) == 0 {
+		return
+	}
+	if err := storeImportRows(c, rows); err != nil {
+		logEntry(c).WithError(err).WithField("rows", len(rows)).Warn("Failed to import batch, retrying row by row")
+		for i := range rows {
+			err := storeImportRows(c, rows[i:i+1])
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				result.fail(rows[i].row, "Song already exists")
+				continue
+			}
+			if err != nil {
+				logEntry(c).WithError(err).WithField("row", rows[i].row).Error("Failed to import song")
+				result.fail(rows[i].row, "Failed to store song")
+				continue
+			}
+			result.Imported++
+		}
+		return
+	}
+	result.Imported += len(rows)
+}
+
+// @Summary Import songs from CSV
+// @Description Bulk-load songs from a CSV file with a header row of columns group, song, releaseDate, link and text (group and song are required, order is free). The file is sent as the text/csv request body or as the "file" field of a multipart form and is parsed as a stream; each row is validated on its own, so bad rows are reported without stopping the import. Valid rows are inserted in batches of INSERT_BATCH_SIZE; if a batch fails, its rows are retried one by one. With enrich=true empty releaseDate, link and text fields are filled from the enrichment providers, in the background when the job queue is running.
+// @ID import-songs
+// @Accept text/csv
+// @Accept multipart/form-data
+// @Produce  json
+// @Param file formData file false "CSV file when sent as a multipart form"
+// @Param enrich query bool false "Fill missing fields from the enrichment providers"
+// @Success 200 {object} ImportResult
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 415 {object} APIError
+// @Router /songs/import [post]
+func ImportSongs(info SongInfoProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enrich, err := strconv.ParseBool(c.DefaultQuery("enrich", "false"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid enrich flag")
+			return
+		}
+		src, status, err := importSource(c)
+		if err != nil {
+			abortWithError(c, status, statusErrorCode(status), err.Error())
+			return
+		}
+
+		r := csv.NewReader(src)
+		header, err := r.Read()
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Missing or invalid CSV header")
+			return
+		}
+		columns, err := importHeader(header)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errorBody(err))
+			return
+		}
+
+		result := ImportResult{Errors: []ImportRowError{}}
+		// Строки вставляются пачками; уже прочитанные сохраняются и при
+		// оборванной загрузке
+		pending := make([]importRow, 0, insertBatchSize)
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				result.fail(parseErr.StartLine, parseErr.Err.Error())
+				continue
+			}
+			if err != nil {
+				// Загрузка оборвалась: уже сохраненные строки остаются
+				logEntry(c).WithError(err).Warn("Failed to read CSV upload")
+				result.fail(0, "Failed to read upload: "+err.Error())
+				break
+			}
+			row, _ := r.FieldPos(0)
+			song, err := songFromRecord(record, columns)
+			if err != nil {
+				result.fail(row, err.Error())
+				continue
+			}
+			pending = append(pending, prepareImportRow(c, info, row, song, enrich))
+			if len(pending) == insertBatchSize {
+				importRows(c, pending, &result)
+				pending = pending[:0]
+			}
+		}
+		importRows(c, pending, &result)
+		// Ошибки строк из пачек, сохраненных по одной, идут не по порядку
+		sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Row < result.Errors[j].Row })
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Размер импорта в бенчмарках: каталог, на котором вставка по одной строке
+// заметно медленнее пачек
+const benchImportRows = 100_000
+
+func benchmarkImportCSV() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("group,song,releaseDate,link,text\n")
+	for i := 0; i < benchImportRows; i++ {
+		fmt.Fprintf(&buf, "Group %d,Song %d,16.07.2006,https://www.youtube.com/watch?v=%d,\"Ooh baby, don't you know I suffer?\nOoh baby, can you hear me moan?\"\n", i%1000, i, i)
+	}
+	return buf.Bytes()
+}
+
+// benchmarkImport импортирует benchImportRows строк через POST /songs/import
+// в новую базу на каждой итерации; batchSize 1 - прежняя вставка по строке
+func benchmarkImport(b *testing.B, batchSize int) {
+	data := benchmarkImportCSV()
+	prev := insertBatchSize
+	insertBatchSize = batchSize
+	b.Cleanup(func() { insertBatchSize = prev })
+	gin.SetMode(gin.TestMode)
+
+	var elapsed time.Duration
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		setupTestDB(b)
+		r := newTestRouter()
+		req := httptest.NewRequest(http.MethodPost, "/songs/import", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "text/csv")
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		w := httptest.NewRecorder()
+		b.StartTimer()
+
+		start := time.Now()
+		r.ServeHTTP(w, req)
+		elapsed += time.Since(start)
+
+		var result ImportResult
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || result.Imported != benchImportRows {
+			b.Fatalf("import: status %d, %s", w.Code, w.Body.String())
+		}
+	}
+	b.ReportMetric(float64(benchImportRows*b.N)/elapsed.Seconds(), "rows/s")
+}
+
+func BenchmarkImportRowByRow(b *testing.B) {
+	benchmarkImport(b, 1)
+}
+
+func BenchmarkImportBatched(b *testing.B) {
+	benchmarkImport(b, 500)
+}
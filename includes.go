@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// includeSpec описывает связь, которую клиент может запросить через ?include=
+type includeSpec struct {
+	association string // имя поля-связи в модели
+	// Связь "один к одному" (belongs-to, has-one) подтягивается JOIN в том же
+	// запросе; "один ко многим" - отдельным Preload, одним запросом на все строки
+	join bool
+}
+
+// Связи песни, доступные в GET /songs?include=owner,tags,links
+var songIncludes = map[string]includeSpec{
+	"owner": {association: "Owner", join: true},
+	"tags":  {association: "Tags"},
+	"links": {association: "Links"},
+}
+
+// parseIncludes разбирает список через запятую и отклоняет неизвестные связи
+func parseIncludes(raw string, allowed map[string]includeSpec) ([]includeSpec, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var specs []includeSpec
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		spec, ok := allowed[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown include %q", name)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// applyIncludes добавляет к запросу JOIN или Preload для каждой связи.
+// После JOIN колонки основной таблицы в условиях нужно уточнять ее именем.
+func applyIncludes(query *gorm.DB, specs []includeSpec) *gorm.DB {
+	for _, spec := range specs {
+		if spec.join {
+			query = query.Joins(spec.association)
+		} else {
+			query = query.Preload(spec.association)
+		}
+	}
+	return query
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Состояния задач в GET /admin/jobs
+const (
+	jobStatusPending = "pending"
+	jobStatusRunning = "running"
+	jobStatusFailed  = "failed"
+)
+
+const defaultJobListLimit = 50
+
+var (
+	errJobNotFound  = errors.New("job not found")
+	errJobNotFailed = errors.New("job has not failed")
+	errJobRunning   = errors.New("job is running")
+)
+
+// Структура PausedJobQueue (приостановленная очередь). Хранится в базе,
+// чтобы пауза действовала на воркеры всех экземпляров.
+type PausedJobQueue struct {
+	Kind     string    `json:"kind" gorm:"primaryKey"`
+	PausedBy string    `json:"pausedBy"`
+	PausedAt time.Time `json:"pausedAt"`
+}
+
+// JobQueueStatus - очередь одного вида задач
+type JobQueueStatus struct {
+	Kind     string     `json:"kind"`
+	Pending  int64      `json:"pending"` // ждут воркера, включая отложенные повторы
+	Running  int64      `json:"running"`
+	Failed   int64      `json:"failed"`
+	Paused   bool       `json:"paused"`
+	PausedBy string     `json:"pausedBy,omitempty"`
+	PausedAt *time.Time `json:"pausedAt,omitempty"`
+	Handled  bool       `json:"handled"` // в этом экземпляре есть обработчик
+}
+
+// Queues возвращает очереди всех видов: с обработчиком, с задачами в базе
+// или приостановленные
+func (q *JobQueue) Queues(ctx context.Context) ([]JobQueueStatus, error) {
+	now := time.Now()
+	var rows []struct {
+		Kind    string
+		Pending int64
+		Running int64
+		Failed  int64
+	}
+	err := q.db.WithContext(ctx).Model(&Job{}).Select(`kind,
+		SUM(CASE WHEN failed_at IS NULL AND (locked_until IS NULL OR locked_until < ?) THEN 1 ELSE 0 END) AS pending,
+		SUM(CASE WHEN failed_at IS NULL AND locked_until >= ? THEN 1 ELSE 0 END) AS running,
+		SUM(CASE WHEN failed_at IS NOT NULL THEN 1 ELSE 0 END) AS failed`, now, now).
+		Group("kind").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	var paused []PausedJobQueue
+	if err := q.db.WithContext(ctx).Find(&paused).Error; err != nil {
+		return nil, err
+	}
+
+	queues := map[string]*JobQueueStatus{}
+	queue := func(kind string) *JobQueueStatus {
+		if queues[kind] == nil {
+			_, handled := q.handlers[kind]
+			queues[kind] = &JobQueueStatus{Kind: kind, Handled: handled}
+		}
+		return queues[kind]
+	}
+	for kind := range q.handlers {
+		queue(kind)
+	}
+	for _, row := range rows {
+		s := queue(row.Kind)
+		s.Pending, s.Running, s.Failed = row.Pending, row.Running, row.Failed
+	}
+	for _, p := range paused {
+		s := queue(p.Kind)
+		pausedAt := p.PausedAt
+		s.Paused, s.PausedBy, s.PausedAt = true, p.PausedBy, &pausedAt
+	}
+
+	list := make([]JobQueueStatus, 0, len(queues))
+	for _, s := range queues {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Kind < list[j].Kind })
+	return list, nil
+}
+
+// Pause останавливает выдачу задач вида воркерам; уже начатые доработают
+func (q *JobQueue) Pause(ctx context.Context, kind, actor string) error {
+	paused := PausedJobQueue{Kind: kind, PausedBy: actor, PausedAt: time.Now()}
+	return q.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&paused).Error
+}
+
+// Resume возобновляет очередь
+func (q *JobQueue) Resume(ctx context.Context, kind string) error {
+	if err := q.db.WithContext(ctx).Delete(&PausedJobQueue{Kind: kind}).Error; err != nil {
+		return err
+	}
+	q.notify()
+	return nil
+}
+
+// Retry возвращает упавшую задачу в очередь с обнуленными попытками.
+// LastError остается до следующего запуска.
+func (q *JobQueue) Retry(ctx context.Context, id int) error {
+	res := q.db.WithContext(ctx).Model(&Job{}).Where("id = ? AND failed_at IS NOT NULL", id).
+		Updates(map[string]interface{}{"failed_at": nil, "attempts": 0, "run_at": time.Now(), "locked_until": nil})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return q.explain(ctx, id, errJobNotFailed)
+	}
+	q.notify()
+	return nil
+}
+
+// RetryFailed возвращает в очередь все упавшие задачи вида; пустой kind -
+// всех видов
+func (q *JobQueue) RetryFailed(ctx context.Context, kind string) (int64, error) {
+	query := q.db.WithContext(ctx).Model(&Job{}).Where("failed_at IS NOT NULL")
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	res := query.Updates(map[string]interface{}{"failed_at": nil, "attempts": 0, "run_at": time.Now(), "locked_until": nil})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected > 0 {
+		q.notify()
+	}
+	return res.RowsAffected, nil
+}
+
+// Discard удаляет задачу, если ее сейчас не выполняет воркер
+func (q *JobQueue) Discard(ctx context.Context, id int) error {
+	now := time.Now()
+	res := q.db.WithContext(ctx).Where("id = ? AND (failed_at IS NOT NULL OR locked_until IS NULL OR locked_until < ?)", id, now).
+		Delete(&Job{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return q.explain(ctx, id, errJobRunning)
+	}
+	return nil
+}
+
+// DiscardFailed удаляет упавшие задачи вида; пустой kind - всех видов
+func (q *JobQueue) DiscardFailed(ctx context.Context, kind string) (int64, error) {
+	query := q.db.WithContext(ctx).Where("failed_at IS NOT NULL")
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	res := query.Delete(&Job{})
+	return res.RowsAffected, res.Error
+}
+
+// explain отличает отсутствующую задачу от задачи в неподходящем состоянии
+func (q *JobQueue) explain(ctx context.Context, id int, stateErr error) error {
+	var count int64
+	if err := q.db.WithContext(ctx).Model(&Job{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errJobNotFound
+	}
+	return stateErr
+}
+
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// jobQueueRunning отвечает 503, если очередь задач не запущена (jobs == nil)
+func jobQueueRunning(c *gin.Context) bool {
+	if jobs == nil {
+		abortWithError(c, http.StatusServiceUnavailable, codeUnavailable, "Job queue is not running")
+		return false
+	}
+	return true
+}
+
+// jobError отвечает на ошибку операции с задачей
+func jobError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, errJobNotFound):
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Job not found")
+	case errors.Is(err, errJobNotFailed):
+		abortWithError(c, http.StatusConflict, codeConflict, "Job has not failed")
+	case errors.Is(err, errJobRunning):
+		abortWithError(c, http.StatusConflict, codeConflict, "Job is running")
+	default:
+		logEntry(c).WithError(err).Error("Failed to " + action + " job")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to "+action+" job")
+	}
+}
+
+func jobIDParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid job ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// @Summary List job queues
+// @Description List job kinds with pending, running and failed counts, whether the queue is paused and whether this instance has a handler for it.
+// @ID list-job-queues
+// @Produce  json
+// @Success 200 {array} JobQueueStatus
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 500 {object} APIError
+// @Failure 503 {object} APIError "The job queue is not running"
+// @Router /admin/jobs/queues [get]
+func GetJobQueues(c *gin.Context) {
+	if !jobQueueRunning(c) {
+		return
+	}
+	queues, err := jobs.Queues(c.Request.Context())
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch job queues")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch job queues")
+		return
+	}
+	c.JSON(http.StatusOK, queues)
+}
+
+// @Summary Pause job queue
+// @Description Stop handing jobs of this kind to workers on every instance. Jobs already running finish; new jobs are still accepted and wait.
+// @ID pause-job-queue
+// @Produce  json
+// @Param kind path string true "Job kind, e.g. enrichment"
+// @Success 200 {object} Message
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 500 {object} APIError
+// @Failure 503 {object} APIError "The job queue is not running"
+// @Router /admin/jobs/queues/{kind}/pause [post]
+func PauseJobQueue(c *gin.Context) {
+	if !jobQueueRunning(c) {
+		return
+	}
+	if err := jobs.Pause(c.Request.Context(), c.Param("kind"), auditActor(c)); err != nil {
+		logEntry(c).WithError(err).Error("Failed to pause job queue")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to pause job queue")
+		return
+	}
+	logEntry(c).WithField("kind", c.Param("kind")).Warn("Job queue paused")
+	c.JSON(http.StatusOK, gin.H{"message": "Queue paused"})
+}
+
+// @Summary Resume job queue
+// @Description Let workers pick up jobs of this kind again.
+// @ID resume-job-queue
+// @Produce  json
+// @Param kind path string true "Job kind, e.g. enrichment"
+// @Success 200 {object} Message
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 500 {object} APIError
+// @Failure 503 {object} APIError "The job queue is not running"
+// @Router /admin/jobs/queues/{kind}/resume [post]
+func ResumeJobQueue(c *gin.Context) {
+	if !jobQueueRunning(c) {
+		return
+	}
+	if err := jobs.Resume(c.Request.Context(), c.Param("kind")); err != nil {
+		logEntry(c).WithError(err).Error("Failed to resume job queue")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to resume job queue")
+		return
+	}
+	logEntry(c).WithField("kind", c.Param("kind")).Warn("Job queue resumed")
+	c.JSON(http.StatusOK, gin.H{"message": "Queue resumed"})
+}
+
+// @Summary List jobs
+// @Description List jobs in one state with their payloads and last errors: failed jobs most recent first, pending and running jobs in the order workers take them.
+// @ID list-jobs
+// @Produce  json
+// @Param status query string false "failed (default), pending or running" Enums(failed, pending, running)
+// @Param kind query string false "Job kind"
+// @Param limit query int false "Maximum number of jobs" minimum(1)
+// @Success 200 {array} Job
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/jobs [get]
+func GetJobs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultJobListLimit)))
+	if err != nil || limit < 1 {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid limit")
+		return
+	}
+	now := time.Now()
+	query := dbFor(c).Model(&Job{})
+	switch c.DefaultQuery("status", jobStatusFailed) {
+	case jobStatusFailed:
+		query = query.Where("failed_at IS NOT NULL").Order("failed_at DESC, id DESC")
+	case jobStatusPending:
+		query = query.Where("failed_at IS NULL AND (locked_until IS NULL OR locked_until < ?)", now).Order("priority DESC, id")
+	case jobStatusRunning:
+		query = query.Where("failed_at IS NULL AND locked_until >= ?", now).Order("id")
+	default:
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid status")
+		return
+	}
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	list := []Job{}
+	if err := query.Limit(limit).Find(&list).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch jobs")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch jobs")
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Get job
+// @Description Get a job with its payload, attempts and last error.
+// @ID get-job
+// @Produce  json
+// @Param id path int true "Job ID"
+// @Success 200 {object} Job
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/jobs/{id} [get]
+func GetJob(c *gin.Context) {
+	id, ok := jobIDParam(c)
+	if !ok {
+		return
+	}
+	var job Job
+	err := dbFor(c).First(&job, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Job not found")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch job")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch job")
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// @Summary Retry failed job
+// @Description Put a failed job back into its queue with the attempt counter reset.
+// @ID retry-job
+// @Produce  json
+// @Param id path int true "Job ID"
+// @Success 200 {object} Message
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError "The job has not failed"
+// @Failure 500 {object} APIError
+// @Failure 503 {object} APIError "The job queue is not running"
+// @Router /admin/jobs/{id}/retry [post]
+func RetryJob(c *gin.Context) {
+	if !jobQueueRunning(c) {
+		return
+	}
+	id, ok := jobIDParam(c)
+	if !ok {
+		return
+	}
+	if err := jobs.Retry(c.Request.Context(), id); err != nil {
+		jobError(c, err, "retry")
+		return
+	}
+	logEntry(c).WithField("job_id", id).Warn("Failed job retried")
+	c.JSON(http.StatusOK, gin.H{"message": "Job queued"})
+}
+
+// @Summary Discard job
+// @Description Delete a failed or waiting job. A job a worker is running cannot be discarded.
+// @ID discard-job
+// @Produce  json
+// @Param id path int true "Job ID"
+// @Success 200 {object} Message
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError "The job is running"
+// @Failure 500 {object} APIError
+// @Failure 503 {object} APIError "The job queue is not running"
+// @Router /admin/jobs/{id} [delete]
+func DiscardJob(c *gin.Context) {
+	if !jobQueueRunning(c) {
+		return
+	}
+	id, ok := jobIDParam(c)
+	if !ok {
+		return
+	}
+	if err := jobs.Discard(c.Request.Context(), id); err != nil {
+		jobError(c, err, "discard")
+		return
+	}
+	logEntry(c).WithField("job_id", id).Warn("Job discarded")
+	c.JSON(http.StatusOK, gin.H{"message": "Job discarded"})
+}
+
+// @Summary Retry failed jobs
+// @Description Put all failed jobs, or those of one kind, back into their queues.
+// @ID retry-failed-jobs
+// @Produce  json
+// @Param kind query string false "Job kind; all kinds when empty"
+// @Success 200 {object} map[string]int64
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 500 {object} APIError
+// @Failure 503 {object} APIError "The job queue is not running"
+// @Router /admin/jobs/failed/retry [post]
+func RetryFailedJobs(c *gin.Context) {
+	if !jobQueueRunning(c) {
+		return
+	}
+	n, err := jobs.RetryFailed(c.Request.Context(), c.Query("kind"))
+	if err != nil {
+		jobError(c, err, "retry")
+		return
+	}
+	logEntry(c).WithFields(map[string]interface{}{"kind": c.Query("kind"), "count": n}).Warn("Failed jobs retried")
+	c.JSON(http.StatusOK, gin.H{"retried": n})
+}
+
+// @Summary Discard failed jobs
+// @Description Delete all failed jobs, or those of one kind.
+// @ID discard-failed-jobs
+// @Produce  json
+// @Param kind query string false "Job kind; all kinds when empty"
+// @Success 200 {object} map[string]int64
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 500 {object} APIError
+// @Failure 503 {object} APIError "The job queue is not running"
+// @Router /admin/jobs/failed [delete]
+func DiscardFailedJobs(c *gin.Context) {
+	if !jobQueueRunning(c) {
+		return
+	}
+	n, err := jobs.DiscardFailed(c.Request.Context(), c.Query("kind"))
+	if err != nil {
+		jobError(c, err, "discard")
+		return
+	}
+	logEntry(c).WithFields(map[string]interface{}{"kind": c.Query("kind"), "count": n}).Warn("Failed jobs discarded")
+	c.JSON(http.StatusOK, gin.H{"discarded": n})
+}
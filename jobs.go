@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrQueueFull возвращается Enqueue, когда очередь достигла лимита
+var ErrQueueFull = errors.New("job queue is full")
+
+// Структура Job (фоновая задача). Задачи хранятся в базе и переживают
+// перезапуск; захваченная задача невидима другим воркерам до LockedUntil.
+type Job struct {
+	ID          int             `json:"id" gorm:"primaryKey"`
+	Kind        string          `json:"kind" gorm:"not null"`
+	Payload     json.RawMessage `json:"payload" gorm:"type:jsonb" swaggertype:"object"`
+	Priority    int             `json:"priority" gorm:"not null;default:0;index:idx_jobs_pick,priority:1"`
+	Attempts    int             `json:"attempts" gorm:"not null;default:0"`
+	RunAt       time.Time       `json:"runAt" gorm:"not null;index:idx_jobs_pick,priority:2"`
+	LockedUntil *time.Time      `json:"lockedUntil"`
+	// Токен захвата: воркер записывает результат, только пока задача за ним
+	LockedBy    string     `json:"-"`
+	FailedAt    *time.Time `json:"failedAt"`
+	LastError   string     `json:"lastError"`
+	TraceParent string     `json:"-"` // трасса, поставившая задачу; ее продолжает воркер
+	// Ключ задачи, которая должна стоять в очереди в одном экземпляре, см. EnqueueUnique
+	UniqueKey *string   `json:"uniqueKey,omitempty" gorm:"uniqueIndex"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// JobHandler выполняет задачу одного вида
+type JobHandler func(ctx context.Context, payload json.RawMessage) error
+
+// JobQueueConfig - параметры пула воркеров
+type JobQueueConfig struct {
+	Workers      int           // число воркеров, больше горутин не запускается
+	Visibility   time.Duration // на сколько задача скрывается от других воркеров
+	PollInterval time.Duration
+	MaxDepth     int // 0 - без лимита
+	MaxAttempts  int
+}
+
+// JobQueue - ограниченный пул воркеров над таблицей jobs
+type JobQueue struct {
+	db       *gorm.DB
+	cfg      JobQueueConfig
+	handlers map[string]JobHandler
+	wake     chan struct{}
+	busy     atomic.Int64
+	wg       sync.WaitGroup
+}
+
+var jobs *JobQueue
+
+func NewJobQueue(db *gorm.DB, cfg JobQueueConfig) *JobQueue {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	return &JobQueue{
+		db:       db,
+		cfg:      cfg,
+		handlers: map[string]JobHandler{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Register задает обработчик для вида задач; вызывается до Start
+func (q *JobQueue) Register(kind string, handler JobHandler) {
+	q.handlers[kind] = handler
+}
+
+// Enqueue ставит задачу в очередь. Чем больше priority, тем раньше она будет выполнена.
+func (q *JobQueue) Enqueue(ctx context.Context, kind string, payload interface{}, priority int) error {
+	return q.EnqueueAt(ctx, kind, payload, priority, time.Now())
+}
+
+// EnqueueAt ставит задачу, которую воркеры возьмут не раньше runAt
+func (q *JobQueue) EnqueueAt(ctx context.Context, kind string, payload interface{}, priority int, runAt time.Time) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode job payload: %w", err)
+	}
+	if q.cfg.MaxDepth > 0 {
+		var depth int64
+		if err := q.db.WithContext(ctx).Model(&Job{}).Where("failed_at IS NULL").Count(&depth).Error; err != nil {
+			return fmt.Errorf("count queued jobs: %w", err)
+		}
+		if depth >= int64(q.cfg.MaxDepth) {
+			return ErrQueueFull
+		}
+	}
+
+	job := Job{Kind: kind, Payload: data, Priority: priority, RunAt: runAt, TraceParent: traceParent(ctx)}
+	if err := q.db.WithContext(ctx).Create(&job).Error; err != nil {
+		return fmt.Errorf("enqueue job: %w", err)
+	}
+	q.notify()
+	return nil
+}
+
+// EnqueueUnique ставит задачу, только если задачи с тем же ключом в очереди
+// нет; false - она уже стоит или выполняется. Ключ освобождается, когда
+// задача выполнена или окончательно провалилась.
+func (q *JobQueue) EnqueueUnique(ctx context.Context, key, kind string, payload interface{}, priority int) (bool, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return false, fmt.Errorf("encode job payload: %w", err)
+	}
+	job := Job{Kind: kind, Payload: data, Priority: priority, RunAt: time.Now(), TraceParent: traceParent(ctx), UniqueKey: &key}
+	res := q.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&job)
+	if res.Error != nil {
+		return false, fmt.Errorf("enqueue job: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return false, nil
+	}
+	q.notify()
+	return true, nil
+}
+
+// Start запускает воркеры; они завершаются после отмены ctx
+func (q *JobQueue) Start(ctx context.Context) {
+	for i := 0; i < q.cfg.Workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+}
+
+// Wait ждет завершения воркеров после отмены контекста
+func (q *JobQueue) Wait() {
+	q.wg.Wait()
+}
+
+func (q *JobQueue) work(ctx context.Context) {
+	defer q.wg.Done()
+	log := componentLogger(componentJobs)
+	for {
+		job, err := q.claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.WithError(err).Error("Failed to claim job")
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+			case <-time.After(q.cfg.PollInterval):
+			}
+			continue
+		}
+		q.run(ctx, job)
+	}
+}
+
+// claim захватывает следующую готовую задачу с наибольшим приоритетом
+func (q *JobQueue) claim(ctx context.Context) (*Job, error) {
+	var job Job
+	err := q.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		query := tx.Where("failed_at IS NULL AND run_at <= ? AND (locked_until IS NULL OR locked_until < ?)", now, now).
+			Where("kind NOT IN (?)", tx.Model(&PausedJobQueue{}).Select("kind")).
+			Order("priority DESC, id")
+		if tx.Dialector.Name() == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := query.First(&job).Error; err != nil {
+			return err
+		}
+		token, err := randomToken()
+		if err != nil {
+			return err
+		}
+		until := now.Add(q.cfg.Visibility)
+		job.Attempts++
+		job.LockedUntil = &until
+		job.LockedBy = token
+		return tx.Model(&job).Updates(map[string]interface{}{"attempts": job.Attempts, "locked_until": until, "locked_by": token}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (q *JobQueue) run(ctx context.Context, job *Job) {
+	q.busy.Add(1)
+	defer q.busy.Add(-1)
+
+	entry := componentLogger(componentJobs).WithFields(logrus.Fields{
+		"job_id": job.ID, "kind": job.Kind, "attempt": job.Attempts,
+	})
+	// Обработчик должен уложиться в таймаут видимости, иначе задачу возьмет другой воркер
+	runCtx, cancel := context.WithTimeout(ctx, q.cfg.Visibility)
+	defer cancel()
+	runCtx, span := tracer().Start(withTraceParent(runCtx, job.TraceParent), "job "+job.Kind,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.Int("job.id", job.ID), attribute.Int("job.attempt", job.Attempts)),
+	)
+	defer span.End()
+
+	err := q.call(runCtx, job)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	// Задачу, которую после истечения видимости захватил другой воркер,
+	// этот воркер уже не трогает
+	owned := q.db.WithContext(context.WithoutCancel(ctx)).Model(&Job{}).
+		Where("id = ? AND locked_by = ? AND attempts = ?", job.ID, job.LockedBy, job.Attempts)
+	if err == nil {
+		res := owned.Delete(&Job{})
+		if res.Error != nil {
+			entry.WithError(res.Error).Error("Failed to remove completed job")
+		} else if res.RowsAffected == 0 {
+			entry.Warn("Job completed after its lock expired")
+		} else {
+			entry.Debug("Job completed")
+		}
+		return
+	}
+
+	updates := map[string]interface{}{"locked_until": nil, "locked_by": "", "last_error": err.Error()}
+	if job.Attempts >= q.cfg.MaxAttempts {
+		updates["failed_at"] = time.Now()
+		// Проваленная задача остается для разбора, следующую можно поставить
+		updates["unique_key"] = nil
+		entry.WithError(err).Error("Job failed permanently")
+	} else {
+		updates["run_at"] = time.Now().Add(jobBackoff(job.Attempts))
+		entry.WithError(err).Warn("Job failed, will retry")
+	}
+	res := owned.Updates(updates)
+	if res.Error != nil {
+		entry.WithError(res.Error).Error("Failed to reschedule job")
+	} else if res.RowsAffected == 0 {
+		entry.Warn("Job failed after its lock expired")
+	}
+}
+
+func (q *JobQueue) call(ctx context.Context, job *Job) (err error) {
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler for job kind %q", job.Kind)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job.Payload)
+}
+
+// jobBackoff - экспоненциальная пауза перед повтором: 2с, 4с, 8с... но не больше 10 минут
+func jobBackoff(attempt int) time.Duration {
+	d := time.Second << attempt
+	if d <= 0 || d > 10*time.Minute {
+		return 10 * time.Minute
+	}
+	return d
+}
+
+// JobStats - метрики очереди
+type JobStats struct {
+	Pending          int64   `json:"pending"`
+	Running          int64   `json:"running"`
+	Failed           int64   `json:"failed"`
+	OldestPendingAge float64 `json:"oldestPendingAgeSeconds"`
+	Workers          int     `json:"workers"`
+	BusyWorkers      int64   `json:"busyWorkers"`
+}
+
+// Stats считает глубину и возраст очереди
+func (q *JobQueue) Stats(ctx context.Context) (JobStats, error) {
+	stats := JobStats{Workers: q.cfg.Workers, BusyWorkers: q.busy.Load()}
+	now := time.Now()
+	db := q.db.WithContext(ctx).Model(&Job{})
+
+	if err := db.Session(&gorm.Session{}).Where("failed_at IS NULL").Count(&stats.Pending).Error; err != nil {
+		return stats, err
+	}
+	if err := db.Session(&gorm.Session{}).Where("failed_at IS NULL AND locked_until >= ?", now).Count(&stats.Running).Error; err != nil {
+		return stats, err
+	}
+	if err := db.Session(&gorm.Session{}).Where("failed_at IS NOT NULL").Count(&stats.Failed).Error; err != nil {
+		return stats, err
+	}
+
+	var oldest Job
+	err := db.Session(&gorm.Session{}).Where("failed_at IS NULL").Order("created_at").Limit(1).Find(&oldest).Error
+	if err != nil {
+		return stats, err
+	}
+	if oldest.ID != 0 {
+		stats.OldestPendingAge = now.Sub(oldest.CreatedAt).Seconds()
+	}
+	return stats, nil
+}
+
+// PendingByKind считает невыполненные задачи (ждущие и захваченные) по видам
+func (q *JobQueue) PendingByKind(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		Kind  string
+		Count int64
+	}
+	err := q.db.WithContext(ctx).Model(&Job{}).Select("kind, COUNT(*) AS count").
+		Where("failed_at IS NULL").Group("kind").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	pending := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		pending[row.Kind] = row.Count
+	}
+	return pending, nil
+}
+
+// @Summary Job queue stats
+// @Description Queue depth, age of the oldest pending job and worker utilisation.
+// @ID get-job-stats
+// @Produce  json
+// @Success 200 {object} JobStats
+// @Failure 500 {object} APIError
+// @Failure 503 {object} APIError "The job queue is not running"
+// @Router /admin/jobs/stats [get]
+func GetJobStats(c *gin.Context) {
+	if !jobQueueRunning(c) {
+		return
+	}
+	stats, err := jobs.Stats(c.Request.Context())
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to collect job stats")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch job stats")
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
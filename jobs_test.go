@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestJobResultNeedsLease(t *testing.T) {
+	conn := setupTestDB(t)
+	q := NewJobQueue(conn, JobQueueConfig{Visibility: time.Minute, MaxAttempts: 3})
+	fail := false
+	q.Register("test", func(ctx context.Context, payload json.RawMessage) error {
+		if fail {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	ctx := context.Background()
+	if err := q.Enqueue(ctx, "test", struct{}{}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Первый воркер не уложился в видимость, задачу захватил второй
+	stale, err := q.claim(ctx)
+	if err != nil || stale == nil {
+		t.Fatalf("claim = %v, %v", stale, err)
+	}
+	conn.Model(&Job{}).Where("id = ?", stale.ID).Update("locked_until", time.Now().Add(-time.Second))
+	current, err := q.claim(ctx)
+	if err != nil || current == nil || current.ID != stale.ID {
+		t.Fatalf("second claim = %v, %v", current, err)
+	}
+
+	// Ни успех, ни ошибка первого воркера не меняют задачу второго
+	q.run(ctx, stale)
+	fail = true
+	q.run(ctx, stale)
+	var job Job
+	if err := conn.First(&job, stale.ID).Error; err != nil {
+		t.Fatalf("job removed by a stale worker: %v", err)
+	}
+	if job.LockedBy != current.LockedBy || job.LastError != "" || job.Attempts != 2 {
+		t.Fatalf("job changed by a stale worker: %+v", job)
+	}
+
+	fail = false
+	q.run(ctx, current)
+	if err := conn.First(&job, stale.ID).Error; err == nil {
+		t.Fatalf("completed job left in the queue: %+v", job)
+	}
+}
+
+func TestJobDashboardWithoutQueue(t *testing.T) {
+	setupTestDB(t)
+	prev := jobs
+	jobs = nil
+	t.Cleanup(func() { jobs = prev })
+	router := newTestRouter()
+
+	for _, r := range []struct{ method, target string }{
+		{http.MethodGet, "/admin/jobs/stats"},
+		{http.MethodGet, "/admin/jobs/queues"},
+		{http.MethodPost, "/admin/jobs/queues/enrichment/pause"},
+		{http.MethodPost, "/admin/jobs/1/retry"},
+		{http.MethodDelete, "/admin/jobs/failed"},
+	} {
+		if w := doRequestAs(router, r.method, r.target, "", testAdminToken); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s %s: status %d, body %s", r.method, r.target, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	jsonAPIContentType = "application/vnd.api+json"
+	formatJSONAPI      = "jsonapi"
+)
+
+// Типы ресурсов JSON:API
+const (
+	jsonAPISongs   = "songs"
+	jsonAPIArtists = "artists"
+	jsonAPIAlbums  = "albums"
+	jsonAPIUsers   = "users"
+)
+
+// Ссылка на ресурс: {"type": "albums", "id": "3"}
+type jsonAPIIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Связь; Data без omitempty: пустая связь по спецификации - null
+type jsonAPIRelationship struct {
+	Data  *jsonAPIIdentifier `json:"data"`
+	Links map[string]string  `json:"links,omitempty"`
+}
+
+// Поля песни без id и внешних ключей - они уходят в relationships
+type songAttributes struct {
+	Group             string            `json:"group"`
+	SongName          string            `json:"song"`
+	ReleaseDate       string            `json:"releaseDate"`
+	Text              string            `json:"text"`
+	Link              string            `json:"link"`
+	LinkConfidence    *float64          `json:"linkConfidence"`
+	Album             string            `json:"album"`
+	AlbumPosition     int               `json:"albumPosition"`
+	DurationMs        int               `json:"durationMs"`
+	Explicit          bool              `json:"explicit"`
+	EnrichmentPending bool              `json:"enrichmentPending"`
+	EnrichmentSources map[string]string `json:"enrichmentSources,omitempty"`
+	Archived          bool              `json:"archived"`
+	Listeners         int64             `json:"listeners"`
+	Playcount         int64             `json:"playcount"`
+	StatsUpdatedAt    *time.Time        `json:"statsUpdatedAt"`
+	Version           int               `json:"version"`
+	Tags              []SongTag         `json:"tags,omitempty"`
+	Links             SongLinks         `json:"links,omitempty"`
+}
+
+type songResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id"`
+	Attributes    songAttributes                 `json:"attributes"`
+	Relationships map[string]jsonAPIRelationship `json:"relationships"`
+	Links         map[string]string              `json:"links"`
+}
+
+// Документ с одной песней или списком; Data - songResource или []songResource
+type jsonAPIDocument struct {
+	Data  interface{}       `json:"data"`
+	Links map[string]string `json:"links,omitempty"`
+	Meta  *songsTotal       `json:"meta,omitempty"`
+}
+
+// wantsJSONAPI: ?format=jsonapi или Accept: application/vnd.api+json
+func wantsJSONAPI(c *gin.Context) bool {
+	if c.Query("format") == formatJSONAPI {
+		return true
+	}
+	return c.NegotiateFormat(gin.MIMEJSON, jsonAPIContentType) == jsonAPIContentType
+}
+
+func jsonAPIRelated(kind string, id int) jsonAPIRelationship {
+	ref := strconv.Itoa(id)
+	return jsonAPIRelationship{
+		Data:  &jsonAPIIdentifier{Type: kind, ID: ref},
+		Links: map[string]string{"related": "/" + kind + "/" + ref},
+	}
+}
+
+// artistIDs находит профили артистов по названиям групп песен. Песня не
+// ссылается на артиста, связь - совпадение group с именем профиля.
+func artistIDs(db *gorm.DB, songs []Song) (map[string]int, error) {
+	names := make([]string, 0, len(songs))
+	for _, song := range songs {
+		names = append(names, song.Group)
+	}
+	var artists []Artist
+	if err := db.Select("id", "name").Where("name IN ?", names).Find(&artists).Error; err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int, len(artists))
+	for _, artist := range artists {
+		ids[artist.Name] = artist.ID
+	}
+	return ids, nil
+}
+
+func newSongResource(s Song, artists map[string]int) songResource {
+	id := encodeSongID(s.ID)
+	res := songResource{
+		Type: jsonAPISongs,
+		ID:   id,
+		Attributes: songAttributes{
+			Group:             s.Group,
+			SongName:          s.SongName,
+			ReleaseDate:       s.ReleaseDate.String(),
+			Text:              s.Text,
+			Link:              s.Link,
+			LinkConfidence:    s.LinkConfidence,
+			Album:             s.Album,
+			AlbumPosition:     s.AlbumPosition,
+			DurationMs:        s.DurationMs,
+			Explicit:          s.Explicit,
+			EnrichmentPending: s.EnrichmentPending,
+			EnrichmentSources: s.EnrichmentSources,
+			Archived:          s.Archived,
+			Listeners:         s.Listeners,
+			Playcount:         s.Playcount,
+			StatsUpdatedAt:    s.StatsUpdatedAt,
+			Version:           s.Version,
+			Tags:              s.Tags,
+			Links:             s.Links,
+		},
+		Relationships: map[string]jsonAPIRelationship{
+			"artist": {}, "album": {}, "owner": {},
+		},
+		Links: map[string]string{"self": "/songs/" + id},
+	}
+	if artistID, ok := artists[s.Group]; ok {
+		res.Relationships["artist"] = jsonAPIRelated(jsonAPIArtists, artistID)
+	}
+	if s.AlbumID != nil {
+		res.Relationships["album"] = jsonAPIRelated(jsonAPIAlbums, *s.AlbumID)
+	}
+	// Пользователей читают только администраторы, поэтому без ссылки
+	if s.OwnerID != nil {
+		res.Relationships["owner"] = jsonAPIRelationship{Data: &jsonAPIIdentifier{Type: jsonAPIUsers, ID: strconv.Itoa(*s.OwnerID)}}
+	}
+	return res
+}
+
+// jsonAPIPageLinks строит self, first, prev и next по параметрам запроса.
+// Следующая страница есть, если обработчик выставил X-Next-Cursor; при
+// курсорной пагинации next продолжает курсор, иначе увеличивает page.
+func jsonAPIPageLinks(c *gin.Context) map[string]string {
+	link := func(set map[string]string) string {
+		q := c.Request.URL.Query()
+		for k, v := range set {
+			if v == "" {
+				q.Del(k)
+			} else {
+				q.Set(k, v)
+			}
+		}
+		return c.Request.URL.Path + "?" + q.Encode()
+	}
+	links := map[string]string{"self": c.Request.URL.RequestURI(), "first": link(map[string]string{"page": "1", "after": ""})}
+	next := c.Writer.Header().Get("X-Next-Cursor")
+	if c.Query("after") != "" {
+		if next != "" {
+			links["next"] = link(map[string]string{"after": next})
+		}
+		return links
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		return links
+	}
+	if page > 1 {
+		links["prev"] = link(map[string]string{"page": strconv.Itoa(page - 1)})
+	}
+	if next != "" {
+		links["next"] = link(map[string]string{"page": strconv.Itoa(page + 1)})
+	}
+	return links
+}
+
+// writeJSONAPI отдает песню или список песен документом JSON:API
+func writeJSONAPI(c *gin.Context, status int, songs []Song, list bool) {
+	artists, err := artistIDs(dbFor(c), songs)
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch artists for JSON:API relationships")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch songs")
+		return
+	}
+	resources := make([]songResource, len(songs))
+	for i, song := range songs {
+		resources[i] = newSongResource(song, artists)
+	}
+	doc := jsonAPIDocument{Data: resources}
+	if list {
+		doc.Links = jsonAPIPageLinks(c)
+		doc.Meta = requestSongsTotal(c)
+	} else {
+		doc.Data = resources[0]
+	}
+	// Без экранирования HTML: иначе & в ссылках пагинации станет \u0026
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		logEntry(c).WithError(err).Error("Failed to encode JSON:API document")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch songs")
+		return
+	}
+	c.Data(status, jsonAPIContentType, body.Bytes())
+}
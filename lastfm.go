@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	lastFMAPIURL = "https://ws.audioscrobbler.com/2.0/"
+	// Код ошибки Last.fm "Invalid parameters": трек или исполнитель не найден
+	lastFMErrNotFound = 6
+
+	jobKindLastFMRefresh = "lastfm_refresh"
+	defaultRefreshBatch  = 100
+)
+
+// LastFMConfig - параметры Last.fm; без API-ключа статистика не собирается
+type LastFMConfig struct {
+	APIKey  string
+	APIURL  string
+	Timeout time.Duration
+	MaxTags int // сколько верхних тегов сохранять
+}
+
+// LastFMClient получает теги и число слушателей трека
+type LastFMClient struct {
+	cfg  LastFMConfig
+	http *http.Client
+}
+
+// Клиент Last.fm; nil - шаг обогащения статистикой выключен
+var lastfm *LastFMClient
+
+func NewLastFMClient(cfg LastFMConfig) *LastFMClient {
+	if cfg.APIKey == "" {
+		return nil
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = lastFMAPIURL
+	}
+	return &LastFMClient{cfg: cfg, http: trackHTTP(&http.Client{Timeout: cfg.Timeout}, "lastfm", dependencyEnrichment)}
+}
+
+// Структура SongTag (тег Last.fm); порядок по ID - по популярности
+type SongTag struct {
+	ID     int    `json:"-" gorm:"primaryKey"`
+	SongID int    `json:"-" gorm:"not null;index"`
+	Name   string `json:"name" gorm:"not null"`
+}
+
+// LastFMStats - статистика трека
+type LastFMStats struct {
+	Listeners int64
+	Playcount int64
+	Tags      []string
+}
+
+// Ответ track.getInfo; числа Last.fm отдает строками
+type lastFMTrackResponse struct {
+	Error   int    `json:"error"`
+	Message string `json:"message"`
+	Track   struct {
+		Listeners string `json:"listeners"`
+		Playcount string `json:"playcount"`
+		TopTags   struct {
+			Tag []struct {
+				Name string `json:"name"`
+			} `json:"tag"`
+		} `json:"toptags"`
+	} `json:"track"`
+}
+
+// TrackStats запрашивает track.getInfo; autocorrect исправляет опечатки в названиях
+func (lc *LastFMClient) TrackStats(ctx context.Context, group, song string) (LastFMStats, error) {
+	params := url.Values{
+		"method":      {"track.getInfo"},
+		"api_key":     {lc.cfg.APIKey},
+		"artist":      {group},
+		"track":       {song},
+		"autocorrect": {"1"},
+		"format":      {"json"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, lc.cfg.APIURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return LastFMStats{}, fmt.Errorf("build last.fm request: %w", err)
+	}
+	resp, err := lc.http.Do(req)
+	if err != nil {
+		return LastFMStats{}, fmt.Errorf("%w: last.fm: %w", ErrInfoUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	// Ошибки приходят в теле, часто со статусом 200
+	var result lastFMTrackResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return LastFMStats{}, &InfoStatusError{StatusCode: resp.StatusCode}
+		}
+		return LastFMStats{}, fmt.Errorf("decode last.fm response: %w", err)
+	}
+	if result.Error == lastFMErrNotFound {
+		return LastFMStats{}, ErrInfoNotFound
+	}
+	if result.Error != 0 {
+		return LastFMStats{}, fmt.Errorf("last.fm error %d: %s", result.Error, result.Message)
+	}
+
+	stats := LastFMStats{}
+	stats.Listeners, _ = strconv.ParseInt(result.Track.Listeners, 10, 64)
+	stats.Playcount, _ = strconv.ParseInt(result.Track.Playcount, 10, 64)
+	for _, tag := range result.Track.TopTags.Tag {
+		if lc.cfg.MaxTags > 0 && len(stats.Tags) >= lc.cfg.MaxTags {
+			break
+		}
+		stats.Tags = append(stats.Tags, strings.ToLower(tag.Name))
+	}
+	return stats, nil
+}
+
+type lastFMRefreshPayload struct {
+	SongID int `json:"songId"`
+}
+
+// enqueueStatsRefresh ставит в очередь обновление статистики песни
+func enqueueStatsRefresh(ctx context.Context, songID int) error {
+	if lastfm == nil || jobs == nil {
+		return nil
+	}
+	return jobs.Enqueue(ctx, jobKindLastFMRefresh, lastFMRefreshPayload{SongID: songID}, 0)
+}
+
+// refreshStatsJob - обработчик задачи lastfm_refresh
+func refreshStatsJob(ctx context.Context, payload json.RawMessage) error {
+	var p lastFMRefreshPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	return refreshSongStats(ctx, GetDB().WithContext(ctx), lastfm, p.SongID)
+}
+
+// refreshSongStats обновляет счетчики и заменяет теги песни
+func refreshSongStats(ctx context.Context, db *gorm.DB, client *LastFMClient, songID int) error {
+	var song Song
+	if err := db.First(&song, songID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Песню удалили, пока задача ждала очереди
+			return nil
+		}
+		return err
+	}
+
+	stats, err := client.TrackStats(ctx, song.Group, song.SongName)
+	if errors.Is(err, ErrInfoNotFound) {
+		// Трека нет в Last.fm: время обновления запоминается, чтобы не
+		// спрашивать его снова в каждом обходе
+		return db.Model(&song).Update("stats_updated_at", time.Now()).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&song).Updates(map[string]interface{}{
+			"listeners":        stats.Listeners,
+			"playcount":        stats.Playcount,
+			"stats_updated_at": time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("song_id = ?", song.ID).Delete(&SongTag{}).Error; err != nil {
+			return err
+		}
+		if len(stats.Tags) == 0 {
+			return nil
+		}
+		tags := make([]SongTag, len(stats.Tags))
+		for i, name := range stats.Tags {
+			tags[i] = SongTag{SongID: song.ID, Name: name}
+		}
+		return tx.Create(&tags).Error
+	})
+	if err != nil {
+		return err
+	}
+	return purgeCache(ctx, cacheKeySongs)
+}
+
+// Тело запроса на обновление статистики
+type StatsRefreshRequest struct {
+	OlderThan string `json:"olderThan" binding:"required"` // например 168h; песни без статистики берутся всегда
+	Limit     int    `json:"limit"`
+}
+
+// @Summary Refresh Last.fm statistics
+// @Description Queue background jobs that refresh Last.fm tags and listener counts for songs with stale statistics.
+// @ID refresh-song-stats
+// @Accept  json
+// @Produce  json
+// @Param request body StatsRefreshRequest true "Staleness threshold and batch size"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} APIError
+// @Failure 500 {object} APIError
+// @Failure 503 {object} APIError
+// @Router /admin/lastfm/refresh [post]
+func RefreshSongStats(c *gin.Context) {
+	if lastfm == nil {
+		abortWithError(c, http.StatusServiceUnavailable, codeUnavailable, "Last.fm integration is not configured")
+		return
+	}
+	var req StatsRefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	age, err := time.ParseDuration(req.OlderThan)
+	if err != nil || age < 0 {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid olderThan duration")
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultRefreshBatch
+	}
+
+	var ids []int
+	err = dbFor(c).Model(&Song{}).
+		Where("stats_updated_at IS NULL OR stats_updated_at < ?", time.Now().Add(-age)).
+		Order("stats_updated_at NULLS FIRST, id").Limit(req.Limit).Pluck("id", &ids).Error
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to find songs with stale statistics")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to queue refresh")
+		return
+	}
+
+	queued := 0
+	for _, id := range ids {
+		if err := enqueueStatsRefresh(c.Request.Context(), id); err != nil {
+			logEntry(c).WithError(err).WithField(fieldSongID, id).Error("Failed to queue statistics refresh")
+			break
+		}
+		queued++
+	}
+	c.JSON(http.StatusAccepted, gin.H{"queued": queued})
+}
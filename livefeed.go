@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = 2 * wsPingInterval
+	wsReadLimit    = 4 << 10
+	// Сколько событий ждет отправки одному клиенту, прежде чем его отключат
+	liveEventBuffer = 64
+	// Сколько последних событий хранится для продолжения потока по ID
+	songEventHistory = 1000
+)
+
+// SongEvent - событие изменения песни, как его получают клиенты /ws и
+// /songs/events
+type SongEvent struct {
+	ID         int64     `json:"id"`
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Data       Song      `json:"data"`
+}
+
+// MarshalJSON отдает песню события с публичным ID
+func (e SongEvent) MarshalJSON() ([]byte, error) {
+	type plain SongEvent
+	if publicIDs == nil {
+		return json.Marshal(plain(e))
+	}
+	return json.Marshal(struct {
+		plain
+		Data interface{} `json:"data"`
+	}{plain(e), publicSong(e.Data)})
+}
+
+// SongEventBus раздает события подписчикам внутри процесса. Публикация не
+// ждет подписчиков: тот, кто не успевает читать, отключается.
+type SongEventBus struct {
+	mu      sync.Mutex
+	subs    map[chan SongEvent]struct{}
+	closed  bool
+	seq     int64
+	history []SongEvent
+}
+
+// Нумерация начинается с момента запуска в микросекундах, поэтому ID
+// прошлого процесса всегда меньше новых и распознается как пропуск
+func NewSongEventBus() *SongEventBus {
+	return &SongEventBus{subs: map[chan SongEvent]struct{}{}, seq: time.Now().UnixMicro()}
+}
+
+// Шина событий песен; события других экземпляров сервиса сюда не попадают
+var songEvents = NewSongEventBus()
+
+// SongSubscription - подписка на шину. C закрывается при Close, при
+// отставании подписчика и при остановке шины.
+type SongSubscription struct {
+	C       <-chan SongEvent
+	Backlog []SongEvent // события после since из истории, до первого события в C
+	Gap     bool        // часть событий после since уже не хранится
+	close   func()
+}
+
+func (s *SongSubscription) Close() { s.close() }
+
+// Subscribe подписывает на новые события. Если since не 0, в Backlog
+// попадают сохраненные события с ID больше since.
+func (b *SongEventBus) Subscribe(since int64, buffer int) *SongSubscription {
+	ch := make(chan SongEvent, buffer)
+	sub := &SongSubscription{C: ch, close: func() {}}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return sub
+	}
+	if since != 0 {
+		oldest := b.seq + 1
+		if len(b.history) > 0 {
+			oldest = b.history[0].ID
+		}
+		sub.Gap = since < oldest-1 || since > b.seq
+		for _, event := range b.history {
+			if event.ID > since {
+				sub.Backlog = append(sub.Backlog, event)
+			}
+		}
+	}
+	b.subs[ch] = struct{}{}
+	sub.close = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.drop(ch)
+	}
+	return sub
+}
+
+// Publish нумерует событие и передает его всем подписчикам
+func (b *SongEventBus) Publish(event SongEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	event.ID = b.seq
+	b.history = append(b.history, event)
+	if len(b.history) > songEventHistory {
+		b.history = b.history[len(b.history)-songEventHistory:]
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			componentLogger(componentEvents).WithField("event", event.Event).Warn("Song event subscriber is too slow, disconnecting")
+			b.drop(ch)
+		}
+	}
+}
+
+// Close отключает всех подписчиков; вызывается при остановке сервера
+func (b *SongEventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		b.drop(ch)
+	}
+}
+
+// Closed сообщает, остановлена ли шина
+func (b *SongEventBus) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+func (b *SongEventBus) drop(ch chan SongEvent) {
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// LiveFilter - фильтр подключения к /ws. Клиент может заменить его,
+// отправив этот JSON сообщением.
+type LiveFilter struct {
+	Events []string `json:"events"` // song.created, song.updated, song.deleted
+	Group  string   `json:"group"`  // группа песни, без учета регистра
+}
+
+func (f LiveFilter) webhookFilter() WebhookFilter {
+	return WebhookFilter{Events: f.Events, Artist: f.Group}
+}
+
+// liveFilterFromQuery читает начальный фильтр из параметров events и group
+func liveFilterFromQuery(c *gin.Context) (LiveFilter, error) {
+	filter := LiveFilter{Group: c.Query("group")}
+	if events := c.Query("events"); events != "" {
+		filter.Events = strings.Split(events, ",")
+	}
+	return filter, filter.webhookFilter().validate()
+}
+
+// Проверка источника отключена: доступ к /ws решает токен, как и у остальных маршрутов
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// Сообщение клиента: новый фильтр или ошибка его разбора
+type liveFilterUpdate struct {
+	filter LiveFilter
+	err    error
+}
+
+// @Summary Live song events
+// @Description Upgrade to a WebSocket and receive song.created, song.updated and song.deleted events as JSON messages {"event", "occurredAt", "data"}. The initial filter comes from the query; sending {"events": [...], "group": "..."} replaces it. Clients that fall behind are disconnected with close code 1013.
+// @ID song-events-socket
+// @Param events query string false "Comma-separated event types"
+// @Param group query string false "Only songs of this group"
+// @Success 101 {object} SongEvent
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Router /ws [get]
+func SongEventsSocket(c *gin.Context) {
+	filter, err := liveFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade уже ответил клиенту
+		logEntry(c).WithError(err).Debug("WebSocket upgrade failed")
+		return
+	}
+	defer conn.Close()
+
+	sub := songEvents.Subscribe(0, liveEventBuffer)
+	defer sub.Close()
+	updates := make(chan liveFilterUpdate)
+	done, stop := make(chan struct{}), make(chan struct{})
+	defer close(stop)
+	go readLiveFilters(conn, updates, done, stop)
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	match := filter.webhookFilter()
+	for {
+		var msg interface{}
+		select {
+		case <-done:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+			continue
+		case update := <-updates:
+			if update.err != nil {
+				msg = gin.H{"error": update.err.Error()}
+				break
+			}
+			match = update.filter.webhookFilter()
+			continue
+		case event, ok := <-sub.C:
+			if !ok {
+				code, reason := websocket.CloseTryAgainLater, "Client is too slow"
+				if songEvents.Closed() {
+					code, reason = websocket.CloseGoingAway, "Server is shutting down"
+				}
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason),
+					time.Now().Add(wsWriteTimeout))
+				return
+			}
+			if !match.Matches(event.Event, event.Data) {
+				continue
+			}
+			msg = event
+		}
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// readLiveFilters читает сообщения клиента, пока соединение открыто, и
+// отвечает за таймаут: без pong за wsPongTimeout соединение закрывается
+func readLiveFilters(conn *websocket.Conn, updates chan<- liveFilterUpdate, done chan<- struct{}, stop <-chan struct{}) {
+	defer close(done)
+	conn.SetReadLimit(wsReadLimit)
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var update liveFilterUpdate
+		if err := json.Unmarshal(data, &update.filter); err != nil {
+			update.err = err
+		} else {
+			update.err = update.filter.webhookFilter().validate()
+		}
+		select {
+		case updates <- update:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Событие потока /songs/events, после которого клиенту нужно заново
+// загрузить данные: часть событий после Last-Event-ID потеряна
+const sseEventReset = "reset"
+
+// @Summary Song change feed
+// @Description Stream song.created, song.updated and song.deleted events as Server-Sent Events. Each event's id can be passed back as the Last-Event-ID header or the since parameter to resume after a disconnect; if events after it are no longer kept, a "reset" event is sent first and the client should reload the catalog.
+// @ID song-event-stream
+// @Produce text/event-stream
+// @Param since query int false "Resume after this event ID; the Last-Event-ID header takes precedence"
+// @Param events query string false "Comma-separated event types"
+// @Param group query string false "Only songs of this group"
+// @Success 200 {object} SongEvent
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Router /songs/events [get]
+func SongEventStream(c *gin.Context) {
+	filter, err := liveFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	var since int64
+	raw := c.GetHeader("Last-Event-ID")
+	if raw == "" {
+		raw = c.Query("since")
+	}
+	if raw != "" {
+		if since, err = strconv.ParseInt(raw, 10, 64); err != nil || since < 0 {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid event ID")
+			return
+		}
+	}
+
+	sub := songEvents.Subscribe(since, liveEventBuffer)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("X-Accel-Buffering", "no") // nginx не должен копить поток
+	c.Status(http.StatusOK)
+	match := filter.webhookFilter()
+	send := func(event SongEvent) error {
+		if !match.Matches(event.Event, event.Data) {
+			return nil
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Event, data)
+		return err
+	}
+	if sub.Gap {
+		fmt.Fprintf(c.Writer, "event: %s\ndata: {}\n\n", sseEventReset)
+	}
+	for _, event := range sub.Backlog {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ping.C:
+			// Комментарий не дает прокси закрыть простаивающее соединение
+			if _, err := io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-sub.C:
+			// Отставший клиент переподключится с Last-Event-ID и получит пропущенное
+			if !ok {
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
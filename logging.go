@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Единые имена полей для структурированных логов
+const (
+	fieldRequestID = "request_id"
+	fieldRoute     = "route"
+	fieldUserID    = "user_id"
+	fieldLatencyMs = "latency_ms"
+	fieldTraceID   = "trace_id"
+	fieldHandler   = "handler"
+	fieldSongID    = "song_id"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDKey - ключ ID запроса в контексте; по нему журнал SQL
+// связывает запросы к базе с HTTP-запросом
+type requestIDKey struct{}
+
+// Длиннее этого X-Request-ID клиента не принимается
+const maxRequestIDLength = 128
+
+// Компоненты с собственным уровнем логирования
+const (
+	componentEnrichment = "enrichment"
+	componentEvents     = "events"
+	componentJobs       = "jobs"
+	componentDB         = "db"
+	componentCache      = "cache"
+)
+
+var (
+	componentMu      sync.Mutex
+	componentLoggers = map[string]*logrus.Logger{}
+	componentLevels  = map[string]logrus.Level{} // уровни, заданные явно
+)
+
+// setupLogging задает начальный уровень и формат вывода logrus
+func setupLogging(cfg Config) error {
+	level, err := logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid LOG_LEVEL: %w", err)
+	}
+	setLogLevel("", level)
+
+	switch cfg.LogFormat {
+	case "", "text":
+		return nil
+	case "json":
+	default:
+		return fmt.Errorf("unknown LOG_FORMAT %q, expected text or json", cfg.LogFormat)
+	}
+	logrus.SetFormatter(&logrus.JSONFormatter{
+		TimestampFormat: time.RFC3339Nano,
+		FieldMap: logrus.FieldMap{
+			logrus.FieldKeyTime: "timestamp",
+			logrus.FieldKeyMsg:  "message",
+		},
+	})
+	// Служебный вывод gin тоже уходит в logrus
+	gin.DefaultWriter = logrus.StandardLogger().Writer()
+	gin.DefaultErrorWriter = logrus.StandardLogger().WriterLevel(logrus.ErrorLevel)
+	return nil
+}
+
+// RequestID присваивает каждому запросу идентификатор (или берет его из
+// заголовка) и приводит тела ответов с ошибкой к APIError
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(fieldRequestID, id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, id))
+		c.Header(requestIDHeader, id)
+		c.Writer = &errorBodyWriter{ResponseWriter: c.Writer, requestID: id}
+		c.Next()
+	}
+}
+
+// validRequestID пропускает ID клиента, только если он не испортит строку
+// лога: ограниченной длины и из букв, цифр и знаков -_.:
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// errorBodyWriter дописывает в JSON-ответы вида {"error": ...} код ошибки
+// и requestId, чтобы клиент мог ветвиться по коду и сослаться на запрос,
+// не читая заголовков. Обработчики пишут ошибки одним вызовом c.JSON.
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	requestID string
+}
+
+func (w *errorBodyWriter) Write(b []byte) (int, error) {
+	if w.Status() < http.StatusBadRequest || w.Written() || !bytes.HasPrefix(b, []byte("{")) ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), gin.MIMEJSON) {
+		return w.ResponseWriter.Write(b)
+	}
+	body, ok := apiErrorBody(w.Status(), b, w.requestID)
+	if !ok {
+		return w.ResponseWriter.Write(b)
+	}
+	if _, err := w.ResponseWriter.Write(body); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w *errorBodyWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// AccessLogger пишет журнал доступа через logrus: метод, путь, код ответа,
+// задержку, число запросов к базе и обращений к кешу подготовленных
+// выражений и, после аутентификации, пользователя или API-ключ
+func AccessLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		counter := requestQueryCounter(c)
+		c.Next()
+
+		entry := logEntry(c).WithFields(logrus.Fields{
+			"method":       c.Request.Method,
+			"path":         c.Request.URL.Path,
+			"status":       c.Writer.Status(),
+			"client_ip":    c.ClientIP(),
+			"queries":      counter.n.Load(),
+			"stmt_hits":    counter.stmtHits.Load(),
+			"stmt_misses":  counter.stmtMisses.Load(),
+			fieldLatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		})
+		if len(c.Errors) > 0 {
+			entry = entry.WithField("errors", c.Errors.String())
+		}
+
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			entry.Error("request completed")
+		case status >= 400:
+			entry.Warn("request completed")
+		default:
+			entry.Info("request completed")
+		}
+	}
+}
+
+// logEntry возвращает запись logrus с полями текущего запроса. Контекст
+// запроса нужен хуку отслеживания ошибок.
+func logEntry(c *gin.Context) *logrus.Entry {
+	return logrus.WithContext(c.Request.Context()).WithFields(requestFields(c))
+}
+
+func requestFields(c *gin.Context) logrus.Fields {
+	fields := logrus.Fields{
+		fieldRequestID: c.GetString(fieldRequestID),
+		fieldRoute:     c.FullPath(),
+	}
+	// Без маршрута последним обработчиком была бы middleware
+	if c.FullPath() != "" {
+		fields[fieldHandler] = handlerName(c)
+	}
+	// На маршрутах одной песни ее ID попадает во все записи запроса
+	if strings.Contains(c.FullPath(), "/songs/:id") {
+		if id, err := parseSongID(c.Param("id")); err == nil {
+			fields[fieldSongID] = id
+		}
+	}
+	if userID, ok := c.Get(fieldUserID); ok {
+		fields[fieldUserID] = userID
+	}
+	if keyID, ok := c.Get(fieldAPIKeyID); ok {
+		fields[fieldAPIKeyID] = keyID
+	}
+	if role, ok := c.Get(fieldRole); ok {
+		fields[fieldRole] = role
+	}
+	// По trace_id запись лога находится в трассе и наоборот
+	if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+		fields[fieldTraceID] = sc.TraceID().String()
+	}
+	return fields
+}
+
+// handlerName - имя функции обработчика без пакета: GetSong
+func handlerName(c *gin.Context) string {
+	name := c.HandlerName()
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	// main.GetSong, main.GetMeta.func1
+	parts := strings.Split(name, ".")
+	if len(parts) < 2 {
+		return name
+	}
+	return parts[1]
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// componentLogger возвращает логгер компонента; пока уровень компонента
+// не задан явно, он совпадает с глобальным
+func componentLogger(name string) *logrus.Logger {
+	componentMu.Lock()
+	defer componentMu.Unlock()
+
+	if l, ok := componentLoggers[name]; ok {
+		return l
+	}
+	std := logrus.StandardLogger()
+	l := logrus.New()
+	l.SetOutput(std.Out)
+	l.SetFormatter(std.Formatter)
+	l.ReplaceHooks(std.Hooks)
+	l.SetLevel(std.GetLevel())
+	if level, ok := componentLevels[name]; ok {
+		l.SetLevel(level)
+	}
+	componentLoggers[name] = l
+	return l
+}
+
+// componentEntry - то же, что logEntry, но через логгер компонента
+func componentEntry(c *gin.Context, name string) *logrus.Entry {
+	return componentLogger(name).WithContext(c.Request.Context()).WithFields(requestFields(c)).WithField("component", name)
+}
+
+// setLogLevel меняет глобальный уровень или уровень отдельного компонента
+func setLogLevel(component string, level logrus.Level) {
+	componentMu.Lock()
+	defer componentMu.Unlock()
+
+	if component == "" {
+		logrus.SetLevel(level)
+		for name, l := range componentLoggers {
+			if _, ok := componentLevels[name]; !ok {
+				l.SetLevel(level)
+			}
+		}
+		return
+	}
+	componentLevels[component] = level
+	if l, ok := componentLoggers[component]; ok {
+		l.SetLevel(level)
+	}
+}
+
+// logLevels возвращает текущие уровни: глобальный и заданные для компонентов
+func logLevels() (string, map[string]string) {
+	componentMu.Lock()
+	defer componentMu.Unlock()
+
+	components := make(map[string]string, len(componentLevels))
+	for name, level := range componentLevels {
+		components[name] = level.String()
+	}
+	return logrus.GetLevel().String(), components
+}
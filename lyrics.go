@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Форматы вывода текста песни
+const (
+	lyricsFormatPlain    = "plain"
+	lyricsFormatHTML     = "html"
+	lyricsFormatMarkdown = "markdown"
+)
+
+const verseSeparator = "\n\n"
+
+// Размер страницы текста в символах: по умолчанию и верхняя граница ?limit=
+var (
+	lyricsPageSize    = 10
+	lyricsMaxPageSize = 10000
+)
+
+// LyricsPage - страница текста песни с данными для навигации
+type LyricsPage struct {
+	Text        string `json:"text"`
+	Page        int    `json:"page"`
+	Limit       int    `json:"limit"`
+	TotalPages  int    `json:"totalPages"`
+	TotalVerses int    `json:"totalVerses"`
+}
+
+// paginateLyrics режет текст на страницы по limit символов; страница за
+// концом текста пустая. Считаются руны, чтобы не разрезать кириллицу.
+func paginateLyrics(text string, page, limit int) LyricsPage {
+	runes := []rune(text)
+	pages := (len(runes) + limit - 1) / limit
+	// Сравнение страниц, а не смещений: (page-1)*limit может переполниться
+	offset := len(runes)
+	if page <= pages {
+		offset = (page - 1) * limit
+	}
+	end := min(offset+limit, len(runes))
+	return LyricsPage{
+		Text:        string(runes[offset:end]),
+		Page:        page,
+		Limit:       limit,
+		TotalPages:  pages,
+		TotalVerses: len(splitVerses(text)),
+	}
+}
+
+// splitVerses делит текст на куплеты по пустой строке
+func splitVerses(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var verses []string
+	for _, verse := range strings.Split(text, verseSeparator) {
+		verse = strings.Trim(verse, "\n")
+		if verse != "" {
+			verses = append(verses, verse)
+		}
+	}
+	return verses
+}
+
+// formatLyrics преобразует текст песни в запрошенный формат
+func formatLyrics(text, format string) (string, error) {
+	switch format {
+	case "", lyricsFormatPlain:
+		return text, nil
+	case lyricsFormatHTML:
+		var b strings.Builder
+		for _, verse := range splitVerses(text) {
+			lines := strings.Split(verse, "\n")
+			for i, line := range lines {
+				lines[i] = html.EscapeString(line)
+			}
+			b.WriteString("<p>")
+			b.WriteString(strings.Join(lines, "<br>\n"))
+			b.WriteString("</p>\n")
+		}
+		return b.String(), nil
+	case lyricsFormatMarkdown:
+		verses := splitVerses(text)
+		for i, verse := range verses {
+			lines := strings.Split(verse, "\n")
+			for j, line := range lines {
+				lines[j] = escapeMarkdown(line)
+			}
+			// Два пробела в конце строки - перенос строки в Markdown
+			verses[i] = strings.Join(lines, "  \n")
+		}
+		return strings.Join(verses, verseSeparator), nil
+	default:
+		return "", fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "{", `\{`, "}", `\}`,
+	"[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "#", `\#`, "+", `\+`,
+	"-", `\-`, ".", `\.`, "!", `\!`, "|", `\|`, "<", `\<`, ">", `\>`,
+)
+
+func escapeMarkdown(line string) string {
+	return markdownEscaper.Replace(line)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLyricsNotFound - у источника нет текста этой песни
+var ErrLyricsNotFound = errors.New("lyrics not found")
+
+// LyricsProvider - источник полного текста песни. В цепочке обогащения
+// он заполняет text, если его не дали источники перед ним.
+type LyricsProvider interface {
+	Lyrics(ctx context.Context, group, song string) (string, error)
+}
+
+// Значения LYRICS_PROVIDER
+const providerGenius = "genius"
+
+// newLyricsProvider создает источник текстов по имени. У каждого источника
+// свой кеш со своим временем жизни.
+func newLyricsProvider(name string, cfg Config) (LyricsProvider, error) {
+	switch name {
+	case providerGenius:
+		genius, err := NewGeniusProvider(cfg.Genius)
+		if err != nil {
+			return nil, err
+		}
+		return newCachedLyrics(genius, cfg.Genius.CacheTTL, cfg.Genius.CacheSize), nil
+	default:
+		return nil, fmt.Errorf("unknown lyrics provider %q", name)
+	}
+}
+
+// cachedLyrics запоминает найденные тексты и отсутствие текста;
+// временные ошибки не кешируются
+type cachedLyrics struct {
+	provider LyricsProvider
+	ttl      time.Duration
+	size     int
+
+	mu      sync.Mutex
+	entries map[string]lyricsCacheEntry
+}
+
+type lyricsCacheEntry struct {
+	text     string
+	notFound bool
+	expires  time.Time
+}
+
+func newCachedLyrics(provider LyricsProvider, ttl time.Duration, size int) LyricsProvider {
+	if ttl <= 0 || size <= 0 {
+		return provider
+	}
+	return &cachedLyrics{provider: provider, ttl: ttl, size: size, entries: map[string]lyricsCacheEntry{}}
+}
+
+func (c *cachedLyrics) Lyrics(ctx context.Context, group, song string) (string, error) {
+	key := strings.ToLower(group) + "\x00" + strings.ToLower(song)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		if entry.notFound {
+			return "", ErrLyricsNotFound
+		}
+		return entry.text, nil
+	}
+
+	text, err := c.provider.Lyrics(ctx, group, song)
+	if err != nil && !errors.Is(err, ErrLyricsNotFound) {
+		return "", err
+	}
+	c.store(key, lyricsCacheEntry{text: text, notFound: err != nil, expires: now.Add(c.ttl)})
+	return text, err
+}
+
+func (c *cachedLyrics) store(key string, entry lyricsCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.size {
+		// Сначала выбрасываются устаревшие записи, если их нет - любая
+		for k, e := range c.entries {
+			if time.Now().After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = entry
+}
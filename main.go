@@ -1,21 +1,21 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
 	"os"
 	"strconv"
 	"strings"
-
-	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -32,59 +32,281 @@ import (
 // @license.name Apache 2.0
 // @license.url http://www.apache.org/licenses/LICENSE-2.0.html
 
-// @BasePath /api/v1
+// @BasePath /
 
 // Структура Song (Песня)
 type Song struct {
-	ID          int    `json:"id" gorm:"primaryKey"`
-	Group       string `json:"group" binding:"required"`
-	SongName    string `json:"song" binding:"required"`
-	ReleaseDate string `json:"releaseDate"`
-	Text        string `json:"text"`
-	Link        string `json:"link"`
+	ID          int         `json:"id" extensions:"x-public-id" gorm:"primaryKey"`
+	Group       string      `json:"group" binding:"required,max=200,nocontrol"`
+	SongName    string      `json:"song" binding:"required,max=300,nocontrol"`
+	ReleaseDate ReleaseDate `json:"releaseDate" swaggertype:"string" example:"16.07.2006"` // на входе и YYYY-MM-DD; пусто - неизвестна
+	Text        string      `json:"text" binding:"lyrics"`
+	Link        string      `json:"link" binding:"omitempty,max=2048,weblink"`
+	// Оценка 0..1 ссылки, найденной поиском в YouTube; пусто - ссылку дал
+	// источник или ее исправил администратор
+	LinkConfidence *float64 `json:"linkConfidence"`
+	Album          string   `json:"album" binding:"max=300,nocontrol"`
+	// Альбом в каталоге и номер трека в нем; задаются POST /albums/:id/enrich
+	AlbumID       *int `json:"albumId" gorm:"index"`
+	AlbumPosition int  `json:"albumPosition" gorm:"not null;default:0"`
+	DurationMs    int  `json:"durationMs" binding:"min=0"`
+	Explicit      bool `json:"explicit"`
+	OwnerID       *int `json:"ownerId" gorm:"index"` // кто добавил песню; пусто для песен, добавленных без пользователя
+	// Внешний API был недоступен, песня сохранена без даты, текста и ссылки
+	EnrichmentPending bool `json:"enrichmentPending" gorm:"not null;default:false"`
+	// Источник каждого поля при добавлении: {"text": "genius", "link": "youtube"}
+	EnrichmentSources map[string]string `json:"enrichmentSources,omitempty" gorm:"serializer:json"`
+	// Текст перенесен в archived_lyrics; отдается через GET /songs/:id/text
+	Archived bool `json:"archived" gorm:"not null;default:false"`
+	// Статистика Last.fm, обновляется фоновой задачей
+	Listeners      int64      `json:"listeners" gorm:"not null;default:0"`
+	Playcount      int64      `json:"playcount" gorm:"not null;default:0"`
+	StatsUpdatedAt *time.Time `json:"statsUpdatedAt"`
+	// Версия для оптимистичной блокировки: растет при каждой правке через
+	// applySongPatch, PUT /songs/:id принимает ее в If-Match или в теле
+	Version int `json:"version" gorm:"not null;default:1"`
+	// Владелец, только при ?include=owner
+	Owner *User `json:"owner,omitempty" gorm:"foreignKey:OwnerID;constraint:OnDelete:SET NULL"`
+	// Теги Last.fm, только при ?include=tags
+	Tags []SongTag `json:"tags,omitempty" gorm:"foreignKey:SongID;constraint:OnDelete:CASCADE"`
+	// Ссылки на площадки, только при ?include=links
+	Links SongLinks `json:"links,omitempty" swaggertype:"object,string" gorm:"foreignKey:SongID;constraint:OnDelete:CASCADE"`
+	// Время последнего изменения, GORM обновляет его сам; из него считается
+	// ETag, в ответах не отдается
+	UpdatedAt time.Time `json:"-"`
+	// Время удаления; удаленная песня скрыта, пока ее не восстановят или
+	// не удалит задача song_purge
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 var db *gorm.DB
 
+var rateLimiter RateLimiter
+
+// Обратные прокси, которым верится X-Forwarded-For; nil - никому
+var trustedProxies []string
+
+var routeLimits []RouteLimit
+
 func GetDB() *gorm.DB {
 	if db == nil {
 		err := godotenv.Load()
 		if err != nil {
-			log.Fatal("Error loading .env file")
+			logrus.Fatal("Error loading .env file")
 		}
-		dbConn, err := gorm.Open(postgres.Open(os.Getenv("DATABASE_URL")), &gorm.Config{})
+		dbConn, err := gorm.Open(postgres.Open(os.Getenv("DATABASE_URL")), &gorm.Config{TranslateError: true})
 		if err != nil {
-			log.Fatalf("Failed to connect to database: %v", err)
+			logrus.WithError(err).Fatal("Failed to connect to database")
 		}
 		db = dbConn
 	}
 	return db
 }
 
-func main() {
-	gin.SetMode(gin.ReleaseMode)
+// dbFor возвращает подключение, привязанное к контексту запроса
+func dbFor(c *gin.Context) *gorm.DB {
+	return GetDB().WithContext(c.Request.Context())
+}
 
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
+func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
+	cmd, ok := findCommand(name)
+	if !ok {
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+	if err := cmd.run(args); err != nil {
+		logrus.Fatal(err)
+	}
+}
 
-	dsn := os.Getenv("DATABASE_URL")                         // Получение DSN из переменной окружения
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{}) // Использование postgres.Open()
-	sqlDB, err := db.DB()                                    // Получение базового соединения *sql.DB
-	if err != nil {
-		log.Fatal(err)
+// setupRouter регистрирует middleware и маршруты
+func setupRouter(cfg Config) *gin.Engine {
+	router := gin.New()
+	// Без доверенных прокси c.ClientIP() - адрес соединения: поддельный
+	// X-Forwarded-For не обходит лимиты по IP. Список проверен в
+	// ParseTrustedProxies.
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		logrus.WithError(err).Error("Invalid trusted proxies")
+	}
+	// Сжатие первым: его писатель ближе всех к соединению и получает
+	// окончательное тело
+	if cfg.Compression.Enabled {
+		router.Use(Compression(cfg.Compression))
+	}
+	router.Use(RequestID())
+	if tracerProvider != nil {
+		// Спан на запрос; контекст трассы уходит в c.Request и дальше в базу и внешние API
+		router.Use(otelgin.Middleware(cfg.Tracing.ServiceName))
+	}
+	router.Use(Metrics())
+	if accessLog != nil {
+		router.Use(FormattedAccessLogger(accessLog))
+	} else {
+		router.Use(AccessLogger())
+	}
+	router.Use(Recovery())
+	if errorTracker != nil {
+		router.Use(ErrorTracking(errorTracker))
+	}
+	if rateLimiter != nil {
+		router.Use(RateLimitMiddleware(rateLimiter, cfg.RateLimitIP, cfg.RateLimitKey))
+	}
+	if scrapers != nil {
+		router.Use(ScraperDetection(scrapers))
+	}
+	router.Use(RouteLimits(routeLimits, cfg.DefaultRouteLimit))
+	if cfg.QueryBudget > 0 {
+		router.Use(QueryBudget(cfg.QueryBudget))
+	}
+	router.Use(Recorder(cfg.AdminToken))
+	router.Use(Chaos())
+	if requestSpec != nil {
+		router.Use(ValidateRequests(requestSpec))
 	}
-	defer sqlDB.Close()
 
-	router := gin.Default()
+	router.GET("/healthz", Healthz)
+	// Метрики для Prometheus открыты, как и проверка живости
+	router.GET("/metrics", GetMetrics)
+	// Оформление нужно фронтенду до входа, поэтому /meta открыт всегда
+	router.GET("/meta", GetMeta(newMeta(cfg)))
+	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	router.POST("/auth/login", Login)
+	router.GET("/auth/oidc/login", OIDCLogin)
+	router.GET("/auth/oidc/callback", OIDCCallback)
+
+	// Чтение открыто, если не включен AUTH_REQUIRE_READS; запись - для редакторов
+	reads := router.Group("/", Authenticate(cfg.AdminToken))
+	if cfg.AuthReadsToo {
+		reads.Use(RequireRole(RoleReader))
+	}
+	reads.Use(CacheHeaders(cfg.Cache, cfg.AuthReadsToo))
+	if responseCache != nil {
+		reads.Use(ResponseCaching(responseCache, cfg.AuthReadsToo))
+	}
+	writes := router.Group("/", Authenticate(cfg.AdminToken), RequireRole(RoleEditor))
+
+	if songStore != nil {
+		registerStoreSongRoutes(reads, writes, songStore)
+	} else {
+		reads.GET("/songs", GetSongs)
+		reads.GET("/songs/export", ExportSongs(nil))
+		writes.POST("/songs", AddSong(enrichment))
+		writes.POST("/songs/import", ImportSongs(enrichment))
+		writes.POST("/songs/batch", BatchSongs)
+		writes.PUT("/songs/:id", UpdateSong)
+		writes.PATCH("/songs/:id", PatchSong)
+		writes.DELETE("/songs/:id", DeleteSong)
+		writes.POST("/songs/:id/restore", RestoreSong)
+		reads.GET("/songs/:id/text", GetSongText)
+		reads.GET("/songs/:id/enrichment", GetSongEnrichment)
+		// Отложенные правки применяет очередь задач
+		writes.POST("/songs/:id/scheduled-changes", ScheduleSongChange)
+		writes.GET("/scheduled-changes", GetScheduledChanges)
+		writes.DELETE("/scheduled-changes/:id", CancelScheduledChange)
+	}
 
-	router.GET("/songs", GetSongs)
-	router.POST("/songs", AddSong)
-	router.PUT("/songs/:id", UpdateSong)
-	router.DELETE("/songs/:id", DeleteSong)
-	router.GET("/songs/:id/text", GetSongText)
+	// Заметки редакции не читают даже вошедшие читатели
+	writes.GET("/songs/:id/notes", GetSongNotes)
+	writes.POST("/songs/:id/notes", CreateSongNote)
+	writes.PUT("/songs/:id/notes/:noteId", UpdateSongNote)
+	writes.DELETE("/songs/:id/notes/:noteId", DeleteSongNote)
+
+	// События песен в реальном времени
+	reads.GET("/ws", SongEventsSocket)
+	reads.GET("/songs/events", SongEventStream)
+
+	reads.GET("/albums/:id", GetAlbum)
+	writes.POST("/albums", CreateAlbum)
+	writes.POST("/albums/:id/enrich", EnrichAlbum(enrichment))
+
+	// Личные настройки - только для вошедших пользователей
+	me := router.Group("/me", Authenticate(cfg.AdminToken), RequireRole(RoleReader))
+	me.GET("/notification-preferences", GetNotificationPreferences)
+	me.PUT("/notification-preferences", UpdateNotificationPreferences)
+	me.POST("/artist-claims", CreateArtistClaim)
+	me.POST("/artist-claims/:id/verify", VerifyArtistClaim)
+	me.POST("/session/merge", MergeSession)
+	me.PUT("/region", UpdateMyRegion)
+
+	// Избранное и история: у вошедших - свои, у гостей - в сессии по cookie
+	reads.GET("/favorites", GetFavorites)
+	reads.PUT("/favorites/:id", AddFavorite)
+	reads.DELETE("/favorites/:id", RemoveFavorite)
+	reads.GET("/history", GetHistory)
+	reads.POST("/history", RecordPlay)
+
+	// Профили артистов меняют подтвердившие их пользователи; права проверяет обработчик
+	reads.GET("/artists/:id", GetArtist)
+	artists := router.Group("/artists", Authenticate(cfg.AdminToken), RequireRole(RoleReader))
+	artists.PUT("/:id", UpdateArtist)
+	artists.PUT("/songs/:id/links/:platform", SetSongPlatformLink)
+	artists.GET("/:id/submissions", GetSubmissions)
+	artists.POST("/:id/submissions", CreateSubmission)
+	artists.PUT("/:id/submissions/:submissionId", UpdateSubmission)
+	artists.PUT("/:id/submissions/:submissionId/audio", UploadSubmissionAudio)
+	artists.POST("/:id/submissions/:submissionId/submit", SubmitSubmission)
+
+	admin := router.Group("/admin", Authenticate(cfg.AdminToken), RequireRole(RoleAdmin))
+	admin.PUT("/log-level", SetLogLevel)
+	admin.GET("/panics", GetPanics)
+	admin.GET("/recordings", GetRecordings)
+	admin.POST("/users", CreateUser)
+	admin.PUT("/users/:id/role", SetUserRole)
+	admin.GET("/api-keys", GetAPIKeys)
+	admin.POST("/api-keys", CreateAPIKey)
+	admin.DELETE("/api-keys/:id", RevokeAPIKey)
+	admin.GET("/audit", GetAuditLog)
+	admin.GET("/export", ExportDatabase)
+	admin.POST("/import", RestoreBackup)
+	admin.GET("/import/:id", GetRestore)
+	admin.GET("/jobs/stats", GetJobStats)
+	admin.GET("/jobs/queues", GetJobQueues)
+	admin.POST("/jobs/queues/:kind/pause", PauseJobQueue)
+	admin.POST("/jobs/queues/:kind/resume", ResumeJobQueue)
+	admin.POST("/jobs/failed/retry", RetryFailedJobs)
+	admin.DELETE("/jobs/failed", DiscardFailedJobs)
+	admin.GET("/jobs", GetJobs)
+	admin.GET("/jobs/:id", GetJob)
+	admin.POST("/jobs/:id/retry", RetryJob)
+	admin.DELETE("/jobs/:id", DiscardJob)
+	admin.GET("/dependencies", GetDependencies)
+	admin.GET("/scrapers", GetScrapers)
+	admin.DELETE("/scrapers/:client", ResetScraper)
+	admin.PUT("/scrapers/whitelist/:client", WhitelistScraper)
+	admin.DELETE("/scrapers/whitelist/:client", UnwhitelistScraper)
+	admin.GET("/db/statements", GetStmtCacheStats)
+	admin.GET("/stats/runtime", GetRuntimeStats)
+	admin.GET("/debug/pprof/*profile", DebugPprof)
+	admin.POST("/debug/pprof/symbol", DebugPprof)
+	admin.GET("/debug/vars", DebugVars)
+	admin.POST("/lyrics/archive", ArchiveIdleLyrics)
+	admin.POST("/songs/:id/lyrics/restore", RestoreLyrics)
+	admin.POST("/lastfm/refresh", RefreshSongStats)
+	admin.PUT("/songs/:id/link", CorrectSongLink)
+	admin.GET("/webhooks", GetWebhooks)
+	admin.POST("/webhooks", CreateWebhook)
+	admin.PUT("/webhooks/:id", UpdateWebhook)
+	admin.DELETE("/webhooks/:id", DeleteWebhook)
+	admin.GET("/submissions", GetModerationQueue)
+	admin.GET("/submissions/:id/audio", GetSubmissionAudio)
+	admin.POST("/submissions/:id/approve", ApproveSubmission)
+	admin.POST("/submissions/:id/reject", RejectSubmission)
+
+	return router
+}
 
+// @Summary Health check
+// @Description Liveness probe.
+// @ID healthz
+// @Produce  json
+// @Success 200 {object} map[string]string
+// @Router /healthz [get]
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
 // @Summary Get songs
@@ -95,245 +317,660 @@ func main() {
 // @Param page query int false "Page number"
 // @Param limit query int false "Limit number"
 // @Success 200 {array} Song
-// @Failure 500 {object} Error
+// @Failure 500 {object} APIError
 // func GetSongs(c *gin.Context)
 
 func Migrate(db *gorm.DB) error {
-	err := db.AutoMigrate(&Song{})
+	if err := convertReleaseDateColumn(db); err != nil {
+		return fmt.Errorf("failed to convert release dates: %w", err)
+	}
+	err := db.AutoMigrate(&Song{}, &User{}, &APIKey{}, &UserIdentity{}, &AuditEntry{}, &Job{}, &PlayEvent{}, &ArchivedLyrics{}, &SongTag{}, &Album{}, &SongLink{}, &Webhook{}, &NotificationPreferences{}, &Artist{}, &ArtistClaim{}, &SongEnrichment{}, &SongSubmission{}, &SubmissionAudio{}, &SongNote{}, &ScheduledChange{}, &AnonymousSession{}, &Favorite{}, &ListenEntry{}, &PausedJobQueue{}, &BackupRestore{}, &BackupRestoreData{})
 	if err != nil {
-		fmt.Errorf("failed to migrate database: %v", err)
-		return err
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if err := ensureSongNameIndex(db); err != nil {
+		return fmt.Errorf("failed to add song name index: %w", err)
 	}
-	return nil
+	return applySQLMigrations(db, migrationFiles)
 }
 
 // @Summary Get songs
-// @Description Get a list of songs.
+// @Description Get a list of songs. Besides equality, filters take an operator in brackets: group[ne], song[contains], id[gt], listeners[gte], playcount[lt] and so on; an unsupported operator is rejected with 400.
 // @ID get-songs
 // @Accept  json
 // @Produce  json
+// @Produce  xml
+// @Produce  application/vnd.api+json
 // @Param page query int false "Page number"
-// @Param limit query int false "Limit number"
+// @Param limit query int false "Limit number, at most 100; a negative limit returns all matching songs as a JSON array streamed while it is read, without ETag"
 // @Param group query string false "Group filter"
 // @Param song query string false "Song filter"
-// @Param releaseDate query string false "Release date filter"
-// @Param text query string false "Text filter"
+// @Param releaseDate query string false "Release date filter, DD.MM.YYYY or YYYY-MM-DD; releaseDate[gte], releaseDate[lt] and the other comparisons select a range"
+// @Param text query string false "Text filter; lyrics moved to the archive (POST /admin/lyrics/archive) are not searched until restored"
 // @Param link query string false "Link filter"
-// @Success 200 {array} Song
-// @Failure 500 {object} Error
-
+// @Param explicit query bool false "Explicit lyrics filter"
+// @Param albumId query int false "Album filter"
+// @Param mine query bool false "Only songs owned by the caller"
+// @Param include_deleted query bool false "Also list deleted songs that have not been purged yet (admins only)"
+// @Param include query string false "Related data to embed: owner, tags, links"
+// @Param after query string false "Cursor from X-Next-Cursor: return songs after this song ID (ignores page)" extensions(x-public-id)
+// @Param as_of query string false "Return the catalog as it was at this RFC 3339 time; cannot be combined with text, include or filter operators"
+// @Param format query string false "jsonapi for a JSON:API document with pagination links; the same as Accept: application/vnd.api+json"
+// @Param exact query bool false "Count meta.total of a JSON:API list exactly instead of using a cached or estimated count"
+// @Param If-None-Match header string false "ETag of a previously received list"
+// @Success 200 {array} Song "Songs, or LyricMatch snippets when filtering by text; an empty array when nothing matches"
+// @Header 200 {string} X-Next-Cursor "Cursor for the next page, when there may be more songs"
+// @Header 200 {string} ETag "Weak ETag derived from the listed songs' versions"
+// @Success 304 "The songs on the page have not changed since If-None-Match"
+// @Failure 400 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError "Nothing matches; only with EMPTY_SONGS_404 for older clients"
+// @Failure 500 {object} APIError
+// @Router /songs [get]
 func GetSongs(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset := (page - 1) * limit
-
-	var song Song
-	if err := c.ShouldBindQuery(&song); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	p, ok := parseSongsPage(c)
+	if !ok {
 		return
 	}
+	limit, offset := p.Limit, (p.Page-1)*p.Limit
 
-	var songs []Song
-	db := GetDB()
-	query := db.Model(&Song{})
-
-	// Создаем map для условий фильтрации
-	where := make(map[string]interface{})
-	if song.Group != "" {
-		query = query.Where("group = ?", song.Group)
+	song, ok := songFilterFromQuery(c)
+	if !ok {
+		return
+	}
+	deleted, ok := includeDeletedSongs(c)
+	if !ok {
+		return
 	}
-	if song.SongName != "" {
-		query = query.Where("song_name = ?", song.SongName)
+
+	asOf, ok := parseAsOf(c)
+	if !ok {
+		return
 	}
-	if song.ReleaseDate != "" {
-		query = query.Where("release_date = ?", song.ReleaseDate)
+	if asOf != nil {
+		getSongsAsOf(c, song, *asOf, offset, limit)
+		return
 	}
+
+	// Поиск по тексту возвращает фрагменты куплетов, а не песни целиком
 	if song.Text != "" {
-		query = query.Where("text LIKE ?", "%"+song.Text+"%")
+		searchLyrics(c, song, offset, limit)
+		return
 	}
-	if song.Link != "" {
-		query = query.Where("link = ?", song.Link)
+
+	includes, err := parseIncludes(c.Query("include"), songIncludes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
 	}
 
-	result := db.Model(&Song{}).Where(where).Offset(offset).Limit(limit).Find(&songs)
+	// Курсорная пагинация не пропускает и не повторяет строки при вставках
+	var songs []Song
+	listQuery := applyIncludes(readDBFor(c).Model(&Song{}), includes)
+	if deleted {
+		listQuery = listQuery.Unscoped()
+	}
+	listQuery = songFilterSet(song, "songs").Apply(listQuery).Order("songs.id")
+	if restriction := regionRestriction(c); restriction != nil {
+		listQuery = restriction.Scope(listQuery, "songs")
+	}
+	if after := c.Query("after"); after != "" {
+		afterID, err := parseSongID(after)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid cursor")
+			return
+		}
+		listQuery = listQuery.Where("songs.id > ?", afterID)
+	} else {
+		listQuery = listQuery.Offset(offset)
+	}
+	// Список без ограничения (limit < 0) не собирается в память целиком
+	if limit < 0 && len(includes) == 0 && !wantsJSONAPI(c) && !wantsXML(c) {
+		streamSongs(c, listQuery)
+		return
+	}
+	result := listQuery.Limit(limit).Find(&songs)
 
 	if result.Error != nil {
-		logrus.WithError(result.Error).Error("Failed to fetch songs from database")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch songs"})
+		logEntry(c).WithError(result.Error).Error("Failed to fetch songs from database")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch songs")
 		return
 	}
-	if len(songs) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No songs found"})
+	if len(songs) == 0 && emptySongs404 {
+		writeNoSongs(c)
 		return
 	}
-	c.JSON(http.StatusOK, songs)
+	if len(songs) == limit {
+		c.Header("X-Next-Cursor", encodeSongID(songs[len(songs)-1].ID))
+	}
+	// Общее число нужно только в meta документа JSON:API
+	if wantsJSONAPI(c) {
+		total, err := countSongs(c, song, regionRestriction(c), deleted)
+		if err != nil {
+			logEntry(c).WithError(err).Error("Failed to count songs")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch songs")
+			return
+		}
+		c.Set(ctxSongsTotal, total)
+	}
+	writeSongs(c, http.StatusOK, songs)
+}
+
+// Параметры фильтрации списка песен
+type SongFilter struct {
+	Group       string      `form:"group"`
+	SongName    string      `form:"song"`
+	ReleaseDate ReleaseDate `form:"releaseDate"`
+	Text        string      `form:"text"`
+	Link        string      `form:"link"`
+	Explicit    *bool       `form:"-"`
+	OwnerID     *int        `form:"-"`
+	// Условия с операторами (listeners[gt]=...), см. songFilterFields
+	Conds []FilterCond `form:"-"`
+}
+
+// songFilterFromQuery читает фильтры списка песен, включая операторы и mine.
+// При ошибке отвечает клиенту сам и возвращает false.
+func songFilterFromQuery(c *gin.Context) (SongFilter, bool) {
+	filter := SongFilter{Text: c.Query("text")}
+	conds, err := songFilterFields.Parse(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return filter, false
+	}
+	// Равенство остается в полях SongFilter: его понимают все хранилища
+	for _, cond := range conds {
+		if cond.Op == filterOpEq {
+			switch cond.Field {
+			case "group":
+				filter.Group = cond.Value.(string)
+				continue
+			case "song":
+				filter.SongName = cond.Value.(string)
+				continue
+			case "releaseDate":
+				filter.ReleaseDate = cond.Value.(ReleaseDate)
+				continue
+			case "link":
+				filter.Link = cond.Value.(string)
+				continue
+			case "explicit":
+				explicit := cond.Value.(bool)
+				filter.Explicit = &explicit
+				continue
+			}
+		}
+		filter.Conds = append(filter.Conds, cond)
+	}
+	if mine, _ := strconv.ParseBool(c.Query("mine")); mine {
+		userID, ok := currentUserID(c)
+		if !ok {
+			abortWithError(c, http.StatusUnauthorized, codeUnauthenticated, "Authentication required")
+			return filter, false
+		}
+		filter.OwnerID = &userID
+	}
+	return filter, true
 }
 
 // @Summary Add song
-// @Description Add a new song.
+// @Description Add a new song. When the job queue is running the song is stored at once with enrichmentPending set and enriched in the background; poll GET /songs/{id}/enrichment for progress. Group and song are unique regardless of case: adding an existing song is rejected with 409 and the existing song's ID in existingId, or with upsert=true updates the existing song with the non-empty fields of the body and returns it with 200.
 // @ID add-song
 // @Accept  json
 // @Produce  json
+// @Produce  xml
+// @Produce  application/vnd.api+json
 // @Param song body Song true "Song object"
-// @Success 201 {object} Song
-// @Failure 400 {object} Error
-// @Failure 500 {object} Error
-
-func AddSong(c *gin.Context) {
-	var newSong Song
-	if err := c.ShouldBindBodyWithJSON(&newSong); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
+// @Param upsert query bool false "Update the song if it already exists"
+// @Success 200 {object} Song "Existing song updated (upsert=true)"
+// @Success 201 {object} Song "Created; enrichmentPending is set when the info API was unavailable"
+// @Success 202 {object} Song "Stored; enrichment is queued"
+// @Failure 400 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 500 {object} APIError
+// @Failure 502 {object} APIError
+// @Router /songs [post]
+func AddSong(info SongInfoProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var newSong Song
+		if err := c.ShouldBindBodyWithJSON(&newSong); err != nil {
+			c.JSON(http.StatusBadRequest, errorBody(err))
+			return
+		}
+		// Дубликат отсекается до обращения к источникам
+		existing, err := songByName(dbFor(c), newSong.Group, newSong.SongName)
+		if err == nil {
+			if upsert, _ := strconv.ParseBool(c.Query("upsert")); upsert {
+				upsertSong(c, existing, newSong)
+			} else {
+				writeSongExists(c, newSong.Group, newSong.SongName)
+			}
+			return
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logEntry(c).WithError(err).Error("Failed to look up song")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to add song")
+			return
+		}
 
-	resp, err := http.Get(fmt.Sprintf("http://localhost:8080/info?group=%s&song=%s", url.QueryEscape(newSong.Group), url.QueryEscape(newSong.SongName)))
-	if err != nil {
-		logrus.WithError(err).Error("Failed to fetch song info from external API")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch songs"})
-		return
+		if jobs != nil {
+			addSongAsync(c, &newSong)
+			return
+		}
+		if !enrichNewSong(c, info, &newSong) {
+			return
+		}
+
+		songs := []Song{newSong}
+		err = inSongTx(c, func(w *songWrite) error {
+			return w.createSongs(songs, nil, enrichmentQueue{})
+		})
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			writeSongExists(c, newSong.Group, newSong.SongName)
+			return
+		}
+		if err != nil {
+			logEntry(c).WithError(err).Error("Failed to create song in database")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to add song")
+			return
+		}
+
+		writeSong(c, http.StatusCreated, songs[0])
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		logrus.WithField("status_code", resp.StatusCode).Error("External API returned non-OK status code")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add song"})
-		return
+// enrichNewSong заполняет песню данными внешних источников и владельцем.
+// При ошибке отвечает клиенту сам и возвращает false.
+func enrichNewSong(c *gin.Context, info SongInfoProvider, newSong *Song) bool {
+	songDetail, err := info.SongDetail(c.Request.Context(), newSong.Group, newSong.SongName)
+	if errors.Is(err, ErrInfoNotFound) {
+		abortWithError(c, http.StatusNotFound, codeSongInfoNotFound, "Song info not found")
+		return false
 	}
-	var songDetail SongDetail
-	if err := json.NewDecoder(resp.Body).Decode(&songDetail); err != nil {
-		logrus.WithError(err).Error("Failed to decode song info from external API")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch song info"})
-		return
+	if errors.Is(err, ErrInfoUnavailable) {
+		// Без upstream песня сохраняется без обогащения
+		componentEntry(c, componentEnrichment).WithError(err).Warn("Info API unavailable, storing song without enrichment")
+		newSong.EnrichmentPending = true
+	} else if err != nil {
+		componentEntry(c, componentEnrichment).WithError(err).Error("Failed to fetch song info from external API")
+		abortWithError(c, http.StatusBadGateway, codeEnrichmentFailed, "Failed to fetch song info")
+		return false
+	} else if err := chaosEnrichment(c, &songDetail); err != nil {
+		componentEntry(c, componentEnrichment).WithError(err).Error("Failed to fetch song info from external API")
+		abortWithError(c, http.StatusInternalServerError, codeEnrichmentFailed, "Failed to fetch song info")
+		return false
 	}
 
-	verses := strings.Split(songDetail.Text, "\n\n")
-	newSong.Text = strings.Join(verses, "\n\n")
+	applySongDetail(newSong, songDetail)
+	if err == nil {
+		resolveYouTubeLink(c, newSong)
+	}
+	newSong.Explicit = profanity.Contains(newSong.Text)
+	setSongOwner(c, newSong)
+	return true
+}
 
-	newSong.ReleaseDate = songDetail.ReleaseDate
-	newSong.Text = songDetail.Text
-	newSong.Link = songDetail.Link
+// applySongDetail переносит в песню данные внешних источников
+func applySongDetail(song *Song, detail SongDetail) {
+	verses := strings.Split(detail.Text, "\n\n")
+	song.Text = strings.Join(verses, "\n\n")
+
+	song.ReleaseDate = providerReleaseDate(detail.ReleaseDate)
+	song.Link = detail.Link
+	song.LinkConfidence = nil
+	song.EnrichmentSources = detail.Sources
+	song.Album = detail.Album
+	song.DurationMs = detail.DurationMs
+}
 
-	db := GetDB()
-	if err := db.Create(&newSong).Error; err != nil {
-		logrus.WithError(err).Error("Failed to create song in database")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add song"})
-		return
+// fillSongDetail дополняет песню данными источников, не трогая поля,
+// которые уже заполнены
+func fillSongDetail(song *Song, detail SongDetail) {
+	sources := map[string]string{}
+	fill := func(field string, dst *string, value string) {
+		if *dst == "" && value != "" {
+			*dst = value
+			if source, ok := detail.Sources[field]; ok {
+				sources[field] = source
+			}
+		}
 	}
+	if song.ReleaseDate.IsZero() {
+		if date := providerReleaseDate(detail.ReleaseDate); !date.IsZero() {
+			song.ReleaseDate = date
+			if source, ok := detail.Sources[fieldReleaseDate]; ok {
+				sources[fieldReleaseDate] = source
+			}
+		}
+	}
+	fill(fieldText, &song.Text, detail.Text)
+	fill(fieldLink, &song.Link, detail.Link)
+	fill(fieldAlbum, &song.Album, detail.Album)
+	if song.DurationMs == 0 && detail.DurationMs != 0 {
+		song.DurationMs = detail.DurationMs
+		if source, ok := detail.Sources[fieldDurationMs]; ok {
+			sources[fieldDurationMs] = source
+		}
+	}
+	if len(sources) > 0 {
+		song.EnrichmentSources = sources
+	}
+}
 
-	c.JSON(http.StatusCreated, newSong)
-
+// setSongOwner делает владельцем новой песни вошедшего пользователя
+func setSongOwner(c *gin.Context, song *Song) {
+	song.OwnerID = nil
+	if userID, ok := currentUserID(c); ok {
+		song.OwnerID = &userID
+	}
 }
 
 type SongDetail struct {
 	ReleaseDate string `json:"releaseDate"`
 	Text        string `json:"text"`
 	Link        string `json:"link"`
+	Album       string `json:"album,omitempty"`
+	DurationMs  int    `json:"durationMs,omitempty"`
+	// Какой источник дал каждое поле; заполняет цепочка обогащения
+	Sources map[string]string `json:"-"`
 }
 
 // @Summary Update song
-// @Description Update a song.
+// @Description Update a song. The client must send the version it read, either as If-Match: "<version>" or as the version field of the body; If-Match: * skips the check. If the song was changed since then, the update is rejected with 409 and the client should reload the song and retry. The new version is returned in the body and in the ETag header.
 // @ID update-song
 // @Accept  json
 // @Produce  json
-// @Param id path int true "Song ID"
+// @Produce  xml
+// @Produce  application/vnd.api+json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Param If-Match header string false "Version the client read, e.g. \"3\"; * skips the check"
 // @Param song body Song true "Song object"
 // @Success 200 {object} Song
-// @Failure 400 {object} Error
-// @Failure 404 {object} Error
-// @Failure 500 {object} Error
-
+// @Header 200 {string} ETag "New song version"
+// @Failure 400 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 428 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /songs/{id} [put]
 func UpdateSong(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := parseSongID(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid song ID"})
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
 		return
 	}
 
 	var song Song
 	if err := c.ShouldBindJSON(&song); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, errorBody(err))
 		return
 	}
-
-	db := GetDB()
-	result := db.Model(&Song{}).Where("id = ?", id).Updates(&song)
-
-	if result.Error != nil {
-		logrus.WithError(result.Error).Error("Failed to update song")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update song"})
+	song.OwnerID = nil // владелец не меняется через обновление
+	song.LinkConfidence = nil
+	song.Version, err = expectedSongVersion(c, song.Version)
+	if errors.Is(err, errInvalidIfMatch) {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "If-Match must be a song version like \"3\" or *")
+		return
+	}
+	if err != nil {
+		abortWithError(c, http.StatusPreconditionRequired, codePrecondition, "Send the song version in If-Match or in the version field")
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+	var after Song
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		var before Song
+		if err := tx.First(&before, id).Error; err != nil {
+			return err
+		}
+		if !canModifySong(c, before) {
+			return errNotOwner
+		}
+		var err error
+		if after, err = applySongPatch(tx, before, song); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, auditEntitySong, id, auditActionUpdate, before, after)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeSongNotFound, "Song not found")
 		return
 	}
+	if errors.Is(err, errNotOwner) {
+		abortWithError(c, http.StatusForbidden, codeNotOwner, "You can only change your own songs")
+		return
+	}
+	if errors.Is(err, errVersionConflict) {
+		abortWithError(c, http.StatusConflict, codeVersionConflict, "Song was changed by someone else")
+		return
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		writeSongExists(c, song.Group, song.SongName)
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to update song")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to update song")
+		return
+	}
+	publishSongEventFor(c, songEventUpdated, after)
+
+	song.Version = after.Version
+	c.Header("ETag", songVersionETag(after))
+	writeSong(c, http.StatusOK, song)
+}
+
+// applySongPatch записывает непустые поля patch поверх before и возвращает
+// песню после изменения; общий шаг ручных и отложенных правок. Непустой
+// patch.Version - версия, которую видел клиент: если песню с тех пор
+// изменили, возвращается errVersionConflict.
+func applySongPatch(tx *gorm.DB, before, patch Song) (Song, error) {
+	expected := patch.Version
+	patch.Version = before.Version + 1
+	return applySongUpdate(tx, before, expected, &patch, patch.Link != "", patch.Text != "")
+}
 
-	c.JSON(http.StatusOK, song)
+// applySongUpdate записывает values (*Song или map колонок, в обоих уже
+// новая версия) и проверяет версию expected; 0 - без проверки. linkSet и
+// textSet - изменены ли ссылка и текст.
+func applySongUpdate(tx *gorm.DB, before Song, expected int, values interface{}, linkSet, textSet bool) (Song, error) {
+	id := before.ID
+	var after Song
+	if expected != 0 && expected != before.Version {
+		return after, errVersionConflict
+	}
+	// Условие на версию ловит правку, закоммиченную после чтения before
+	res := tx.Model(&Song{}).Where("id = ? AND version = ?", id, before.Version).Updates(values)
+	if res.Error != nil {
+		return after, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return after, errVersionConflict
+	}
+	// Ссылку заменили вручную - оценка поиска к ней больше не относится
+	if linkSet && before.LinkConfidence != nil {
+		if err := tx.Model(&Song{}).Where("id = ?", id).Update("link_confidence", nil).Error; err != nil {
+			return after, err
+		}
+	}
+	// Новый текст заменяет архивный
+	if before.Archived && textSet {
+		if err := tx.Model(&Song{}).Where("id = ?", id).Update("archived", false).Error; err != nil {
+			return after, err
+		}
+		if err := dropArchivedLyrics(tx, id); err != nil {
+			return after, err
+		}
+	}
+	err := tx.First(&after, id).Error
+	return after, err
 }
 
 // @Summary Delete song
-// @Description Delete a song.
+// @Description Delete a song. The song is hidden but kept, and can be restored with POST /songs/{id}/restore until it is purged after SONG_RETENTION.
 // @ID delete-song
 // @Accept  json
 // @Produce  json
-// @Param id path int true "Song ID"
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
 // @Success 200 {object} Message
-// @Failure 404 {object} Error
-// @Failure 500 {object} Error
-
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /songs/{id} [delete]
 func DeleteSong(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := parseSongID(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid song ID"})
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
 		return
 	}
 
-	db := GetDB()
-	result := db.Where("id = ?", id).Delete(&Song{})
-
-	if result.Error != nil {
-		logrus.WithError(result.Error).Error("Failed to delete song")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete song"})
+	var before Song
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&before, id).Error; err != nil {
+			return err
+		}
+		if !canModifySong(c, before) {
+			return errNotOwner
+		}
+		// Теги и архивный текст остаются до окончательного удаления
+		if err := tx.Delete(&before).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, auditEntitySong, id, auditActionDelete, before, nil)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeSongNotFound, "Song not found")
 		return
 	}
-
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+	if errors.Is(err, errNotOwner) {
+		abortWithError(c, http.StatusForbidden, codeNotOwner, "You can only change your own songs")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to delete song")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to delete song")
 		return
 	}
+	publishSongEventFor(c, songEventDeleted, before)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Song deleted"})
 }
 
+// @Summary Get song text
+// @Description Get paginated song text in the requested format. Pages are counted in characters of the stored text; the response also carries the page size actually used and the total number of pages and verses.
+// @ID get-song-text
+// @Produce  json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Param page query int false "Page number, starting at 1"
+// @Param limit query int false "Characters per page; defaults to LYRICS_PAGE_SIZE and is capped at LYRICS_MAX_PAGE_SIZE"
+// @Param format query string false "Output format: plain, html or markdown"
+// @Param clean query bool false "Mask profanity"
+// @Param lang query string false "Wordlist language for clean mode"
+// @Param as_of query string false "Return the text as it was at this RFC 3339 time"
+// @Param If-None-Match header string false "ETag of a previously received page"
+// @Success 200 {object} LyricsPage
+// @Header 200 {string} ETag "Weak ETag derived from the song's version; not sent with as_of"
+// @Success 304 "The song has not changed since If-None-Match"
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 451 {object} APIError "Song or its lyrics are restricted in the client's region"
+// @Failure 500 {object} APIError
+// @Router /songs/{id}/text [get]
 func GetSongText(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := parseSongID(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid song ID"})
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
+		return
+	}
+	asOf, ok := parseAsOf(c)
+	if !ok {
 		return
 	}
 
+	load := func() (Song, error) { return loadSongText(readDBFor(c), id, asOf) }
 	var song Song
-	db := GetDB()
-	result := db.First(&song, id)
+	if asOf != nil {
+		song, err = load()
+	} else {
+		// Текущая версия берется из кеша; просмотр пишется и при попадании
+		song, err = cachedSong(c.Request.Context(), id, load)
+	}
 
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithError(c, http.StatusNotFound, codeSongNotFound, "Song not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch song"})
-			logrus.WithError(result.Error).Error("Error fetching song text")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch song")
+			logEntry(c).WithError(err).Error("Error fetching song text")
 		}
 		return
 	}
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset := (page - 1) * limit
-	end := min(offset+limit, len(song.Text))
-	text := song.Text[offset:end]
+	respondLyrics(c, song)
+}
+
+// loadSongText загружает песню вместе с текстом, в том числе архивным
+func loadSongText(tx *gorm.DB, id int, asOf *time.Time) (Song, error) {
+	var song Song
+	var err error
+	if asOf != nil {
+		song, err = songAsOf(tx, id, *asOf)
+	} else {
+		err = tx.First(&song, id).Error
+	}
+	if err != nil {
+		return song, err
+	}
+	// Архив хранит последний текст; если песню архивировали после as_of, это он же
+	if song.Archived {
+		if song.Text, err = loadArchivedLyrics(tx, song.ID); err != nil {
+			return song, fmt.Errorf("load archived lyrics: %w", err)
+		}
+	}
+	return song, nil
+}
+
+// respondLyrics отдает страницу текста в запрошенном формате
+func respondLyrics(c *gin.Context, song Song) {
+	if !restrictLyrics(c, song) {
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid page")
+		return
+	}
+	limit := lyricsPageSize
+	if raw := c.Query("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid limit")
+			return
+		}
+	}
+	// Слишком большая страница урезается до максимума, а не отклоняется
+	limit = min(limit, lyricsMaxPageSize)
+	// Клиент уже видел эту версию текста; просмотр не записывается
+	if notModified(c, songETag(song)) {
+		return
+	}
+
+	lyrics := paginateLyrics(song.Text, page, limit)
+	text := lyrics.Text
+	if clean, _ := strconv.ParseBool(c.Query("clean")); clean {
+		text = profanity.Mask(text, c.Query("lang"))
+	}
+
+	lyrics.Text, err = formatLyrics(text, c.DefaultQuery("format", lyricsFormatPlain))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"text": text})
+	recordEvent(c, song.ID, eventLyricsView)
+	writeLyricsText(c, http.StatusOK, lyrics)
 }
 
 func min(a, b int) int {
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BrandingConfig - оформление установки для white-label фронтендов
+type BrandingConfig struct {
+	CatalogName string
+	Operator    string // кто держит установку
+	Contact     string // адрес или URL для связи
+	TermsURL    string
+	Flags       string // через запятую: произвольные флаги для фронтенда
+}
+
+// Meta - ответ GET /meta
+type Meta struct {
+	CatalogName string `json:"catalogName" example:"Musik"`
+	Operator    string `json:"operator,omitempty"`
+	Contact     string `json:"contact,omitempty"`
+	TermsURL    string `json:"termsUrl,omitempty"`
+	Version     string `json:"version" example:"v1.2.3"`
+	// Возможности, зависящие от настроек установки
+	Features map[string]bool `json:"features"`
+	Flags    []string        `json:"flags"`
+}
+
+// newMeta собирает описание установки; вызывается после настройки
+// глобальных компонентов, чтобы признаки возможностей были точными
+func newMeta(cfg Config) Meta {
+	meta := Meta{
+		CatalogName: cfg.Branding.CatalogName,
+		Operator:    cfg.Branding.Operator,
+		Contact:     cfg.Branding.Contact,
+		TermsURL:    cfg.Branding.TermsURL,
+		Version:     version,
+		Features: map[string]bool{
+			"authRequiredForReads": cfg.AuthReadsToo,
+			"oidcLogin":            cfg.OIDCIssuer != "",
+			"publicIds":            publicIDs != nil,
+			"regionRules":          regionRules != nil,
+			"captcha":              scrapers != nil && scrapers.verifier != nil,
+			"lastfmStats":          cfg.LastFM.APIKey != "",
+			"youtubeLinks":         cfg.YouTube.APIKey != "",
+			"platformLinks":        cfg.LinkProviders.Providers != "",
+			// Хранилище mongo поддерживает только базовые операции с /songs
+			"fullCatalog": songStore == nil,
+		},
+		Flags: []string{},
+	}
+	for _, flag := range strings.Split(cfg.Branding.Flags, ",") {
+		if flag = strings.TrimSpace(flag); flag != "" {
+			meta.Flags = append(meta.Flags, flag)
+		}
+	}
+	return meta
+}
+
+// @Summary Deployment metadata
+// @Description Branding and capabilities of this installation: catalog name, operator, contact, terms URL, build version, features that depend on the deployment's configuration and free-form front-end flags. White-label front-ends read it on startup.
+// @ID get-meta
+// @Produce  json
+// @Success 200 {object} Meta
+// @Router /meta [get]
+func GetMeta(meta Meta) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, meta)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Метрики в текстовом формате Prometheus. Клиентская библиотека не нужна:
+// счетчики и гистограммы копятся здесь и сериализуются при каждом опросе.
+
+// Границы корзин гистограмм задержки, в секундах (как DefBuckets в Prometheus)
+var metricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Время на запросы к базе при сборе метрик очереди
+const metricsCollectTimeout = 2 * time.Second
+
+// histogram - накопительная гистограмма; counts[i] - наблюдения не больше
+// metricsBuckets[i]. Синхронизирует владелец.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(metricsBuckets))}
+}
+
+func (h *histogram) observe(seconds float64) {
+	for i, bound := range metricsBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+type requestKey struct {
+	routeKey
+	status int
+}
+
+// httpMetrics - число запросов по маршруту и коду ответа и их задержки
+type httpMetrics struct {
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[routeKey]*histogram
+}
+
+// Метрики HTTP-запросов процесса
+var requestMetrics = &httpMetrics{requests: map[requestKey]uint64{}, durations: map[routeKey]*histogram{}}
+
+func (m *httpMetrics) observe(method, route string, status int, latency time.Duration) {
+	key := routeKey{method: method, route: route}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{routeKey: key, status: status}]++
+	h, ok := m.durations[key]
+	if !ok {
+		h = newHistogram()
+		m.durations[key] = h
+	}
+	h.observe(latency.Seconds())
+}
+
+// Metrics считает запросы по шаблону маршрута, а не по пути, чтобы число
+// рядов не росло с каждым id. Запросы мимо маршрутов идут как "unmatched".
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		requestMetrics.observe(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// metricsWriter пишет ряды в формате экспозиции Prometheus
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (w *metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample пишет одно значение; labels - пары имя, значение
+func (w *metricsWriter) sample(name string, value float64, labels ...string) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&w.buf, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.buf.WriteByte('\n')
+}
+
+// histogram пишет корзины, сумму и число наблюдений
+func (w *metricsWriter) histogram(name string, h *histogram, labels ...string) {
+	labels = labels[:len(labels):len(labels)]
+	for i, bound := range metricsBuckets {
+		w.sample(name+"_bucket", float64(h.counts[i]), append(labels, "le", strconv.FormatFloat(bound, 'g', -1, 64))...)
+	}
+	w.sample(name+"_bucket", float64(h.count), append(labels, "le", "+Inf")...)
+	w.sample(name+"_sum", h.sum, labels...)
+	w.sample(name+"_count", float64(h.count), labels...)
+}
+
+func (m *httpMetrics) write(w *metricsWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+	w.header("musik_http_requests_total", "counter", "HTTP requests by route, method and status code.")
+	for _, key := range keys {
+		w.sample("musik_http_requests_total", float64(m.requests[key]),
+			"method", key.method, "route", key.route, "status", strconv.Itoa(key.status))
+	}
+
+	routes := make([]routeKey, 0, len(m.durations))
+	for key := range m.durations {
+		routes = append(routes, key)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].route != routes[j].route {
+			return routes[i].route < routes[j].route
+		}
+		return routes[i].method < routes[j].method
+	})
+	w.header("musik_http_request_duration_seconds", "histogram", "HTTP request latency by route and method.")
+	for _, key := range routes {
+		w.histogram("musik_http_request_duration_seconds", m.durations[key], "method", key.method, "route", key.route)
+	}
+}
+
+// writeDependencyMetrics пишет накопленные вызовы внешних зависимостей: базы,
+// Redis, источников данных о песнях и CDN
+func writeDependencyMetrics(w *metricsWriter) {
+	dependencies.mu.Lock()
+	deps := make([]*dependencyMetrics, 0, len(dependencies.deps))
+	for _, m := range dependencies.deps {
+		deps = append(deps, m)
+	}
+	dependencies.mu.Unlock()
+	sort.Slice(deps, func(i, j int) bool { return deps[i].name < deps[j].name })
+
+	type snapshot struct {
+		name, kind    string
+		calls, errors uint64
+		latency       histogram
+	}
+	snapshots := make([]snapshot, len(deps))
+	for i, m := range deps {
+		m.mu.Lock()
+		snapshots[i] = snapshot{name: m.name, kind: m.kind, calls: m.calls, errors: m.errors, latency: *m.latency}
+		snapshots[i].latency.counts = append([]uint64(nil), m.latency.counts...)
+		m.mu.Unlock()
+	}
+
+	w.header("musik_dependency_calls_total", "counter", "Calls to external dependencies.")
+	for _, s := range snapshots {
+		w.sample("musik_dependency_calls_total", float64(s.calls), "dependency", s.name, "kind", s.kind)
+	}
+	w.header("musik_dependency_errors_total", "counter", "Failed calls to external dependencies.")
+	for _, s := range snapshots {
+		w.sample("musik_dependency_errors_total", float64(s.errors), "dependency", s.name, "kind", s.kind)
+	}
+	w.header("musik_dependency_duration_seconds", "histogram", "Latency of calls to external dependencies.")
+	for _, s := range snapshots {
+		w.histogram("musik_dependency_duration_seconds", &s.latency, "dependency", s.name, "kind", s.kind)
+	}
+}
+
+// writeDBPoolMetrics пишет состояние пула соединений основной базы
+func writeDBPoolMetrics(w *metricsWriter) error {
+	sqlDB, err := GetDB().DB()
+	if err != nil {
+		return err
+	}
+	stats := sqlDB.Stats()
+	gauges := []struct {
+		name, help string
+		value      float64
+	}{
+		{"musik_db_pool_max_open_connections", "Maximum number of open database connections.", float64(stats.MaxOpenConnections)},
+		{"musik_db_pool_open_connections", "Open database connections.", float64(stats.OpenConnections)},
+		{"musik_db_pool_in_use_connections", "Database connections in use.", float64(stats.InUse)},
+		{"musik_db_pool_idle_connections", "Idle database connections.", float64(stats.Idle)},
+	}
+	for _, g := range gauges {
+		w.header(g.name, "gauge", g.help)
+		w.sample(g.name, g.value)
+	}
+	w.header("musik_db_pool_wait_total", "counter", "Connections waited for because the pool was exhausted.")
+	w.sample("musik_db_pool_wait_total", float64(stats.WaitCount))
+	w.header("musik_db_pool_wait_seconds_total", "counter", "Total time spent waiting for a connection.")
+	w.sample("musik_db_pool_wait_seconds_total", stats.WaitDuration.Seconds())
+	return nil
+}
+
+// writeJobMetrics пишет глубину очереди задач по видам; глубина очереди
+// обогащения - ряд kind="enrichment"
+func writeJobMetrics(ctx context.Context, w *metricsWriter) error {
+	if jobs == nil {
+		return nil
+	}
+	pending, err := jobs.PendingByKind(ctx)
+	if err != nil {
+		return err
+	}
+	kinds := make([]string, 0, len(pending))
+	for kind := range pending {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	w.header("musik_jobs_pending", "gauge", "Background jobs waiting or running, by kind.")
+	for _, kind := range kinds {
+		w.sample("musik_jobs_pending", float64(pending[kind]), "kind", kind)
+	}
+	w.header("musik_job_workers_busy", "gauge", "Job workers currently running a job.")
+	w.sample("musik_job_workers_busy", float64(jobs.busy.Load()))
+	return nil
+}
+
+// @Summary Prometheus metrics
+// @Description Metrics in the Prometheus text format: HTTP requests and latency per route and status code, database pool stats, call counts, errors and latency of external dependencies, and job queue depth per kind (the enrichment queue is kind="enrichment").
+// @ID metrics
+// @Produce  plain
+// @Success 200 {string} string
+// @Router /metrics [get]
+func GetMetrics(c *gin.Context) {
+	w := &metricsWriter{}
+	requestMetrics.write(w)
+	writeDependencyMetrics(w)
+	if songTextCache != nil {
+		songTextCache.write(w)
+	}
+	// Сбой базы не должен отнимать остальные метрики
+	if err := writeDBPoolMetrics(w); err != nil {
+		logEntry(c).WithError(err).Warn("Failed to collect database pool metrics")
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), metricsCollectTimeout)
+	defer cancel()
+	if err := writeJobMetrics(ctx, w); err != nil {
+		logEntry(c).WithError(err).Warn("Failed to collect job queue metrics")
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", w.buf.Bytes())
+}
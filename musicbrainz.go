@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	musicBrainzAPIURL = "https://musicbrainz.org/ws/2"
+	musicBrainzSite   = "https://musicbrainz.org"
+	// Результаты поиска с меньшей оценкой считаются другой песней
+	musicBrainzMinScore = 90
+)
+
+// MusicBrainzConfig - параметры провайдера MusicBrainz
+type MusicBrainzConfig struct {
+	// Контакт (email или URL) для User-Agent: без него MusicBrainz блокирует клиента
+	Contact  string
+	APIURL   string
+	Interval time.Duration // пауза между запросами; правила MusicBrainz - не чаще раза в секунду
+	Timeout  time.Duration
+}
+
+// MusicBrainzProvider ищет запись в MusicBrainz и берет из нее дату первого
+// выпуска, альбом и длительность. Текстов песен MusicBrainz не хранит.
+type MusicBrainzProvider struct {
+	cfg       MusicBrainzConfig
+	http      *http.Client
+	userAgent string
+	limiter   *intervalLimiter
+}
+
+// NewMusicBrainzProvider создает провайдера; запросы всех обработчиков идут
+// через один ограничитель частоты
+func NewMusicBrainzProvider(cfg MusicBrainzConfig) (*MusicBrainzProvider, error) {
+	if cfg.Contact == "" {
+		return nil, errors.New("MUSICBRAINZ_CONTACT must be set")
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = musicBrainzAPIURL
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	cfg.APIURL = strings.TrimSuffix(cfg.APIURL, "/")
+	return &MusicBrainzProvider{
+		cfg:       cfg,
+		http:      trackHTTP(&http.Client{Timeout: cfg.Timeout}, providerMusicBrainz, dependencyEnrichment),
+		userAgent: fmt.Sprintf("musik_api/1.0 ( %s )", cfg.Contact),
+		limiter:   newIntervalLimiter(cfg.Interval),
+	}, nil
+}
+
+// Ответ /ws/2/recording, только нужные поля
+type musicBrainzSearchResponse struct {
+	Recordings []musicBrainzRecording `json:"recordings"`
+}
+
+type musicBrainzRecording struct {
+	ID               string `json:"id"`
+	Score            int    `json:"score"`
+	Title            string `json:"title"`
+	Length           int    `json:"length"` // в миллисекундах
+	FirstReleaseDate string `json:"first-release-date"`
+	Releases         []struct {
+		Title string `json:"title"`
+		Date  string `json:"date"`
+	} `json:"releases"`
+}
+
+func (p *MusicBrainzProvider) SongDetail(ctx context.Context, group, song string) (SongDetail, error) {
+	params := url.Values{
+		"query": {fmt.Sprintf(`recording:"%s" AND artist:"%s"`, luceneEscape(song), luceneEscape(group))},
+		"limit": {"5"},
+		"fmt":   {"json"},
+	}
+	var result musicBrainzSearchResponse
+	if err := p.getJSON(ctx, p.cfg.APIURL+"/recording?"+params.Encode(), &result); err != nil {
+		return SongDetail{}, err
+	}
+	recording, ok := bestRecording(result.Recordings)
+	if !ok {
+		return SongDetail{}, ErrInfoNotFound
+	}
+	return recording.detail(), nil
+}
+
+// bestRecording выбирает запись с самой ранней датой выпуска среди
+// достаточно похожих: у хитов десятки записей (концертные, сборники)
+func bestRecording(recordings []musicBrainzRecording) (musicBrainzRecording, bool) {
+	var best musicBrainzRecording
+	found := false
+	for _, r := range recordings {
+		if r.Score < musicBrainzMinScore {
+			continue
+		}
+		if !found || (r.FirstReleaseDate != "" && (best.FirstReleaseDate == "" || r.FirstReleaseDate < best.FirstReleaseDate)) {
+			best, found = r, true
+		}
+	}
+	return best, found
+}
+
+func (r musicBrainzRecording) detail() SongDetail {
+	detail := SongDetail{
+		ReleaseDate: musicBrainzReleaseDate(r.FirstReleaseDate),
+		Link:        musicBrainzSite + "/recording/" + r.ID,
+		DurationMs:  r.Length,
+	}
+	// Альбом - релиз, вышедший в дату первого выпуска
+	for _, release := range r.Releases {
+		if release.Date == r.FirstReleaseDate {
+			detail.Album = release.Title
+			break
+		}
+	}
+	return detail
+}
+
+// musicBrainzReleaseDate переводит дату MusicBrainz (2006-07-16, 2006-07
+// или 2006) в формат сервиса; точность определяется по длине
+func musicBrainzReleaseDate(date string) string {
+	switch len(date) {
+	case len("2006-01-02"):
+		return spotifyReleaseDate(date, "day")
+	case len("2006-01"):
+		return spotifyReleaseDate(date, "month")
+	default:
+		return spotifyReleaseDate(date, "year")
+	}
+}
+
+// luceneEscape экранирует строку для фразы в кавычках в поисковом запросе
+func luceneEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// intervalLimiter пропускает не больше одного запроса за interval;
+// ожидающие запросы выстраиваются в очередь
+type intervalLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newIntervalLimiter(interval time.Duration) *intervalLimiter {
+	return &intervalLimiter{interval: interval}
+}
+
+// Wait ждет своей очереди или отмены ctx
+func (l *intervalLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	if deadline, ok := ctx.Deadline(); ok && slot.After(deadline) {
+		l.mu.Unlock()
+		return context.DeadlineExceeded
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(slot)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Ответы /ws/2/release: поиск и релиз с записями (inc=recordings)
+type musicBrainzReleaseSearchResponse struct {
+	Releases []struct {
+		ID    string `json:"id"`
+		Score int    `json:"score"`
+		Date  string `json:"date"`
+	} `json:"releases"`
+}
+
+type musicBrainzReleaseResponse struct {
+	Date  string `json:"date"`
+	Media []struct {
+		Tracks []struct {
+			Title  string `json:"title"`
+			Length int    `json:"length"`
+		} `json:"tracks"`
+	} `json:"media"`
+}
+
+// AlbumDetail берет самый ранний подходящий релиз (оригинал, а не переиздание)
+func (p *MusicBrainzProvider) AlbumDetail(ctx context.Context, group, album string) (AlbumDetail, error) {
+	params := url.Values{
+		"query": {fmt.Sprintf(`release:"%s" AND artist:"%s"`, luceneEscape(album), luceneEscape(group))},
+		"limit": {"10"},
+		"fmt":   {"json"},
+	}
+	var search musicBrainzReleaseSearchResponse
+	if err := p.getJSON(ctx, p.cfg.APIURL+"/release?"+params.Encode(), &search); err != nil {
+		return AlbumDetail{}, err
+	}
+	releaseID, earliest := "", ""
+	for _, r := range search.Releases {
+		if r.Score < musicBrainzMinScore {
+			continue
+		}
+		if releaseID == "" || (r.Date != "" && (earliest == "" || r.Date < earliest)) {
+			releaseID, earliest = r.ID, r.Date
+		}
+	}
+	if releaseID == "" {
+		return AlbumDetail{}, ErrInfoNotFound
+	}
+
+	var release musicBrainzReleaseResponse
+	target := p.cfg.APIURL + "/release/" + url.PathEscape(releaseID) + "?inc=recordings&fmt=json"
+	if err := p.getJSON(ctx, target, &release); err != nil {
+		return AlbumDetail{}, err
+	}
+	detail := AlbumDetail{ReleaseDate: musicBrainzReleaseDate(release.Date)}
+	for _, medium := range release.Media {
+		for _, track := range medium.Tracks {
+			detail.Tracks = append(detail.Tracks, AlbumTrack{
+				Position: len(detail.Tracks) + 1, Title: track.Title, DurationMs: track.Length,
+			})
+		}
+	}
+	return detail, nil
+}
+
+// getJSON выполняет запрос с User-Agent и ограничением частоты
+func (p *MusicBrainzProvider) getJSON(ctx context.Context, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("build musicbrainz request: %w", err)
+	}
+	req.Header.Set("User-Agent", p.userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	if err := p.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("%w: musicbrainz: %w", ErrInfoUnavailable, err)
+	}
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: musicbrainz: %w", ErrInfoUnavailable, err)
+	}
+	defer resp.Body.Close()
+	// При превышении частоты MusicBrainz отвечает 503 - это временная ошибка
+	if resp.StatusCode != http.StatusOK {
+		return &InfoStatusError{StatusCode: resp.StatusCode}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode musicbrainz response: %w", err)
+	}
+	return nil
+}
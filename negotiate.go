@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// wantsXML сообщает, что клиент просит XML в Accept. Без Accept и при
+// */* ответ остается JSON.
+func wantsXML(c *gin.Context) bool {
+	switch c.NegotiateFormat(binding.MIMEJSON, binding.MIMEXML, binding.MIMEXML2) {
+	case binding.MIMEXML, binding.MIMEXML2:
+		return true
+	}
+	return false
+}
+
+// writeSong отдает одну песню в формате из Accept или ?format=jsonapi
+func writeSong(c *gin.Context, status int, song Song) {
+	if wantsJSONAPI(c) {
+		writeJSONAPI(c, status, []Song{song}, false)
+		return
+	}
+	if wantsXML(c) {
+		c.XML(status, newSongXML(song))
+		return
+	}
+	c.JSON(status, publicSong(song))
+}
+
+// Пустой список песен - 404, как в первых версиях API. Циклы пагинации
+// стандартных клиентов принимают 404 за ошибку, поэтому по умолчанию пустой
+// список - 200 с [] (meta.total 0 в JSON:API); флаг оставлен для старых клиентов.
+var emptySongs404 = false
+
+// writeNoSongs отвечает на список песен, в котором ничего не нашлось
+func writeNoSongs(c *gin.Context) {
+	if emptySongs404 {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "No songs found")
+		return
+	}
+	writeSongs(c, http.StatusOK, []Song{})
+}
+
+// writeSongs отдает список песен в формате из Accept или ?format=jsonapi;
+// на If-None-Match с тем же ETag отвечает 304
+func writeSongs(c *gin.Context, status int, songs []Song) {
+	songs = restrictSongs(c, songs)
+	if status == http.StatusOK && notModified(c, songsETag(c, songs)) {
+		return
+	}
+	if wantsJSONAPI(c) {
+		writeJSONAPI(c, status, songs, true)
+		return
+	}
+	if wantsXML(c) {
+		list := songsXML{Songs: make([]songXML, len(songs))}
+		for i, song := range songs {
+			list.Songs[i] = newSongXML(song)
+		}
+		c.XML(status, list)
+		return
+	}
+	writeSongsJSON(c, status, songs)
+}
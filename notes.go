@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Структура SongNote (внутренняя заметка редакции к песне). Заметки не
+// входят в ответы о песнях и доступны только редакторам и администраторам.
+type SongNote struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	SongID    PublicID  `json:"songId" extensions:"x-public-id" gorm:"not null;index"`
+	Author    string    `json:"author" gorm:"not null"` // как actor в журнале аудита
+	Body      string    `json:"body" gorm:"not null"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Тело запроса на заметку
+type SongNoteRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// noteSongID проверяет, что песня из пути существует
+func noteSongID(c *gin.Context) (int, bool) {
+	id, err := parseSongID(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
+		return 0, false
+	}
+	return id, songExists(c, id)
+}
+
+// songExists проверяет песню в SQL или во внешнем хранилище; если ее нет,
+// отвечает клиенту сам
+func songExists(c *gin.Context, id int) bool {
+	if songStore != nil {
+		_, err := songStore.GetSong(c.Request.Context(), id)
+		return storeFound(c, err)
+	}
+	var count int64
+	if err := dbFor(c).Model(&Song{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch song")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch song")
+		return false
+	}
+	if count == 0 {
+		abortWithError(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return false
+	}
+	return true
+}
+
+// songNote загружает заметку песни; менять и удалять ее может автор или администратор
+func songNote(c *gin.Context, songID int) (SongNote, bool) {
+	var note SongNote
+	id, err := strconv.Atoi(c.Param("noteId"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid note ID")
+		return note, false
+	}
+	if err := dbFor(c).First(&note, "id = ? AND song_id = ?", id, songID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithError(c, http.StatusNotFound, codeNotFound, "Note not found")
+			return note, false
+		}
+		logEntry(c).WithError(err).Error("Failed to fetch note")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch note")
+		return note, false
+	}
+	if currentRole(c) != RoleAdmin && note.Author != auditActor(c) {
+		abortWithError(c, http.StatusForbidden, codeNotOwner, "You can only change your own notes")
+		return note, false
+	}
+	return note, true
+}
+
+// @Summary List song notes
+// @Description List internal editorial notes on a song, oldest first. Notes are never included in public song responses.
+// @ID list-song-notes
+// @Produce  json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Success 200 {array} SongNote
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /songs/{id}/notes [get]
+func GetSongNotes(c *gin.Context) {
+	songID, ok := noteSongID(c)
+	if !ok {
+		return
+	}
+	notes := []SongNote{}
+	if err := dbFor(c).Where("song_id = ?", songID).Order("id").Find(&notes).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch notes")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch notes")
+		return
+	}
+	c.JSON(http.StatusOK, notes)
+}
+
+// @Summary Add song note
+// @Description Add an internal note about sourcing or cleanup decisions to a song.
+// @ID create-song-note
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Param note body SongNoteRequest true "Note text"
+// @Success 201 {object} SongNote
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /songs/{id}/notes [post]
+func CreateSongNote(c *gin.Context) {
+	songID, ok := noteSongID(c)
+	if !ok {
+		return
+	}
+	var req SongNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	note := SongNote{SongID: PublicID(songID), Author: auditActor(c), Body: req.Body}
+	if err := dbFor(c).Create(&note).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to create note")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to create note")
+		return
+	}
+	c.JSON(http.StatusCreated, note)
+}
+
+// @Summary Update song note
+// @Description Replace the text of a note. Only its author or an administrator can change it.
+// @ID update-song-note
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Param noteId path int true "Note ID"
+// @Param note body SongNoteRequest true "Note text"
+// @Success 200 {object} SongNote
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /songs/{id}/notes/{noteId} [put]
+func UpdateSongNote(c *gin.Context) {
+	songID, ok := noteSongID(c)
+	if !ok {
+		return
+	}
+	var req SongNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	note, ok := songNote(c, songID)
+	if !ok {
+		return
+	}
+	note.Body = req.Body
+	if err := dbFor(c).Save(&note).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to update note")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to update note")
+		return
+	}
+	c.JSON(http.StatusOK, note)
+}
+
+// @Summary Delete song note
+// @Description Delete a note. Only its author or an administrator can delete it.
+// @ID delete-song-note
+// @Produce  json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Param noteId path int true "Note ID"
+// @Success 200 {object} Message
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /songs/{id}/notes/{noteId} [delete]
+func DeleteSongNote(c *gin.Context) {
+	songID, ok := noteSongID(c)
+	if !ok {
+		return
+	}
+	note, ok := songNote(c, songID)
+	if !ok {
+		return
+	}
+	if err := dbFor(c).Delete(&note).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to delete note")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to delete note")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Note deleted"})
+}
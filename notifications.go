@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const jobKindNotification = "notification"
+
+// Каналы уведомлений
+const (
+	channelEmail    = "email"
+	channelPush     = "push"
+	channelWebhook  = "webhook"
+	channelTelegram = "telegram"
+)
+
+var notificationChannels = []string{channelEmail, channelPush, channelWebhook, channelTelegram}
+
+// Структура NotificationPreferences (настройки уведомлений пользователя).
+// Пока пользователь их не сохранил, действуют defaultNotificationPreferences.
+type NotificationPreferences struct {
+	UserID   int      `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	Channels []string `json:"channels" gorm:"serializer:json"` // email, push, webhook, telegram
+	Events   []string `json:"events" gorm:"serializer:json"`   // song.created, song.updated, song.deleted
+	// Адреса каналов; канал без адреса включить нельзя
+	Email          string    `json:"email"`
+	PushToken      string    `json:"pushToken"`
+	WebhookURL     string    `json:"webhookUrl"`
+	TelegramChatID string    `json:"telegramChatId"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// Без сохраненных настроек: все события, но ни одного канала - адресов еще нет
+func defaultNotificationPreferences(userID int) NotificationPreferences {
+	return NotificationPreferences{UserID: userID, Channels: []string{}, Events: songEventTypes}
+}
+
+// address возвращает адрес канала из настроек
+func (p NotificationPreferences) address(channel string) string {
+	switch channel {
+	case channelEmail:
+		return p.Email
+	case channelPush:
+		return p.PushToken
+	case channelWebhook:
+		return p.WebhookURL
+	case channelTelegram:
+		return p.TelegramChatID
+	}
+	return ""
+}
+
+// Allows сообщает, получает ли пользователь событие по каналу
+func (p NotificationPreferences) Allows(channel, event string) bool {
+	return containsString(p.Channels, channel) && containsString(p.Events, event) && p.address(channel) != ""
+}
+
+func (p NotificationPreferences) validate() error {
+	for _, channel := range p.Channels {
+		if !containsString(notificationChannels, channel) {
+			return fmt.Errorf("unknown channel %q", channel)
+		}
+		if p.address(channel) == "" {
+			return fmt.Errorf("channel %q requires an address", channel)
+		}
+	}
+	for _, event := range p.Events {
+		if !containsString(songEventTypes, event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	if p.Email != "" {
+		if _, err := mail.ParseAddress(p.Email); err != nil {
+			return errors.New("invalid email address")
+		}
+	}
+	if p.WebhookURL != "" {
+		if u, err := url.Parse(p.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("invalid webhook URL")
+		}
+	}
+	return nil
+}
+
+// loadNotificationPreferences читает настройки или возвращает настройки по умолчанию
+func loadNotificationPreferences(db *gorm.DB, userID int) (NotificationPreferences, error) {
+	var prefs NotificationPreferences
+	err := db.First(&prefs, "user_id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return defaultNotificationPreferences(userID), nil
+	}
+	return prefs, err
+}
+
+// Notification - текст уведомления, одинаковый для всех каналов
+type Notification struct {
+	Event string `json:"event"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// NotificationSender доставляет уведомление по одному каналу
+type NotificationSender interface {
+	Send(ctx context.Context, address string, n Notification) error
+}
+
+// NotificationDispatcher - единственная точка отправки уведомлений
+// пользователям. Настройки проверяются и при постановке в очередь, и перед
+// доставкой: пользователь мог отключить канал, пока задача ждала.
+type NotificationDispatcher struct {
+	senders map[string]NotificationSender
+}
+
+// Диспетчер уведомлений; nil - уведомления не отправляются
+var notifier *NotificationDispatcher
+
+type notificationPayload struct {
+	UserID       int          `json:"userId"`
+	Channel      string       `json:"channel"`
+	Notification Notification `json:"notification"`
+}
+
+// Notify ставит в очередь уведомление по каждому каналу, который
+// пользователь включил для этого события и который настроен на сервере
+func (d *NotificationDispatcher) Notify(ctx context.Context, db *gorm.DB, userID int, n Notification) error {
+	if jobs == nil {
+		return nil
+	}
+	prefs, err := loadNotificationPreferences(db.WithContext(ctx), userID)
+	if err != nil {
+		return err
+	}
+	for _, channel := range prefs.Channels {
+		if _, ok := d.senders[channel]; !ok || !prefs.Allows(channel, n.Event) {
+			continue
+		}
+		payload := notificationPayload{UserID: userID, Channel: channel, Notification: n}
+		if err := jobs.Enqueue(ctx, jobKindNotification, payload, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver - обработчик задачи notification
+func (d *NotificationDispatcher) deliver(ctx context.Context, payload json.RawMessage) error {
+	var p notificationPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	prefs, err := loadNotificationPreferences(GetDB().WithContext(ctx), p.UserID)
+	if err != nil {
+		return err
+	}
+	sender, ok := d.senders[p.Channel]
+	if !ok || !prefs.Allows(p.Channel, p.Notification.Event) {
+		return nil
+	}
+	return sender.Send(ctx, prefs.address(p.Channel), p.Notification)
+}
+
+// notifySongOwner сообщает владельцу песни, что ее изменил кто-то другой
+func notifySongOwner(c *gin.Context, event string, song Song) {
+	if notifier == nil || song.OwnerID == nil {
+		return
+	}
+	if userID, ok := currentUserID(c); ok && userID == *song.OwnerID {
+		return
+	}
+	n := Notification{Event: event, Title: songEventTitle(event), Body: fmt.Sprintf("%s - %s", song.Group, song.SongName)}
+	if err := notifier.Notify(c.Request.Context(), dbFor(c), *song.OwnerID, n); err != nil {
+		logEntry(c).WithError(err).WithField("event", event).Warn("Failed to queue notification")
+	}
+}
+
+func songEventTitle(event string) string {
+	switch event {
+	case songEventCreated:
+		return "Song added"
+	case songEventUpdated:
+		return "Your song was updated"
+	case songEventDeleted:
+		return "Your song was deleted"
+	}
+	return event
+}
+
+// @Summary Get notification preferences
+// @Description Get the channels and event types the current user receives notifications for.
+// @ID get-notification-preferences
+// @Produce  json
+// @Success 200 {object} NotificationPreferences
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /me/notification-preferences [get]
+func GetNotificationPreferences(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		abortWithError(c, http.StatusForbidden, codeForbidden, "Only users have notification preferences")
+		return
+	}
+	prefs, err := loadNotificationPreferences(dbFor(c), userID)
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch notification preferences")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch notification preferences")
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// @Summary Update notification preferences
+// @Description Replace the current user's notification preferences. Every enabled channel needs its address.
+// @ID update-notification-preferences
+// @Accept  json
+// @Produce  json
+// @Param preferences body NotificationPreferences true "Channels, event types and addresses"
+// @Success 200 {object} NotificationPreferences
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /me/notification-preferences [put]
+func UpdateNotificationPreferences(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		abortWithError(c, http.StatusForbidden, codeForbidden, "Only users have notification preferences")
+		return
+	}
+	var prefs NotificationPreferences
+	if err := c.ShouldBindJSON(&prefs); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	if prefs.Channels == nil {
+		prefs.Channels = []string{}
+	}
+	if prefs.Events == nil {
+		prefs.Events = []string{}
+	}
+	if err := prefs.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	prefs.UserID = userID
+	if err := dbFor(c).Save(&prefs).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to save notification preferences")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to save notification preferences")
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+const telegramAPIURL = "https://api.telegram.org"
+
+// NotificationsConfig - серверная часть каналов; канал без настроек выключен
+type NotificationsConfig struct {
+	SMTPAddr       string // host:port
+	SMTPFrom       string
+	SMTPUsername   string
+	SMTPPassword   string
+	PushGatewayURL string // принимает POST {"token","title","body"}
+	TelegramToken  string
+	TelegramAPIURL string
+	Timeout        time.Duration
+}
+
+// NewNotificationDispatcher подключает настроенные каналы; nil - ни одного
+func NewNotificationDispatcher(cfg NotificationsConfig) *NotificationDispatcher {
+	client := &http.Client{Timeout: cfg.Timeout}
+	senders := map[string]NotificationSender{
+		// Адрес вебхука задает сам пользователь, серверных настроек не нужно
+		channelWebhook: &webhookSender{http: client},
+	}
+	if cfg.SMTPAddr != "" && cfg.SMTPFrom != "" {
+		senders[channelEmail] = &emailSender{cfg: cfg}
+	}
+	if cfg.PushGatewayURL != "" {
+		senders[channelPush] = &pushSender{url: cfg.PushGatewayURL, http: client}
+	}
+	if cfg.TelegramToken != "" {
+		apiURL := cfg.TelegramAPIURL
+		if apiURL == "" {
+			apiURL = telegramAPIURL
+		}
+		senders[channelTelegram] = &telegramSender{
+			url:  strings.TrimSuffix(apiURL, "/") + "/bot" + cfg.TelegramToken + "/sendMessage",
+			http: client,
+		}
+	}
+	return &NotificationDispatcher{senders: senders}
+}
+
+// emailSender отправляет письмо через SMTP
+type emailSender struct {
+	cfg NotificationsConfig
+}
+
+func (s *emailSender) Send(ctx context.Context, address string, n Notification) error {
+	var auth smtp.Auth
+	if s.cfg.SMTPUsername != "" {
+		host, _, _ := net.SplitHostPort(s.cfg.SMTPAddr)
+		auth = smtp.PlainAuth("", s.cfg.SMTPUsername, s.cfg.SMTPPassword, host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		s.cfg.SMTPFrom, address, n.Title, n.Body)
+	if err := smtp.SendMail(s.cfg.SMTPAddr, auth, s.cfg.SMTPFrom, []string{address}, []byte(msg)); err != nil {
+		return fmt.Errorf("send email: %w", err)
+	}
+	return nil
+}
+
+// pushSender передает уведомление шлюзу push-сообщений
+type pushSender struct {
+	url  string
+	http *http.Client
+}
+
+func (s *pushSender) Send(ctx context.Context, token string, n Notification) error {
+	return postNotificationJSON(ctx, s.http, "push gateway", s.url, map[string]string{
+		"token": token, "title": n.Title, "body": n.Body,
+	})
+}
+
+// webhookSender отправляет уведомление на вебхук пользователя
+type webhookSender struct {
+	http *http.Client
+}
+
+func (s *webhookSender) Send(ctx context.Context, address string, n Notification) error {
+	return postNotificationJSON(ctx, s.http, "user webhook", address, n)
+}
+
+// telegramSender пишет в чат через Bot API
+type telegramSender struct {
+	url  string
+	http *http.Client
+}
+
+func (s *telegramSender) Send(ctx context.Context, chatID string, n Notification) error {
+	return postNotificationJSON(ctx, s.http, "telegram", s.url, map[string]string{
+		"chat_id": chatID, "text": n.Title + "\n" + n.Body,
+	})
+}
+
+// postNotificationJSON отправляет JSON; ответ не 2xx - ошибка, задачу повторит очередь
+func postNotificationJSON(ctx context.Context, client *http.Client, name, target string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("build %s request: %w", name, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send to %s: %w", name, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("send to %s: status %d", name, resp.StatusCode)
+	}
+	return nil
+}
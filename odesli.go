@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	odesliAPIURL = "https://api.song.link/v1-alpha.1"
+	deezerAPIURL = "https://api.deezer.com"
+	iTunesAPIURL = "https://itunes.apple.com"
+)
+
+// OdesliConfig - параметры song.link (Odesli); ключ нужен только для
+// повышенного лимита запросов
+type OdesliConfig struct {
+	APIKey string
+	APIURL string
+}
+
+// OdesliClient по ссылке на одной площадке находит ту же песню на остальных
+type OdesliClient struct {
+	cfg     OdesliConfig
+	country string
+	http    *http.Client
+}
+
+func NewOdesliClient(cfg OdesliConfig, country string, timeout time.Duration) *OdesliClient {
+	if cfg.APIURL == "" {
+		cfg.APIURL = odesliAPIURL
+	}
+	cfg.APIURL = strings.TrimSuffix(cfg.APIURL, "/")
+	return &OdesliClient{cfg: cfg, country: country, http: trackHTTP(&http.Client{Timeout: timeout}, linkProviderOdesli, dependencyEnrichment)}
+}
+
+// Ответ /links, только нужные поля
+type odesliLinksResponse struct {
+	LinksByPlatform map[string]struct {
+		URL string `json:"url"`
+	} `json:"linksByPlatform"`
+}
+
+// Links возвращает ссылки по площадкам для известной ссылки на песню
+func (oc *OdesliClient) Links(ctx context.Context, link string) (map[string]string, error) {
+	params := url.Values{"url": {link}}
+	if oc.country != "" {
+		params.Set("userCountry", oc.country)
+	}
+	if oc.cfg.APIKey != "" {
+		params.Set("key", oc.cfg.APIKey)
+	}
+	var result odesliLinksResponse
+	if err := getSearchJSON(ctx, oc.http, "odesli", oc.cfg.APIURL+"/links?"+params.Encode(), &result); err != nil {
+		return nil, err
+	}
+	links := make(map[string]string, len(result.LinksByPlatform))
+	for platform, entry := range result.LinksByPlatform {
+		if entry.URL != "" {
+			links[platform] = entry.URL
+		}
+	}
+	return links, nil
+}
+
+// deezerSearch ищет трек через открытый поиск Deezer
+type deezerSearch struct {
+	apiURL string
+	http   *http.Client
+}
+
+func newDeezerSearch(apiURL string, timeout time.Duration) *deezerSearch {
+	if apiURL == "" {
+		apiURL = deezerAPIURL
+	}
+	return &deezerSearch{apiURL: strings.TrimSuffix(apiURL, "/"), http: trackHTTP(&http.Client{Timeout: timeout}, linkProviderDeezer, dependencyEnrichment)}
+}
+
+func (s *deezerSearch) Platform() string { return platformDeezer }
+
+func (s *deezerSearch) FindTrack(ctx context.Context, group, song string) (string, error) {
+	params := url.Values{
+		"q":     {fmt.Sprintf(`artist:"%s" track:"%s"`, group, song)},
+		"limit": {"5"},
+	}
+	var result struct {
+		Data []struct {
+			Title  string `json:"title"`
+			Link   string `json:"link"`
+			Artist struct {
+				Name string `json:"name"`
+			} `json:"artist"`
+		} `json:"data"`
+	}
+	if err := getSearchJSON(ctx, s.http, "deezer", s.apiURL+"/search?"+params.Encode(), &result); err != nil {
+		return "", err
+	}
+	for _, track := range result.Data {
+		if sameTitle(track.Artist.Name, group) && sameTitle(track.Title, song) {
+			return track.Link, nil
+		}
+	}
+	return "", ErrInfoNotFound
+}
+
+// iTunesSearch ищет трек в iTunes Search API; ссылки ведут в Apple Music
+type iTunesSearch struct {
+	apiURL  string
+	country string
+	http    *http.Client
+}
+
+func newITunesSearch(apiURL, country string, timeout time.Duration) *iTunesSearch {
+	if apiURL == "" {
+		apiURL = iTunesAPIURL
+	}
+	return &iTunesSearch{apiURL: strings.TrimSuffix(apiURL, "/"), country: country, http: trackHTTP(&http.Client{Timeout: timeout}, linkProviderITunes, dependencyEnrichment)}
+}
+
+func (s *iTunesSearch) Platform() string { return platformAppleMusic }
+
+func (s *iTunesSearch) FindTrack(ctx context.Context, group, song string) (string, error) {
+	params := url.Values{
+		"term":   {group + " " + song},
+		"entity": {"song"},
+		"limit":  {"5"},
+	}
+	if s.country != "" {
+		params.Set("country", s.country)
+	}
+	var result struct {
+		Results []struct {
+			TrackName    string `json:"trackName"`
+			ArtistName   string `json:"artistName"`
+			TrackViewURL string `json:"trackViewUrl"`
+		} `json:"results"`
+	}
+	if err := getSearchJSON(ctx, s.http, "itunes", s.apiURL+"/search?"+params.Encode(), &result); err != nil {
+		return "", err
+	}
+	for _, track := range result.Results {
+		if sameTitle(track.ArtistName, group) && sameTitle(track.TrackName, song) {
+			return track.TrackViewURL, nil
+		}
+	}
+	return "", ErrInfoNotFound
+}
+
+// sameTitle сравнивает названия без регистра и знаков препинания
+func sameTitle(a, b string) bool {
+	return strings.Join(searchWords(a), " ") == strings.Join(searchWords(b), " ")
+}
+
+// getSearchJSON выполняет GET и разбирает JSON; 404 - ErrInfoNotFound
+func getSearchJSON(ctx context.Context, client *http.Client, name, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("build %s request: %w", name, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInfoUnavailable, name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrInfoNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &InfoStatusError{StatusCode: resp.StatusCode}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s response: %w", name, err)
+	}
+	return nil
+}
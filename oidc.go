@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcNonceCookie = "oidc_nonce"
+)
+
+// UserIdentity связывает учетную запись у внешнего провайдера с пользователем
+type UserIdentity struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	UserID    int       `json:"userId" gorm:"not null;index"`
+	Issuer    string    `json:"issuer" gorm:"not null;uniqueIndex:idx_identity_subject"`
+	Subject   string    `json:"subject" gorm:"not null;uniqueIndex:idx_identity_subject"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// OIDCAuth - вход через внешнего провайдера (Google, Keycloak и т.п.)
+type OIDCAuth struct {
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	oauth    oauth2.Config
+}
+
+// oidcAuth равен nil, если OIDC не настроен
+var oidcAuth *OIDCAuth
+
+// oidcClaims - поля ID-токена, используемые для создания пользователя
+type oidcClaims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+}
+
+// NewOIDCAuth получает discovery-документ и JWKS провайдера
+func NewOIDCAuth(ctx context.Context, cfg Config) (*OIDCAuth, error) {
+	if cfg.OIDCIssuer == "" {
+		return nil, nil
+	}
+	provider, err := oidc.NewProvider(ctx, cfg.OIDCIssuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+	return &OIDCAuth{
+		provider: provider,
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.OIDCClientID}),
+		oauth: oauth2.Config{
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+	}, nil
+}
+
+// verifyBearer проверяет ID-токен провайдера по его JWKS и возвращает
+// связанного локального пользователя
+func (a *OIDCAuth) verifyBearer(ctx context.Context, raw string) (*User, error) {
+	idToken, err := a.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	return userForIdentity(ctx, idToken.Issuer, claims)
+}
+
+// userForIdentity находит пользователя по (issuer, sub) или создает нового
+func userForIdentity(ctx context.Context, issuer string, claims oidcClaims) (*User, error) {
+	var user User
+	err := GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var identity UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", issuer, claims.Subject).First(&identity).Error
+		if err == nil {
+			return tx.First(&user, identity.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		username := claims.PreferredUsername
+		if username == "" {
+			username = claims.Email
+		}
+		if username == "" {
+			username = claims.Subject
+		}
+		// Имя может быть занято локальным пользователем или другим провайдером
+		var taken int64
+		if err := tx.Model(&User{}).Where("username = ?", username).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			username = fmt.Sprintf("%s@%s", claims.Subject, issuer)
+		}
+
+		user = User{Username: username, Role: RoleReader}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&UserIdentity{UserID: user.ID, Issuer: issuer, Subject: claims.Subject}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// @Summary OIDC login
+// @Description Redirect to the external identity provider.
+// @ID oidc-login
+// @Success 302
+// @Failure 404 {object} APIError
+// @Router /auth/oidc/login [get]
+func OIDCLogin(c *gin.Context) {
+	if oidcAuth == nil {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "OIDC login is not configured")
+		return
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to generate OIDC state")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to start login")
+		return
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to generate OIDC nonce")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to start login")
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, 600, "/auth/oidc", "", c.Request.TLS != nil, true)
+	c.SetCookie(oidcNonceCookie, nonce, 600, "/auth/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, oidcAuth.oauth.AuthCodeURL(state, oidc.Nonce(nonce)))
+}
+
+// @Summary OIDC callback
+// @Description Complete the OIDC code flow and issue a local access token.
+// @ID oidc-callback
+// @Produce  json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /auth/oidc/callback [get]
+func OIDCCallback(c *gin.Context) {
+	if oidcAuth == nil {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "OIDC login is not configured")
+		return
+	}
+
+	state, err := c.Cookie(oidcStateCookie)
+	if err != nil || state == "" || c.Query("state") != state {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid OIDC state")
+		return
+	}
+
+	ctx := c.Request.Context()
+	oauthToken, err := oidcAuth.oauth.Exchange(ctx, c.Query("code"))
+	if err != nil {
+		logEntry(c).WithError(err).Warn("Failed to exchange OIDC code")
+		abortWithError(c, http.StatusUnauthorized, codeUnauthenticated, "Failed to log in")
+		return
+	}
+	rawIDToken, ok := oauthToken.Extra("id_token").(string)
+	if !ok {
+		abortWithError(c, http.StatusUnauthorized, codeUnauthenticated, "Provider returned no ID token")
+		return
+	}
+	idToken, err := oidcAuth.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		logEntry(c).WithError(err).Warn("Failed to verify OIDC ID token")
+		abortWithError(c, http.StatusUnauthorized, codeUnauthenticated, "Failed to log in")
+		return
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		abortWithError(c, http.StatusUnauthorized, codeUnauthenticated, "Failed to log in")
+		return
+	}
+	if nonce, err := c.Cookie(oidcNonceCookie); err != nil || claims.Nonce != nonce {
+		abortWithError(c, http.StatusUnauthorized, codeUnauthenticated, "Invalid OIDC nonce")
+		return
+	}
+
+	user, err := userForIdentity(c.Request.Context(), idToken.Issuer, claims)
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to map OIDC identity to user")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to log in")
+		return
+	}
+
+	token, expires, err := jwtKeys.Issue(*user)
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to issue access token")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to log in")
+		return
+	}
+
+	mergeSessionOnLogin(c, user.ID)
+	c.SetCookie(oidcStateCookie, "", -1, "/auth/oidc", "", c.Request.TLS != nil, true)
+	c.SetCookie(oidcNonceCookie, "", -1, "/auth/oidc", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(expires).Seconds()),
+	})
+}
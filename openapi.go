@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+)
+
+// Расширение операции, отключающее проверку тела: обработчик проверяет его
+// сам, например POST /songs/batch - по каждой песне отдельно
+const extSkipBodyValidation = "x-skip-body-validation"
+
+// Формат строки с ID песни в любой из форм, см. parseSongID
+const publicIDFormat = "public-id"
+
+func init() {
+	openapi3.DefineStringFormatCallback(publicIDFormat, func(s string) error {
+		_, err := parseSongID(s)
+		return err
+	})
+	// Клиенту - причина ошибки, без схемы и значения целиком
+	openapi3.SchemaErrorDetailsDisabled = true
+}
+
+// RequestSpec - встроенная спецификация, по которой проверяются запросы.
+// Swagger 2.0 переводится в OpenAPI 3 и проверяется kin-openapi, поэтому
+// действуют все ключевые слова схем, которые поддерживает библиотека.
+// Операции индексированы шаблоном маршрута gin: /songs/:id.
+type RequestSpec struct {
+	doc    *openapi3.T
+	routes map[string]map[string]*routers.Route // маршрут -> метод -> операция
+}
+
+// Спецификация для проверки запросов; nil - проверка выключена
+var requestSpec *RequestSpec
+
+var specPathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// LoadRequestSpec разбирает спецификацию Swagger 2.0. Спецификация, которую
+// kin-openapi считает некорректной, - ошибка загрузки.
+func LoadRequestSpec(raw string) (*RequestSpec, error) {
+	var doc2 openapi2.T
+	if err := json.Unmarshal([]byte(raw), &doc2); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	doc, err := openapi2conv.ToV3(&doc2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	prepareSpec(doc)
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+
+	s := &RequestSpec{doc: doc, routes: map[string]map[string]*routers.Route{}}
+	if doc.Paths == nil {
+		return s, nil
+	}
+	for path, item := range doc.Paths.Map() {
+		route := specPathParam.ReplaceAllString(path, ":$1")
+		for method, op := range item.Operations() {
+			if s.routes[route] == nil {
+				s.routes[route] = map[string]*routers.Route{}
+			}
+			s.routes[route][method] = &routers.Route{Spec: doc, Path: path, PathItem: item, Method: method, Operation: op}
+		}
+	}
+	return s, nil
+}
+
+// prepareSpec переводит соглашения сервиса на язык OpenAPI 3: необязательные
+// поля принимают null, как и при разборе тела обработчиком, а поля и
+// параметры x-public-id - число или публичную форму ID
+func prepareSpec(doc *openapi3.T) {
+	seen := map[*openapi3.Schema]bool{}
+	if doc.Components != nil {
+		for _, schema := range doc.Components.Schemas {
+			prepareSchema(schema, seen)
+		}
+	}
+	if doc.Paths == nil {
+		return
+	}
+	for _, item := range doc.Paths.Map() {
+		for _, op := range item.Operations() {
+			for _, param := range op.Parameters {
+				if param.Value == nil || param.Value.Schema == nil {
+					continue
+				}
+				if isPublicID(param.Value.Extensions) {
+					publicIDSchema(param.Value.Schema.Value)
+				}
+				prepareSchema(param.Value.Schema, seen)
+			}
+			if op.RequestBody != nil && op.RequestBody.Value != nil {
+				for _, media := range op.RequestBody.Value.Content {
+					prepareSchema(media.Schema, seen)
+				}
+			}
+		}
+	}
+}
+
+func prepareSchema(ref *openapi3.SchemaRef, seen map[*openapi3.Schema]bool) {
+	if ref == nil || ref.Value == nil || seen[ref.Value] {
+		return
+	}
+	schema := ref.Value
+	seen[schema] = true
+	if isPublicID(schema.Extensions) {
+		publicIDSchema(schema)
+	}
+	required := map[string]bool{}
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	for name, prop := range schema.Properties {
+		prepareSchema(prop, seen)
+		if required[name] {
+			continue
+		}
+		if prop.Ref != "" {
+			// Общую схему из components не трогаем: null допустим только здесь
+			schema.Properties[name] = &openapi3.SchemaRef{Value: &openapi3.Schema{Nullable: true, AllOf: openapi3.SchemaRefs{prop}}}
+		} else if prop.Value != nil {
+			prop.Value.Nullable = true
+		}
+	}
+	for _, refs := range []openapi3.SchemaRefs{schema.AllOf, schema.OneOf, schema.AnyOf} {
+		for _, r := range refs {
+			prepareSchema(r, seen)
+		}
+	}
+	prepareSchema(schema.Items, seen)
+	prepareSchema(schema.AdditionalProperties.Schema, seen)
+}
+
+// publicIDSchema: строка - публичная форма или число, целое - любая из двух
+func publicIDSchema(schema *openapi3.Schema) {
+	if schema.Type.Is(openapi3.TypeString) {
+		schema.Format = publicIDFormat
+		return
+	}
+	schema.Type, schema.Format = nil, ""
+	schema.OneOf = openapi3.SchemaRefs{
+		openapi3.NewIntegerSchema().NewRef(),
+		openapi3.NewStringSchema().WithFormat(publicIDFormat).NewRef(),
+	}
+}
+
+// Route возвращает операцию для маршрута gin; nil - ее нет в спецификации
+func (s *RequestSpec) Route(method, route string) *routers.Route {
+	return s.routes[route][method]
+}
+
+// ValidateRequests отвечает 400 на запросы, не соответствующие спецификации,
+// до вызова обработчика. Маршруты, которых нет в спецификации, не проверяются.
+func ValidateRequests(s *RequestSpec) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := s.Route(c.Request.Method, c.FullPath())
+		if route == nil {
+			c.Next()
+			return
+		}
+		if err := validateRequest(c, route); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, errorBody(err))
+			return
+		}
+		c.Next()
+	}
+}
+
+// validateRequest проверяет параметры и JSON-тело. Тела других типов (CSV,
+// формы, архивы) не проверяются: разбор формы до обработчика обошел бы его
+// ограничения размера загружаемых файлов. Тело без Content-Type
+// проверяется как JSON - так его разбирают обработчики.
+func validateRequest(c *gin.Context, route *routers.Route) error {
+	params := make(map[string]string, len(c.Params))
+	for _, p := range c.Params {
+		params[p.Key] = p.Value
+	}
+	req := c.Request
+	opts := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		// Тело и строка запроса доходят до обработчика нетронутыми
+		SkipSettingDefaults: true,
+	}
+	skip, _ := route.Operation.Extensions[extSkipBodyValidation].(bool)
+	switch ct := req.Header.Get("Content-Type"); {
+	case skip:
+		opts.ExcludeRequestBody = true
+	case ct == "":
+		req = c.Request.Clone(c.Request.Context())
+		req.Header.Set("Content-Type", gin.MIMEJSON)
+	default:
+		mediaType, _, err := mime.ParseMediaType(ct)
+		opts.ExcludeRequestBody = err != nil || mediaType != gin.MIMEJSON
+	}
+
+	err := openapi3filter.ValidateRequest(req.Context(), &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: params,
+		Route:      route,
+		Options:    opts,
+	})
+	// Библиотека прочитала тело и положила на место копию
+	c.Request.Body = req.Body
+	return requestSpecError(err)
+}
+
+// requestSpecError переводит ошибку kin-openapi в короткое сообщение:
+// какой параметр или поле тела и что с ним не так
+func requestSpecError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var reqErr *openapi3filter.RequestError
+	if !errors.As(err, &reqErr) {
+		return err
+	}
+	missing := errors.Is(reqErr.Err, openapi3filter.ErrInvalidRequired)
+	reason, field := reqErr.Reason, ""
+	var schemaErr *openapi3.SchemaError
+	if errors.As(reqErr.Err, &schemaErr) {
+		path := schemaErr.JSONPointer()
+		// Необязательное поле со ссылкой обернуто в allOf (см. prepareSchema):
+		// клиенту - ошибка из самой схемы
+		var inner *openapi3.SchemaError
+		for schemaErr.SchemaField == "allOf" && errors.As(schemaErr.Origin, &inner) {
+			schemaErr, path = inner, append(path, inner.JSONPointer()...)
+		}
+		reason, field = schemaErr.Reason, strings.Join(path, ".")
+	} else if reqErr.Err != nil && reason == "" {
+		reason = reqErr.Err.Error()
+	}
+
+	if param := reqErr.Parameter; param != nil {
+		if missing {
+			return fmt.Errorf("Missing %s parameter %s", param.In, param.Name)
+		}
+		return fmt.Errorf("Invalid %s parameter %s: %s", param.In, param.Name, reason)
+	}
+	if body := reqErr.RequestBody; body != nil {
+		if missing {
+			return fmt.Errorf("Missing request body")
+		}
+		if field == "" {
+			return fmt.Errorf("Invalid request body: %s", reason)
+		}
+		if name, _ := body.Extensions["x-originalParamName"].(string); name != "" {
+			field = name + "." + field
+		}
+		return fmt.Errorf("Invalid request body: %s: %s", field, reason)
+	}
+	return err
+}
+
+// isPublicID сообщает, что параметр или поле - ID песни в любой из форм
+func isPublicID(ext map[string]any) bool {
+	_, ok := ext[extPublicID]
+	return ok
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Спецификация с ключевыми словами ограничений, вложенными схемами и
+// расширениями сервиса
+const limitsSpec = `{
+  "swagger": "2.0",
+  "info": {"title": "test", "version": "1"},
+  "paths": {
+    "/items": {
+      "get": {
+        "parameters": [
+          {"name": "q", "in": "query", "type": "string", "minLength": 2, "maxLength": 5, "pattern": "^[a-z]+$"},
+          {"name": "n", "in": "query", "type": "integer", "minimum": 1, "maximum": 10, "exclusiveMaximum": true},
+          {"name": "sort", "in": "query", "type": "string", "enum": ["asc", "desc"]}
+        ],
+        "responses": {"204": {"description": "ok"}}
+      },
+      "post": {
+        "consumes": ["application/json", "text/csv"],
+        "parameters": [
+          {"name": "item", "in": "body", "required": true, "schema": {"$ref": "#/definitions/Item"}}
+        ],
+        "responses": {"204": {"description": "ok"}}
+      }
+    },
+    "/items/{id}": {
+      "put": {
+        "x-skip-body-validation": true,
+        "parameters": [
+          {"name": "id", "in": "path", "required": true, "type": "string", "x-public-id": true},
+          {"name": "item", "in": "body", "required": true, "schema": {"$ref": "#/definitions/Item"}}
+        ],
+        "responses": {"204": {"description": "ok"}}
+      }
+    }
+  },
+  "definitions": {
+    "Item": {
+      "type": "object",
+      "required": ["name"],
+      "properties": {
+        "name": {"type": "string", "minLength": 2, "maxLength": 5},
+        "code": {"type": "string", "pattern": "^[A-Z]{3}$"},
+        "score": {"type": "number", "minimum": 0, "exclusiveMinimum": true, "maximum": 100},
+        "at": {"type": "string", "format": "date-time"},
+        "day": {"type": "string", "format": "date"},
+        "tags": {"type": "array", "minItems": 1, "maxItems": 2, "uniqueItems": true, "items": {"type": "string", "maxLength": 3}},
+        "songId": {"type": "integer", "x-public-id": true},
+        "owner": {"$ref": "#/definitions/Owner"},
+        "meta": {"type": "object", "additionalProperties": false, "properties": {"kind": {"type": "string", "enum": ["a", "b"]}}}
+      }
+    },
+    "Owner": {
+      "type": "object",
+      "required": ["role"],
+      "properties": {"role": {"type": "string", "enum": ["admin", "reader"]}}
+    }
+  }
+}`
+
+func TestValidateRequestsLimits(t *testing.T) {
+	s, err := LoadRequestSpec(limitsSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := publicIDs
+	publicIDs = newOpaqueIDCodec("test-secret")
+	t.Cleanup(func() { publicIDs = prev })
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ValidateRequests(s))
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.GET("/items", ok)
+	router.POST("/items", ok)
+	router.PUT("/items/:id", ok)
+
+	cases := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		err         string // пусто - запрос проходит
+	}{
+		{"valid query", http.MethodGet, "/items?q=abc&n=9&sort=asc", "", "", ""},
+		{"short query", http.MethodGet, "/items?q=a", "", "", "Invalid query parameter q: minimum string length is 2"},
+		{"long query", http.MethodGet, "/items?q=abcdef", "", "", "Invalid query parameter q: maximum string length is 5"},
+		{"query pattern", http.MethodGet, "/items?q=AB", "", "", "Invalid query parameter q: string doesn't match the regular expression"},
+		{"query minimum", http.MethodGet, "/items?n=0", "", "", "Invalid query parameter n: number must be at least 1"},
+		{"query exclusive maximum", http.MethodGet, "/items?n=10", "", "", "Invalid query parameter n: number must be less than 10"},
+		{"query type", http.MethodGet, "/items?n=ten", "", "", "Invalid query parameter n"},
+		{"query enum", http.MethodGet, "/items?sort=up", "", "", "Invalid query parameter sort: value is not one of the allowed values"},
+
+		{"valid body", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ёжик","code":"ABC","score":100,"at":"2024-05-01T10:00:00Z","day":"2024-05-01","tags":["a","b"],"owner":{"role":"admin"},"meta":{"kind":"a"}}`, ""},
+		{"length counts characters", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ёжики"}`, ""},
+		{"missing body", http.MethodPost, "/items", gin.MIMEJSON, "", "Missing request body"},
+		{"required field", http.MethodPost, "/items", gin.MIMEJSON, `{"code":"ABC"}`, `Invalid request body: item.name: property "name" is missing`},
+		{"null required field", http.MethodPost, "/items", gin.MIMEJSON, `{"name":null}`, "Invalid request body: item.name"},
+		{"null skips limits", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","code":null,"owner":null,"tags":null}`, ""},
+		{"short name", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"a"}`, "Invalid request body: item.name: minimum string length is 2"},
+		{"long name", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"abcdef"}`, "Invalid request body: item.name: maximum string length is 5"},
+		{"body pattern", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","code":"abc"}`, "Invalid request body: item.code: string doesn't match the regular expression"},
+		{"exclusive minimum", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","score":0}`, "Invalid request body: item.score: number must be more than 0"},
+		{"maximum", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","score":100.5}`, "Invalid request body: item.score: number must be at most 100"},
+		{"date-time format", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","at":"2024-05-01"}`, `Invalid request body: item.at: string doesn't match the format "date-time"`},
+		{"date format", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","day":"01.05.2024"}`, `Invalid request body: item.day: string doesn't match the format "date"`},
+		{"min items", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","tags":[]}`, "Invalid request body: item.tags: minimum number of items is 1"},
+		{"max items", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","tags":["a","b","c"]}`, "Invalid request body: item.tags: maximum number of items is 2"},
+		{"unique items", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","tags":["a","a"]}`, "Invalid request body: item.tags: duplicate items found"},
+		{"item limits", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","tags":["abcd"]}`, "Invalid request body: item.tags.0: maximum string length is 3"},
+		{"nested enum", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","owner":{"role":"root"}}`, "Invalid request body: item.owner.role: value is not one of the allowed values"},
+		{"nested required", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","owner":{}}`, `Invalid request body: item.owner.role: property "role" is missing`},
+		{"additional properties", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","meta":{"other":1}}`, `Invalid request body: item.meta: property "other" is unsupported`},
+		{"type", http.MethodPost, "/items", gin.MIMEJSON, `{"name":["ab"]}`, "Invalid request body: item.name: value must be a string"},
+		{"numeric song ID", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","songId":1}`, ""},
+		{"public song ID", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","songId":"` + encodeSongID(1) + `"}`, ""},
+		{"invalid song ID", http.MethodPost, "/items", gin.MIMEJSON, `{"name":"ab","songId":"1x"}`, "Invalid request body: item.songId"},
+		{"no content type is JSON", http.MethodPost, "/items", "", `{"name":"a"}`, "Invalid request body: item.name: minimum string length is 2"},
+		{"other content types are not checked", http.MethodPost, "/items", "text/csv", "name\na\n", ""},
+
+		{"public path ID", http.MethodPut, "/items/" + encodeSongID(1), gin.MIMEJSON, `{}`, ""},
+		{"numeric path ID", http.MethodPut, "/items/1", gin.MIMEJSON, `{}`, ""},
+		{"invalid path ID", http.MethodPut, "/items/1x", gin.MIMEJSON, `{}`, "Invalid path parameter id"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if tc.err == "" {
+			if w.Code != http.StatusNoContent {
+				t.Errorf("%s: status %d: %s", tc.name, w.Code, w.Body)
+			}
+			continue
+		}
+		var body struct{ Error string }
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != http.StatusBadRequest || !strings.Contains(body.Error, tc.err) {
+			t.Errorf("%s: status %d, body %s, want 400 with %q", tc.name, w.Code, w.Body, tc.err)
+		}
+	}
+}
+
+func TestValidateRequestsKeepsBody(t *testing.T) {
+	s, err := LoadRequestSpec(limitsSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ValidateRequests(s))
+	var got map[string]interface{}
+	router.POST("/items", func(c *gin.Context) {
+		if err := c.ShouldBindJSON(&got); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// Тело без Content-Type доходит до обработчика без подставленных значений
+	req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"name":"ab"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || len(got) != 1 || got["name"] != "ab" {
+		t.Fatalf("status %d, handler got %v", w.Code, got)
+	}
+}
+
+func TestLoadRequestSpecRejectsInvalidSpec(t *testing.T) {
+	specs := map[string]string{
+		"bad pattern":     `{"swagger":"2.0","info":{"title":"t","version":"1"},"paths":{},"definitions":{"Item":{"properties":{"code":{"type":"string","pattern":"[A-"}}}}}`,
+		"unresolved $ref": `{"swagger":"2.0","info":{"title":"t","version":"1"},"paths":{"/x":{"post":{"parameters":[{"name":"b","in":"body","schema":{"$ref":"#/definitions/Missing"}}],"responses":{"204":{"description":"ok"}}}}}}`,
+		"unknown type":    `{"swagger":"2.0","info":{"title":"t","version":"1"},"paths":{},"definitions":{"Item":{"type":"record"}}}`,
+	}
+	for name, raw := range specs {
+		if _, err := LoadRequestSpec(raw); err == nil || !strings.Contains(err.Error(), "invalid OpenAPI spec") {
+			t.Errorf("%s: error = %v, want invalid spec", name, err)
+		}
+	}
+}
+
+func TestBuiltInSpecValidatesSongs(t *testing.T) {
+	setupTestDB(t)
+	spec, err := LoadRequestSpec(swaggerSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := requestSpec
+	requestSpec = spec
+	t.Cleanup(func() { requestSpec = prev })
+	router := newTestRouter()
+
+	w := doRequestAs(router, http.MethodPost, "/songs", `{"group":"`+strings.Repeat("я", 201)+`","song":"Hysteria"}`, testAdminToken)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "song.group: maximum string length is 200") {
+		t.Errorf("long group: status %d, body %s", w.Code, w.Body)
+	}
+	w = doRequestAs(router, http.MethodGet, "/songs?limit=ten", "", testAdminToken)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Invalid query parameter limit") {
+		t.Errorf("bad limit: status %d, body %s", w.Code, w.Body)
+	}
+	w = doRequestAs(router, http.MethodGet, "/songs?limit=5", "", testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Errorf("valid list: status %d, body %s", w.Code, w.Body)
+	}
+}
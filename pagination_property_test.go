@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"pgregory.net/rapid"
+)
+
+// Свойства пагинации GET /songs: при любом наборе данных, фильтре и размере
+// страницы обход страниц возвращает каждую подходящую песню ровно один раз.
+
+// Группа и название уникальны, как в каталоге
+func genSongs(t *rapid.T) []Song {
+	return rapid.SliceOfNDistinct(rapid.Custom(func(t *rapid.T) Song {
+		return Song{
+			Group:    rapid.SampledFrom([]string{"Muse", "Queen", "Кино"}).Draw(t, "group"),
+			SongName: rapid.StringMatching(`[a-z]{1,8}`).Draw(t, "song"),
+			Explicit: rapid.Bool().Draw(t, "explicit"),
+		}
+	}), 0, 40, batchKey).Draw(t, "songs")
+}
+
+// fetchPage возвращает песни страницы и курсор следующей страницы
+func fetchPage(t interface{ Fatalf(string, ...any) }, router http.Handler, target string) ([]Song, string) {
+	w := doRequest(router, http.MethodGet, target, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d: %s", target, w.Code, w.Body.String())
+	}
+	var songs []Song
+	if err := json.Unmarshal(w.Body.Bytes(), &songs); err != nil {
+		t.Fatalf("GET %s: decode: %v", target, err)
+	}
+	return songs, w.Header().Get("X-Next-Cursor")
+}
+
+func TestPaginationYieldsEveryRowOnce(t *testing.T) {
+	conn := setupTestDB(t)
+	router := newTestRouter()
+
+	rapid.Check(t, func(t *rapid.T) {
+		conn.Exec("DELETE FROM songs")
+		songs := genSongs(t)
+		for i := range songs {
+			if err := conn.Create(&songs[i]).Error; err != nil {
+				t.Fatalf("insert: %v", err)
+			}
+		}
+		limit := rapid.IntRange(1, 15).Draw(t, "limit")
+		filter := rapid.SampledFrom([]string{"", "true", "false"}).Draw(t, "explicit")
+		useCursor := rapid.Bool().Draw(t, "cursor")
+
+		want := map[int]bool{}
+		for _, s := range songs {
+			if filter == "" || strconv.FormatBool(s.Explicit) == filter {
+				want[s.ID] = true
+			}
+		}
+
+		base := fmt.Sprintf("/songs?limit=%d", limit)
+		if filter != "" {
+			base += "&explicit=" + filter
+		}
+
+		seen := map[int]bool{}
+		cursor := ""
+		for page := 1; page <= len(songs)+1; page++ {
+			target := fmt.Sprintf("%s&page=%d", base, page)
+			if useCursor && page > 1 {
+				target = base + "&after=" + cursor
+			}
+			got, next := fetchPage(t, router, target)
+			if len(got) > limit {
+				t.Fatalf("page %d has %d songs, limit %d", page, len(got), limit)
+			}
+			for _, s := range got {
+				if seen[s.ID] {
+					t.Fatalf("song %d returned twice", s.ID)
+				}
+				if !want[s.ID] {
+					t.Fatalf("song %d does not match filter %q", s.ID, filter)
+				}
+				seen[s.ID] = true
+			}
+			if len(got) < limit || (useCursor && next == "") {
+				break
+			}
+			cursor = next
+		}
+
+		if len(seen) != len(want) {
+			t.Fatalf("paging returned %d songs, want %d", len(seen), len(want))
+		}
+	})
+}
+
+func TestCursorPaginationUnderConcurrentInserts(t *testing.T) {
+	conn := setupTestDB(t)
+	router := newTestRouter()
+
+	rapid.Check(t, func(t *rapid.T) {
+		conn.Exec("DELETE FROM songs")
+		initial := rapid.IntRange(0, 30).Draw(t, "initial")
+		inserts := rapid.IntRange(0, 30).Draw(t, "inserts")
+		limit := rapid.IntRange(1, 10).Draw(t, "limit")
+
+		existing := map[int]bool{}
+		for i := 0; i < initial; i++ {
+			s := Song{Group: "Muse", SongName: fmt.Sprintf("before-%d", i)}
+			if err := conn.Create(&s).Error; err != nil {
+				t.Fatalf("insert: %v", err)
+			}
+			existing[s.ID] = true
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < inserts; i++ {
+				conn.Create(&Song{Group: "Muse", SongName: fmt.Sprintf("during-%d", i)})
+			}
+		}()
+
+		seen := map[int]bool{}
+		lastID := 0
+		target := fmt.Sprintf("/songs?limit=%d", limit)
+		for {
+			got, next := fetchPage(t, router, target)
+			for _, s := range got {
+				if seen[s.ID] {
+					t.Fatalf("song %d returned twice", s.ID)
+				}
+				if s.ID <= lastID {
+					t.Fatalf("song %d returned after %d", s.ID, lastID)
+				}
+				seen[s.ID] = true
+				lastID = s.ID
+			}
+			if next == "" {
+				break
+			}
+			target = fmt.Sprintf("/songs?limit=%d&after=%s", limit, next)
+		}
+		wg.Wait()
+
+		// Строки, существовавшие до начала обхода, не могут быть пропущены
+		for id := range existing {
+			if !seen[id] {
+				t.Fatalf("song %d was skipped", id)
+			}
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ProfanityFilter хранит списки нецензурных слов по языкам
+type ProfanityFilter struct {
+	words map[string]map[string]struct{} // язык -> слова
+}
+
+var profanity = &ProfanityFilter{}
+
+// LoadProfanityFilter читает файлы <язык>.txt из каталога: по одному слову
+// в строке, строки с # пропускаются. Пустой путь дает пустой фильтр.
+func LoadProfanityFilter(dir string) (*ProfanityFilter, error) {
+	f := &ProfanityFilter{words: map[string]map[string]struct{}{}}
+	if dir == "" {
+		return f, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		lang := strings.TrimSuffix(filepath.Base(path), ".txt")
+		words, err := readWordlist(path)
+		if err != nil {
+			return nil, err
+		}
+		f.words[lang] = words
+	}
+	return f, nil
+}
+
+func readWordlist(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	words := map[string]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		words[word] = struct{}{}
+	}
+	return words, scanner.Err()
+}
+
+// isProfane проверяет слово по списку языка; пустой язык - по всем спискам
+func (f *ProfanityFilter) isProfane(word, lang string) bool {
+	word = strings.ToLower(word)
+	if lang != "" {
+		_, ok := f.words[lang][word]
+		return ok
+	}
+	for _, words := range f.words {
+		if _, ok := words[word]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains сообщает, есть ли в тексте слова хотя бы из одного списка
+func (f *ProfanityFilter) Contains(text string) bool {
+	for _, word := range strings.FieldsFunc(text, isNotWordRune) {
+		if f.isProfane(word, "") {
+			return true
+		}
+	}
+	return false
+}
+
+// Mask заменяет нецензурные слова звездочками, сохраняя первую букву
+func (f *ProfanityFilter) Mask(text, lang string) string {
+	if len(f.words) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if isNotWordRune(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && !isNotWordRune(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		if f.isProfane(word, lang) {
+			b.WriteRune(runes[i])
+			b.WriteString(strings.Repeat("*", j-i-1))
+		} else {
+			b.WriteString(word)
+		}
+		i = j
+	}
+	return b.String()
+}
+
+func isNotWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Каждый эндпоинт укладывается в фиксированное число запросов к базе
+// независимо от количества строк; рост числа запросов означает N+1
+func TestQueryBudgetPerEndpoint(t *testing.T) {
+	cases := []struct {
+		name, method, target, body string
+		max                        int64
+	}{
+		{name: "list", method: http.MethodGet, target: "/songs", max: 1},
+		{name: "list_with_owner", method: http.MethodGet, target: "/songs?include=owner", max: 1},
+		{name: "list_with_tags", method: http.MethodGet, target: "/songs?include=owner,tags", max: 2},
+		{name: "list_with_links", method: http.MethodGet, target: "/songs?include=tags,links", max: 3},
+		{name: "list_filtered", method: http.MethodGet, target: "/songs?group=Muse&include=owner", max: 1},
+		{name: "text", method: http.MethodGet, target: "/songs/1/text", max: 1},
+		{name: "update", method: http.MethodPut, target: "/songs/2", body: `{"group":"Queen","song":"Innuendo","version":1}`, max: 4},
+		{name: "delete", method: http.MethodDelete, target: "/songs/2", max: 3},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := setupTestDB(t)
+			owner := User{Username: "owner", PasswordHash: "x", Role: RoleEditor}
+			conn.Create(&owner)
+			seedGoldenSongs(t)
+			// Больше строк не должно давать больше запросов
+			for i := 0; i < 20; i++ {
+				conn.Create(&Song{Group: "Muse", SongName: "Filler", OwnerID: &owner.ID})
+			}
+
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			if tc.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			req.Header.Set("Authorization", "Bearer "+testAdminToken)
+			ctx, counter := withQueryCounter(req.Context())
+
+			w := httptest.NewRecorder()
+			newTestRouter().ServeHTTP(w, req.WithContext(ctx))
+			if w.Code >= 300 {
+				t.Fatalf("status %d: %s", w.Code, w.Body.String())
+			}
+			if n := counter.n.Load(); n > tc.max {
+				t.Errorf("%s %s issued %d queries, budget %d", tc.method, tc.target, n, tc.max)
+			}
+		})
+	}
+}
+
+func TestIncludeOwnerEmbedsUser(t *testing.T) {
+	conn := setupTestDB(t)
+	owner := User{Username: "owner", PasswordHash: "x", Role: RoleEditor}
+	conn.Create(&owner)
+	conn.Create(&Song{Group: "Muse", SongName: "Uprising", OwnerID: &owner.ID})
+
+	w := doRequest(newTestRouter(), http.MethodGet, "/songs?include=owner", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"owner":{"id":1,"username":"owner"`) {
+		t.Errorf("status %d, body %s", w.Code, w.Body.String())
+	}
+
+	w = doRequest(newTestRouter(), http.MethodGet, "/songs?include=albums", "")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown include: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
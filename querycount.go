@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Подсчет SQL-запросов на один HTTP-запрос. Считаются запросы, выполненные
+// с контекстом запроса (dbFor); так ловятся N+1 при добавлении связей.
+
+type queryCounterKey struct{}
+
+type queryCounter struct {
+	n atomic.Int64
+	// Обращения к кешу подготовленных выражений (stmtCacheMetrics)
+	stmtHits, stmtMisses atomic.Int64
+}
+
+// requestCounter возвращает счетчик из контекста запроса GORM
+func requestCounter(tx *gorm.DB) *queryCounter {
+	if tx.Statement.Context == nil {
+		return nil
+	}
+	counter, _ := tx.Statement.Context.Value(queryCounterKey{}).(*queryCounter)
+	return counter
+}
+
+// withQueryCounter добавляет в контекст счетчик запросов
+func withQueryCounter(ctx context.Context) (context.Context, *queryCounter) {
+	counter := &queryCounter{}
+	return context.WithValue(ctx, queryCounterKey{}, counter), counter
+}
+
+// requestQueryCounter возвращает счетчик запроса, создавая его при первом
+// обращении: журнал доступа и QueryBudget считают одни и те же запросы
+func requestQueryCounter(c *gin.Context) *queryCounter {
+	if counter, ok := c.Request.Context().Value(queryCounterKey{}).(*queryCounter); ok {
+		return counter
+	}
+	ctx, counter := withQueryCounter(c.Request.Context())
+	c.Request = c.Request.WithContext(ctx)
+	return counter
+}
+
+// queryCounting - плагин GORM, увеличивающий счетчик из контекста
+type queryCounting struct{}
+
+func (queryCounting) Name() string {
+	return "query_counting"
+}
+
+func (queryCounting) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Query().Before("gorm:query").Register("query_count:query", countQuery),
+		cb.Create().Before("gorm:create").Register("query_count:create", countQuery),
+		cb.Update().Before("gorm:update").Register("query_count:update", countQuery),
+		cb.Delete().Before("gorm:delete").Register("query_count:delete", countQuery),
+		cb.Row().Before("gorm:row").Register("query_count:row", countQuery),
+		cb.Raw().Before("gorm:raw").Register("query_count:raw", countQuery),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func countQuery(tx *gorm.DB) {
+	if counter := requestCounter(tx); counter != nil {
+		counter.n.Add(1)
+	}
+}
+
+// QueryBudget - отладочный режим: предупреждает в логе, если обработчик
+// выполнил больше limit запросов
+func QueryBudget(limit int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		counter := requestQueryCounter(c)
+		c.Next()
+
+		if n := counter.n.Load(); n > int64(limit) {
+			logEntry(c).WithFields(logrus.Fields{"queries": n, "budget": limit}).Warn("Query budget exceeded")
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimit - параметры корзины токенов: скорость пополнения и емкость
+type RateLimit struct {
+	Rate  float64 // токенов в секунду; 0 - без ограничения
+	Burst int
+}
+
+// RateLimiter расходует токен из корзины key. Если токенов нет, возвращает
+// время, через которое появится следующий.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error)
+}
+
+// memoryLimiter хранит корзины в памяти процесса
+type memoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	refill time.Duration // за это время пустая корзина заполняется целиком
+}
+
+func newMemoryLimiter() *memoryLimiter {
+	return &memoryLimiter{buckets: map[string]*tokenBucket{}, lastSweep: time.Now()}
+}
+
+func (l *memoryLimiter) Allow(_ context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.refill = time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second))
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait, nil
+}
+
+// sweep удаляет полностью восстановившиеся корзины, чтобы память не росла.
+// Лимиты корзин разные (по IP и по ключу), поэтому время заполнения у
+// каждой свое.
+func (l *memoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > b.refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// redisLimiter хранит корзины в Redis, чтобы лимит был общим для всех экземпляров
+type redisLimiter struct {
+	client *redis.Client
+}
+
+// Скрипт атомарно пополняет корзину и расходует токен.
+// Возвращает {разрешено (0/1), ожидание в миллисекундах}.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + (now - ts) / 1000 * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call("HSET", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, wait}
+`)
+
+func (l *redisLimiter) Allow(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	res, err := tokenBucketScript.Run(ctx, l.client, []string{"ratelimit:" + key},
+		limit.Rate, limit.Burst, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return true, 0, err
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// ParseTrustedProxies разбирает TRUSTED_PROXIES: IP-адреса и подсети CIDR
+// через запятую
+func ParseTrustedProxies(raw string) ([]string, error) {
+	var proxies []string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if net.ParseIP(entry) == nil {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+		}
+		proxies = append(proxies, entry)
+	}
+	return proxies, nil
+}
+
+// NewRateLimiter выбирает хранилище корзин по конфигурации
+func NewRateLimiter(cfg Config) (RateLimiter, error) {
+	if cfg.RateLimitBackend != "redis" {
+		return newMemoryLimiter(), nil
+	}
+	client, err := NewRedisClient(cfg.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+	return &redisLimiter{client: client}, nil
+}
+
+// clientKey - клиент для ограничения частоты и обнаружения парсеров:
+// key:<ID> действующего API-ключа или ip:<адрес>. Выдуманный ключ не дает
+// отдельного клиента, иначе новый ключ на каждый запрос обходил бы лимиты;
+// адрес берется из X-Forwarded-For только от доверенных прокси.
+func clientKey(c *gin.Context) string {
+	if c.GetHeader(apiKeyHeader) != "" {
+		if apiKey, err := resolveAPIKey(c); err == nil {
+			return "key:" + strconv.Itoa(apiKey.ID)
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitMiddleware ограничивает частоту запросов: для машинных клиентов -
+// по API-ключу, для остальных - по IP, см. clientKey. При недоступности
+// хранилища запросы пропускаются.
+func RateLimitMiddleware(limiter RateLimiter, perIP, perKey RateLimit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, limit := clientKey(c), perIP
+		if strings.HasPrefix(key, "key:") {
+			limit = perKey
+		}
+		if limit.Rate <= 0 {
+			c.Next()
+			return
+		}
+
+		allowed, wait, err := limiter.Allow(c.Request.Context(), key, limit)
+		if err != nil {
+			logEntry(c).WithError(err).Warn("Rate limiter unavailable, allowing request")
+		}
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			abortWithError(c, http.StatusTooManyRequests, codeRateLimited, "Too many requests")
+			return
+		}
+		c.Next()
+	}
+}
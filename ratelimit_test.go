@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRateLimitedRouter - роутер сервиса с ограничением частоты в памяти
+func newRateLimitedRouter(t *testing.T, perIP, perKey RateLimit, proxies []string) *gin.Engine {
+	t.Helper()
+	prevLimiter, prevProxies := rateLimiter, trustedProxies
+	rateLimiter, trustedProxies = newMemoryLimiter(), proxies
+	t.Cleanup(func() { rateLimiter, trustedProxies = prevLimiter, prevProxies })
+	cfg := testConfig()
+	cfg.RateLimitIP, cfg.RateLimitKey = perIP, perKey
+	return newTestRouterWith(cfg)
+}
+
+func doLimitedRequest(router http.Handler, header, value string) int {
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRateLimitIgnoresUnknownAPIKeys(t *testing.T) {
+	setupTestDB(t)
+	router := newRateLimitedRouter(t, RateLimit{Rate: 0.001, Burst: 2}, RateLimit{Rate: 0.001, Burst: 100}, nil)
+
+	// Новый выдуманный ключ на каждый запрос не дает новой корзины
+	for i := 0; i < 2; i++ {
+		if code := doLimitedRequest(router, apiKeyHeader, fmt.Sprintf("fake-%d", i)); code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, code)
+		}
+	}
+	if code := doLimitedRequest(router, apiKeyHeader, "fake-2"); code != http.StatusTooManyRequests {
+		t.Fatalf("third request with a fake key: status %d, want 429", code)
+	}
+
+	// Действующий ключ считается по своей корзине
+	raw := "valid-test-key"
+	if err := GetDB().Create(&APIKey{Name: "ci", Prefix: raw[:apiKeyPrefixLen], KeyHash: hashAPIKey(raw), Role: RoleReader}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if code := doLimitedRequest(router, apiKeyHeader, raw); code != http.StatusOK {
+			t.Fatalf("valid key request %d: status %d", i, code)
+		}
+	}
+}
+
+func TestRateLimitTrustsForwardedForOnlyFromProxies(t *testing.T) {
+	setupTestDB(t)
+	limit := RateLimit{Rate: 0.001, Burst: 1}
+
+	// Без доверенных прокси X-Forwarded-For не меняет адрес клиента
+	router := newRateLimitedRouter(t, limit, limit, nil)
+	if code := doLimitedRequest(router, "X-Forwarded-For", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("first request: status %d", code)
+	}
+	if code := doLimitedRequest(router, "X-Forwarded-For", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("spoofed X-Forwarded-For: status %d, want 429", code)
+	}
+
+	// За доверенным прокси клиенты различаются по X-Forwarded-For
+	router = newRateLimitedRouter(t, limit, limit, []string{"192.0.2.0/24"})
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2"} {
+		if code := doLimitedRequest(router, "X-Forwarded-For", ip); code != http.StatusOK {
+			t.Fatalf("client %s behind proxy: status %d", ip, code)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(" 10.0.0.0/8, 192.0.2.1 ,")
+	if err != nil || len(proxies) != 2 || proxies[0] != "10.0.0.0/8" || proxies[1] != "192.0.2.1" {
+		t.Fatalf("proxies = %v, %v", proxies, err)
+	}
+	if _, err := ParseTrustedProxies("proxy.local"); err == nil {
+		t.Fatal("host name accepted as a trusted proxy")
+	}
+}
+
+func TestMemoryLimiterSweepUsesBucketLimit(t *testing.T) {
+	l := newMemoryLimiter()
+	ctx := context.Background()
+	slow := RateLimit{Rate: 0.01, Burst: 10} // заполняется за 1000 секунд
+	fast := RateLimit{Rate: 100, Burst: 1}
+	l.Allow(ctx, "slow", slow)
+	l.Allow(ctx, "fast", fast)
+
+	// Через две минуты быстрая корзина полна, медленная - нет. Очистка,
+	// вызванная запросом с быстрым лимитом, не должна сбросить медленную.
+	past := time.Now().Add(-2 * time.Minute)
+	for _, b := range l.buckets {
+		b.last = past
+	}
+	l.lastSweep = past
+	l.Allow(ctx, "other", fast)
+	if _, ok := l.buckets["slow"]; !ok {
+		t.Fatal("sweep dropped a bucket that is still refilling")
+	}
+	if _, ok := l.buckets["fast"]; ok {
+		t.Fatal("sweep kept a full bucket")
+	}
+}
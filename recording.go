@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	recordHeader       = "X-Debug-Record"
+	maxRecordedBody    = 64 << 10
+	redactedValue      = "[REDACTED]"
+	defaultRecordLimit = 100
+)
+
+// Заголовки, значения которых не попадают в записи
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key", sessionHeader, recordHeader}
+
+// Поля JSON в телах и параметры строки запроса, значения которых не
+// попадают в записи: пароли при входе, выданные токены, новые API-ключи,
+// секреты вебхуков, код авторизации OIDC. Имена сравниваются без учета
+// регистра.
+var sensitiveFields = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"id_token":      true,
+	"pushtoken":     true,
+	"key":           true,
+	"api_key":       true,
+	"secret":        true,
+	"client_secret": true,
+	"code":          true,
+	"state":         true,
+}
+
+// Recording - сохраненная пара запрос/ответ
+type Recording struct {
+	RequestID       string              `json:"requestId"`
+	Time            time.Time           `json:"time"`
+	Method          string              `json:"method"`
+	Path            string              `json:"path"`
+	Query           string              `json:"query"`
+	RequestHeaders  map[string][]string `json:"requestHeaders"`
+	RequestBody     string              `json:"requestBody"`
+	Status          int                 `json:"status"`
+	ResponseHeaders map[string][]string `json:"responseHeaders"`
+	ResponseBody    string              `json:"responseBody"`
+	LatencyMs       float64             `json:"latencyMs"`
+}
+
+// recordingBuffer - кольцевой буфер последних записей
+type recordingBuffer struct {
+	mu    sync.Mutex
+	items []Recording
+	next  int
+	full  bool
+}
+
+var recordings = newRecordingBuffer(defaultRecordLimit)
+
+func newRecordingBuffer(size int) *recordingBuffer {
+	if size <= 0 {
+		size = defaultRecordLimit
+	}
+	return &recordingBuffer{items: make([]Recording, size)}
+}
+
+func (b *recordingBuffer) add(r Recording) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.items[b.next] = r
+	b.next = (b.next + 1) % len(b.items)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// list возвращает записи от новых к старым
+func (b *recordingBuffer) list() []Recording {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := b.next
+	if b.full {
+		n = len(b.items)
+	}
+	out := make([]Recording, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, b.items[(b.next-i+len(b.items))%len(b.items)])
+	}
+	return out
+}
+
+// recordingWriter дублирует тело ответа в буфер
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if room := maxRecordedBody - w.body.Len(); room > 0 {
+		w.body.Write(p[:min(len(p), room)])
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Recorder записывает запрос и ответ, если клиент прислал заголовок
+// X-Debug-Record с токеном администратора
+func Recorder(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value := c.GetHeader(recordHeader)
+		if adminToken == "" || value == "" ||
+			subtle.ConstantTimeCompare([]byte(value), []byte(adminToken)) != 1 {
+			c.Next()
+			return
+		}
+
+		var reqBody []byte
+		if c.Request.Body != nil {
+			reqBody, _ = io.ReadAll(io.LimitReader(c.Request.Body, maxRecordedBody))
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(reqBody), c.Request.Body))
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		start := time.Now()
+
+		c.Next()
+
+		recordings.add(Recording{
+			RequestID:       c.GetString(fieldRequestID),
+			Time:            start,
+			Method:          c.Request.Method,
+			Path:            c.Request.URL.Path,
+			Query:           sanitizeQuery(c.Request.URL.Query()),
+			RequestHeaders:  sanitizeHeaders(c.Request.Header),
+			RequestBody:     sanitizeBody(reqBody),
+			Status:          writer.Status(),
+			ResponseHeaders: sanitizeHeaders(writer.Header()),
+			ResponseBody:    sanitizeBody(writer.body.Bytes()),
+			LatencyMs:       float64(time.Since(start).Microseconds()) / 1000,
+		})
+	}
+}
+
+func sanitizeHeaders(h http.Header) map[string][]string {
+	out := make(map[string][]string, len(h))
+	for k, v := range h {
+		out[k] = append([]string(nil), v...)
+	}
+	for _, k := range sensitiveHeaders {
+		if _, ok := out[http.CanonicalHeaderKey(k)]; ok {
+			out[http.CanonicalHeaderKey(k)] = []string{redactedValue}
+		}
+	}
+	return out
+}
+
+func sanitizeQuery(q url.Values) string {
+	for k := range q {
+		if sensitiveFields[strings.ToLower(k)] {
+			q[k] = []string{redactedValue}
+		}
+	}
+	return q.Encode()
+}
+
+// sanitizeBody скрывает значения чувствительных полей JSON на любой
+// глубине. Тело, которое не разбирается как JSON (обрезанное, CSV, форма),
+// но упоминает такое поле, не сохраняется целиком.
+func sanitizeBody(body []byte) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return string(body)
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil || dec.More() {
+		lower := bytes.ToLower(body)
+		for name := range sensitiveFields {
+			if bytes.Contains(lower, []byte(name)) {
+				return redactedValue
+			}
+		}
+		return string(body)
+	}
+	out, err := json.Marshal(redactJSON(value))
+	if err != nil {
+		return redactedValue
+	}
+	return string(out)
+}
+
+func redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if sensitiveFields[strings.ToLower(k)] {
+				v[k] = redactedValue
+			} else {
+				v[k] = redactJSON(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactJSON(item)
+		}
+	}
+	return value
+}
+
+// @Summary List recordings
+// @Description List recorded request/response pairs, newest first.
+// @ID list-recordings
+// @Produce  json
+// @Success 200 {array} Recording
+// @Failure 401 {object} APIError
+// @Router /admin/recordings [get]
+func GetRecordings(c *gin.Context) {
+	c.JSON(http.StatusOK, recordings.list())
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// doRecordedRequest выполняет запрос с заголовком записи X-Debug-Record
+func doRecordedRequest(router http.Handler, method, target, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(recordHeader, testAdminToken)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRecorderRedactsSecrets(t *testing.T) {
+	setupTestDB(t)
+	useTestJWTKeys(t)
+	prev := recordings
+	recordings = newRecordingBuffer(10)
+	t.Cleanup(func() { recordings = prev })
+	router := newTestRouter()
+	createTestUser(t, "alice", "correct-horse", RoleEditor)
+
+	login := doRecordedRequest(router, http.MethodPost, "/auth/login", `{"username":"alice","password":"correct-horse"}`, "")
+	if login.Code != http.StatusOK {
+		t.Fatalf("login: status %d, body %s", login.Code, login.Body)
+	}
+	var token TokenResponse
+	if err := json.Unmarshal(login.Body.Bytes(), &token); err != nil {
+		t.Fatal(err)
+	}
+	created := doRecordedRequest(router, http.MethodPost, "/admin/api-keys", `{"name":"ci"}`, testAdminToken)
+	if created.Code != http.StatusCreated {
+		t.Fatalf("create API key: status %d, body %s", created.Code, created.Body)
+	}
+	var key CreatedAPIKey
+	if err := json.Unmarshal(created.Body.Bytes(), &key); err != nil {
+		t.Fatal(err)
+	}
+
+	w := doRequestAs(router, http.MethodGet, "/admin/recordings", "", testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("recordings: status %d", w.Code)
+	}
+	var recs []Recording
+	if err := json.Unmarshal(w.Body.Bytes(), &recs); err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("recordings = %d, want 2", len(recs))
+	}
+	for _, secret := range []string{"correct-horse", token.AccessToken, key.Key, testAdminToken} {
+		if strings.Contains(w.Body.String(), secret) {
+			t.Errorf("recordings contain secret %q: %s", secret, w.Body)
+		}
+	}
+	// Остальные поля остаются, записи по-прежнему полезны для отладки
+	loginRec := recs[1]
+	if !strings.Contains(loginRec.RequestBody, `"username":"alice"`) || !strings.Contains(loginRec.RequestBody, `"password":"`+redactedValue+`"`) {
+		t.Errorf("login request body = %s", loginRec.RequestBody)
+	}
+	if !strings.Contains(loginRec.ResponseBody, `"token_type":"Bearer"`) {
+		t.Errorf("login response body = %s", loginRec.ResponseBody)
+	}
+}
+
+func TestSanitizeBody(t *testing.T) {
+	cases := []struct {
+		body, want string
+	}{
+		{`{"songs":[{"group":"Muse","secret":"s"}]}`, `{"songs":[{"group":"Muse","secret":"[REDACTED]"}]}`},
+		{`{"Password":"p","n":1.50}`, `{"Password":"[REDACTED]","n":1.50}`},
+		{`{"password":"cut off`, redactedValue},
+		{"group,song\nMuse,Hysteria\n", "group,song\nMuse,Hysteria\n"},
+		{"", ""},
+	}
+	for _, tc := range cases {
+		if got := sanitizeBody([]byte(tc.body)); got != tc.want {
+			t.Errorf("sanitizeBody(%q) = %q, want %q", tc.body, got, tc.want)
+		}
+	}
+	if got := sanitizeQuery(map[string][]string{"code": {"abc"}, "page": {"2"}}); got != "code=%5BREDACTED%5D&page=2" {
+		t.Errorf("sanitizeQuery = %q", got)
+	}
+}
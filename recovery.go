@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const problemContentType = "application/problem+json"
+
+// PanicStat - сводка по повторяющимся паникам с одинаковым отпечатком
+type PanicStat struct {
+	Fingerprint string    `json:"fingerprint"`
+	Message     string    `json:"message"`
+	Route       string    `json:"route"`
+	Count       int       `json:"count"`
+	FirstSeen   time.Time `json:"firstSeen"`
+	LastSeen    time.Time `json:"lastSeen"`
+}
+
+var (
+	panicMu    sync.Mutex
+	panicStats = map[string]*PanicStat{}
+)
+
+// Recovery перехватывает панику, отвечает 500 в формате problem+json
+// с идентификатором для поиска в логах и учитывает панику по отпечатку
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if isBrokenPipe(rec) {
+				logEntry(c).WithField("error", rec).Warn("Client connection closed")
+				c.Abort()
+				return
+			}
+
+			fingerprint := panicFingerprint(rec)
+			recordPanic(fingerprint, fmt.Sprint(rec), c.FullPath())
+
+			reference := c.GetString(fieldRequestID)
+			logEntry(c).WithFields(logrus.Fields{
+				"panic":       fmt.Sprint(rec),
+				"fingerprint": fingerprint,
+				"stack":       string(debug.Stack()),
+			}).Error("Recovered from panic")
+
+			c.Header("Content-Type", problemContentType)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"type":      "about:blank",
+				"title":     http.StatusText(http.StatusInternalServerError),
+				"status":    http.StatusInternalServerError,
+				"detail":    "An unexpected error occurred",
+				"instance":  c.Request.URL.Path,
+				"reference": reference,
+			})
+		}()
+		c.Next()
+	}
+}
+
+// panicFingerprint строит отпечаток из типа значения паники и стека вызовов
+// без номеров строк, чтобы паники из одного места группировались вместе
+func panicFingerprint(rec any) string {
+	pcs := make([]uintptr, 32)
+	// Пропускаем runtime.Callers, panicFingerprint и отложенную функцию
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%T", rec)
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			fmt.Fprintf(h, "|%s", frame.Function)
+		}
+		if !more {
+			break
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+func recordPanic(fingerprint, message, route string) {
+	panicMu.Lock()
+	defer panicMu.Unlock()
+
+	now := time.Now()
+	stat, ok := panicStats[fingerprint]
+	if !ok {
+		stat = &PanicStat{Fingerprint: fingerprint, Message: message, Route: route, FirstSeen: now}
+		panicStats[fingerprint] = stat
+	}
+	stat.Count++
+	stat.LastSeen = now
+}
+
+// PanicStats возвращает сводку по паникам, самые частые - первыми
+func PanicStats() []PanicStat {
+	panicMu.Lock()
+	defer panicMu.Unlock()
+
+	stats := make([]PanicStat, 0, len(panicStats))
+	for _, stat := range panicStats {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Count > stats[j].Count })
+	return stats
+}
+
+func isBrokenPipe(rec any) bool {
+	err, ok := rec.(error)
+	if !ok {
+		return false
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	var syscallErr *os.SyscallError
+	if !errors.As(opErr, &syscallErr) {
+		return false
+	}
+	msg := strings.ToLower(syscallErr.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Правило REGION_RULES применяется к регионам из Regions; "*" - ко всем.
+// Правила, подходящие региону, складываются.
+type RegionRule struct {
+	Regions            []string `json:"regions"`
+	HideExplicitLyrics bool     `json:"hideExplicitLyrics"` // текст песен с explicit не отдается
+	BlockExplicit      bool     `json:"blockExplicit"`      // песни с explicit скрыты целиком
+	BlockSongs         []int    `json:"blockSongs"`
+	BlockGroups        []string `json:"blockGroups"` // названия групп, с учетом регистра
+}
+
+// RegionRestriction - ограничения одного региона, сложенные из всех правил
+type RegionRestriction struct {
+	HideExplicitLyrics bool
+	BlockExplicit      bool
+	BlockSongs         map[int]bool
+	BlockGroups        map[string]bool
+}
+
+func (r *RegionRestriction) add(rule RegionRule) {
+	r.HideExplicitLyrics = r.HideExplicitLyrics || rule.HideExplicitLyrics
+	r.BlockExplicit = r.BlockExplicit || rule.BlockExplicit
+	for _, id := range rule.BlockSongs {
+		r.BlockSongs[id] = true
+	}
+	for _, group := range rule.BlockGroups {
+		r.BlockGroups[group] = true
+	}
+}
+
+// Blocks сообщает, что песня в регионе недоступна
+func (r *RegionRestriction) Blocks(song Song) bool {
+	return r.BlockSongs[song.ID] || r.BlockGroups[song.Group] || (r.BlockExplicit && song.Explicit)
+}
+
+// HidesLyrics сообщает, что текст песни в регионе не отдается
+func (r *RegionRestriction) HidesLyrics(song Song) bool {
+	return r.HideExplicitLyrics && song.Explicit
+}
+
+// Apply убирает недоступные песни из списка и стирает скрытые тексты
+func (r *RegionRestriction) Apply(songs []Song) []Song {
+	allowed := songs[:0:0]
+	for _, song := range songs {
+		if r.Blocks(song) {
+			continue
+		}
+		if r.HidesLyrics(song) {
+			song.Text = ""
+		}
+		allowed = append(allowed, song)
+	}
+	return allowed
+}
+
+// Scope добавляет к запросу к songs условия, исключающие недоступные
+// песни, чтобы страницы списка не теряли строки после фильтрации
+func (r *RegionRestriction) Scope(q *gorm.DB, table string) *gorm.DB {
+	if len(r.BlockSongs) > 0 {
+		ids := make([]interface{}, 0, len(r.BlockSongs))
+		for id := range r.BlockSongs {
+			ids = append(ids, id)
+		}
+		q = q.Where(clause.Not(clause.IN{Column: clause.Column{Table: table, Name: "id"}, Values: ids}))
+	}
+	if len(r.BlockGroups) > 0 {
+		groups := make([]interface{}, 0, len(r.BlockGroups))
+		for group := range r.BlockGroups {
+			groups = append(groups, group)
+		}
+		q = q.Where(clause.Not(clause.IN{Column: clause.Column{Table: table, Name: "group"}, Values: groups}))
+	}
+	if r.BlockExplicit {
+		q = q.Where(clause.Eq{Column: clause.Column{Table: table, Name: "explicit"}, Value: false})
+	}
+	return q
+}
+
+// RegionRules - ограничения по регионам. Регион берется из профиля
+// пользователя, а если он там не указан - из заголовка запроса, который
+// обычно ставит CDN по IP клиента.
+type RegionRules struct {
+	header   string
+	regions  map[string]*RegionRestriction
+	fallback *RegionRestriction // правила "*" для остальных регионов; nil - их нет
+}
+
+// Правила регионов; nil - ограничений нет
+var regionRules *RegionRules
+
+// Ключ контекста для ограничений, уже найденных для запроса
+const fieldRegionRestriction = "region_restriction"
+
+func normalizeRegion(region string) string {
+	return strings.ToUpper(strings.TrimSpace(region))
+}
+
+// ParseRegionRules читает правила из JSON-массива RegionRule; пустая строка -
+// ограничений нет
+func ParseRegionRules(raw, header string) (*RegionRules, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var rules []RegionRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("invalid REGION_RULES: %w", err)
+	}
+	newRestriction := func() *RegionRestriction {
+		return &RegionRestriction{BlockSongs: map[int]bool{}, BlockGroups: map[string]bool{}}
+	}
+	r := &RegionRules{header: header, regions: map[string]*RegionRestriction{}}
+	var wildcard []RegionRule
+	for i, rule := range rules {
+		if len(rule.Regions) == 0 {
+			return nil, fmt.Errorf("invalid REGION_RULES: rule %d has no regions", i)
+		}
+		for _, region := range rule.Regions {
+			region = normalizeRegion(region)
+			if region == "*" {
+				wildcard = append(wildcard, rule)
+				continue
+			}
+			if r.regions[region] == nil {
+				r.regions[region] = newRestriction()
+			}
+			r.regions[region].add(rule)
+		}
+	}
+	if len(wildcard) > 0 {
+		r.fallback = newRestriction()
+		for _, rule := range wildcard {
+			r.fallback.add(rule)
+			for _, restriction := range r.regions {
+				restriction.add(rule)
+			}
+		}
+	}
+	return r, nil
+}
+
+// For возвращает ограничения региона; nil - ограничений нет
+func (r *RegionRules) For(region string) *RegionRestriction {
+	if restriction, ok := r.regions[normalizeRegion(region)]; ok {
+		return restriction
+	}
+	return r.fallback
+}
+
+// regionRestriction возвращает ограничения для клиента запроса; nil - их
+// нет. Результат запоминается в контексте.
+func regionRestriction(c *gin.Context) *RegionRestriction {
+	if regionRules == nil {
+		return nil
+	}
+	if cached, ok := c.Get(fieldRegionRestriction); ok {
+		return cached.(*RegionRestriction)
+	}
+	region := c.GetHeader(regionRules.header)
+	if userID, ok := currentUserID(c); ok {
+		var user User
+		err := dbFor(c).Select("region").First(&user, userID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			// Без профиля остается регион из заголовка
+			logEntry(c).WithError(err).Warn("Failed to fetch user region")
+		}
+		if user.Region != "" {
+			region = user.Region
+		}
+	}
+	restriction := regionRules.For(region)
+	c.Set(fieldRegionRestriction, restriction)
+	return restriction
+}
+
+// restrictSongs применяет ограничения региона клиента к списку песен
+func restrictSongs(c *gin.Context, songs []Song) []Song {
+	if restriction := regionRestriction(c); restriction != nil {
+		return restriction.Apply(songs)
+	}
+	return songs
+}
+
+// restrictLyrics отвечает 451, если песня или ее текст недоступны в
+// регионе клиента, и возвращает false
+func restrictLyrics(c *gin.Context, song Song) bool {
+	restriction := regionRestriction(c)
+	switch {
+	case restriction == nil:
+		return true
+	case restriction.Blocks(song):
+		abortWithError(c, http.StatusUnavailableForLegalReasons, codeRegionRestricted, "Song is not available in your region")
+		return false
+	case restriction.HidesLyrics(song):
+		abortWithError(c, http.StatusUnavailableForLegalReasons, codeRegionRestricted, "Lyrics are not available in your region")
+		return false
+	}
+	return true
+}
+
+// Тело запроса на смену региона профиля
+type RegionRequest struct {
+	Region string `json:"region" binding:"max=16"` // пусто - брать регион из заголовка запроса
+}
+
+// @Summary Set profile region
+// @Description Set the region whose content rules apply to the current user, overriding the region the request header reports. An empty region clears the override.
+// @ID update-my-region
+// @Accept  json
+// @Produce  json
+// @Param region body RegionRequest true "Region code, e.g. DE"
+// @Success 200 {object} RegionRequest
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /me/region [put]
+func UpdateMyRegion(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		abortWithError(c, http.StatusForbidden, codeForbidden, "Only user accounts have a profile region")
+		return
+	}
+	var req RegionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	req.Region = normalizeRegion(req.Region)
+	if err := dbFor(c).Model(&User{}).Where("id = ?", userID).Update("region", req.Region).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to update user region")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to update region")
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
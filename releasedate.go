@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Форматы даты выхода: в ответах всегда releaseDateLayout, на входе
+// принимается и ISO 8601
+const (
+	releaseDateLayout    = "02.01.2006"
+	releaseDateISOLayout = "2006-01-02"
+)
+
+// ReleaseDate - дата выхода песни, в базе колонка date. Нулевая дата -
+// дата неизвестна: в базе NULL, в JSON и XML пустая строка.
+type ReleaseDate time.Time
+
+// ParseReleaseDate разбирает DD.MM.YYYY или YYYY-MM-DD; пустая строка -
+// нулевая дата. Несуществующие даты (31.02.2006) отклоняются.
+func ParseReleaseDate(s string) (ReleaseDate, error) {
+	if s == "" {
+		return ReleaseDate{}, nil
+	}
+	for _, layout := range []string{releaseDateLayout, releaseDateISOLayout} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return ReleaseDate(t), nil
+		}
+	}
+	return ReleaseDate{}, fmt.Errorf("invalid release date %q: use DD.MM.YYYY or YYYY-MM-DD", s)
+}
+
+// providerReleaseDate переводит дату источника обогащения. Источники знают
+// дату иногда с точностью до месяца (07.2006) или года (2006) - тогда
+// берется первый день; дата, которую не удалось разобрать, теряется.
+func providerReleaseDate(s string) ReleaseDate {
+	if d, err := ParseReleaseDate(s); err == nil {
+		return d
+	}
+	for _, layout := range []string{"01.2006", "2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return ReleaseDate(t)
+		}
+	}
+	return ReleaseDate{}
+}
+
+func (d ReleaseDate) IsZero() bool { return time.Time(d).IsZero() }
+
+func (d ReleaseDate) Time() time.Time { return time.Time(d) }
+
+// String - дата в формате ответов; пусто, если дата неизвестна
+func (d ReleaseDate) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return time.Time(d).Format(releaseDateLayout)
+}
+
+// MarshalText и UnmarshalText задают форму даты в JSON, XML и формах
+func (d ReleaseDate) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *ReleaseDate) UnmarshalText(b []byte) error {
+	parsed, err := ParseReleaseDate(string(b))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (ReleaseDate) GormDataType() string { return "date" }
+
+func (d ReleaseDate) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return time.Time(d), nil
+}
+
+// Scan читает date Postgres и SQLite; SQLite может вернуть и строку, если
+// значение записано до смены типа колонки
+func (d *ReleaseDate) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = ReleaseDate{}
+	case time.Time:
+		y, m, day := v.Date()
+		*d = ReleaseDate(time.Date(y, m, day, 0, 0, 0, 0, time.UTC))
+	case []byte:
+		return d.Scan(string(v))
+	case string:
+		if len(v) > len(releaseDateISOLayout) && reISODatePrefix.MatchString(v) {
+			v = v[:len(releaseDateISOLayout)]
+		}
+		*d = providerReleaseDate(v)
+	default:
+		return fmt.Errorf("cannot scan %T into ReleaseDate", value)
+	}
+	return nil
+}
+
+// Начало даты с временем, как SQLite хранит time.Time
+var reISODatePrefix = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[ T]`)
+
+// parseReleaseDateFilter - значение фильтра releaseDate
+func parseReleaseDateFilter(s string) (interface{}, error) { return ParseReleaseDate(s) }
+
+// convertReleaseDateColumn переводит текстовую колонку release_date прежних
+// версий в date до AutoMigrate: GORM привел бы ее через ::date, а Postgres
+// не разбирает DD.MM.YYYY. Сначала значения приводятся к YYYY-MM-DD
+// отдельным шагом (normalizeReleaseDates), затем меняется тип - в одной
+// транзакции, чтобы смена типа не упала на середине.
+func convertReleaseDateColumn(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" || !db.Migrator().HasColumn(&Song{}, "release_date") {
+		return nil
+	}
+	var dataType string
+	err := db.Raw(`SELECT data_type FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'songs' AND column_name = 'release_date'`).Scan(&dataType).Error
+	if err != nil || dataType == "date" {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := normalizeReleaseDates(tx); err != nil {
+			return err
+		}
+		return tx.Exec(`ALTER TABLE songs ALTER COLUMN release_date TYPE date USING NULLIF(release_date, '')::date`).Error
+	})
+}
+
+// normalizeReleaseDates переписывает текстовые даты выхода в YYYY-MM-DD.
+// Неполные даты становятся первым днем месяца или года. Значения, которые
+// не разобрать, и несуществующие даты вида 31.02.2020 (to_date Postgres на
+// них падает) заменяются на NULL и пишутся в лог; возвращается их число.
+func normalizeReleaseDates(tx *gorm.DB) (int, error) {
+	type row struct {
+		ID          uint
+		ReleaseDate string
+	}
+	var rows []row
+	err := tx.Raw(`SELECT id, release_date FROM songs WHERE release_date IS NOT NULL AND release_date <> ''`).Scan(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+	invalid := 0
+	for _, r := range rows {
+		var d ReleaseDate
+		if err := d.Scan(r.ReleaseDate); err != nil {
+			return invalid, err
+		}
+		var value interface{}
+		if d.IsZero() {
+			invalid++
+			logrus.WithFields(logrus.Fields{"song_id": r.ID, "release_date": r.ReleaseDate}).
+				Warn("Cleared invalid release date before converting the column to date")
+		} else if value = d.Time().Format(releaseDateISOLayout); value == r.ReleaseDate {
+			continue
+		}
+		if err := tx.Exec(`UPDATE songs SET release_date = ? WHERE id = ?`, value, r.ID).Error; err != nil {
+			return invalid, err
+		}
+	}
+	return invalid, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseReleaseDate(t *testing.T) {
+	cases := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"16.07.2006", "16.07.2006", true},
+		{"2006-07-16", "16.07.2006", true},
+		{"", "", true},
+		{"31.02.2006", "", false},
+		{"2006-13-01", "", false},
+		{"16/07/2006", "", false},
+		{"yesterday", "", false},
+	}
+	for _, tc := range cases {
+		d, err := ParseReleaseDate(tc.in)
+		if (err == nil) != tc.ok {
+			t.Errorf("%q: err = %v, want ok=%t", tc.in, err, tc.ok)
+			continue
+		}
+		if got := d.String(); got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestReleaseDateRoundTripsThroughDatabase(t *testing.T) {
+	conn := setupTestDB(t)
+	songs := []Song{
+		{Group: "Muse", SongName: "Starlight", ReleaseDate: mustReleaseDate("2006-09-04")},
+		{Group: "Muse", SongName: "Uprising", ReleaseDate: mustReleaseDate("07.09.2009")},
+		{Group: "Muse", SongName: "Unreleased"},
+	}
+	if err := conn.Create(&songs).Error; err != nil {
+		t.Fatal(err)
+	}
+	var got []Song
+	if err := conn.Order("id").Find(&got).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i, song := range got {
+		if song.ReleaseDate.String() != songs[i].ReleaseDate.String() {
+			t.Errorf("%s: got %q, want %q", song.SongName, song.ReleaseDate, songs[i].ReleaseDate)
+		}
+	}
+	var nulls int64
+	conn.Model(&Song{}).Where("release_date IS NULL").Count(&nulls)
+	if nulls != 1 {
+		t.Errorf("unknown date stored as %d NULLs, want 1", nulls)
+	}
+}
+
+func TestGetSongsReleaseDateRange(t *testing.T) {
+	setupTestDB(t)
+	seedGoldenSongs(t)
+	router := newTestRouter()
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"releaseDate[gte]=2000-01-01", []string{"Supermassive Black Hole"}},
+		{"releaseDate[lt]=01.01.2000", []string{"Bohemian Rhapsody"}},
+		{"releaseDate[gte]=1975-10-31&releaseDate[lte]=2006-07-16", []string{"Supermassive Black Hole", "Bohemian Rhapsody"}},
+		{"releaseDate=2006-07-16", []string{"Supermassive Black Hole"}},
+	}
+	for _, tc := range cases {
+		w := doRequest(router, http.MethodGet, "/songs?"+tc.query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tc.query, w.Code, w.Body.String())
+		}
+		var songs []Song
+		if err := json.Unmarshal(w.Body.Bytes(), &songs); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range songs {
+			got = append(got, s.SongName)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: got %v, want %v", tc.query, got, tc.want)
+		}
+	}
+
+	if w := doRequest(router, http.MethodGet, "/songs?releaseDate[gt]=soon", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid date filter: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAddSongRejectsInvalidReleaseDate(t *testing.T) {
+	setupTestDB(t)
+	router := newTestRouter()
+	w := doRequestAs(router, http.MethodPost, "/songs", `{"group":"Muse","song":"Hysteria","releaseDate":"someday"}`, testAdminToken)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "invalid release date") {
+		t.Errorf("error does not mention the date: %s", w.Body.String())
+	}
+}
+
+func TestNormalizeReleaseDates(t *testing.T) {
+	conn := setupTestDB(t)
+	// Текстовая колонка и значения, как их хранили версии до колонки date
+	for _, stmt := range []string{`ALTER TABLE songs DROP COLUMN release_date`, `ALTER TABLE songs ADD COLUMN release_date text`} {
+		if err := conn.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	legacy := map[string]string{
+		"Starlight":  "04.09.2006",
+		"Uprising":   "2009-09-07",
+		"Hysteria":   "12.2003",
+		"Showbiz":    "1999",
+		"Invalid":    "31.02.2020",
+		"Garbage":    "someday",
+		"Unreleased": "",
+	}
+	want := map[string]string{
+		"Starlight": "04.09.2006",
+		"Uprising":  "07.09.2009",
+		"Hysteria":  "01.12.2003",
+		"Showbiz":   "01.01.1999",
+	}
+	for name, date := range legacy {
+		song := Song{Group: "Muse", SongName: name}
+		if err := conn.Create(&song).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.Exec(`UPDATE songs SET release_date = ? WHERE id = ?`, date, song.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	invalid, err := normalizeReleaseDates(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invalid != 2 {
+		t.Errorf("invalid = %d, want 2", invalid)
+	}
+	var songs []Song
+	if err := conn.Find(&songs).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, song := range songs {
+		if got := song.ReleaseDate.String(); got != want[song.SongName] {
+			t.Errorf("%s: got %q, want %q", song.SongName, got, want[song.SongName])
+		}
+	}
+	var nulls int64
+	conn.Model(&Song{}).Where("release_date IS NULL").Count(&nulls)
+	if nulls != 2 {
+		t.Errorf("%d NULL dates, want 2 (the invalid ones)", nulls)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Имя резолвера реплики. Резолвер регистрируется только под именем, без
+// общего: запросы без dbresolver.Use идут в основную базу, как и раньше,
+// и чтение сразу после записи не видит отставания реплики.
+const replicaResolver = "read_replica"
+
+// Реплика для чтения подключена
+var readReplica bool
+
+// useReadReplica подключает реплику через dbresolver. Запись и транзакции
+// с резолвером реплики по-прежнему идут в основную базу.
+func useReadReplica(conn *gorm.DB, dsn string) error {
+	err := conn.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: []gorm.Dialector{postgres.Open(dsn)},
+	}, replicaResolver))
+	if err != nil {
+		return err
+	}
+	readReplica = true
+	return nil
+}
+
+// readDBFor возвращает подключение для чтений, которые допускают отставание
+// реплики; без реплики - то же, что dbFor
+func readDBFor(c *gin.Context) *gorm.DB {
+	if !readReplica {
+		return dbFor(c)
+	}
+	return dbFor(c).Clauses(dbresolver.Use(replicaResolver))
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	responseCacheHeader = "X-Cache"
+	responseCachePrefix = "musik:cache:"
+)
+
+// Заголовки ответа, которые сохраняются вместе с телом
+var responseCacheHeaders = []string{"Content-Type", "X-Next-Cursor", "ETag"}
+
+// ResponseCacheConfig - кеш чтений в Redis
+type ResponseCacheConfig struct {
+	Enabled  bool
+	SongsTTL time.Duration // ответы GET /songs
+	SongTTL  time.Duration // песня для GET /songs/:id/text
+}
+
+// ResponseCache хранит в Redis ответы GET /songs и песни для GET
+// /songs/:id/text. Записи помечаются теми же ключами, что и Surrogate-Key,
+// и сбрасываются вместе с кешем перед API (purgeCache).
+type ResponseCache struct {
+	client *redis.Client
+	cfg    ResponseCacheConfig
+}
+
+// Кеш чтений; nil - выключен
+var responseCache *ResponseCache
+
+func NewResponseCache(client *redis.Client, cfg ResponseCacheConfig) *ResponseCache {
+	return &ResponseCache{client: client, cfg: cfg}
+}
+
+// cachedResponse - сохраненный ответ
+type cachedResponse struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header"`
+	Body   []byte            `json:"body"`
+}
+
+func tagKey(tag string) string {
+	return responseCachePrefix + "tag:" + tag
+}
+
+// get читает запись; false - записи нет или Redis недоступен
+func (rc *ResponseCache) get(ctx context.Context, key string, v interface{}) bool {
+	data, err := rc.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			componentLogger(componentCache).WithError(err).Warn("Failed to read response cache")
+		}
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// set сохраняет запись и добавляет ее в множества ключей инвалидации
+func (rc *ResponseCache) set(ctx context.Context, key string, v interface{}, ttl time.Duration, tags []string) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	_, err = rc.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, data, ttl)
+		for _, tag := range tags {
+			pipe.SAdd(ctx, tagKey(tag), key)
+			// Множество живет не меньше своих записей
+			pipe.Expire(ctx, tagKey(tag), ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		componentLogger(componentCache).WithError(err).Warn("Failed to write response cache")
+	}
+}
+
+// Invalidate удаляет записи, помеченные ключами
+func (rc *ResponseCache) Invalidate(ctx context.Context, tags []string) error {
+	for _, tag := range tags {
+		keys, err := rc.client.SMembers(ctx, tagKey(tag)).Result()
+		if err != nil {
+			return fmt.Errorf("read cache tag %s: %w", tag, err)
+		}
+		if err := rc.client.Del(ctx, append(keys, tagKey(tag))...).Err(); err != nil {
+			return fmt.Errorf("invalidate cache tag %s: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// Маршруты с кешем ответов и ключи инвалидации их записей
+var responseCacheRoutes = map[string][]string{
+	"/songs": {cacheKeySongs},
+}
+
+// ResponseCaching отдает анонимные GET из кеша и сохраняет успешные ответы.
+// Ключ - маршрут, нормализованные параметры запроса и заголовки, от которых
+// зависит ответ. Ответы с учетными данными не кешируются: они зависят от роли.
+func ResponseCaching(rc *ResponseCache, authReads bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tags, ok := responseCacheRoutes[c.FullPath()]
+		if !ok || c.Request.Method != http.MethodGet || authReads ||
+			c.GetHeader("Authorization") != "" || c.GetHeader(apiKeyHeader) != "" {
+			c.Next()
+			return
+		}
+		key := responseCacheKey(c)
+		var cached cachedResponse
+		if rc.get(c.Request.Context(), key, &cached) {
+			for name, value := range cached.Header {
+				c.Header(name, value)
+			}
+			c.Header(responseCacheHeader, "HIT")
+			if etag := cached.Header["ETag"]; etag != "" && etagMatches(c.GetHeader("If-None-Match"), etag) {
+				c.AbortWithStatus(http.StatusNotModified)
+				return
+			}
+			c.Data(cached.Status, cached.Header["Content-Type"], cached.Body)
+			c.Abort()
+			return
+		}
+
+		c.Header(responseCacheHeader, "MISS")
+		w := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		if w.Status() != http.StatusOK {
+			return
+		}
+		cached = cachedResponse{Status: w.Status(), Header: map[string]string{}, Body: w.body.Bytes()}
+		for _, name := range responseCacheHeaders {
+			if value := w.Header().Get(name); value != "" {
+				cached.Header[name] = value
+			}
+		}
+		// Ответ уже отправлен; запись не должна зависеть от отмены запроса
+		rc.set(context.WithoutCancel(c.Request.Context()), key, cached, rc.cfg.SongsTTL, tags)
+	}
+}
+
+// responseCacheKey нормализует запрос: Encode сортирует параметры, а
+// Accept и регион выбирают формат и правила ответа
+func responseCacheKey(c *gin.Context) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s?%s\nAccept: %s\n", c.FullPath(), c.Request.URL.Query().Encode(), c.GetHeader("Accept"))
+	if regionRules != nil {
+		fmt.Fprintf(h, "Region: %s\n", c.GetHeader(regionRules.header))
+	}
+	return responseCachePrefix + "resp:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder копирует тело ответа для кеша
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// cachedSongEntry - песня в кеше; время изменения в JSON песни не входит,
+// а без него ответ остался бы без ETag
+type cachedSongEntry struct {
+	Song      Song      `json:"song"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func songCacheKey(id int) string {
+	return responseCachePrefix + "song:" + strconv.Itoa(id)
+}
+
+// cachedSong читает песню с текстом (в том числе архивным) из кеша в
+// памяти процесса, затем из Redis, и только потом загружает через load.
+// Ошибки load не кешируются.
+func cachedSong(ctx context.Context, id int, load func() (Song, error)) (Song, error) {
+	if songTextCache == nil {
+		return redisCachedSong(ctx, id, load)
+	}
+	if song, ok := songTextCache.Get(id); ok {
+		return song, nil
+	}
+	song, err := redisCachedSong(ctx, id, load)
+	if err != nil {
+		return song, err
+	}
+	songTextCache.Put(song)
+	return song, nil
+}
+
+func redisCachedSong(ctx context.Context, id int, load func() (Song, error)) (Song, error) {
+	if responseCache == nil {
+		return load()
+	}
+	var entry cachedSongEntry
+	if responseCache.get(ctx, songCacheKey(id), &entry) {
+		entry.Song.UpdatedAt = entry.UpdatedAt
+		return entry.Song, nil
+	}
+	song, err := load()
+	if err != nil {
+		return song, err
+	}
+	entry = cachedSongEntry{Song: song, UpdatedAt: song.UpdatedAt}
+	responseCache.set(ctx, songCacheKey(id), entry, responseCache.cfg.SongTTL, []string{cacheKeySongs})
+	return song, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// useResponseCache включает кеш ответов в Redis; роутер нужно создать после
+func useResponseCache(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	responseCache = NewResponseCache(client, ResponseCacheConfig{Enabled: true, SongsTTL: time.Minute, SongTTL: time.Minute})
+	t.Cleanup(func() { responseCache = nil })
+	return mr
+}
+
+func TestResponseCaching(t *testing.T) {
+	setupTestDB(t)
+	seedGoldenSongs(t)
+	useResponseCache(t)
+	router := newTestRouter()
+
+	miss := doRequest(router, http.MethodGet, "/songs?group=Queen&limit=10", "")
+	if miss.Code != http.StatusOK || miss.Header().Get(responseCacheHeader) != "MISS" {
+		t.Fatalf("first read: status %d, X-Cache %q", miss.Code, miss.Header().Get(responseCacheHeader))
+	}
+	// Порядок параметров не меняет ключ
+	hit := doRequest(router, http.MethodGet, "/songs?limit=10&group=Queen", "")
+	if hit.Header().Get(responseCacheHeader) != "HIT" || hit.Body.String() != miss.Body.String() {
+		t.Fatalf("second read: X-Cache %q, body %s", hit.Header().Get(responseCacheHeader), hit.Body)
+	}
+	if hit.Header().Get("Content-Type") != miss.Header().Get("Content-Type") {
+		t.Errorf("cached Content-Type = %q", hit.Header().Get("Content-Type"))
+	}
+
+	// Запросы с учетными данными и ошибки мимо кеша
+	if w := doRequestAs(router, http.MethodGet, "/songs?group=Queen&limit=10", "", testAdminToken); w.Header().Get(responseCacheHeader) != "" {
+		t.Errorf("authenticated read: X-Cache %q", w.Header().Get(responseCacheHeader))
+	}
+	for i := 0; i < 2; i++ {
+		if w := doRequest(router, http.MethodGet, "/songs?page=0", ""); w.Header().Get(responseCacheHeader) != "MISS" {
+			t.Errorf("error response %d: X-Cache %q", i+1, w.Header().Get(responseCacheHeader))
+		}
+	}
+
+	// Запись сбрасывает закешированные списки
+	w := doRequestAs(router, http.MethodPut, "/songs/"+encodeSongID(2),
+		`{"group":"Queen","song":"Bohemian Rhapsody","link":"https://example.com/queen","version":1}`, testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: status %d, body %s", w.Code, w.Body)
+	}
+	after := doRequest(router, http.MethodGet, "/songs?group=Queen&limit=10", "")
+	if after.Header().Get(responseCacheHeader) != "MISS" || !strings.Contains(after.Body.String(), "https://example.com/queen") {
+		t.Errorf("read after update: X-Cache %q, body %s", after.Header().Get(responseCacheHeader), after.Body)
+	}
+}
+
+func TestResponseCachingSongText(t *testing.T) {
+	conn := setupTestDB(t)
+	seedGoldenSongs(t)
+	mr := useResponseCache(t)
+	router := newTestRouter()
+	target := "/songs/" + encodeSongID(2) + "/text?limit=1000"
+
+	if w := doRequest(router, http.MethodGet, target, ""); w.Code != http.StatusOK {
+		t.Fatalf("text: status %d, body %s", w.Code, w.Body)
+	}
+	if !mr.Exists(songCacheKey(2)) {
+		t.Fatal("song not cached after reading its text")
+	}
+	// Изменение мимо API не видно, пока запись в кеше жива
+	conn.Model(&Song{}).Where("id = ?", 2).Update("text", "Changed")
+	if w := doRequest(router, http.MethodGet, target, ""); !strings.Contains(w.Body.String(), "real life") {
+		t.Fatalf("text not served from cache: %s", w.Body)
+	}
+
+	w := doRequestAs(router, http.MethodPut, "/songs/"+encodeSongID(2),
+		`{"group":"Queen","song":"Bohemian Rhapsody","text":"Mama, just killed a man","version":1}`, testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: status %d, body %s", w.Code, w.Body)
+	}
+	if mr.Exists(songCacheKey(2)) {
+		t.Error("song still cached after update")
+	}
+	if w := doRequest(router, http.MethodGet, target, ""); !strings.Contains(w.Body.String(), "Mama, just killed a man") {
+		t.Errorf("text after update: %s", w.Body)
+	}
+}
+
+func TestResponseCachingWithoutRedis(t *testing.T) {
+	setupTestDB(t)
+	seedGoldenSongs(t)
+	mr := useResponseCache(t)
+	router := newTestRouter()
+	mr.Close()
+
+	// Недоступный Redis не ломает чтение
+	for _, target := range []string{"/songs", "/songs/" + encodeSongID(1) + "/text"} {
+		if w := doRequest(router, http.MethodGet, target, ""); w.Code != http.StatusOK {
+			t.Errorf("%s: status %d, body %s", target, w.Code, w.Body)
+		}
+	}
+}
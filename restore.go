@@ -0,0 +1,657 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Восстановление из выгрузки GET /admin/export. Файл проверяется при
+// загрузке, а пишется в базу задачей restore одной транзакцией: если
+// восстановление не удалось, база остается как была.
+const jobKindRestore = "restore"
+
+// Режимы восстановления
+const (
+	restoreModeMerge   = "merge"   // строки с тем же ключом перезаписываются, остальные остаются
+	restoreModeReplace = "replace" // таблицы выгрузки очищаются перед вставкой
+)
+
+// Статусы восстановления
+const (
+	restoreStatusPending = "pending"
+	restoreStatusRunning = "running"
+	restoreStatusDone    = "done"
+	restoreStatusFailed  = "failed"
+)
+
+// Больший файл POST /admin/import отклоняется с 413
+var restoreMaxBytes int64 = 512 << 20
+
+// BackupRestore - восстановление из выгрузки и его ход
+type BackupRestore struct {
+	ID           int              `json:"id" gorm:"primaryKey"`
+	Mode         string           `json:"mode" gorm:"not null"`
+	Format       string           `json:"format" gorm:"not null"`
+	Status       string           `json:"status" gorm:"not null"`
+	TotalRows    int64            `json:"totalRows" gorm:"not null;default:0"`
+	RestoredRows int64            `json:"restoredRows" gorm:"not null;default:0"`
+	Tables       map[string]int64 `json:"tables" gorm:"serializer:json"` // восстановлено строк по таблицам
+	Error        string           `json:"error,omitempty"`
+	Actor        string           `json:"actor" gorm:"not null"` // как actor в журнале аудита
+	CreatedAt    time.Time        `json:"createdAt"`
+	FinishedAt   *time.Time       `json:"finishedAt,omitempty"`
+}
+
+// BackupRestoreData - загруженный файл; удаляется, когда задача закончена
+type BackupRestoreData struct {
+	RestoreID int    `gorm:"primaryKey;autoIncrement:false"`
+	Data      []byte `gorm:"not null"`
+}
+
+type restorePayload struct {
+	RestoreID int `json:"restoreId"`
+}
+
+// backupDump - разобранная выгрузка: значения приведены к типам колонок
+type backupDump struct {
+	tables map[string][]map[string]interface{}
+	total  int64
+}
+
+// parseBackup разбирает и проверяет выгрузку. Таблицы и колонки должны быть
+// известны этой версии, а число строк - совпадать с итогом: без итога или
+// с другим числом строк файл оборван.
+func parseBackup(db *gorm.DB, format string, data []byte) (backupDump, error) {
+	tables, err := backupTables(db)
+	if err != nil {
+		return backupDump{}, err
+	}
+	var raw map[string][]map[string]interface{}
+	var summary *BackupSummary
+	switch format {
+	case backupFormatNDJSON:
+		raw, summary, err = readNDJSONBackup(data)
+	case backupFormatZip:
+		raw, summary, err = readZipBackup(data)
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return backupDump{}, err
+	}
+	if summary == nil {
+		return backupDump{}, errors.New("backup has no summary: the dump is incomplete")
+	}
+
+	dump := backupDump{tables: map[string][]map[string]interface{}{}}
+	known := map[string]bool{}
+	for _, table := range tables {
+		known[table.name] = true
+		rows := raw[table.name]
+		if int64(len(rows)) != summary.Tables[table.name] {
+			return backupDump{}, fmt.Errorf("table %s has %d rows, the summary lists %d", table.name, len(rows), summary.Tables[table.name])
+		}
+		for i, row := range rows {
+			for column, value := range row {
+				field := table.schema.LookUpField(column)
+				if field == nil || field.DBName != column {
+					return backupDump{}, fmt.Errorf("table %s: unknown column %q", table.name, column)
+				}
+				if row[column], err = backupColumnValue(field, value); err != nil {
+					return backupDump{}, fmt.Errorf("table %s, row %d, column %s: %w", table.name, i+1, column, err)
+				}
+			}
+		}
+		dump.tables[table.name] = rows
+		dump.total += int64(len(rows))
+	}
+	for name := range raw {
+		if !known[name] {
+			return backupDump{}, fmt.Errorf("unknown table %q", name)
+		}
+	}
+	for name := range summary.Tables {
+		if !known[name] {
+			return backupDump{}, fmt.Errorf("unknown table %q", name)
+		}
+	}
+	return dump, nil
+}
+
+// readNDJSONBackup читает строки {"table", "row"} до строки {"summary"}
+func readNDJSONBackup(data []byte) (map[string][]map[string]interface{}, *BackupSummary, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Числа остаются текстом, чтобы большие ID не теряли точность
+	dec.UseNumber()
+	tables := map[string][]map[string]interface{}{}
+	for line := 1; ; line++ {
+		var entry struct {
+			Table   string                 `json:"table"`
+			Row     map[string]interface{} `json:"row"`
+			Summary *BackupSummary         `json:"summary"`
+		}
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			return tables, nil, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if entry.Summary != nil {
+			if dec.More() {
+				return nil, nil, fmt.Errorf("line %d: data after the summary", line+1)
+			}
+			return tables, entry.Summary, nil
+		}
+		if entry.Table == "" || entry.Row == nil {
+			return nil, nil, fmt.Errorf("line %d: expected a table row or the summary", line)
+		}
+		tables[entry.Table] = append(tables[entry.Table], entry.Row)
+	}
+}
+
+// readZipBackup читает <таблица>.csv и manifest.json. Пустая ячейка - NULL
+// или пустая строка, см. backupColumnValue.
+func readZipBackup(data []byte) (map[string][]map[string]interface{}, *BackupSummary, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, err
+	}
+	tables := map[string][]map[string]interface{}{}
+	var summary *BackupSummary
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if f.Name == "manifest.json" {
+			summary = &BackupSummary{}
+			err = json.NewDecoder(r).Decode(summary)
+		} else if table, ok := strings.CutSuffix(f.Name, ".csv"); ok {
+			tables[table], err = readBackupCSV(r)
+		} else {
+			err = errors.New("unexpected file")
+		}
+		r.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return tables, summary, nil
+}
+
+func readBackupCSV(r io.Reader) ([]map[string]interface{}, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("missing header")
+	}
+	header := records[0]
+	rows := make([]map[string]interface{}, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(header))
+		for i, column := range header {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Форматы времени в выгрузке: backupValue пишет RFC 3339, но колонка,
+// которую база вернула текстом, попадает в выгрузку как есть
+var backupTimeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999", releaseDateISOLayout}
+
+// backupColumnValue приводит значение из выгрузки к типу колонки, обратно
+// backupValue. Пустая строка - NULL, кроме строковых колонок NOT NULL.
+func backupColumnValue(field *schema.Field, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	case bool:
+		s = strconv.FormatBool(v)
+	default:
+		return nil, fmt.Errorf("unexpected value %v", value)
+	}
+	if s == "" && (field.DataType != schema.String || field.FieldType.Kind() == reflect.Ptr) {
+		return nil, nil
+	}
+	switch field.DataType {
+	case schema.Bool:
+		return strconv.ParseBool(s)
+	case schema.Int, schema.Uint:
+		return strconv.ParseInt(s, 10, 64)
+	case schema.Float:
+		return strconv.ParseFloat(s, 64)
+	case schema.Bytes:
+		return base64.StdEncoding.DecodeString(s)
+	case schema.Time, schema.DataType(ReleaseDate{}.GormDataType()):
+		for _, layout := range backupTimeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid time %q", s)
+	}
+	// Строки и колонки с JSON в тексте пишутся как есть
+	return s, nil
+}
+
+// restoreBackup пишет выгрузку в tx. progress получает число строк каждой
+// записанной пачки.
+func restoreBackup(tx *gorm.DB, dump backupDump, mode string, progress func(table string, rows int64)) error {
+	tables, err := backupTables(tx)
+	if err != nil {
+		return err
+	}
+	if mode == restoreModeReplace {
+		// Обратный порядок: сначала строки, которые ссылаются на другие
+		for i := len(tables) - 1; i >= 0; i-- {
+			if err := tx.Exec("DELETE FROM " + tx.Statement.Quote(tables[i].name)).Error; err != nil {
+				return fmt.Errorf("clear %s: %w", tables[i].name, err)
+			}
+		}
+	}
+	for _, table := range tables {
+		rows := dump.tables[table.name]
+		if len(rows) == 0 {
+			continue
+		}
+		if table.name == "songs" {
+			if err := dropMissingOwners(tx, rows); err != nil {
+				return err
+			}
+			if mode == restoreModeMerge {
+				if err := checkSongNames(tx, rows); err != nil {
+					return err
+				}
+			}
+		}
+		query := tx.Table(table.name)
+		if mode == restoreModeMerge {
+			query = query.Clauses(backupUpsert(table, rows[0]))
+		}
+		for start := 0; start < len(rows); start += insertBatchSize {
+			batch := rows[start:min(start+insertBatchSize, len(rows))]
+			if err := query.Create(batch).Error; err != nil {
+				return fmt.Errorf("restore %s: %w", table.name, err)
+			}
+			progress(table.name, int64(len(batch)))
+		}
+	}
+	return resetSequences(tx, tables)
+}
+
+// backupUpsert перезаписывает строку с тем же первичным ключом
+func backupUpsert(table backupTable, row map[string]interface{}) clause.OnConflict {
+	conflict := clause.OnConflict{}
+	primary := map[string]bool{}
+	for _, name := range table.schema.PrimaryFieldDBNames {
+		conflict.Columns = append(conflict.Columns, clause.Column{Name: name})
+		primary[name] = true
+	}
+	var update []string
+	for column := range row {
+		if !primary[column] {
+			update = append(update, column)
+		}
+	}
+	sort.Strings(update)
+	if len(update) == 0 {
+		conflict.DoNothing = true
+	} else {
+		conflict.DoUpdates = clause.AssignmentColumns(update)
+	}
+	return conflict
+}
+
+// Сколько песен перечисляет songNameConflictError
+const songNameConflictsListed = 10
+
+// songNameConflictError - в merge песни выгрузки встали бы рядом с песнями
+// каталога с тем же названием под другим ID, и их отклонил бы уникальный
+// индекс songNameIndex
+type songNameConflictError struct {
+	songs []string
+	total int
+}
+
+func (e songNameConflictError) Error() string {
+	msg := "songs already exist under other IDs: " + strings.Join(e.songs, "; ")
+	if e.total > len(e.songs) {
+		msg += fmt.Sprintf(" and %d more", e.total-len(e.songs))
+	}
+	return msg + ". Restore with mode=replace or delete these songs first"
+}
+
+// checkSongNames ищет песни каталога, которые merge не перезапишет, с тем же
+// названием, что у неудаленной песни выгрузки
+func checkSongNames(tx *gorm.DB, rows []map[string]interface{}) error {
+	ids := make(map[int64]bool, len(rows))
+	names := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		id, _ := row["id"].(int64)
+		ids[id] = true
+		if row["deleted_at"] == nil {
+			group, _ := row["group"].(string)
+			name, _ := row["song_name"].(string)
+			names[batchKey(Song{Group: group, SongName: name})] = id
+		}
+	}
+	var existing []Song
+	if err := tx.Select("id", "group", "song_name").Order("id").Find(&existing).Error; err != nil {
+		return err
+	}
+	var conflict songNameConflictError
+	for _, song := range existing {
+		backupID, ok := names[batchKey(song)]
+		if !ok || ids[int64(song.ID)] {
+			continue
+		}
+		if conflict.total++; len(conflict.songs) < songNameConflictsListed {
+			conflict.songs = append(conflict.songs, fmt.Sprintf("%s - %s (%d in the backup, %d in the database)", song.Group, song.SongName, backupID, song.ID))
+		}
+	}
+	if conflict.total > 0 {
+		return conflict
+	}
+	return nil
+}
+
+// dropMissingOwners снимает владельцев, которых нет в этой базе: пользователи
+// не выгружаются, и при переносе в другое окружение ссылка на них нарушила
+// бы внешний ключ
+func dropMissingOwners(tx *gorm.DB, rows []map[string]interface{}) error {
+	var ids []int64
+	if err := tx.Model(&User{}).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	users := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		users[id] = true
+	}
+	for _, row := range rows {
+		if owner, ok := row["owner_id"].(int64); ok && !users[owner] {
+			row["owner_id"] = nil
+		}
+	}
+	return nil
+}
+
+// resetSequences продолжает счетчики ID Postgres после вставленных строк:
+// ID из выгрузки записываются явно, и счетчик о них не знает
+func resetSequences(tx *gorm.DB, tables []backupTable) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, table := range tables {
+		field := table.schema.PrioritizedPrimaryField
+		if field == nil || !field.AutoIncrement {
+			continue
+		}
+		err := tx.Exec(fmt.Sprintf(`SELECT setval(pg_get_serial_sequence(?, ?), COALESCE((SELECT MAX(%s) FROM %s), 0) + 1, false)`,
+			tx.Statement.Quote(field.DBName), tx.Statement.Quote(table.name)), table.name, field.DBName).Error
+		if err != nil {
+			return fmt.Errorf("reset %s sequence: %w", table.name, err)
+		}
+	}
+	return nil
+}
+
+// restoreJob - обработчик задачи restore. Ошибка восстановления не
+// повторяется: файл тот же, а база после отката не изменилась. Статус -
+// failed, оператор может загрузить исправленный файл.
+func restoreJob(ctx context.Context, payload json.RawMessage) error {
+	var p restorePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	db := GetDB().WithContext(ctx)
+	var restore BackupRestore
+	if err := db.First(&restore, p.RestoreID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	// running остается после падения воркера: транзакция тогда откатилась,
+	// и восстановление можно начать заново
+	if restore.Status != restoreStatusPending && restore.Status != restoreStatusRunning {
+		return nil
+	}
+	var data BackupRestoreData
+	if err := db.First(&data, p.RestoreID).Error; err != nil {
+		return err
+	}
+
+	log := logrus.WithFields(logrus.Fields{"restore": restore.ID, "mode": restore.Mode})
+	restore.Status, restore.RestoredRows, restore.Tables = restoreStatusRunning, 0, map[string]int64{}
+	if err := db.Select("status", "restored_rows", "tables").Updates(&restore).Error; err != nil {
+		return err
+	}
+	dump, err := parseBackup(db, restore.Format, data.Data)
+	if err == nil {
+		progress := startRestoreProgress(db, log)
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return restoreBackup(tx, dump, restore.Mode, func(table string, rows int64) {
+				restore.Tables[table] += rows
+				restore.RestoredRows += rows
+				progress.report(restore)
+			})
+		})
+		progress.stop()
+	}
+
+	now := time.Now()
+	restore.Status, restore.FinishedAt = restoreStatusDone, &now
+	if err != nil {
+		log.WithError(err).Error("Failed to restore backup")
+		restore.Status, restore.Error = restoreStatusFailed, err.Error()
+	} else {
+		log.WithField("rows", restore.RestoredRows).Info("Restored backup")
+		if err := purgeCache(ctx, cacheKeySongs); err != nil {
+			log.WithError(err).Warn("Failed to purge cache")
+		}
+		// Песни меняются в обход publishSongEvent, который удаляет их по одной
+		if songTextCache != nil {
+			songTextCache.Clear()
+		}
+	}
+	if err := db.Select("status", "error", "finished_at", "restored_rows", "tables").Updates(&restore).Error; err != nil {
+		return err
+	}
+	return db.Delete(&BackupRestoreData{}, restore.ID).Error
+}
+
+// restoreProgress пишет ход восстановления из своей горутины: запись идет
+// вне транзакции, чтобы его было видно в GET /admin/import/:id, и ждет
+// свободного подключения, не задерживая транзакцию. Из отчетов, пришедших
+// за время записи, пишется только последний.
+type restoreProgress struct {
+	latest  chan BackupRestore
+	written chan struct{}
+}
+
+func startRestoreProgress(db *gorm.DB, log *logrus.Entry) *restoreProgress {
+	p := &restoreProgress{latest: make(chan BackupRestore, 1), written: make(chan struct{})}
+	go func() {
+		defer close(p.written)
+		for restore := range p.latest {
+			if err := db.Select("restored_rows", "tables").Updates(&restore).Error; err != nil {
+				log.WithError(err).Warn("Failed to update restore progress")
+			}
+		}
+	}()
+	return p
+}
+
+// report заменяет еще не записанный отчет; вызывается из одной горутины
+func (p *restoreProgress) report(restore BackupRestore) {
+	restore.Tables = maps.Clone(restore.Tables)
+	select {
+	case <-p.latest:
+	default:
+	}
+	p.latest <- restore
+}
+
+// stop дожидается записи последнего отчета
+func (p *restoreProgress) stop() {
+	close(p.latest)
+	<-p.written
+}
+
+// @Summary Restore from a backup
+// @Description Restore the catalog from a dump made by GET /admin/export, sent as the request body with Content-Type application/x-ndjson or application/zip. The dump is checked right away: unknown tables or columns, or row counts that do not match the summary, are rejected with 400. The restore then runs as a background job in one transaction, so a failed restore leaves the database unchanged; follow its progress at the Location URL. merge overwrites rows with the same primary key and keeps the rest; it is rejected with 409 if a song in the dump has the same group and title as a song in the database under another ID. replace first clears every exported table. Song owners that do not exist in this database are dropped.
+// @ID restore-backup
+// @Accept application/x-ndjson
+// @Accept application/zip
+// @Produce json
+// @Param mode query string false "merge (default) or replace"
+// @Success 202 {object} BackupRestore
+// @Header 202 {string} Location "URL of the restore status"
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 413 {object} APIError
+// @Failure 415 {object} APIError
+// @Failure 500 {object} APIError
+// @Failure 503 {object} APIError
+// @Router /admin/import [post]
+func RestoreBackup(c *gin.Context) {
+	mode := c.DefaultQuery("mode", restoreModeMerge)
+	if mode != restoreModeMerge && mode != restoreModeReplace {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Unsupported restore mode: "+mode)
+		return
+	}
+	var format string
+	switch c.ContentType() {
+	case "application/x-ndjson":
+		format = backupFormatNDJSON
+	case "application/zip":
+		format = backupFormatZip
+	default:
+		abortWithError(c, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "Content-Type must be application/x-ndjson or application/zip")
+		return
+	}
+	if jobs == nil {
+		abortWithError(c, http.StatusServiceUnavailable, codeUnavailable, "Job queue is not running")
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, restoreMaxBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		abortWithError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "Backup is too large")
+		return
+	}
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Failed to read backup")
+		return
+	}
+	dump, err := parseBackup(dbFor(c), format, data)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid backup: "+err.Error())
+		return
+	}
+	// Задача проверяет еще раз в своей транзакции: каталог мог измениться
+	if mode == restoreModeMerge {
+		err := checkSongNames(dbFor(c), dump.tables["songs"])
+		var conflict songNameConflictError
+		if errors.As(err, &conflict) {
+			abortWithError(c, http.StatusConflict, codeConflict, err.Error())
+			return
+		}
+		if err != nil {
+			logEntry(c).WithError(err).Error("Failed to check backup songs")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to queue restore")
+			return
+		}
+	}
+
+	restore := BackupRestore{Mode: mode, Format: format, Status: restoreStatusPending, TotalRows: dump.total, Tables: map[string]int64{}, Actor: auditActor(c)}
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&restore).Error; err != nil {
+			return err
+		}
+		return tx.Create(&BackupRestoreData{RestoreID: restore.ID, Data: data}).Error
+	})
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to store backup for restore")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to queue restore")
+		return
+	}
+	if err := jobs.Enqueue(c.Request.Context(), jobKindRestore, restorePayload{RestoreID: restore.ID}, 0); err != nil {
+		logEntry(c).WithError(err).Error("Failed to queue restore")
+		failed := map[string]interface{}{"status": restoreStatusFailed, "error": err.Error()}
+		if err := dbFor(c).Model(&restore).Updates(failed).Error; err != nil {
+			logEntry(c).WithError(err).Error("Failed to update restore status")
+		}
+		dbFor(c).Delete(&BackupRestoreData{}, restore.ID)
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to queue restore")
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/admin/import/%d", restore.ID))
+	c.JSON(http.StatusAccepted, restore)
+}
+
+// @Summary Get restore status
+// @Description Status and progress of a restore started with POST /admin/import: restoredRows of totalRows and the rows restored per table so far.
+// @ID get-restore
+// @Produce json
+// @Param id path int true "Restore ID"
+// @Success 200 {object} BackupRestore
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/import/{id} [get]
+func GetRestore(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid restore ID")
+		return
+	}
+	var restore BackupRestore
+	err = dbFor(c).First(&restore, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Restore not found")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch restore")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch restore")
+		return
+	}
+	c.JSON(http.StatusOK, restore)
+}
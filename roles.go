@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Role - роль пользователя или API-ключа
+type Role string
+
+const (
+	RoleReader Role = "reader"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+const fieldRole = "role"
+
+// Каждая следующая роль включает права предыдущих
+var roleRank = map[Role]int{
+	RoleReader: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// Allows сообщает, достаточно ли роли для действия, требующего required
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] >= roleRank[required]
+}
+
+// currentRole возвращает роль аутентифицированного клиента или пустую строку
+func currentRole(c *gin.Context) Role {
+	role, _ := c.Get(fieldRole)
+	r, _ := role.(Role)
+	return r
+}
+
+// currentUserID возвращает ID пользователя, если клиент вошел как пользователь,
+// а не по API-ключу или статическому токену
+func currentUserID(c *gin.Context) (int, bool) {
+	userID, _ := c.Get(fieldUserID)
+	id, ok := userID.(int)
+	return id, ok
+}
+
+var errNotOwner = errors.New("song is owned by another user")
+
+// canModifySong: менять и удалять песню может ее владелец; администратор - любую.
+// API-ключ выдает администратор для интеграций, владельца у ключа нет: ключ
+// с ролью editor меняет любую песню.
+func canModifySong(c *gin.Context, song Song) bool {
+	role := currentRole(c)
+	if role == RoleAdmin {
+		return true
+	}
+	if _, isKey := c.Get(fieldAPIKeyID); isKey {
+		return role.Allows(RoleEditor)
+	}
+	userID, ok := currentUserID(c)
+	return ok && song.OwnerID != nil && *song.OwnerID == userID
+}
+
+// RequireRole пропускает только клиентов с ролью не ниже required.
+// Все проверки прав выполняются здесь, а не в обработчиках.
+func RequireRole(required Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := currentRole(c)
+		if role == "" {
+			abortWithError(c, http.StatusUnauthorized, codeUnauthenticated, "Authentication required")
+			return
+		}
+		if !role.Allows(required) {
+			abortWithError(c, http.StatusForbidden, codeForbidden, "Insufficient permissions")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// createTestAPIKey добавляет действующий ключ с ролью и возвращает его значение
+func createTestAPIKey(t *testing.T, name string, role Role) string {
+	t.Helper()
+	raw := name + "-test-api-key"
+	key := APIKey{Name: name, Prefix: raw[:apiKeyPrefixLen], KeyHash: hashAPIKey(raw), Role: role}
+	if err := GetDB().Create(&key).Error; err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// issueTestToken выдает access-токен пользователю
+func issueTestToken(t *testing.T, user User) string {
+	t.Helper()
+	token, _, err := jwtKeys.Issue(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// doRequestWithHeader выполняет запрос с одним заголовком аутентификации
+func doRequestWithHeader(router http.Handler, method, target, body, header, value string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSongModifyPermissions(t *testing.T) {
+	// Песня принадлежит пользователю owner; каждая строка - клиент и
+	// ответ на PATCH этой песни
+	cases := []struct {
+		name      string
+		principal func(t *testing.T, owner User) (header, value string)
+		status    int
+	}{
+		{"anonymous", func(t *testing.T, owner User) (string, string) { return "", "" }, http.StatusUnauthorized},
+		{"admin token", func(t *testing.T, owner User) (string, string) {
+			return "Authorization", "Bearer " + testAdminToken
+		}, http.StatusOK},
+		{"admin user", func(t *testing.T, owner User) (string, string) {
+			return "Authorization", "Bearer " + issueTestToken(t, createTestUser(t, "root", "pw", RoleAdmin))
+		}, http.StatusOK},
+		{"editor user owning the song", func(t *testing.T, owner User) (string, string) {
+			return "Authorization", "Bearer " + issueTestToken(t, owner)
+		}, http.StatusOK},
+		{"editor user not owning the song", func(t *testing.T, owner User) (string, string) {
+			return "Authorization", "Bearer " + issueTestToken(t, createTestUser(t, "bob", "pw", RoleEditor))
+		}, http.StatusForbidden},
+		{"reader user", func(t *testing.T, owner User) (string, string) {
+			return "Authorization", "Bearer " + issueTestToken(t, createTestUser(t, "carol", "pw", RoleReader))
+		}, http.StatusForbidden},
+		{"admin API key", func(t *testing.T, owner User) (string, string) {
+			return apiKeyHeader, createTestAPIKey(t, "ops", RoleAdmin)
+		}, http.StatusOK},
+		{"editor API key", func(t *testing.T, owner User) (string, string) {
+			return apiKeyHeader, createTestAPIKey(t, "importer", RoleEditor)
+		}, http.StatusOK},
+		{"reader API key", func(t *testing.T, owner User) (string, string) {
+			return apiKeyHeader, createTestAPIKey(t, "dashboard", RoleReader)
+		}, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := setupTestDB(t)
+			useTestJWTKeys(t)
+			router := newTestRouter()
+			owner := createTestUser(t, "alice", "pw", RoleEditor)
+			song := Song{Group: "Muse", SongName: "Hysteria", OwnerID: &owner.ID}
+			if err := conn.Create(&song).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			header, value := tc.principal(t, owner)
+			w := doRequestWithHeader(router, http.MethodPatch, "/songs/"+encodeSongID(song.ID), `{"album":"Absolution","version":1}`, header, value)
+			if w.Code != tc.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tc.status, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteLimit задает таймаут обработчика и число одновременных запросов
+// для маршрута. Пустой Method подходит для любого метода.
+type RouteLimit struct {
+	Route         string   `json:"route"`
+	Method        string   `json:"method"`
+	Timeout       Duration `json:"timeout"`
+	MaxConcurrent int      `json:"maxConcurrent"`
+}
+
+// Duration читается из JSON строкой вида "2s"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ParseRouteLimits читает правила из JSON-массива RouteLimit
+func ParseRouteLimits(raw string) ([]RouteLimit, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var limits []RouteLimit
+	if err := json.Unmarshal([]byte(raw), &limits); err != nil {
+		return nil, fmt.Errorf("invalid ROUTE_LIMITS: %w", err)
+	}
+	return limits, nil
+}
+
+type routeGate struct {
+	timeout time.Duration
+	slots   chan struct{} // nil - без ограничения
+}
+
+func newRouteGate(l RouteLimit) *routeGate {
+	g := &routeGate{timeout: time.Duration(l.Timeout)}
+	if l.MaxConcurrent > 0 {
+		g.slots = make(chan struct{}, l.MaxConcurrent)
+	}
+	return g
+}
+
+// Потоки событий открыты, пока клиент не отключится, выгрузка каталога и
+// резервная копия базы идут столько, сколько в них строк, а профиль pprof -
+// сколько запрошено; таймаут по умолчанию на них не действует, свой можно
+// задать в ROUTE_LIMITS
+var streamingRoutes = map[string]bool{"/ws": true, "/songs/events": true, "/songs/export": true, "/admin/export": true, debugPprofRoute: true}
+
+// routeGates хранит шлюзы маршрутов. Для маршрутов без своих правил шлюз
+// со значениями по умолчанию заводится при первом запросе, поэтому лимит
+// по умолчанию действует на каждый маршрут отдельно.
+type routeGates struct {
+	mu       sync.Mutex
+	gates    map[string]*routeGate
+	defaults RouteLimit
+}
+
+func (r *routeGates) get(method, route string) *routeGate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if g, ok := r.gates[method+" "+route]; ok {
+		return g
+	}
+	if g, ok := r.gates[" "+route]; ok {
+		return g
+	}
+	defaults := r.defaults
+	if streamingRoutes[route] {
+		defaults.Timeout = 0
+	}
+	g := newRouteGate(defaults)
+	r.gates[method+" "+route] = g
+	return g
+}
+
+// RouteLimits ограничивает время обработки и параллелизм по маршрутам, чтобы
+// медленные запросы не занимали ресурсы дешевых. Таймаут передается через
+// контекст запроса; обработчик, не ответивший к сроку, получает 504.
+func RouteLimits(limits []RouteLimit, defaults RouteLimit) gin.HandlerFunc {
+	registry := &routeGates{gates: map[string]*routeGate{}, defaults: defaults}
+	for _, l := range limits {
+		registry.gates[l.Method+" "+l.Route] = newRouteGate(l)
+	}
+
+	return func(c *gin.Context) {
+		gate := registry.get(c.Request.Method, c.FullPath())
+
+		if gate.slots != nil {
+			select {
+			case gate.slots <- struct{}{}:
+				defer func() { <-gate.slots }()
+			default:
+				c.Header("Retry-After", "1")
+				abortWithError(c, http.StatusServiceUnavailable, codeServerBusy, "Server is busy, retry later")
+				return
+			}
+		}
+
+		if gate.timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), gate.timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			logEntry(c).WithField("timeout", gate.timeout.String()).Warn("Handler timed out")
+			abortWithError(c, http.StatusGatewayTimeout, codeTimeout, "Request timed out")
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const jobKindScheduledChange = "scheduled_change"
+
+// Статусы отложенного изменения
+const (
+	scheduledPending   = "pending"
+	scheduledApplied   = "applied"
+	scheduledCancelled = "cancelled"
+	scheduledFailed    = "failed" // песню удалили до срока
+)
+
+// Поля фильтров GET /scheduled-changes
+var scheduledFilterFields = FilterFields{
+	"status":      {Column: "status", Ops: []string{filterOpEq, filterOpNe}},
+	"songId":      {Column: "song_id", Ops: filterOpsEq, Parse: parseSongIDFilter},
+	"effectiveAt": {Column: "effective_at", Ops: filterOpsOrdered, Parse: parseTimeFilter},
+}
+
+// Структура ScheduledChange (правка песни, которая вступит в силу в
+// EffectiveAt). Применяет ее задача очереди, запланированная на этот момент.
+type ScheduledChange struct {
+	ID          int             `json:"id" gorm:"primaryKey"`
+	SongID      PublicID        `json:"songId" extensions:"x-public-id" gorm:"not null;index"`
+	Changes     json.RawMessage `json:"changes" gorm:"type:jsonb" swaggertype:"object"` // поля как в PUT /songs/{id}
+	EffectiveAt time.Time       `json:"effectiveAt" gorm:"not null"`
+	Status      string          `json:"status" gorm:"not null;default:pending;index"`
+	// Кто и каким запросом запланировал; попадает в журнал аудита при применении
+	Actor     string     `json:"actor" gorm:"not null"`
+	RequestID string     `json:"-"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// Тело запроса на отложенное изменение
+type ScheduleChangeRequest struct {
+	EffectiveAt time.Time       `json:"effectiveAt" binding:"required"`
+	Changes     json.RawMessage `json:"changes" binding:"required" swaggertype:"object"`
+}
+
+type scheduledChangePayload struct {
+	ChangeID int `json:"changeId"`
+}
+
+// songPatch разбирает сохраненные поля; владелец и оценка ссылки, как и в
+// PUT /songs/{id}, не меняются
+func (sc ScheduledChange) songPatch() (Song, error) {
+	var patch Song
+	if err := json.Unmarshal(sc.Changes, &patch); err != nil {
+		return patch, err
+	}
+	patch.ID = 0
+	patch.OwnerID = nil
+	patch.LinkConfidence = nil
+	// Изменение применяется поверх текущей версии песни, какой бы она ни была
+	patch.Version = 0
+	return patch, nil
+}
+
+// applyScheduledChangeJob - обработчик задачи scheduled_change. Отмененное
+// или уже примененное изменение пропускается.
+func applyScheduledChangeJob(ctx context.Context, payload json.RawMessage) error {
+	var p scheduledChangePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	db := GetDB().WithContext(ctx)
+	var after Song
+	applied := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var change ScheduledChange
+		if err := tx.First(&change, p.ChangeID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		if change.Status != scheduledPending {
+			return nil
+		}
+		now := time.Now()
+		var before Song
+		err := tx.First(&before, change.SongID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Model(&change).Updates(map[string]interface{}{"status": scheduledFailed, "error": "song was deleted"}).Error
+		}
+		if err != nil {
+			return err
+		}
+		patch, err := change.songPatch()
+		if err != nil {
+			return tx.Model(&change).Updates(map[string]interface{}{"status": scheduledFailed, "error": err.Error()}).Error
+		}
+		if after, err = applySongPatch(tx, before, patch); err != nil {
+			return err
+		}
+		err = tx.Model(&change).Updates(map[string]interface{}{"status": scheduledApplied, "applied_at": now}).Error
+		if err != nil {
+			return err
+		}
+		applied = true
+		return recordAuditAs(tx, change.Actor, change.RequestID, auditEntitySong, before.ID, auditActionUpdate, before, after)
+	})
+	if err != nil || !applied {
+		return err
+	}
+	if err := publishSongEvent(ctx, db, songEventUpdated, after); err != nil {
+		componentLogger(componentJobs).WithError(err).WithField(fieldSongID, after.ID).Warn("Failed to publish webhook event")
+	}
+	return nil
+}
+
+// @Summary Schedule song change
+// @Description Stage an edit that is applied automatically at effectiveAt, e.g. corrected lyrics going live at album release. Changes take the same fields as PUT /songs/{id}.
+// @ID schedule-song-change
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Param change body ScheduleChangeRequest true "Effective time and song fields"
+// @Success 201 {object} ScheduledChange
+// @Failure 400 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Failure 503 {object} APIError
+// @Router /songs/{id}/scheduled-changes [post]
+func ScheduleSongChange(c *gin.Context) {
+	id, err := parseSongID(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
+		return
+	}
+	var req ScheduleChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	if !req.EffectiveAt.After(time.Now()) {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "effectiveAt must be in the future")
+		return
+	}
+	change := ScheduledChange{
+		SongID: PublicID(id), Changes: req.Changes, EffectiveAt: req.EffectiveAt, Status: scheduledPending,
+		Actor: auditActor(c), RequestID: c.GetString(fieldRequestID),
+	}
+	if _, err := change.songPatch(); err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, fmt.Sprintf("invalid changes: %v", err))
+		return
+	}
+	if jobs == nil {
+		abortWithError(c, http.StatusServiceUnavailable, codeUnavailable, "Scheduler is not running")
+		return
+	}
+
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		var song Song
+		if err := tx.First(&song, id).Error; err != nil {
+			return err
+		}
+		if !canModifySong(c, song) {
+			return errNotOwner
+		}
+		return tx.Create(&change).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
+	if errors.Is(err, errNotOwner) {
+		abortWithError(c, http.StatusForbidden, codeNotOwner, "You can only change your own songs")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to schedule change")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to schedule change")
+		return
+	}
+	payload := scheduledChangePayload{ChangeID: change.ID}
+	if err := jobs.EnqueueAt(c.Request.Context(), jobKindScheduledChange, payload, 0, change.EffectiveAt); err != nil {
+		logEntry(c).WithError(err).Error("Failed to queue scheduled change")
+		dbFor(c).Delete(&change)
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to schedule change")
+		return
+	}
+	c.JSON(http.StatusCreated, change)
+}
+
+// @Summary List scheduled changes
+// @Description List scheduled song changes by effective time. Defaults to pending ones. Filters take an operator in brackets, e.g. status[ne]=cancelled or effectiveAt[lt]=2024-01-01T00:00:00Z.
+// @ID list-scheduled-changes
+// @Produce  json
+// @Param status query string false "pending, applied, cancelled or failed"
+// @Param songId query int false "Only changes to this song"
+// @Param effectiveAt[lt] query string false "Only changes due before this RFC 3339 time"
+// @Success 200 {array} ScheduledChange
+// @Failure 400 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /scheduled-changes [get]
+func GetScheduledChanges(c *gin.Context) {
+	conds, err := scheduledFilterFields.Parse(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	fs := NewFilterSet("").Conds(conds)
+	if !hasFilter(conds, "status") {
+		fs.Eq("status", scheduledPending)
+	}
+	changes := []ScheduledChange{}
+	if err := fs.Apply(dbFor(c).Model(&ScheduledChange{})).Order("effective_at, id").Find(&changes).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch scheduled changes")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch scheduled changes")
+		return
+	}
+	c.JSON(http.StatusOK, changes)
+}
+
+// @Summary Cancel scheduled change
+// @Description Cancel a pending scheduled change so it is never applied.
+// @ID cancel-scheduled-change
+// @Produce  json
+// @Param id path int true "Scheduled change ID"
+// @Success 200 {object} ScheduledChange
+// @Failure 400 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /scheduled-changes/{id} [delete]
+func CancelScheduledChange(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid scheduled change ID")
+		return
+	}
+	var change ScheduledChange
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&change, id).Error; err != nil {
+			return err
+		}
+		if change.Status != scheduledPending {
+			return errScheduledNotPending
+		}
+		var song Song
+		if err := tx.First(&song, change.SongID).Error; err == nil && !canModifySong(c, song) {
+			return errNotOwner
+		}
+		change.Status = scheduledCancelled
+		return tx.Model(&change).Update("status", scheduledCancelled).Error
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Scheduled change not found")
+	case errors.Is(err, errScheduledNotPending):
+		abortWithError(c, http.StatusConflict, codeConflict, "Scheduled change is no longer pending")
+	case errors.Is(err, errNotOwner):
+		abortWithError(c, http.StatusForbidden, codeNotOwner, "You can only change your own songs")
+	case err != nil:
+		logEntry(c).WithError(err).Error("Failed to cancel scheduled change")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to cancel scheduled change")
+	default:
+		c.JSON(http.StatusOK, change)
+	}
+}
+
+var errScheduledNotPending = errors.New("scheduled change is not pending")
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Уровни ответа подозрительному клиенту; каждое нарушение поднимает уровень
+// на один, каждый Cooldown без нарушений - опускает
+const (
+	scraperLevelNone = iota
+	scraperLevelThrottle
+	scraperLevelChallenge
+	scraperLevelBlock
+)
+
+var scraperLevelNames = []string{"none", "throttle", "challenge", "block"}
+
+// Причины нарушений в отчете
+const (
+	scraperReasonBurst = "burst"
+	scraperReasonWalk  = "sequential_ids"
+)
+
+const (
+	// Заголовок ответа на уровне challenge: клиенту нужно пройти капчу
+	botChallengeHeader = "X-Bot-Challenge"
+	// Заголовок запроса с решенной капчей
+	captchaTokenHeader = "X-Captcha-Token"
+)
+
+// ScraperConfig - обнаружение парсеров каталога. Счетчики живут в памяти
+// процесса, поэтому за балансировщиком лучше держать привязку клиента к
+// экземпляру.
+type ScraperConfig struct {
+	Enabled      bool
+	Window       time.Duration // окно подсчета запросов
+	BurstLimit   int           // больше запросов за окно - нарушение
+	WalkLimit    int           // столько запросов подряд к соседним ID песен - нарушение
+	ThrottleRate RateLimit     // лимит клиента на уровне throttle
+	BlockFor     time.Duration
+	Cooldown     time.Duration
+	Whitelist    string // через запятую: IP или ключи клиентов из GET /admin/scrapers
+
+	CaptchaVerifyURL string // siteverify hCaptcha, reCAPTCHA или Turnstile; пусто - капча не проверяется
+	CaptchaSecret    string
+	CaptchaTimeout   time.Duration
+}
+
+// ChallengeVerifier проверяет решение капчи, присланное клиентом
+type ChallengeVerifier interface {
+	Verify(ctx context.Context, token, clientIP string) (bool, error)
+}
+
+// siteVerifier проверяет токен через siteverify: у hCaptcha, reCAPTCHA и
+// Turnstile одинаковые запрос и поле success в ответе
+type siteVerifier struct {
+	url    string
+	secret string
+	http   *http.Client
+}
+
+func (v *siteVerifier) Verify(ctx context.Context, token, clientIP string) (bool, error) {
+	form := url.Values{"secret": {v.secret}, "response": {token}, "remoteip": {clientIP}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("captcha verification returned status %d", resp.StatusCode)
+	}
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
+
+// scraperClient - счетчики одного клиента
+type scraperClient struct {
+	windowStart  time.Time
+	requests     int // в текущем окне
+	lastSongID   int
+	walk         int // длина текущей цепочки соседних ID
+	walkStep     int // направление цепочки: 1 или -1
+	level        int
+	reason       string
+	lastStrike   time.Time
+	levelSince   time.Time // с него отсчитывается Cooldown до снижения уровня
+	blockedUntil time.Time
+	firstSeen    time.Time
+	lastSeen     time.Time
+	total        int64
+}
+
+// ScraperDetector считает запросы клиентов и повышает уровень ответа тем,
+// кто запрашивает каталог слишком часто или перебирает ID песен подряд
+type ScraperDetector struct {
+	cfg      ScraperConfig
+	verifier ChallengeVerifier // nil - уровень challenge снимается только временем или администратором
+	throttle *memoryLimiter
+
+	mu        sync.Mutex
+	clients   map[string]*scraperClient
+	whitelist map[string]bool
+	lastSweep time.Time
+}
+
+// Обнаружение парсеров; nil - выключено
+var scrapers *ScraperDetector
+
+// NewScraperDetector создает детектор; nil - обнаружение выключено
+func NewScraperDetector(cfg ScraperConfig) *ScraperDetector {
+	if !cfg.Enabled {
+		return nil
+	}
+	d := &ScraperDetector{
+		cfg:       cfg,
+		throttle:  newMemoryLimiter(),
+		clients:   map[string]*scraperClient{},
+		whitelist: map[string]bool{},
+		lastSweep: time.Now(),
+	}
+	for _, entry := range strings.Split(cfg.Whitelist, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			d.whitelist[entry] = true
+		}
+	}
+	if cfg.CaptchaVerifyURL != "" {
+		d.verifier = &siteVerifier{
+			url:    cfg.CaptchaVerifyURL,
+			secret: cfg.CaptchaSecret,
+			http:   trackHTTP(&http.Client{Timeout: cfg.CaptchaTimeout}, "captcha", dependencyCaptcha),
+		}
+	}
+	return d
+}
+
+// Whitelisted сообщает, что клиент не проверяется
+func (d *ScraperDetector) Whitelisted(key, ip string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.whitelist[key] || d.whitelist[ip]
+}
+
+// Observe учитывает запрос клиента и возвращает его уровень. songID > 0 -
+// запрос к песне по ID.
+func (d *ScraperDetector) Observe(key string, songID int, now time.Time) (int, time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sweep(now)
+
+	cl, ok := d.clients[key]
+	if !ok {
+		cl = &scraperClient{windowStart: now, firstSeen: now}
+		d.clients[key] = cl
+	}
+	d.decay(cl, now)
+	cl.lastSeen = now
+	cl.total++
+
+	if now.Sub(cl.windowStart) >= d.cfg.Window {
+		cl.windowStart, cl.requests = now, 0
+	}
+	cl.requests++
+	if d.cfg.BurstLimit > 0 && cl.requests > d.cfg.BurstLimit {
+		// Следующее нарушение - только после еще одного полного всплеска
+		cl.windowStart, cl.requests = now, 0
+		d.strike(key, cl, scraperReasonBurst, now)
+	}
+
+	if songID > 0 {
+		step := songID - cl.lastSongID
+		switch {
+		case cl.lastSongID != 0 && (step == 1 || step == -1) && (cl.walk == 0 || step == cl.walkStep):
+			cl.walk, cl.walkStep = cl.walk+1, step
+		case cl.lastSongID != 0 && (step == 1 || step == -1):
+			// Смена направления начинает новую цепочку
+			cl.walk, cl.walkStep = 1, step
+		default:
+			cl.walk = 0
+		}
+		cl.lastSongID = songID
+		if d.cfg.WalkLimit > 0 && cl.walk >= d.cfg.WalkLimit {
+			cl.walk = 0
+			d.strike(key, cl, scraperReasonWalk, now)
+		}
+	}
+	return cl.level, cl.blockedUntil
+}
+
+// decay снижает уровень за каждый Cooldown без нарушений. Блокировка
+// длится BlockFor, после нее клиент остается на уровне challenge.
+func (d *ScraperDetector) decay(cl *scraperClient, now time.Time) {
+	if cl.level == scraperLevelBlock {
+		if now.Before(cl.blockedUntil) {
+			return
+		}
+		cl.level, cl.levelSince = scraperLevelChallenge, cl.blockedUntil
+	}
+	for cl.level > scraperLevelNone && d.cfg.Cooldown > 0 && now.Sub(cl.levelSince) >= d.cfg.Cooldown {
+		cl.level--
+		cl.levelSince = cl.levelSince.Add(d.cfg.Cooldown)
+	}
+}
+
+func (d *ScraperDetector) strike(key string, cl *scraperClient, reason string, now time.Time) {
+	if cl.level < scraperLevelBlock {
+		cl.level++
+	}
+	cl.reason, cl.lastStrike, cl.levelSince = reason, now, now
+	if cl.level == scraperLevelBlock {
+		cl.blockedUntil = now.Add(d.cfg.BlockFor)
+	}
+	logrus.WithFields(logrus.Fields{"client": key, "reason": reason, "level": scraperLevelNames[cl.level]}).Warn("Scraping suspected")
+}
+
+// sweep удаляет клиентов без нарушений, давно не делавших запросов
+func (d *ScraperDetector) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < time.Minute {
+		return
+	}
+	d.lastSweep = now
+	idle := d.cfg.Window
+	if d.cfg.Cooldown > idle {
+		idle = d.cfg.Cooldown
+	}
+	for key, cl := range d.clients {
+		d.decay(cl, now)
+		if cl.level == scraperLevelNone && now.Sub(cl.lastSeen) > idle {
+			delete(d.clients, key)
+		}
+	}
+}
+
+// Reset забывает счетчики и уровень клиента
+func (d *ScraperDetector) Reset(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.clients[key]
+	delete(d.clients, key)
+	return ok
+}
+
+// SetWhitelisted добавляет клиента в белый список или убирает из него
+func (d *ScraperDetector) SetWhitelisted(key string, whitelisted bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if whitelisted {
+		d.whitelist[key] = true
+		delete(d.clients, key)
+		return
+	}
+	delete(d.whitelist, key)
+}
+
+// ScraperClient - клиент в отчете GET /admin/scrapers
+type ScraperClient struct {
+	Client       string     `json:"client"` // ip:<адрес> или key:<ID API-ключа>
+	Level        string     `json:"level" enums:"none,throttle,challenge,block"`
+	Reason       string     `json:"reason,omitempty" enums:"burst,sequential_ids"`
+	Requests     int64      `json:"requests"`
+	FirstSeen    time.Time  `json:"firstSeen"`
+	LastSeen     time.Time  `json:"lastSeen"`
+	LastStrike   *time.Time `json:"lastStrike,omitempty"`
+	BlockedUntil *time.Time `json:"blockedUntil,omitempty"`
+}
+
+type ScraperReport struct {
+	Clients   []ScraperClient `json:"clients"`
+	Whitelist []string        `json:"whitelist"`
+}
+
+// Report перечисляет клиентов, начиная с самых подозрительных; all=false -
+// только с уровнем выше none
+func (d *ScraperDetector) Report(all bool, now time.Time) ScraperReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	report := ScraperReport{Clients: []ScraperClient{}, Whitelist: make([]string, 0, len(d.whitelist))}
+	for key, cl := range d.clients {
+		d.decay(cl, now)
+		if cl.level == scraperLevelNone && !all {
+			continue
+		}
+		entry := ScraperClient{
+			Client:    key,
+			Level:     scraperLevelNames[cl.level],
+			Reason:    cl.reason,
+			Requests:  cl.total,
+			FirstSeen: cl.firstSeen,
+			LastSeen:  cl.lastSeen,
+		}
+		if !cl.lastStrike.IsZero() {
+			lastStrike := cl.lastStrike
+			entry.LastStrike = &lastStrike
+		}
+		if cl.level == scraperLevelBlock {
+			blockedUntil := cl.blockedUntil
+			entry.BlockedUntil = &blockedUntil
+		}
+		report.Clients = append(report.Clients, entry)
+	}
+	levels := map[string]int{}
+	for i, name := range scraperLevelNames {
+		levels[name] = i
+	}
+	sort.Slice(report.Clients, func(i, j int) bool {
+		a, b := report.Clients[i], report.Clients[j]
+		if levels[a.Level] != levels[b.Level] {
+			return levels[a.Level] > levels[b.Level]
+		}
+		return a.LastSeen.After(b.LastSeen)
+	})
+	for key := range d.whitelist {
+		report.Whitelist = append(report.Whitelist, key)
+	}
+	sort.Strings(report.Whitelist)
+	return report
+}
+
+// ScraperDetection применяет уровень клиента к запросу: throttle - строгий
+// лимит частоты, challenge - 403 с X-Bot-Challenge до решения капчи, block -
+// 403 до конца блокировки
+func ScraperDetection(d *ScraperDetector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := clientKey(c)
+		// Администратор не должен заблокировать сам себя
+		if strings.HasPrefix(c.FullPath(), "/admin/") || d.Whitelisted(key, c.ClientIP()) {
+			c.Next()
+			return
+		}
+		songID := 0
+		if strings.HasPrefix(c.FullPath(), "/songs/:id") {
+			songID, _ = parseSongID(c.Param("id"))
+		}
+		level, blockedUntil := d.Observe(key, songID, time.Now())
+
+		switch level {
+		case scraperLevelThrottle:
+			allowed, wait, _ := d.throttle.Allow(c.Request.Context(), key, d.cfg.ThrottleRate)
+			if !allowed {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				abortWithError(c, http.StatusTooManyRequests, codeRateLimited, "Too many requests")
+				return
+			}
+		case scraperLevelChallenge:
+			if d.passChallenge(c, key) {
+				break
+			}
+			c.Header(botChallengeHeader, "captcha")
+			abortWithError(c, http.StatusForbidden, codeCaptchaRequired, "Verification required")
+			return
+		case scraperLevelBlock:
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(blockedUntil).Seconds()))))
+			abortWithError(c, http.StatusForbidden, codeBlocked, "Access blocked")
+			return
+		}
+		c.Next()
+	}
+}
+
+// passChallenge проверяет капчу из X-Captcha-Token; решенная капча
+// сбрасывает уровень клиента
+func (d *ScraperDetector) passChallenge(c *gin.Context, key string) bool {
+	token := c.GetHeader(captchaTokenHeader)
+	if d.verifier == nil || token == "" {
+		return false
+	}
+	ok, err := d.verifier.Verify(c.Request.Context(), token, c.ClientIP())
+	if err != nil {
+		logEntry(c).WithError(err).Warn("Failed to verify captcha")
+		return false
+	}
+	if ok {
+		d.Reset(key)
+	}
+	return ok
+}
+
+// @Summary List suspected scrapers
+// @Description List clients whose requests look like scraping, most suspicious first, with the response level applied to them (throttle, challenge or block), the reason of the last violation and the whitelist. Counters are kept per instance.
+// @ID list-scrapers
+// @Produce  json
+// @Param all query bool false "Include clients without violations"
+// @Success 200 {object} ScraperReport
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Router /admin/scrapers [get]
+func GetScrapers(c *gin.Context) {
+	if scrapers == nil {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Scraper detection is disabled")
+		return
+	}
+	all, _ := strconv.ParseBool(c.Query("all"))
+	c.JSON(http.StatusOK, scrapers.Report(all, time.Now()))
+}
+
+// @Summary Reset scraper state
+// @Description Forget a client's counters and lift its throttle, challenge or block.
+// @ID reset-scraper
+// @Produce  json
+// @Param client path string true "Client key from the report, e.g. ip:203.0.113.5"
+// @Success 200 {object} Message
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Router /admin/scrapers/{client} [delete]
+func ResetScraper(c *gin.Context) {
+	if scrapers == nil {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Scraper detection is disabled")
+		return
+	}
+	if !scrapers.Reset(c.Param("client")) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Client not found")
+		return
+	}
+	logEntry(c).WithField("client", c.Param("client")).Warn("Scraper state reset")
+	c.JSON(http.StatusOK, gin.H{"message": "Client reset"})
+}
+
+// @Summary Whitelist client
+// @Description Exempt a client from scraper detection. The client is a key from the report or a bare IP address.
+// @ID whitelist-scraper
+// @Produce  json
+// @Param client path string true "Client key or IP address"
+// @Success 200 {object} Message
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Router /admin/scrapers/whitelist/{client} [put]
+func WhitelistScraper(c *gin.Context) {
+	setScraperWhitelisted(c, true)
+}
+
+// @Summary Remove client from whitelist
+// @Description Subject a previously whitelisted client to scraper detection again.
+// @ID unwhitelist-scraper
+// @Produce  json
+// @Param client path string true "Client key or IP address"
+// @Success 200 {object} Message
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Router /admin/scrapers/whitelist/{client} [delete]
+func UnwhitelistScraper(c *gin.Context) {
+	setScraperWhitelisted(c, false)
+}
+
+func setScraperWhitelisted(c *gin.Context, whitelisted bool) {
+	if scrapers == nil {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Scraper detection is disabled")
+		return
+	}
+	client := c.Param("client")
+	scrapers.SetWhitelisted(client, whitelisted)
+	logEntry(c).WithFields(logrus.Fields{"client": client, "whitelisted": whitelisted}).Warn("Scraper whitelist changed")
+	if whitelisted {
+		c.JSON(http.StatusOK, gin.H{"message": "Client whitelisted"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Client removed from whitelist"})
+}
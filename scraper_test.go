@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testScraperConfig() ScraperConfig {
+	return ScraperConfig{
+		Enabled:      true,
+		Window:       time.Minute,
+		BurstLimit:   5,
+		WalkLimit:    3,
+		ThrottleRate: RateLimit{Rate: 1, Burst: 1},
+		BlockFor:     time.Hour,
+		Cooldown:     15 * time.Minute,
+	}
+}
+
+func TestScraperBurstLimit(t *testing.T) {
+	d := NewScraperDetector(testScraperConfig())
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		if level, _ := d.Observe("ip:a", 0, now); level != scraperLevelNone {
+			t.Fatalf("request %d within the limit: level %s", i+1, scraperLevelNames[level])
+		}
+	}
+	if level, _ := d.Observe("ip:a", 0, now); level != scraperLevelThrottle {
+		t.Fatalf("request over the limit: level %s, want throttle", scraperLevelNames[level])
+	}
+	// Счетчик окна сбрасывается: следующее нарушение - после нового всплеска
+	for i := 0; i < 5; i++ {
+		d.Observe("ip:a", 0, now)
+	}
+	if level, _ := d.Observe("ip:a", 0, now); level != scraperLevelChallenge {
+		t.Fatalf("second burst: level %s, want challenge", scraperLevelNames[level])
+	}
+	// Другой клиент считается отдельно
+	if level, _ := d.Observe("ip:b", 0, now); level != scraperLevelNone {
+		t.Fatalf("other client: level %s", scraperLevelNames[level])
+	}
+	report := d.Report(false, now)
+	if len(report.Clients) != 1 || report.Clients[0].Client != "ip:a" || report.Clients[0].Reason != scraperReasonBurst {
+		t.Fatalf("report = %+v", report.Clients)
+	}
+}
+
+func TestScraperSequentialIDs(t *testing.T) {
+	cfg := testScraperConfig()
+	cfg.BurstLimit = 0
+	d := NewScraperDetector(cfg)
+	now := time.Now()
+
+	// 10, 11, 12 - цепочка из двух шагов, смена направления начинает новую
+	for _, id := range []int{10, 11, 12, 11, 10} {
+		if level, _ := d.Observe("ip:a", id, now); level != scraperLevelNone {
+			t.Fatalf("song %d: level %s", id, scraperLevelNames[level])
+		}
+	}
+	if level, _ := d.Observe("ip:a", 9, now); level != scraperLevelThrottle {
+		t.Fatalf("third step down: level %s, want throttle", scraperLevelNames[level])
+	}
+	// Запросы не подряд не образуют цепочку
+	for _, id := range []int{1, 5, 6, 20, 21, 40} {
+		if level, _ := d.Observe("ip:b", id, now); level != scraperLevelNone {
+			t.Fatalf("song %d: level %s", id, scraperLevelNames[level])
+		}
+	}
+}
+
+func TestScraperBlockAndDecay(t *testing.T) {
+	cfg := testScraperConfig()
+	cfg.BurstLimit = 1
+	d := NewScraperDetector(cfg)
+	now := time.Now()
+
+	var level int
+	var blockedUntil time.Time
+	for i := 0; i < 6; i++ {
+		level, blockedUntil = d.Observe("ip:a", 0, now)
+	}
+	if level != scraperLevelBlock || !blockedUntil.Equal(now.Add(cfg.BlockFor)) {
+		t.Fatalf("after three bursts: level %s until %v", scraperLevelNames[level], blockedUntil)
+	}
+	// После блокировки - challenge, через Cooldown без нарушений - throttle
+	after := blockedUntil.Add(time.Second)
+	if level, _ := d.Observe("ip:a", 0, after); level != scraperLevelChallenge {
+		t.Fatalf("after block: level %s, want challenge", scraperLevelNames[level])
+	}
+	if level, _ := d.Observe("ip:a", 0, blockedUntil.Add(cfg.Cooldown+time.Second)); level != scraperLevelThrottle {
+		t.Fatalf("after cooldown: level %s, want throttle", scraperLevelNames[level])
+	}
+}
+
+func TestScraperDetectionIdentifiesClients(t *testing.T) {
+	setupTestDB(t)
+	prev := scrapers
+	cfg := testScraperConfig()
+	cfg.BurstLimit = 2
+	cfg.ThrottleRate = RateLimit{Rate: 0.001, Burst: 1}
+	scrapers = NewScraperDetector(cfg)
+	t.Cleanup(func() { scrapers = prev })
+	router := newTestRouter()
+
+	request := func(header, value string) int {
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		req.Header.Set(header, value)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Выдуманные ключи и поддельный X-Forwarded-For не делают из одного
+	// клиента разных: всплеск засчитывается адресу соединения
+	codes := []int{
+		request(apiKeyHeader, "fake-1"),
+		request(apiKeyHeader, "fake-2"),
+		request("X-Forwarded-For", "198.51.100.1"),
+		request("X-Forwarded-For", "198.51.100.2"),
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[3] != http.StatusTooManyRequests {
+		t.Fatalf("status codes = %v, want the client throttled", codes)
+	}
+	report := scrapers.Report(false, time.Now())
+	if len(report.Clients) != 1 || report.Clients[0].Client != "ip:192.0.2.1" {
+		t.Fatalf("report = %+v", report.Clients)
+	}
+
+	// Действующий ключ - отдельный клиент
+	raw := "scraper-test-key"
+	key := APIKey{Name: "ci", Prefix: raw[:apiKeyPrefixLen], KeyHash: hashAPIKey(raw), Role: RoleReader}
+	if err := GetDB().Create(&key).Error; err != nil {
+		t.Fatal(err)
+	}
+	if code := request(apiKeyHeader, raw); code != http.StatusOK {
+		t.Fatalf("valid key: status %d", code)
+	}
+	report = scrapers.Report(true, time.Now())
+	found := false
+	for _, cl := range report.Clients {
+		found = found || cl.Client == fmt.Sprintf("key:%d", key.ID)
+	}
+	if !found {
+		t.Fatalf("report = %+v, want key:%d", report.Clients, key.ID)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LyricMatch - фрагмент куплета, в котором найден искомый текст
+type LyricMatch struct {
+	ID       PublicID `json:"id" extensions:"x-public-id"`
+	Group    string   `json:"group"`
+	SongName string   `json:"song"`
+	Verse    int      `json:"verse"`
+	Snippet  string   `json:"snippet"`
+}
+
+// Куплеты песни с номерами; текст экранируется до подсветки,
+// чтобы в ответе не было других тегов, кроме <em>
+const versesJoin = `CROSS JOIN LATERAL regexp_split_to_table(` +
+	`replace(replace(replace(songs.text, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), E'\n\n'` +
+	`) WITH ORDINALITY AS verses(body, n)`
+
+// Условие по всему тексту песни совпадает с выражением индекса
+// idx_songs_text_fts: куплет с искомыми словами есть только в песне, текст
+// которой содержит их все
+const songTextMatch = `to_tsvector('simple', songs.text) @@ plainto_tsquery('simple', ?)`
+
+// searchLyrics ищет текст по куплетам и отвечает фрагментами с подсветкой.
+// Песни сначала отбираются по индексу, на куплеты делятся только найденные.
+func searchLyrics(c *gin.Context, filter SongFilter, offset, limit int) {
+	term := filter.Text
+	query := dbFor(c).Table("songs").
+		Select(`songs.id, songs."group", songs.song_name, verses.n AS verse, `+
+			`ts_headline('simple', verses.body, plainto_tsquery('simple', ?), 'StartSel=<em>, StopSel=</em>, HighlightAll=true') AS snippet`, term).
+		Joins(versesJoin).
+		Where("songs.deleted_at IS NULL").
+		// Архивный текст сжат и не ищется, см. archive.go
+		Where("songs.archived = ?", false).
+		Where(songTextMatch, term).
+		Where(`to_tsvector('simple', verses.body) @@ plainto_tsquery('simple', ?)`, term)
+
+	query = songFilterSet(filter, "songs").Apply(query)
+	// Фрагменты - тот же текст, поэтому скрытые тексты в поиск не попадают
+	if restriction := regionRestriction(c); restriction != nil {
+		query = restriction.Scope(query, "songs")
+		if restriction.HideExplicitLyrics {
+			query = query.Where("songs.explicit = ?", false)
+		}
+	}
+
+	var matches []LyricMatch
+	result := query.Order("songs.id, verses.n").Offset(offset).Limit(limit).Scan(&matches)
+	if result.Error != nil {
+		logEntry(c).WithError(result.Error).Error("Failed to search lyrics")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch songs")
+		return
+	}
+	if len(matches) == 0 && emptySongs404 {
+		writeNoSongs(c)
+		return
+	}
+	if matches == nil {
+		matches = []LyricMatch{}
+	}
+	c.JSON(http.StatusOK, matches)
+}
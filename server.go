@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const shutdownTimeout = 15 * time.Second
+
+// serve запускает HTTP-сервер: обычный, с сертификатом из файлов
+// или с автоматическим получением сертификатов через ACME (Let's Encrypt).
+// После отмены ctx сервер дожидается текущих запросов и возвращает nil.
+func serve(ctx context.Context, cfg Config, handler http.Handler) error {
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// Shutdown не ждет WebSocket-соединений; их закрывает шина событий
+	server.RegisterOnShutdown(songEvents.Close)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- listen(server, cfg)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	logrus.Info("Shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// listen выбирает режим TLS по конфигурации
+func listen(server *http.Server, cfg Config) error {
+	switch {
+	case cfg.AutocertDomains != "":
+		domains := strings.Split(cfg.AutocertDomains, ",")
+		for i := range domains {
+			domains[i] = strings.TrimSpace(domains[i])
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		// HTTP-01 проверка и редирект на HTTPS
+		go func() {
+			if err := http.ListenAndServe(":80", manager.HTTPHandler(nil)); err != nil {
+				logrus.WithError(err).Error("ACME HTTP challenge listener stopped")
+			}
+		}()
+
+		server.Addr = ":443"
+		server.TLSConfig = manager.TLSConfig()
+		server.TLSConfig.MinVersion = tls.VersionTLS12
+		logrus.WithField("domains", domains).Info("Serving HTTPS with ACME certificates")
+		return server.ListenAndServeTLS("", "")
+
+	case cfg.TLSCertFile != "" && cfg.TLSKeyFile != "":
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		logrus.WithField("addr", server.Addr).Info("Serving HTTPS")
+		return server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+
+	default:
+		logrus.WithField("addr", server.Addr).Info("Serving HTTP")
+		return server.ListenAndServe()
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	sessionCookie = "musik_session"
+	sessionHeader = "X-Session-Token"
+	// Cookie живет год; при каждом запросе срок не продлевается
+	sessionCookieMaxAge = 365 * 24 * 60 * 60
+)
+
+// Структура AnonymousSession (сессия гостя). Избранное и история гостя
+// привязаны к ней, пока он не войдет. Как и у API-ключей, хранится только
+// хеш токена.
+type AnonymousSession struct {
+	ID         int       `json:"id" gorm:"primaryKey"`
+	TokenHash  string    `json:"-" gorm:"uniqueIndex;not null"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+}
+
+// listener - владелец избранного и истории: пользователь или сессия гостя.
+// Пустой listener - гость без сессии, у него ничего нет.
+type listener struct {
+	UserID    *int
+	SessionID *int
+}
+
+func (l listener) empty() bool {
+	return l.UserID == nil && l.SessionID == nil
+}
+
+// scope ограничивает запрос записями владельца
+func (l listener) scope(q *gorm.DB) *gorm.DB {
+	if l.UserID != nil {
+		return q.Where("user_id = ?", *l.UserID)
+	}
+	return q.Where("session_id = ?", *l.SessionID)
+}
+
+// sessionToken читает токен гостя из заголовка X-Session-Token или cookie
+func sessionToken(c *gin.Context) string {
+	if token := c.GetHeader(sessionHeader); token != "" {
+		return token
+	}
+	token, _ := c.Cookie(sessionCookie)
+	return token
+}
+
+// findSession ищет сессию по токену и отмечает ее использование
+func findSession(db *gorm.DB, token string) (*AnonymousSession, error) {
+	var session AnonymousSession
+	if err := db.Where("token_hash = ?", hashAPIKey(token)).First(&session).Error; err != nil {
+		return nil, err
+	}
+	db.Model(&session).UpdateColumn("last_seen_at", time.Now())
+	return &session, nil
+}
+
+// startSession создает сессию гостя и отдает токен в cookie и в заголовке
+// X-Session-Token - для клиентов без cookie
+func startSession(c *gin.Context) (*AnonymousSession, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	raw := hex.EncodeToString(b)
+	session := AnonymousSession{TokenHash: hashAPIKey(raw), LastSeenAt: time.Now()}
+	if err := dbFor(c).Create(&session).Error; err != nil {
+		return nil, err
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, raw, sessionCookieMaxAge, "/", "", c.Request.TLS != nil, true)
+	c.Header(sessionHeader, raw)
+	return &session, nil
+}
+
+// listenerFor определяет владельца по пользователю или сессии гостя. С
+// create гостю без действующей сессии она создается. При ошибке отвечает
+// клиенту сам и возвращает false.
+func listenerFor(c *gin.Context, create bool) (listener, bool) {
+	if userID, ok := currentUserID(c); ok {
+		return listener{UserID: &userID}, true
+	}
+	if token := sessionToken(c); token != "" {
+		session, err := findSession(dbFor(c), token)
+		if err == nil {
+			return listener{SessionID: &session.ID}, true
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logEntry(c).WithError(err).Error("Failed to fetch session")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch session")
+			return listener{}, false
+		}
+		// Неизвестный токен - как его отсутствие: сессию могли уже слить с аккаунтом
+	}
+	if !create {
+		return listener{}, true
+	}
+	session, err := startSession(c)
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to start session")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to start session")
+		return listener{}, false
+	}
+	return listener{SessionID: &session.ID}, true
+}
+
+// Итог переноса данных гостя в аккаунт
+type SessionMergeResult struct {
+	Favorites int `json:"favorites"` // перенесено в избранное; уже бывшие там песни не считаются
+	History   int `json:"history"`
+}
+
+// mergeSession переносит избранное и историю сессии пользователю и удаляет
+// сессию. Песни, которые уже есть в избранном пользователя, не дублируются.
+func mergeSession(db *gorm.DB, sessionID, userID int) (SessionMergeResult, error) {
+	var result SessionMergeResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		owned := tx.Model(&Favorite{}).Select("song_id").Where("user_id = ?", userID)
+		err := tx.Where("session_id = ? AND song_id IN (?)", sessionID, owned).Delete(&Favorite{}).Error
+		if err != nil {
+			return err
+		}
+		moved := tx.Model(&Favorite{}).Where("session_id = ?", sessionID).
+			Updates(map[string]interface{}{"user_id": userID, "session_id": nil})
+		if moved.Error != nil {
+			return moved.Error
+		}
+		result.Favorites = int(moved.RowsAffected)
+
+		moved = tx.Model(&ListenEntry{}).Where("session_id = ?", sessionID).
+			Updates(map[string]interface{}{"user_id": userID, "session_id": nil})
+		if moved.Error != nil {
+			return moved.Error
+		}
+		result.History = int(moved.RowsAffected)
+		if err := trimHistory(tx, listener{UserID: &userID}); err != nil {
+			return err
+		}
+		return tx.Delete(&AnonymousSession{}, sessionID).Error
+	})
+	return result, err
+}
+
+// clearSessionCookie удаляет cookie слитой сессии
+func clearSessionCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+}
+
+// mergeSessionOnLogin сливает сессию гостя при входе. Ошибка не мешает
+// входу: данные остаются в сессии, и их можно перенести через
+// POST /me/session/merge.
+func mergeSessionOnLogin(c *gin.Context, userID int) {
+	token := sessionToken(c)
+	if token == "" {
+		return
+	}
+	session, err := findSession(dbFor(c), token)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return
+	}
+	if err == nil {
+		_, err = mergeSession(dbFor(c), session.ID, userID)
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Warn("Failed to merge anonymous session on login")
+		return
+	}
+	clearSessionCookie(c)
+}
+
+// @Summary Merge anonymous session
+// @Description Fold the favorites and listening history of an anonymous session into the signed-in account and delete the session. The session token is taken from the X-Session-Token header or the session cookie. Songs already in the account's favorites are not duplicated. Login does this automatically when the request carries a session.
+// @ID merge-session
+// @Produce  json
+// @Param X-Session-Token header string false "Anonymous session token, if not sent as a cookie"
+// @Success 200 {object} SessionMergeResult
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /me/session/merge [post]
+func MergeSession(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		abortWithError(c, http.StatusForbidden, codeForbidden, "Only user accounts can take over a session")
+		return
+	}
+	token := sessionToken(c)
+	if token == "" {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Missing session token")
+		return
+	}
+	session, err := findSession(dbFor(c), token)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch session")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to merge session")
+		return
+	}
+	result, err := mergeSession(dbFor(c), session.ID, userID)
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to merge session")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to merge session")
+		return
+	}
+	clearSessionCookie(c)
+	c.JSON(http.StatusOK, result)
+}
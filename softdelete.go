@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Удаленная песня остается в songs с deleted_at и скрыта от запросов GORM.
+// Ее можно восстановить, пока задача song_purge не удалит ее окончательно
+// по истечении SONG_RETENTION.
+
+const jobKindSongPurge = "song_purge"
+
+const (
+	songPurgeInterval  = time.Hour
+	songPurgeBatchSize = 500
+)
+
+const auditActionRestore = "restore"
+
+// includeDeletedSongs разбирает ?include_deleted=true; удаленные песни видят
+// только администраторы. При ошибке отвечает клиенту сам и возвращает false.
+func includeDeletedSongs(c *gin.Context) (include, ok bool) {
+	include, _ = strconv.ParseBool(c.Query("include_deleted"))
+	if include && currentRole(c) != RoleAdmin {
+		abortWithError(c, http.StatusForbidden, codeForbidden, "Only admins can list deleted songs")
+		return false, false
+	}
+	return include, true
+}
+
+// @Summary Restore song
+// @Description Restore a deleted song with its tags, links and archived text. Deleted songs can be restored until they are purged after SONG_RETENTION; a song with the same group and title added since then blocks the restore with 409. Publishes song.created.
+// @ID restore-song
+// @Produce  json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Success 200 {object} Song
+// @Failure 400 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /songs/{id}/restore [post]
+func RestoreSong(c *gin.Context) {
+	id, err := parseSongID(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
+		return
+	}
+
+	var song Song
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("deleted_at IS NOT NULL").First(&song, id).Error; err != nil {
+			return err
+		}
+		if !canModifySong(c, song) {
+			return errNotOwner
+		}
+		if err := tx.Unscoped().Model(&song).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		song.DeletedAt = gorm.DeletedAt{}
+		return recordAudit(tx, c, auditEntitySong, id, auditActionRestore, nil, song)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Deleted song not found")
+		return
+	}
+	if errors.Is(err, errNotOwner) {
+		abortWithError(c, http.StatusForbidden, codeNotOwner, "You can only change your own songs")
+		return
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		writeSongExists(c, song.Group, song.SongName)
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to restore song")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to restore song")
+		return
+	}
+	publishSongEventFor(c, songEventCreated, song)
+
+	c.JSON(http.StatusOK, publicSong(song))
+}
+
+// purgeDeletedSongsJob - обработчик задачи song_purge: окончательно удаляет
+// песни, удаленные раньше retention. Следующий запуск ставит
+// scheduleSongPurge, поэтому ошибка не прерывает расписание.
+func purgeDeletedSongsJob(retention time.Duration) JobHandler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		// Хранение без срока включили после постановки задачи
+		if retention <= 0 {
+			return nil
+		}
+		n, err := purgeDeletedSongs(GetDB().WithContext(ctx), time.Now().Add(-retention))
+		if n > 0 {
+			componentLogger(componentJobs).WithField("songs", n).Info("Purged deleted songs")
+		}
+		return err
+	}
+}
+
+// Строки, которые ссылаются на песню без внешнего ключа, и удаляются вместе
+// с ней. Теги и ссылки на площадки удаляет каскад, события прослушиваний
+// остаются в статистике.
+var songDependents = []interface{}{&ArchivedLyrics{}, &SongNote{}, &SongEnrichment{}, &ScheduledChange{}, &Favorite{}, &ListenEntry{}}
+
+// purgeDeletedSongs удаляет порциями песни, удаленные до cutoff, вместе со
+// songDependents; заявки артистов остаются без ссылки на песню
+func purgeDeletedSongs(db *gorm.DB, cutoff time.Time) (int, error) {
+	purged := 0
+	for {
+		var ids []int
+		err := db.Unscoped().Model(&Song{}).Where("deleted_at < ?", cutoff).
+			Order("id").Limit(songPurgeBatchSize).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return purged, err
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, model := range songDependents {
+				if err := tx.Where("song_id IN ?", ids).Delete(model).Error; err != nil {
+					return err
+				}
+			}
+			err := tx.Model(&SongSubmission{}).Where("song_id IN ?", ids).Update("song_id", nil).Error
+			if err != nil {
+				return err
+			}
+			return tx.Unscoped().Delete(&Song{}, ids).Error
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged += len(ids)
+	}
+}
+
+// scheduleSongPurge ставит задачу song_purge при запуске и затем каждые
+// songPurgeInterval, пока не отменен ctx. Задача ставится с ключом: пока
+// прежняя стоит в очереди, новая не добавляется, в том числе другими
+// экземплярами сервиса.
+func scheduleSongPurge(ctx context.Context, q *JobQueue) {
+	log := componentLogger(componentJobs)
+	go func() {
+		ticker := time.NewTicker(songPurgeInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := enqueueSongPurge(ctx, q); err != nil && ctx.Err() == nil {
+				log.WithError(err).Error("Failed to schedule song purge")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// enqueueSongPurge ставит задачу song_purge, если ее нет в очереди
+func enqueueSongPurge(ctx context.Context, q *JobQueue) (bool, error) {
+	return q.EnqueueUnique(ctx, jobKindSongPurge, jobKindSongPurge, struct{}{}, 0)
+}
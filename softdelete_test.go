@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPurgeDeletedSongsRemovesDependents(t *testing.T) {
+	conn := setupTestDB(t)
+	seedGoldenSongs(t)
+	userID := 7
+	for _, row := range []interface{}{
+		&SongNote{SongID: 2, Author: "admin", Body: "check the lyrics"},
+		&SongEnrichment{SongID: 2, Status: enrichmentStatusPending},
+		&ScheduledChange{SongID: 2, Status: scheduledPending, EffectiveAt: time.Now().Add(time.Hour)},
+		&Favorite{UserID: &userID, SongID: 2},
+		&ListenEntry{UserID: &userID, SongID: 2, PlayedAt: time.Now()},
+		&Favorite{UserID: &userID, SongID: 1},
+	} {
+		if err := conn.Create(row).Error; err != nil {
+			t.Fatalf("create %T: %v", row, err)
+		}
+	}
+	conn.Delete(&Song{}, 2)
+
+	purged, err := purgeDeletedSongs(conn, time.Now().Add(time.Minute))
+	if err != nil || purged != 1 {
+		t.Fatalf("purge = %d, %v; want 1 song", purged, err)
+	}
+	for _, model := range songDependents {
+		var left int64
+		conn.Model(model).Where("song_id = ?", 2).Count(&left)
+		if left != 0 {
+			t.Errorf("%T: %d rows of the purged song left", model, left)
+		}
+	}
+	// Строки живой песни не трогаются
+	var favorites int64
+	conn.Model(&Favorite{}).Where("song_id = ?", 1).Count(&favorites)
+	if favorites != 1 {
+		t.Errorf("favorites of song 1 = %d, want 1", favorites)
+	}
+}
+
+func TestSongPurgeEnqueuedOnce(t *testing.T) {
+	conn := setupTestDB(t)
+	q := NewJobQueue(conn, JobQueueConfig{Visibility: time.Minute, MaxAttempts: 1})
+	q.Register(jobKindSongPurge, func(ctx context.Context, payload json.RawMessage) error {
+		return errors.New("database is down")
+	})
+	ctx := context.Background()
+
+	for i, want := range []bool{true, false} {
+		added, err := enqueueSongPurge(ctx, q)
+		if err != nil || added != want {
+			t.Fatalf("enqueue %d: added=%t, err=%v; want %t", i+1, added, err, want)
+		}
+	}
+	var queued int64
+	conn.Model(&Job{}).Where("kind = ?", jobKindSongPurge).Count(&queued)
+	if queued != 1 {
+		t.Fatalf("%d purge jobs queued, want 1", queued)
+	}
+
+	// Провал задачи не останавливает расписание: следующий тик ставит новую
+	job, err := q.claim(ctx)
+	if err != nil || job == nil {
+		t.Fatalf("claim = %v, %v", job, err)
+	}
+	q.run(ctx, job)
+	if added, err := enqueueSongPurge(ctx, q); err != nil || !added {
+		t.Fatalf("enqueue after failure: added=%t, err=%v", added, err)
+	}
+	var failed int64
+	conn.Model(&Job{}).Where("kind = ? AND failed_at IS NOT NULL", jobKindSongPurge).Count(&failed)
+	if failed != 1 {
+		t.Errorf("%d failed purge jobs, want the failure kept", failed)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ключ контекста с общим числом песен для meta списка JSON:API
+const ctxSongsTotal = "songsTotal"
+
+// Больше разных фильтров кеш не хранит: сначала выбрасываются устаревшие
+// записи, если их нет - все
+const songCountCacheMaxEntries = 1024
+
+// songsTotal - meta списка JSON:API. Estimated - число взято из кеша или
+// статистики Postgres и могло отстать; ?exact=true пересчитывает его.
+type songsTotal struct {
+	Total     int64 `json:"total"`
+	Estimated bool  `json:"totalEstimated"`
+}
+
+// SongCountCache недолго хранит число песен по фильтру, чтобы COUNT(*) не
+// выполнялся на каждой странице списка
+type SongCountCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]songCountEntry
+}
+
+type songCountEntry struct {
+	count   int64
+	expires time.Time
+}
+
+// Кеш числа песен; nil - COUNT(*) на каждой странице
+var songCountCache *SongCountCache
+
+// NewSongCountCache возвращает nil, если TTL не задан
+func NewSongCountCache(ttl time.Duration) *SongCountCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &SongCountCache{ttl: ttl, entries: map[string]songCountEntry{}}
+}
+
+func (cc *SongCountCache) Get(key string) (int64, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	entry, ok := cc.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return 0, false
+	}
+	return entry.count, true
+}
+
+func (cc *SongCountCache) Put(key string, count int64) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	now := time.Now()
+	if len(cc.entries) >= songCountCacheMaxEntries {
+		for k, entry := range cc.entries {
+			if now.After(entry.expires) {
+				delete(cc.entries, k)
+			}
+		}
+		if len(cc.entries) >= songCountCacheMaxEntries {
+			clear(cc.entries)
+		}
+	}
+	cc.entries[key] = songCountEntry{count: count, expires: now.Add(cc.ttl)}
+}
+
+// songCountKey - фильтр и ограничения региона; json сортирует ключи map,
+// поэтому одинаковые фильтры дают одинаковый ключ
+func songCountKey(filter SongFilter, restriction *RegionRestriction, deleted bool) string {
+	key, _ := json.Marshal(struct {
+		Filter  SongFilter
+		Region  *RegionRestriction
+		Deleted bool
+	}{filter, restriction, deleted})
+	return string(key)
+}
+
+// countSongs считает песни списка для meta. Без фильтров в Postgres берется
+// оценка из pg_class.reltuples, с фильтрами - число из кеша; ?exact=true
+// выполняет COUNT(*) и обновляет кеш. Оценка учитывает и удаленные песни,
+// ожидающие очистки.
+func countSongs(c *gin.Context, filter SongFilter, restriction *RegionRestriction, deleted bool) (songsTotal, error) {
+	exact, _ := strconv.ParseBool(c.Query("exact"))
+	tx := readDBFor(c)
+	fs := songFilterSet(filter, "songs")
+	if !exact && len(fs.conds) == 0 && restriction == nil && tx.Dialector.Name() == "postgres" {
+		var estimate int64
+		err := tx.Raw("SELECT reltuples::bigint FROM pg_class WHERE oid = 'songs'::regclass").Scan(&estimate).Error
+		// -1 - таблица еще не анализировалась
+		if err == nil && estimate >= 0 {
+			return songsTotal{Total: estimate, Estimated: true}, nil
+		}
+	}
+
+	key := songCountKey(filter, restriction, deleted)
+	if !exact && songCountCache != nil {
+		if count, ok := songCountCache.Get(key); ok {
+			return songsTotal{Total: count, Estimated: true}, nil
+		}
+	}
+	query := fs.Apply(tx.Model(&Song{}))
+	if deleted {
+		query = query.Unscoped()
+	}
+	if restriction != nil {
+		query = restriction.Scope(query, "songs")
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return songsTotal{}, err
+	}
+	if songCountCache != nil {
+		songCountCache.Put(key, count)
+	}
+	return songsTotal{Total: count}, nil
+}
+
+// requestSongsTotal - число песен, посчитанное обработчиком списка
+func requestSongsTotal(c *gin.Context) *songsTotal {
+	if total, ok := c.Get(ctxSongsTotal); ok {
+		t := total.(songsTotal)
+		return &t
+	}
+	return nil
+}
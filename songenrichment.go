@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const jobKindEnrichment = "enrichment"
+
+// Статусы обогащения песни
+const (
+	enrichmentStatusPending  = "pending"
+	enrichmentStatusDone     = "done"
+	enrichmentStatusNotFound = "not_found" // песни нет ни в одном источнике
+	enrichmentStatusFailed   = "failed"    // источники не ответили за все попытки
+)
+
+// Структура SongEnrichment (ход фонового обогащения песни). Строка есть
+// только у песен, добавленных через очередь.
+type SongEnrichment struct {
+	SongID    PublicID  `json:"songId" extensions:"x-public-id" gorm:"primaryKey;autoIncrement:false"`
+	Status    string    `json:"status" gorm:"not null"`
+	Attempts  int       `json:"attempts" gorm:"not null;default:0"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type enrichmentPayload struct {
+	SongID int `json:"songId"`
+	// Заполнить только пустые поля, например у импортированных песен
+	MissingOnly bool `json:"missingOnly,omitempty"`
+}
+
+// addSongAsync сохраняет песню сразу и ставит обогащение в очередь, чтобы
+// медленный или недоступный источник не задерживал запись
+func addSongAsync(c *gin.Context, newSong *Song) {
+	newSong.EnrichmentPending = true
+	newSong.Explicit = profanity.Contains(newSong.Text)
+	setSongOwner(c, newSong)
+
+	songs := []Song{*newSong}
+	err := inSongTx(c, func(w *songWrite) error {
+		// Приоритет выше фоновых обновлений: результата ждет клиент
+		return w.createSongs(songs, []bool{true}, enrichmentQueue{priority: 1})
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		writeSongExists(c, newSong.Group, newSong.SongName)
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to create song in database")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to add song")
+		return
+	}
+	*newSong = songs[0]
+
+	c.Header("Location", "/songs/"+encodeSongID(newSong.ID)+"/enrichment")
+	writeSong(c, http.StatusAccepted, *newSong)
+}
+
+// queueSongEnrichment ставит задачу обогащения; если очередь ее не приняла,
+// статус сразу становится failed
+func queueSongEnrichment(c *gin.Context, payload enrichmentPayload, priority int) {
+	if err := jobs.Enqueue(c.Request.Context(), jobKindEnrichment, payload, priority); err != nil {
+		componentEntry(c, componentEnrichment).WithError(err).Error("Failed to queue song enrichment")
+		failed := map[string]interface{}{"status": enrichmentStatusFailed, "error": err.Error()}
+		if err := dbFor(c).Model(&SongEnrichment{}).Where("song_id = ?", payload.SongID).Updates(failed).Error; err != nil {
+			logEntry(c).WithError(err).Error("Failed to update enrichment status")
+		}
+	}
+}
+
+// enrichSongJob - обработчик задачи enrichment. Ошибка источника
+// возвращается очереди для повтора; после последней попытки статус - failed.
+func enrichSongJob(info SongInfoProvider) JobHandler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var p enrichmentPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return err
+		}
+		db := GetDB().WithContext(ctx)
+		var song Song
+		if err := db.First(&song, p.SongID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Песню удалили, пока задача ждала очереди
+				return nil
+			}
+			return err
+		}
+
+		detail, err := info.SongDetail(ctx, song.Group, song.SongName)
+		if errors.Is(err, ErrInfoNotFound) {
+			song.EnrichmentPending = false
+			return finishEnrichment(db, song, []string{"enrichment_pending"}, enrichmentStatusNotFound)
+		}
+		if err != nil {
+			return failEnrichment(db, song.ID, err)
+		}
+
+		if p.MissingOnly {
+			fillSongDetail(&song, detail)
+		} else {
+			applySongDetail(&song, detail)
+		}
+		if err := findYouTubeLink(ctx, &song); err != nil {
+			componentLogger(componentEnrichment).WithError(err).WithField(fieldSongID, song.ID).Warn("Failed to search YouTube")
+		}
+		song.Explicit = profanity.Contains(song.Text)
+		song.EnrichmentPending = false
+		columns := []string{
+			"release_date", "text", "link", "link_confidence", "enrichment_sources",
+			"album", "duration_ms", "explicit", "enrichment_pending",
+		}
+		if err := finishEnrichment(db, song, columns, enrichmentStatusDone); err != nil {
+			return err
+		}
+
+		log := componentLogger(componentEnrichment).WithField(fieldSongID, song.ID)
+		if err := enqueueStatsRefresh(ctx, song.ID); err != nil {
+			log.WithError(err).Warn("Failed to queue Last.fm statistics refresh")
+		}
+		if err := enqueueLinksResolve(ctx, song.ID); err != nil {
+			log.WithError(err).Warn("Failed to queue streaming links resolution")
+		}
+		if err := publishSongEvent(ctx, db, songEventUpdated, song); err != nil {
+			log.WithError(err).Warn("Failed to publish webhook event")
+		}
+		return nil
+	}
+}
+
+// finishEnrichment сохраняет поля песни и итоговый статус одной транзакцией
+func finishEnrichment(db *gorm.DB, song Song, columns []string, status string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var before, after Song
+		if err := tx.First(&before, song.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&song).Select(columns).Updates(&song).Error; err != nil {
+			return err
+		}
+		// Изменения из фона тоже пишутся в журнал, иначе as_of их не откатит
+		if err := tx.First(&after, song.ID).Error; err != nil {
+			return err
+		}
+		if err := recordAuditAs(tx, auditActorEnrichment, "", auditEntitySong, song.ID, auditActionUpdate, before, after); err != nil {
+			return err
+		}
+		return tx.Model(&SongEnrichment{}).Where("song_id = ?", song.ID).Updates(map[string]interface{}{
+			"status": status, "attempts": gorm.Expr("attempts + 1"), "error": "",
+		}).Error
+	})
+}
+
+// failEnrichment записывает неудачную попытку и возвращает ошибку очереди
+func failEnrichment(db *gorm.DB, songID int, cause error) error {
+	var status SongEnrichment
+	if err := db.First(&status, "song_id = ?", songID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	status.Attempts++
+	updates := map[string]interface{}{"attempts": status.Attempts, "error": cause.Error()}
+	if jobs != nil && status.Attempts >= jobs.cfg.MaxAttempts {
+		updates["status"] = enrichmentStatusFailed
+	}
+	if err := db.Model(&SongEnrichment{}).Where("song_id = ?", songID).Updates(updates).Error; err != nil {
+		return err
+	}
+	return cause
+}
+
+// @Summary Get song enrichment status
+// @Description Get the progress of background enrichment: pending, done, not_found or failed. Songs enriched while they were added report done, or pending if the info API was unavailable.
+// @ID get-song-enrichment
+// @Produce  json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Success 200 {object} SongEnrichment
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /songs/{id}/enrichment [get]
+func GetSongEnrichment(c *gin.Context) {
+	id, err := parseSongID(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
+		return
+	}
+	var song Song
+	if err := dbFor(c).Select("id", "enrichment_pending").First(&song, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithError(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+			return
+		}
+		logEntry(c).WithError(err).Error("Failed to fetch song")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch enrichment status")
+		return
+	}
+	var status SongEnrichment
+	err = dbFor(c).First(&status, "song_id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		status = SongEnrichment{SongID: PublicID(id), Status: enrichmentStatusDone}
+		if song.EnrichmentPending {
+			status.Status = enrichmentStatusPending
+		}
+		err = nil
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch enrichment status")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch enrichment status")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Ручная сериализация Song без рефлексии. Вывод побайтно совпадает с
+// encoding/json (включая экранирование <, >, & и U+2028/U+2029), это
+// проверяет songjson_test.go. В обработчиках используется только в сборке
+// с тегом fastjson, см. songjson_fast.go.
+
+const jsonContentType = "application/json; charset=utf-8"
+
+var jsonBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 4096)
+		return &b
+	},
+}
+
+// appendSongsJSON дописывает в dst массив песен
+func appendSongsJSON(dst []byte, songs []Song) []byte {
+	if songs == nil {
+		return append(dst, "null"...)
+	}
+	dst = append(dst, '[')
+	for i := range songs {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendSongJSON(dst, &songs[i])
+	}
+	return append(dst, ']')
+}
+
+// appendSongJSON дописывает в dst объект песни; порядок полей как в структуре Song
+func appendSongJSON(dst []byte, s *Song) []byte {
+	dst = append(dst, `{"id":`...)
+	if publicIDs != nil {
+		dst = appendJSONString(dst, publicIDs.Encode(s.ID))
+	} else {
+		dst = strconv.AppendInt(dst, int64(s.ID), 10)
+	}
+	dst = append(dst, `,"group":`...)
+	dst = appendJSONString(dst, s.Group)
+	dst = append(dst, `,"song":`...)
+	dst = appendJSONString(dst, s.SongName)
+	dst = append(dst, `,"releaseDate":`...)
+	dst = appendJSONString(dst, s.ReleaseDate.String())
+	dst = append(dst, `,"text":`...)
+	dst = appendJSONString(dst, s.Text)
+	dst = append(dst, `,"link":`...)
+	dst = appendJSONString(dst, s.Link)
+	dst = append(dst, `,"linkConfidence":`...)
+	if s.LinkConfidence == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = strconv.AppendFloat(dst, *s.LinkConfidence, 'f', -1, 64)
+	}
+	dst = append(dst, `,"album":`...)
+	dst = appendJSONString(dst, s.Album)
+	dst = append(dst, `,"albumId":`...)
+	if s.AlbumID == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = strconv.AppendInt(dst, int64(*s.AlbumID), 10)
+	}
+	dst = append(dst, `,"albumPosition":`...)
+	dst = strconv.AppendInt(dst, int64(s.AlbumPosition), 10)
+	dst = append(dst, `,"durationMs":`...)
+	dst = strconv.AppendInt(dst, int64(s.DurationMs), 10)
+	dst = append(dst, `,"explicit":`...)
+	dst = strconv.AppendBool(dst, s.Explicit)
+	dst = append(dst, `,"ownerId":`...)
+	if s.OwnerID == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = strconv.AppendInt(dst, int64(*s.OwnerID), 10)
+	}
+	dst = append(dst, `,"enrichmentPending":`...)
+	dst = strconv.AppendBool(dst, s.EnrichmentPending)
+	if len(s.EnrichmentSources) > 0 {
+		sources, err := json.Marshal(s.EnrichmentSources)
+		if err == nil {
+			dst = append(dst, `,"enrichmentSources":`...)
+			dst = append(dst, sources...)
+		}
+	}
+	dst = append(dst, `,"archived":`...)
+	dst = strconv.AppendBool(dst, s.Archived)
+	dst = append(dst, `,"listeners":`...)
+	dst = strconv.AppendInt(dst, s.Listeners, 10)
+	dst = append(dst, `,"playcount":`...)
+	dst = strconv.AppendInt(dst, s.Playcount, 10)
+	dst = append(dst, `,"statsUpdatedAt":`...)
+	if s.StatsUpdatedAt == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = append(dst, '"')
+		dst = s.StatsUpdatedAt.AppendFormat(dst, time.RFC3339Nano)
+		dst = append(dst, '"')
+	}
+	dst = append(dst, `,"version":`...)
+	dst = strconv.AppendInt(dst, int64(s.Version), 10)
+	// Связи запрашиваются редко, их сериализует encoding/json
+	if s.Owner != nil {
+		owner, err := json.Marshal(s.Owner)
+		if err == nil {
+			dst = append(dst, `,"owner":`...)
+			dst = append(dst, owner...)
+		}
+	}
+	if len(s.Tags) > 0 {
+		tags, err := json.Marshal(s.Tags)
+		if err == nil {
+			dst = append(dst, `,"tags":`...)
+			dst = append(dst, tags...)
+		}
+	}
+	if len(s.Links) > 0 {
+		links, err := json.Marshal(s.Links)
+		if err == nil {
+			dst = append(dst, `,"links":`...)
+			dst = append(dst, links...)
+		}
+	}
+	return append(dst, '}')
+}
+
+// appendLyricsPageJSON дописывает ответ GetSongText в порядке полей LyricsPage
+func appendLyricsPageJSON(dst []byte, p LyricsPage) []byte {
+	dst = append(dst, `{"text":`...)
+	dst = appendJSONString(dst, p.Text)
+	dst = append(dst, `,"page":`...)
+	dst = strconv.AppendInt(dst, int64(p.Page), 10)
+	dst = append(dst, `,"limit":`...)
+	dst = strconv.AppendInt(dst, int64(p.Limit), 10)
+	dst = append(dst, `,"totalPages":`...)
+	dst = strconv.AppendInt(dst, int64(p.TotalPages), 10)
+	dst = append(dst, `,"totalVerses":`...)
+	dst = strconv.AppendInt(dst, int64(p.TotalVerses), 10)
+	return append(dst, '}')
+}
+
+const jsonHex = "0123456789abcdef"
+
+// appendJSONString экранирует строку так же, как encoding/json
+func appendJSONString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', jsonHex[b>>4], jsonHex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i++
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', jsonHex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
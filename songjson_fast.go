@@ -0,0 +1,34 @@
+//go:build fastjson
+
+package main
+
+import "github.com/gin-gonic/gin"
+
+// Буферы крупнее этого не возвращаются в пул, чтобы редкий большой ответ
+// не держал память
+const maxPooledJSONBuf = 1 << 20
+
+// writeSongsJSON отдает список песен ручным сериализатором без рефлексии
+func writeSongsJSON(c *gin.Context, status int, songs []Song) {
+	writePooledJSON(c, status, func(buf []byte) []byte { return appendSongsJSON(buf, songs) })
+}
+
+// appendSongElement дописывает песню элементом потокового массива
+func appendSongElement(dst []byte, song *Song) ([]byte, error) {
+	return appendSongJSON(dst, song), nil
+}
+
+// writeLyricsText отдает страницу текста песни
+func writeLyricsText(c *gin.Context, status int, page LyricsPage) {
+	writePooledJSON(c, status, func(buf []byte) []byte { return appendLyricsPageJSON(buf, page) })
+}
+
+func writePooledJSON(c *gin.Context, status int, appendBody func([]byte) []byte) {
+	bp := jsonBufPool.Get().(*[]byte)
+	buf := appendBody((*bp)[:0])
+	c.Data(status, jsonContentType, buf)
+	if cap(buf) <= maxPooledJSONBuf {
+		*bp = buf
+		jsonBufPool.Put(bp)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !fastjson
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+)
+
+// В обычной сборке ответы сериализует encoding/json через gin
+func writeSongsJSON(c *gin.Context, status int, songs []Song) {
+	c.JSON(status, publicSongs(songs))
+}
+
+// appendSongElement дописывает песню элементом потокового массива
+func appendSongElement(dst []byte, song *Song) ([]byte, error) {
+	b, err := json.Marshal(publicSong(*song))
+	return append(dst, b...), err
+}
+
+func writeLyricsText(c *gin.Context, status int, page LyricsPage) {
+	c.JSON(status, page)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+var trickyStrings = []string{
+	"",
+	"plain",
+	`quote " and backslash \`,
+	"<script>alert('x') && 1</script>",
+	"tabs\tnew\nlines\r\n\b\f\x00\x1f",
+	"юникод и эмодзи 🎸",
+	"line\u2028paragraph\u2029",
+	"invalid \xff\xfe utf-8",
+}
+
+func TestAppendSongJSONMatchesEncodingJSON(t *testing.T) {
+	owner := 7
+	confidence := 0.85
+	updated := time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.FixedZone("MSK", 3*60*60))
+	for _, s := range trickyStrings {
+		for _, song := range []Song{
+			{ID: 1, Group: s, SongName: s, ReleaseDate: mustReleaseDate("16.07.2006"), Text: s, Link: s, LinkConfidence: &confidence},
+			{ID: 42, Group: "Muse", SongName: s, Explicit: true, OwnerID: &owner, EnrichmentPending: true,
+				EnrichmentSources: map[string]string{"text": s, "link": "youtube"},
+				Owner:             &User{ID: owner, Username: s, Role: RoleEditor}},
+			{ID: 43, Listeners: 1234567, Playcount: 89012345, StatsUpdatedAt: &updated,
+				Tags:  []SongTag{{ID: 1, SongID: 43, Name: s}, {ID: 2, SongID: 43, Name: "rock"}},
+				Links: SongLinks{{ID: 1, SongID: 43, Platform: platformDeezer, URL: s}, {ID: 2, SongID: 43, Platform: platformSpotify, URL: "https://open.spotify.com/track/1"}}},
+		} {
+			want, err := json.Marshal(song)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := appendSongJSON(nil, &song); string(got) != string(want) {
+				t.Errorf("song %q:\n got  %s\n want %s", s, got, want)
+			}
+		}
+
+		page := LyricsPage{Text: s, Page: 2, Limit: 10, TotalPages: 3, TotalVerses: 1}
+		want, _ := json.Marshal(page)
+		if got := appendLyricsPageJSON(nil, page); string(got) != string(want) {
+			t.Errorf("text %q:\n got  %s\n want %s", s, got, want)
+		}
+	}
+
+	for _, songs := range [][]Song{nil, {}, {{ID: 1}, {ID: 2, Group: "Queen"}}} {
+		want, _ := json.Marshal(songs)
+		if got := appendSongsJSON(nil, songs); string(got) != string(want) {
+			t.Errorf("songs %v:\n got  %s\n want %s", songs, got, want)
+		}
+	}
+}
+
+// Сравнение: go test -run '^$' -bench SongsJSON -benchmem
+func benchmarkSongs() []Song {
+	songs := make([]Song, 10)
+	for i := range songs {
+		songs[i] = Song{
+			ID: i + 1, Group: "Muse", SongName: "Supermassive Black Hole", ReleaseDate: mustReleaseDate("16.07.2006"),
+			Text: strings.Repeat("Ooh baby, don't you know I suffer?\n", 20),
+			Link: "https://www.youtube.com/watch?v=Xsp3_a-PMTw",
+		}
+	}
+	return songs
+}
+
+func BenchmarkSongsJSONEncodingJSON(b *testing.B) {
+	songs := benchmarkSongs()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(songs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSongsJSONAppend(b *testing.B) {
+	songs := benchmarkSongs()
+	b.ReportAllocs()
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		buf = appendSongsJSON(buf[:0], songs)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const jobKindLinksResolve = "links_resolve"
+
+// Площадки в ключах links; имена как в Odesli
+const (
+	platformSpotify    = "spotify"
+	platformAppleMusic = "appleMusic"
+	platformDeezer     = "deezer"
+	platformYouTube    = "youtube"
+)
+
+// Значения LINK_PROVIDERS
+const (
+	linkProviderOdesli = "odesli"
+	linkProviderDeezer = "deezer"
+	linkProviderITunes = "itunes"
+)
+
+// Структура SongLink (ссылка на песню на одной площадке)
+type SongLink struct {
+	ID       int    `gorm:"primaryKey"`
+	SongID   int    `gorm:"not null;uniqueIndex:idx_song_link_platform"`
+	Platform string `gorm:"not null;uniqueIndex:idx_song_link_platform"`
+	URL      string `gorm:"not null"`
+}
+
+// SongLinks сериализуется картой площадка -> ссылка
+type SongLinks []SongLink
+
+func (links SongLinks) MarshalJSON() ([]byte, error) {
+	m := make(map[string]string, len(links))
+	for _, link := range links {
+		m[link.Platform] = link.URL
+	}
+	return json.Marshal(m)
+}
+
+// LinkSearcher ищет песню на одной площадке. ErrInfoNotFound - песни там нет.
+type LinkSearcher interface {
+	Platform() string
+	FindTrack(ctx context.Context, group, song string) (string, error)
+}
+
+// LinkResolver собирает ссылки на площадки: сначала Odesli по уже известной
+// ссылке песни, затем поиск по площадкам, которых Odesli не вернул
+type LinkResolver struct {
+	odesli   *OdesliClient
+	searches []LinkSearcher
+}
+
+// Сборщик ссылок; nil - ссылки на площадки не собираются
+var songLinks *LinkResolver
+
+// LinkProvidersConfig - источники ссылок на площадки
+type LinkProvidersConfig struct {
+	Providers string // через запятую: odesli, deezer, itunes; пусто - выключено
+	Odesli    OdesliConfig
+	DeezerURL string
+	ITunesURL string
+	Country   string // страна магазина для Odesli и iTunes
+	Timeout   time.Duration
+}
+
+// NewLinkResolver создает сборщик из списка источников
+func NewLinkResolver(cfg LinkProvidersConfig) (*LinkResolver, error) {
+	if cfg.Providers == "" {
+		return nil, nil
+	}
+	resolver := &LinkResolver{}
+	for _, name := range strings.Split(cfg.Providers, ",") {
+		switch strings.TrimSpace(name) {
+		case linkProviderOdesli:
+			resolver.odesli = NewOdesliClient(cfg.Odesli, cfg.Country, cfg.Timeout)
+		case linkProviderDeezer:
+			resolver.searches = append(resolver.searches, newDeezerSearch(cfg.DeezerURL, cfg.Timeout))
+		case linkProviderITunes:
+			resolver.searches = append(resolver.searches, newITunesSearch(cfg.ITunesURL, cfg.Country, cfg.Timeout))
+		default:
+			return nil, fmt.Errorf("unknown link provider %q", name)
+		}
+	}
+	return resolver, nil
+}
+
+// Resolve возвращает найденные ссылки по площадкам. Ошибка возвращается,
+// только если не удалось опросить ни один источник.
+func (r *LinkResolver) Resolve(ctx context.Context, song Song) (map[string]string, error) {
+	links := map[string]string{}
+	if platform := linkPlatform(song.Link); platform != "" {
+		links[platform] = song.Link
+	}
+
+	var errs []error
+	// Odesli понимает только ссылки на известные площадки
+	if r.odesli != nil && len(links) > 0 {
+		found, err := r.odesli.Links(ctx, song.Link)
+		if err != nil && !errors.Is(err, ErrInfoNotFound) {
+			errs = append(errs, err)
+		}
+		for platform, link := range found {
+			links[platform] = link
+		}
+	}
+	for _, search := range r.searches {
+		if _, ok := links[search.Platform()]; ok {
+			continue
+		}
+		link, err := search.FindTrack(ctx, song.Group, song.SongName)
+		if errors.Is(err, ErrInfoNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		links[search.Platform()] = link
+	}
+	if len(links) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return links, nil
+}
+
+// linkPlatform определяет площадку по адресу ссылки
+func linkPlatform(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimPrefix(u.Hostname(), "www.")
+	switch host {
+	case "open.spotify.com":
+		return platformSpotify
+	case "music.apple.com":
+		return platformAppleMusic
+	case "deezer.com":
+		return platformDeezer
+	case "youtube.com", "youtu.be", "m.youtube.com":
+		return platformYouTube
+	}
+	return ""
+}
+
+type linksResolvePayload struct {
+	SongID int `json:"songId"`
+}
+
+// enqueueLinksResolve ставит в очередь сбор ссылок на площадки
+func enqueueLinksResolve(ctx context.Context, songID int) error {
+	if songLinks == nil || jobs == nil {
+		return nil
+	}
+	return jobs.Enqueue(ctx, jobKindLinksResolve, linksResolvePayload{SongID: songID}, 0)
+}
+
+// resolveLinksJob - обработчик задачи links_resolve
+func resolveLinksJob(ctx context.Context, payload json.RawMessage) error {
+	var p linksResolvePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	return resolveSongLinks(ctx, GetDB().WithContext(ctx), songLinks, p.SongID)
+}
+
+// resolveSongLinks сохраняет найденные ссылки; ссылки на площадки, которые
+// в этот раз не ответили, остаются прежними
+func resolveSongLinks(ctx context.Context, db *gorm.DB, resolver *LinkResolver, songID int) error {
+	var song Song
+	if err := db.First(&song, songID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	found, err := resolver.Resolve(ctx, song)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	rows := make([]SongLink, 0, len(found))
+	for platform, link := range found {
+		rows = append(rows, SongLink{SongID: song.ID, Platform: platform, URL: link})
+	}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "song_id"}, {Name: "platform"}},
+		DoUpdates: clause.AssignmentColumns([]string{"url"}),
+	}).Create(&rows).Error
+	if err != nil {
+		return err
+	}
+	return purgeCache(ctx, cacheKeySongs)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SongPatch - тело PATCH /songs/:id. Меняются только присланные поля, пустое
+// значение очищает поле; null равнозначен отсутствию поля. В отличие от PUT,
+// где GORM пропускает нулевые значения, так можно очистить текст или ссылку.
+type SongPatch struct {
+	Group       *string      `json:"group"`
+	SongName    *string      `json:"song"`
+	ReleaseDate *ReleaseDate `json:"releaseDate" swaggertype:"string" example:"16.07.2006"`
+	Text        *string      `json:"text"`
+	Link        *string      `json:"link"`
+	Album       *string      `json:"album"`
+	DurationMs  *int         `json:"durationMs"`
+	Explicit    *bool        `json:"explicit"`
+	// Версия, которую видел клиент; можно прислать и в If-Match
+	Version int `json:"version"`
+}
+
+// apply записывает присланные поля в song и возвращает их как колонки songs
+func (p SongPatch) apply(song *Song) map[string]interface{} {
+	cols := map[string]interface{}{}
+	if p.Group != nil {
+		song.Group, cols["group"] = *p.Group, *p.Group
+	}
+	if p.SongName != nil {
+		song.SongName, cols["song_name"] = *p.SongName, *p.SongName
+	}
+	if p.ReleaseDate != nil {
+		song.ReleaseDate, cols["release_date"] = *p.ReleaseDate, *p.ReleaseDate
+	}
+	if p.Text != nil {
+		song.Text, cols["text"] = *p.Text, *p.Text
+	}
+	if p.Link != nil {
+		song.Link, cols["link"] = *p.Link, *p.Link
+	}
+	if p.Album != nil {
+		song.Album, cols["album"] = *p.Album, *p.Album
+	}
+	if p.DurationMs != nil {
+		song.DurationMs, cols["duration_ms"] = *p.DurationMs, *p.DurationMs
+	}
+	if p.Explicit != nil {
+		song.Explicit, cols["explicit"] = *p.Explicit, *p.Explicit
+	}
+	return cols
+}
+
+// Ошибки PATCH, которые относятся к телу запроса, а не к базе
+var (
+	errPatchEmpty   = errors.New("no fields to update")
+	errPatchInvalid = errors.New("invalid patch")
+)
+
+// @Summary Patch song
+// @Description Change only the fields present in the body; an empty string clears a field, an absent or null field is left as is. Group and song cannot be cleared. Like PUT, the client must send the version it read in If-Match or in the version field, and gets 409 if the song was changed since then.
+// @ID patch-song
+// @Accept  json
+// @Produce  json
+// @Produce  xml
+// @Produce  application/vnd.api+json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Param If-Match header string false "Version the client read, e.g. \"3\"; * skips the check"
+// @Param patch body SongPatch true "Fields to change"
+// @Success 200 {object} Song
+// @Header 200 {string} ETag "New song version"
+// @Failure 400 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 428 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /songs/{id} [patch]
+func PatchSong(c *gin.Context) {
+	id, err := parseSongID(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
+		return
+	}
+
+	var patch SongPatch
+	dec := json.NewDecoder(c.Request.Body)
+	// Неизвестное поле - скорее опечатка или поле, которое здесь не меняется
+	// (ownerId), чем то, что клиент готов потерять молча
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	expected, err := expectedSongVersion(c, patch.Version)
+	if errors.Is(err, errInvalidIfMatch) {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "If-Match must be a song version like \"3\" or *")
+		return
+	}
+	if err != nil {
+		abortWithError(c, http.StatusPreconditionRequired, codePrecondition, "Send the song version in If-Match or in the version field")
+		return
+	}
+
+	var after Song
+	var invalid error // почему песня после правки не прошла проверку
+	var renamed Song  // песня после правки, для ответа о дубликате
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		var before Song
+		if err := tx.First(&before, id).Error; err != nil {
+			return err
+		}
+		if !canModifySong(c, before) {
+			return errNotOwner
+		}
+		merged := before
+		cols := patch.apply(&merged)
+		if len(cols) == 0 {
+			return errPatchEmpty
+		}
+		renamed = merged
+		if invalid = validateSong(merged); invalid != nil {
+			return errPatchInvalid
+		}
+		cols["version"] = before.Version + 1
+		var err error
+		if after, err = applySongUpdate(tx, before, expected, cols, patch.Link != nil, patch.Text != nil); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, auditEntitySong, id, auditActionUpdate, before, after)
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		abortWithError(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	case errors.Is(err, errNotOwner):
+		abortWithError(c, http.StatusForbidden, codeNotOwner, "You can only change your own songs")
+		return
+	case errors.Is(err, errPatchEmpty):
+		abortWithError(c, http.StatusBadRequest, codeValidation, "No fields to update")
+		return
+	case errors.Is(err, errPatchInvalid):
+		c.JSON(http.StatusBadRequest, errorBody(invalid))
+		return
+	case errors.Is(err, errVersionConflict):
+		abortWithError(c, http.StatusConflict, codeVersionConflict, "Song was changed by someone else")
+		return
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		writeSongExists(c, renamed.Group, renamed.SongName)
+		return
+	case err != nil:
+		logEntry(c).WithError(err).Error("Failed to patch song")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to update song")
+		return
+	}
+	publishSongEventFor(c, songEventUpdated, after)
+
+	c.Header("ETag", songVersionETag(after))
+	writeSong(c, http.StatusOK, after)
+}
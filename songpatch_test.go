@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPatchSong(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   string
+		status int
+		check  func(t *testing.T, song Song)
+	}{
+		{name: "absent fields unchanged", body: `{"album":"Black Holes and Revelations","version":1}`, status: http.StatusOK,
+			check: func(t *testing.T, song Song) {
+				if song.Album != "Black Holes and Revelations" || song.Text == "" || song.Link == "" || song.ReleaseDate.IsZero() {
+					t.Errorf("got %+v, want only the album changed", song)
+				}
+				if song.Version != 2 {
+					t.Errorf("version %d, want 2", song.Version)
+				}
+			}},
+		{name: "empty string clears", body: `{"text":"","link":"","releaseDate":"","version":1}`, status: http.StatusOK,
+			check: func(t *testing.T, song Song) {
+				if song.Text != "" || song.Link != "" || !song.ReleaseDate.IsZero() {
+					t.Errorf("text %q, link %q, release date %v; want all cleared", song.Text, song.Link, song.ReleaseDate)
+				}
+				if song.SongName != "Supermassive Black Hole" {
+					t.Errorf("song name %q changed", song.SongName)
+				}
+			}},
+		{name: "null is absent", body: `{"text":null,"link":null,"album":"Origin of Symmetry","version":1}`, status: http.StatusOK,
+			check: func(t *testing.T, song Song) {
+				if song.Text == "" || song.Link == "" {
+					t.Errorf("text %q, link %q; null must leave them as is", song.Text, song.Link)
+				}
+			}},
+		{name: "unknown field", body: `{"ownerId":5,"version":1}`, status: http.StatusBadRequest},
+		{name: "stale version", body: `{"album":"Absolution","version":3}`, status: http.StatusConflict,
+			check: func(t *testing.T, song Song) {
+				if song.Album != "" || song.Version != 1 {
+					t.Errorf("album %q, version %d; the song must not change", song.Album, song.Version)
+				}
+			}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := setupTestDB(t)
+			seedGoldenSongs(t)
+			router := newTestRouter()
+
+			w := doRequestAs(router, http.MethodPatch, "/songs/1", tc.body, testAdminToken)
+			if w.Code != tc.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tc.status, w.Body.String())
+			}
+			if tc.check != nil {
+				var song Song
+				if err := conn.First(&song, 1).Error; err != nil {
+					t.Fatal(err)
+				}
+				tc.check(t, song)
+			}
+		})
+	}
+}
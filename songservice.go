@@ -0,0 +1,86 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// songWrite - запись песен одной транзакцией. Песни, их статусы обогащения
+// и аудит пишутся в tx: ошибка любого шага откатывает все. Задачи очереди и
+// события вебхуков копятся и выполняются только после коммита, поэтому после
+// отката не остается ни задач, ни событий о песнях, которых нет в базе.
+type songWrite struct {
+	c     *gin.Context
+	tx    *gorm.DB
+	after []func()
+}
+
+// inSongTx выполняет fn в транзакции запроса, а после коммита - шаги,
+// отложенные через afterCommit. Ошибку fn возвращает как есть.
+func inSongTx(c *gin.Context, fn func(w *songWrite) error) error {
+	w := &songWrite{c: c}
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		w.tx = tx
+		return fn(w)
+	})
+	if err != nil {
+		return err
+	}
+	for _, step := range w.after {
+		step()
+	}
+	return nil
+}
+
+// afterCommit откладывает шаг до коммита; при откате он не выполняется
+func (w *songWrite) afterCommit(step func()) {
+	w.after = append(w.after, step)
+}
+
+// enrichmentQueue - задача обогащения новых песен: приоритет и MissingOnly
+type enrichmentQueue struct {
+	priority    int
+	missingOnly bool
+}
+
+// createSongs вставляет песни пачками с записями аудита; ID попадают в songs.
+// queued[i] - обогащение песни i ставится в очередь: у нее сразу появляется
+// статус pending. nil - в очередь не ставится ни одна.
+func (w *songWrite) createSongs(songs []Song, queued []bool, queue enrichmentQueue) error {
+	if err := insertSongs(w.tx, w.c, songs); err != nil {
+		return err
+	}
+	var statuses []SongEnrichment
+	for i := range queued {
+		if queued[i] {
+			statuses = append(statuses, SongEnrichment{SongID: PublicID(songs[i].ID), Status: enrichmentStatusPending})
+		}
+	}
+	if len(statuses) > 0 {
+		if err := w.tx.CreateInBatches(statuses, insertBatchSize).Error; err != nil {
+			return err
+		}
+	}
+	for i := range songs {
+		song, q := songs[i], i < len(queued) && queued[i]
+		w.afterCommit(func() {
+			if q {
+				queueSongEnrichment(w.c, enrichmentPayload{SongID: song.ID, MissingOnly: queue.missingOnly}, queue.priority)
+			} else {
+				songCreated(w.c, song)
+			}
+			publishSongEventFor(w.c, songEventCreated, song)
+		})
+	}
+	return nil
+}
+
+// songCreated ставит задачи статистики и ссылок по сохраненной песне
+func songCreated(c *gin.Context, song Song) {
+	if err := enqueueStatsRefresh(c.Request.Context(), song.ID); err != nil {
+		componentEntry(c, componentEnrichment).WithError(err).Warn("Failed to queue Last.fm statistics refresh")
+	}
+	if err := enqueueLinksResolve(c.Request.Context(), song.ID); err != nil {
+		componentEntry(c, componentEnrichment).WithError(err).Warn("Failed to queue streaming links resolution")
+	}
+}
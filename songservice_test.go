@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFailedSongWriteQueuesNothing(t *testing.T) {
+	conn := setupTestDB(t)
+	router := newTestRouter()
+	jobs = NewJobQueue(GetDB(), JobQueueConfig{})
+	// С клиентом Last.fm каждая новая песня ставит задачу статистики
+	lastfm = NewLastFMClient(LastFMConfig{APIKey: "test"})
+	sub := songEvents.Subscribe(0, 16)
+	t.Cleanup(func() {
+		jobs, lastfm = nil, nil
+		sub.Close()
+	})
+
+	artist := Artist{Name: "Muse"}
+	conn.Create(&artist)
+	submission := SongSubmission{ArtistID: artist.ID, UserID: 1, SongName: "Uprising", Status: submissionPending}
+	conn.Create(&submission)
+
+	// Аудит пишется последним шагом транзакции: без его таблицы падает
+	// запись, когда песня уже вставлена
+	if err := conn.Migrator().DropTable(&AuditEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := []struct{ name, target, body string }{
+		{"batch atomic", "/songs/batch", `[{"group":"Muse","song":"Uprising"}]`},
+		{"batch items", "/songs/batch?mode=items", `[{"group":"Muse","song":"Uprising"}]`},
+		{"approve submission", fmt.Sprintf("/admin/submissions/%d/approve", submission.ID), ""},
+	}
+	for _, r := range requests {
+		w := doRequestAs(router, http.MethodPost, r.target, r.body, testAdminToken)
+		if w.Code == http.StatusCreated || (w.Code == http.StatusOK && !strings.Contains(w.Body.String(), batchItemFailed)) {
+			t.Errorf("%s: status %d without the audit table: %s", r.name, w.Code, w.Body.String())
+		}
+	}
+	var songs, queued int64
+	conn.Model(&Song{}).Count(&songs)
+	conn.Model(&Job{}).Count(&queued)
+	if songs != 0 || queued != 0 || len(sub.C) != 0 {
+		t.Fatalf("after rollback: %d songs, %d jobs, %d events; want none", songs, queued, len(sub.C))
+	}
+	conn.First(&submission, submission.ID)
+	if submission.Status != submissionPending {
+		t.Errorf("submission status %q after rollback", submission.Status)
+	}
+
+	// Та же запись с таблицей аудита ставит задачу и событие
+	if err := conn.AutoMigrate(&AuditEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	if w := doRequestAs(router, http.MethodPost, requests[0].target, requests[0].body, testAdminToken); w.Code != http.StatusCreated {
+		t.Fatalf("batch: status %d: %s", w.Code, w.Body.String())
+	}
+	conn.Model(&Job{}).Count(&queued)
+	if queued != 1 || len(sub.C) != 1 {
+		t.Errorf("after commit: %d jobs, %d events; want 1 of each", queued, len(sub.C))
+	}
+}
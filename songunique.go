@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Уникальный индекс песни: группа и название без учета регистра, как
+// batchKey. Удаленные песни в него не входят, поэтому удаленную песню
+// можно добавить заново.
+const songNameIndex = "idx_songs_group_song"
+
+// Сколько повторяющихся песен перечисляет ошибка миграции
+const songDuplicatesListed = 10
+
+// songDuplicate - название, под которым в каталоге несколько песен:
+// самая ранняя из них и их число
+type songDuplicate struct {
+	ID    int
+	Songs int
+}
+
+// ensureSongNameIndex создает индекс, если его еще нет. GORM не описывает
+// индексы по выражениям, поэтому он создается здесь, а не тегом. Если в
+// каталоге уже есть повторы, миграция останавливается и перечисляет их:
+// какую из песен оставить, решает оператор, или он запускает migrate
+// -dedupe-songs, см. dedupeSongs.
+func ensureSongNameIndex(db *gorm.DB) error {
+	if db.Migrator().HasIndex(&Song{}, songNameIndex) {
+		return nil
+	}
+	var duplicates []songDuplicate
+	err := db.Model(&Song{}).Select("MIN(id) AS id, COUNT(*) AS songs").
+		Group(`LOWER("group"), LOWER(song_name)`).Having("COUNT(*) > 1").Order("id").Scan(&duplicates).Error
+	if err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		listed := make([]string, 0, songDuplicatesListed+1)
+		for _, d := range duplicates[:min(len(duplicates), songDuplicatesListed)] {
+			var song Song
+			if err := db.Select("id", "group", "song_name").First(&song, d.ID).Error; err != nil {
+				return err
+			}
+			listed = append(listed, fmt.Sprintf("%s - %s (%d songs)", song.Group, song.SongName, d.Songs))
+		}
+		if more := len(duplicates) - len(listed); more > 0 {
+			listed = append(listed, fmt.Sprintf("%d more", more))
+		}
+		return fmt.Errorf("duplicate songs with the same group and title: %s; delete or merge the extra songs, or run migrate -dedupe-songs to keep the earliest song of each",
+			strings.Join(listed, ", "))
+	}
+	return db.Exec(`CREATE UNIQUE INDEX ` + songNameIndex + ` ON songs (LOWER("group"), LOWER(song_name)) WHERE deleted_at IS NULL`).Error
+}
+
+// dedupeSongs - разовая чистка перед индексом: из песен с одним названием
+// остается самая ранняя, остальные помечаются удаленными. Их видно с
+// include_deleted, пока их не очистит song_purge.
+func dedupeSongs(db *gorm.DB) (int64, error) {
+	res := db.Exec(`UPDATE songs SET deleted_at = ? WHERE deleted_at IS NULL AND id NOT IN (
+		SELECT MIN(id) FROM songs WHERE deleted_at IS NULL GROUP BY LOWER("group"), LOWER(song_name))`, time.Now())
+	if res.RowsAffected > 0 {
+		logrus.WithField("songs", res.RowsAffected).Warn("Deleted duplicate songs before adding the unique index")
+	}
+	return res.RowsAffected, res.Error
+}
+
+// songByName - песня каталога с той же группой и названием, как их
+// сравнивает индекс
+func songByName(tx *gorm.DB, group, name string) (Song, error) {
+	var song Song
+	err := tx.Where(`LOWER("group") = LOWER(?) AND LOWER(song_name) = LOWER(?)`, group, name).First(&song).Error
+	return song, err
+}
+
+// writeSongExists отвечает 409 с ID песни, которая уже есть в каталоге.
+// Песню ищет заново: ошибку индекса дает и гонка двух добавлений.
+func writeSongExists(c *gin.Context, group, name string) {
+	body := gin.H{"code": codeSongExists, "error": "Song already exists"}
+	if existing, err := songByName(dbFor(c), group, name); err == nil {
+		body["existingId"] = PublicID(existing.ID)
+	}
+	c.JSON(http.StatusConflict, body)
+}
+
+// upsertSong - POST /songs?upsert=true для песни, которая уже есть:
+// непустые поля запроса записываются поверх нее, как в PUT без версии
+func upsertSong(c *gin.Context, existing, song Song) {
+	if !canModifySong(c, existing) {
+		abortWithError(c, http.StatusForbidden, codeNotOwner, "You can only change your own songs")
+		return
+	}
+	song.ID, song.OwnerID, song.LinkConfidence, song.Version = 0, nil, nil, 0
+	// Название сохраняется как в каталоге: совпадение без учета регистра
+	song.Group, song.SongName = "", ""
+
+	var after Song
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if after, err = applySongPatch(tx, existing, song); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, auditEntitySong, existing.ID, auditActionUpdate, existing, after)
+	})
+	if errors.Is(err, errVersionConflict) {
+		abortWithError(c, http.StatusConflict, codeVersionConflict, "Song was changed by someone else")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to update song")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to update song")
+		return
+	}
+	publishSongEventFor(c, songEventUpdated, after)
+
+	c.Header("ETag", songVersionETag(after))
+	writeSong(c, http.StatusOK, after)
+}
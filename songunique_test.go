@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSongNameIndexNeedsDedupe(t *testing.T) {
+	conn := setupTestDB(t)
+	seedGoldenSongs(t)
+	// Каталог до индекса: та же песня дважды в разном регистре
+	if err := conn.Exec("DROP INDEX " + songNameIndex).Error; err != nil {
+		t.Fatal(err)
+	}
+	conn.Create(&Song{Group: "QUEEN", SongName: "bohemian rhapsody"})
+
+	err := Migrate(conn)
+	if err == nil || !strings.Contains(err.Error(), "Queen - Bohemian Rhapsody (2 songs)") {
+		t.Fatalf("migrate error = %v, want the duplicate listed", err)
+	}
+	var count int64
+	conn.Model(&Song{}).Count(&count)
+	if count != 3 {
+		t.Fatalf("migrate deleted songs on its own: %d left", count)
+	}
+
+	deleted, err := dedupeSongs(conn)
+	if err != nil || deleted != 1 {
+		t.Fatalf("dedupe = %d, %v; want 1 song deleted", deleted, err)
+	}
+	if err := Migrate(conn); err != nil {
+		t.Fatalf("migrate after dedupe: %v", err)
+	}
+	var kept Song
+	conn.Where("LOWER(song_name) = ?", "bohemian rhapsody").First(&kept)
+	if kept.ID != 2 {
+		t.Errorf("kept song %d, want the earliest", kept.ID)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// Песню изменили после того, как клиент ее прочитал
+	errVersionConflict = errors.New("song version changed")
+	errVersionRequired = errors.New("song version required")
+	errInvalidIfMatch  = errors.New("invalid If-Match")
+)
+
+// expectedSongVersion - версия песни, которую видел клиент: из If-Match
+// ("3", сильный ETag ответа PUT) или из поля version тела. If-Match: *
+// снимает проверку, тогда возвращается 0.
+func expectedSongVersion(c *gin.Context, bodyVersion int) (int, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		if bodyVersion <= 0 {
+			return 0, errVersionRequired
+		}
+		return bodyVersion, nil
+	}
+	if header == "*" {
+		return 0, nil
+	}
+	raw, quoted := strings.CutPrefix(header, `"`)
+	raw, closed := strings.CutSuffix(raw, `"`)
+	if !quoted || !closed {
+		return 0, errInvalidIfMatch
+	}
+	version, err := strconv.Atoi(raw)
+	if err != nil || version <= 0 {
+		return 0, errInvalidIfMatch
+	}
+	return version, nil
+}
+
+// songVersionETag - сильный ETag версии песни для If-Match
+func songVersionETag(song Song) string {
+	return `"` + strconv.Itoa(song.Version) + `"`
+}
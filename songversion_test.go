@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestSQLStoreUpdateSongChecksVersion(t *testing.T) {
+	setupTestDB(t)
+	seedGoldenSongs(t)
+	store := newSQLSongStore(GetDB())
+
+	song, err := store.UpdateSong(context.Background(), 1, Song{Album: "Black Holes and Revelations", Version: 1})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if song.Version != 2 || song.Album != "Black Holes and Revelations" {
+		t.Fatalf("song after update = version %d, album %q", song.Version, song.Album)
+	}
+	// Клиент, прочитавший версию 1, не затирает чужую правку
+	if _, err := store.UpdateSong(context.Background(), 1, Song{Album: "Origin of Symmetry", Version: 1}); !errors.Is(err, errVersionConflict) {
+		t.Fatalf("stale update error = %v, want errVersionConflict", err)
+	}
+}
+
+func TestCorrectSongLinkRaisesVersion(t *testing.T) {
+	setupTestDB(t)
+	seedGoldenSongs(t)
+	router := newTestRouter()
+
+	w := doRequestAs(router, http.MethodPut, "/admin/songs/1/link", `{"link":"https://www.youtube.com/watch?v=abc"}`, testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var song Song
+	if err := GetDB().First(&song, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if song.Version != 2 {
+		t.Fatalf("version = %d, want 2", song.Version)
+	}
+}
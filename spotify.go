@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	spotifyAPIURL   = "https://api.spotify.com/v1"
+	spotifyTokenURL = "https://accounts.spotify.com/api/token"
+)
+
+// SpotifyConfig - параметры провайдера Spotify Web API
+type SpotifyConfig struct {
+	ClientID     string
+	ClientSecret string
+	Market       string // код страны для поиска, например RU; пусто - без ограничения
+	APIURL       string
+	TokenURL     string
+	Timeout      time.Duration
+}
+
+// SpotifyProvider находит трек в Spotify и берет из него дату выхода, альбом,
+// длительность и ссылку. Текстов песен Spotify не отдает.
+type SpotifyProvider struct {
+	cfg  SpotifyConfig
+	http *http.Client
+}
+
+// NewSpotifyProvider создает провайдера; токен приложения (client credentials)
+// запрашивается при первом обращении и обновляется автоматически
+func NewSpotifyProvider(cfg SpotifyConfig) (*SpotifyProvider, error) {
+	if cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return nil, errors.New("SPOTIFY_CLIENT_ID and SPOTIFY_CLIENT_SECRET must be set")
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = spotifyAPIURL
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = spotifyTokenURL
+	}
+	cfg.APIURL = strings.TrimSuffix(cfg.APIURL, "/")
+
+	creds := clientcredentials.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		TokenURL:     cfg.TokenURL,
+	}
+	base := trackHTTP(&http.Client{Timeout: cfg.Timeout}, providerSpotify, dependencyEnrichment)
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, base)
+	client := creds.Client(ctx)
+	client.Timeout = cfg.Timeout
+	return &SpotifyProvider{cfg: cfg, http: client}, nil
+}
+
+// Ответ /v1/search, только нужные поля
+type spotifySearchResponse struct {
+	Tracks struct {
+		Items []spotifyTrack `json:"items"`
+	} `json:"tracks"`
+}
+
+type spotifyTrack struct {
+	Name         string `json:"name"`
+	DurationMs   int    `json:"duration_ms"`
+	ExternalURLs struct {
+		Spotify string `json:"spotify"`
+	} `json:"external_urls"`
+	Album struct {
+		Name                 string `json:"name"`
+		ReleaseDate          string `json:"release_date"`
+		ReleaseDatePrecision string `json:"release_date_precision"`
+	} `json:"album"`
+}
+
+func (p *SpotifyProvider) SongDetail(ctx context.Context, group, song string) (SongDetail, error) {
+	params := url.Values{
+		"q":     {fmt.Sprintf("track:%q artist:%q", song, group)},
+		"type":  {"track"},
+		"limit": {"1"},
+	}
+	if p.cfg.Market != "" {
+		params.Set("market", p.cfg.Market)
+	}
+	var result spotifySearchResponse
+	if err := p.getJSON(ctx, p.cfg.APIURL+"/search?"+params.Encode(), &result); err != nil {
+		return SongDetail{}, err
+	}
+	if len(result.Tracks.Items) == 0 {
+		return SongDetail{}, ErrInfoNotFound
+	}
+	track := result.Tracks.Items[0]
+	return SongDetail{
+		ReleaseDate: spotifyReleaseDate(track.Album.ReleaseDate, track.Album.ReleaseDatePrecision),
+		Link:        track.ExternalURLs.Spotify,
+		Album:       track.Album.Name,
+		DurationMs:  track.DurationMs,
+	}, nil
+}
+
+// spotifyReleaseDate переводит дату Spotify (2006-07-16, 2006-07 или 2006)
+// в формат сервиса: 16.07.2006, 07.2006 или 2006
+func spotifyReleaseDate(date, precision string) string {
+	layouts := map[string][2]string{
+		"day":   {"2006-01-02", "02.01.2006"},
+		"month": {"2006-01", "01.2006"},
+		"year":  {"2006", "2006"},
+	}
+	layout, ok := layouts[precision]
+	if !ok {
+		return date
+	}
+	t, err := time.Parse(layout[0], date)
+	if err != nil {
+		return date
+	}
+	return t.Format(layout[1])
+}
+
+// Ответы поиска альбома и /v1/albums/{id}/tracks, только нужные поля
+type spotifyAlbumSearchResponse struct {
+	Albums struct {
+		Items []struct {
+			ID                   string `json:"id"`
+			ReleaseDate          string `json:"release_date"`
+			ReleaseDatePrecision string `json:"release_date_precision"`
+		} `json:"items"`
+	} `json:"albums"`
+}
+
+type spotifyAlbumTracksResponse struct {
+	Items []struct {
+		Name       string `json:"name"`
+		DurationMs int    `json:"duration_ms"`
+	} `json:"items"`
+	Next string `json:"next"`
+}
+
+// AlbumDetail находит альбом и читает его трек-лист постранично
+func (p *SpotifyProvider) AlbumDetail(ctx context.Context, group, album string) (AlbumDetail, error) {
+	params := url.Values{
+		"q":     {fmt.Sprintf("album:%q artist:%q", album, group)},
+		"type":  {"album"},
+		"limit": {"1"},
+	}
+	if p.cfg.Market != "" {
+		params.Set("market", p.cfg.Market)
+	}
+	var search spotifyAlbumSearchResponse
+	if err := p.getJSON(ctx, p.cfg.APIURL+"/search?"+params.Encode(), &search); err != nil {
+		return AlbumDetail{}, err
+	}
+	if len(search.Albums.Items) == 0 {
+		return AlbumDetail{}, ErrInfoNotFound
+	}
+	found := search.Albums.Items[0]
+	detail := AlbumDetail{ReleaseDate: spotifyReleaseDate(found.ReleaseDate, found.ReleaseDatePrecision)}
+
+	next := p.cfg.APIURL + "/albums/" + url.PathEscape(found.ID) + "/tracks?limit=50"
+	for next != "" {
+		var page spotifyAlbumTracksResponse
+		if err := p.getJSON(ctx, next, &page); err != nil {
+			return AlbumDetail{}, err
+		}
+		for _, track := range page.Items {
+			detail.Tracks = append(detail.Tracks, AlbumTrack{
+				Position: len(detail.Tracks) + 1, Title: track.Name, DurationMs: track.DurationMs,
+			})
+		}
+		next = page.Next
+	}
+	return detail, nil
+}
+
+func (p *SpotifyProvider) getJSON(ctx context.Context, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("build spotify request: %w", err)
+	}
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: spotify: %w", ErrInfoUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &InfoStatusError{StatusCode: resp.StatusCode}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode spotify response: %w", err)
+	}
+	return nil
+}
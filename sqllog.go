@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// SQLLogConfig - журнал SQL-запросов
+type SQLLogConfig struct {
+	SlowThreshold time.Duration // запросы дольше - предупреждение в логе; 0 - не отмечать медленные
+	LogParams     bool          // писать значения параметров; по умолчанию в логе только $1, $2...
+}
+
+// sqlLogger направляет журнал GORM в logrus через логгер компонента db.
+// Ошибки пишутся всегда, медленные запросы - предупреждением, все
+// остальные - на уровне debug (PUT /admin/log-level с component=db).
+type sqlLogger struct {
+	cfg SQLLogConfig
+}
+
+func newSQLLogger(cfg SQLLogConfig) gormlogger.Interface {
+	return sqlLogger{cfg: cfg}
+}
+
+// LogMode ничего не меняет: уровень задается логгером компонента
+func (l sqlLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (l sqlLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	sqlEntry(ctx).Infof(msg, data...)
+}
+
+func (l sqlLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	sqlEntry(ctx).Warnf(msg, data...)
+}
+
+func (l sqlLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	sqlEntry(ctx).Errorf(msg, data...)
+}
+
+func (l sqlLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	log := componentLogger(componentDB)
+	var level logrus.Level
+	switch {
+	// Отсутствие записи - обычный ответ на First, а не сбой
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level = logrus.ErrorLevel
+	case l.cfg.SlowThreshold > 0 && elapsed >= l.cfg.SlowThreshold:
+		level = logrus.WarnLevel
+	default:
+		level = logrus.DebugLevel
+	}
+	if !log.IsLevelEnabled(level) {
+		return
+	}
+
+	sql, rows := fc()
+	entry := sqlEntry(ctx).WithFields(logrus.Fields{
+		"sql":          sql,
+		fieldLatencyMs: float64(elapsed.Microseconds()) / 1000,
+	})
+	if rows >= 0 {
+		entry = entry.WithField("rows", rows)
+	}
+	switch level {
+	case logrus.ErrorLevel:
+		entry.WithError(err).Error("Query failed")
+	case logrus.WarnLevel:
+		entry.WithField("threshold_ms", l.cfg.SlowThreshold.Milliseconds()).Warn("Slow query")
+	default:
+		entry.Debug("Query")
+	}
+}
+
+// ParamsFilter убирает значения параметров из SQL в логе: среди них
+// бывают хеши ключей и личные данные
+func (l sqlLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.cfg.LogParams {
+		return sql, params
+	}
+	return sql, nil
+}
+
+// sqlEntry - запись лога компонента db с ID запроса и трассы, если запрос
+// к базе выполнен с контекстом HTTP-запроса
+func sqlEntry(ctx context.Context) *logrus.Entry {
+	entry := componentLogger(componentDB).WithField("component", componentDB)
+	if ctx == nil {
+		return entry
+	}
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		entry = entry.WithField(fieldRequestID, id)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		entry = entry.WithField(fieldTraceID, sc.TraceID().String())
+	}
+	return entry
+}
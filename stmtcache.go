@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// stmtCacheMetrics считает обращения к кешу подготовленных выражений GORM.
+// GORM кеширует выражение по тексту SQL, поэтому первый запрос с новым
+// текстом - промах (подготовка и планирование), повторные - попадания.
+// Запросы списка песен держат текст стабильным: значения фильтров, LIMIT
+// и OFFSET передаются параметрами, и число разных текстов ограничено
+// сочетаниями фильтров.
+type stmtCacheMetrics struct {
+	enabled bool
+	seen    sync.Map
+	size    atomic.Int64
+	hits    atomic.Int64
+	misses  atomic.Int64
+}
+
+var stmtCache = &stmtCacheMetrics{}
+
+func (m *stmtCacheMetrics) Name() string {
+	return "stmt_cache_metrics"
+}
+
+// Initialize регистрирует счетчики после выполнения каждого вида запросов
+func (m *stmtCacheMetrics) Initialize(db *gorm.DB) error {
+	m.enabled = db.PrepareStmt
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Query().After("gorm:query").Register("stmt_cache:query", m.observe),
+		cb.Create().After("gorm:create").Register("stmt_cache:create", m.observe),
+		cb.Update().After("gorm:update").Register("stmt_cache:update", m.observe),
+		cb.Delete().After("gorm:delete").Register("stmt_cache:delete", m.observe),
+		cb.Row().After("gorm:row").Register("stmt_cache:row", m.observe),
+		cb.Raw().After("gorm:raw").Register("stmt_cache:raw", m.observe),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *stmtCacheMetrics) observe(tx *gorm.DB) {
+	if !tx.PrepareStmt || tx.DryRun || tx.Statement.SQL.Len() == 0 {
+		return
+	}
+	counter := requestCounter(tx)
+	if _, loaded := m.seen.LoadOrStore(tx.Statement.SQL.String(), struct{}{}); loaded {
+		m.hits.Add(1)
+		if counter != nil {
+			counter.stmtHits.Add(1)
+		}
+		return
+	}
+	m.size.Add(1)
+	m.misses.Add(1)
+	if counter != nil {
+		counter.stmtMisses.Add(1)
+	}
+}
+
+// StmtCacheStats - метрики кеша подготовленных выражений
+type StmtCacheStats struct {
+	Enabled    bool    `json:"enabled"`
+	Statements int64   `json:"statements"`
+	Hits       int64   `json:"hits"`
+	Misses     int64   `json:"misses"`
+	HitRatio   float64 `json:"hitRatio"`
+}
+
+func (m *stmtCacheMetrics) Stats() StmtCacheStats {
+	stats := StmtCacheStats{
+		Enabled:    m.enabled,
+		Statements: m.size.Load(),
+		Hits:       m.hits.Load(),
+		Misses:     m.misses.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// @Summary Prepared statement cache stats
+// @Description Number of cached statements and cache hits/misses since startup.
+// @ID get-stmt-cache-stats
+// @Produce  json
+// @Success 200 {object} StmtCacheStats
+// @Router /admin/db/statements [get]
+func GetStmtCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, stmtCache.Stats())
+}
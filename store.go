@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Хранилище песен за пределами SQL. Основной вариант - PostgreSQL, его
+// обслуживают обработчики из main.go напрямую: аудит, архив текстов и поиск
+// по куплетам завязаны на транзакции и SQL. Другие хранилища подключаются
+// через SongStore и получают тот же HTTP-интерфейс /songs без этих функций.
+
+// Значения STORAGE_BACKEND
+const (
+	storageSQL   = "sql"
+	storageMongo = "mongo"
+)
+
+// ErrSongNotFound - в хранилище нет песни с таким ID
+var ErrSongNotFound = errors.New("song not found")
+
+// SongQuery - выборка для ListSongs
+type SongQuery struct {
+	Filter  SongFilter
+	AfterID int // курсор; 0 - с начала, тогда действует Offset
+	Offset  int
+	Limit   int
+}
+
+// SongStore - граница репозитория песен
+type SongStore interface {
+	ListSongs(ctx context.Context, q SongQuery) ([]Song, error)
+	GetSong(ctx context.Context, id int) (Song, error)
+	CreateSong(ctx context.Context, song *Song) error
+	// UpdateSong заменяет непустые поля patch, как Updates в GORM. Хранилища,
+	// которые ведут версию песни, сверяют с ней непустой patch.Version.
+	UpdateSong(ctx context.Context, id int, patch Song) (Song, error)
+	DeleteSong(ctx context.Context, id int) error
+	Close(ctx context.Context) error
+}
+
+// Хранилище, выбранное STORAGE_BACKEND; nil - песни в SQL
+var songStore SongStore
+
+// NewSongStore подключает хранилище из конфигурации
+func NewSongStore(ctx context.Context, cfg Config) (SongStore, error) {
+	switch cfg.StorageBackend {
+	case storageSQL, "":
+		return nil, nil
+	case storageMongo:
+		return NewMongoSongStore(ctx, cfg.Mongo)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	}
+}
+
+// registerStoreSongRoutes регистрирует /songs поверх SongStore
+func registerStoreSongRoutes(reads, writes gin.IRoutes, store SongStore) {
+	reads.GET("/songs", listStoredSongs(store))
+	reads.GET("/songs/export", ExportSongs(store))
+	writes.POST("/songs", addStoredSong(store, enrichment))
+	writes.PUT("/songs/:id", updateStoredSong(store))
+	writes.DELETE("/songs/:id", deleteStoredSong(store))
+	reads.GET("/songs/:id/text", getStoredSongText(store))
+}
+
+func listStoredSongs(store SongStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := parseSongsPage(c)
+		if !ok {
+			return
+		}
+		page, limit := p.Page, p.Limit
+
+		filter, ok := songFilterFromQuery(c)
+		if !ok {
+			return
+		}
+		// Хранилище понимает только равенство полей
+		if filter.Text != "" || c.Query("include") != "" || c.Query("as_of") != "" || len(filter.Conds) > 0 {
+			abortWithError(c, http.StatusNotImplemented, codeNotImplemented, "Not supported by this storage backend")
+			return
+		}
+
+		q := SongQuery{Filter: filter, Offset: (page - 1) * limit, Limit: limit}
+		if after := c.Query("after"); after != "" {
+			afterID, err := parseSongID(after)
+			if err != nil {
+				abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid cursor")
+				return
+			}
+			q.AfterID = afterID
+		}
+
+		songs, err := store.ListSongs(c.Request.Context(), q)
+		if err != nil {
+			logEntry(c).WithError(err).Error("Failed to fetch songs from store")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch songs")
+			return
+		}
+		if len(songs) == 0 {
+			writeNoSongs(c)
+			return
+		}
+		if len(songs) == limit {
+			c.Header("X-Next-Cursor", encodeSongID(songs[len(songs)-1].ID))
+		}
+		writeSongs(c, http.StatusOK, songs)
+	}
+}
+
+func addStoredSong(store SongStore, info SongInfoProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var newSong Song
+		if err := c.ShouldBindBodyWithJSON(&newSong); err != nil {
+			c.JSON(http.StatusBadRequest, errorBody(err))
+			return
+		}
+		if !enrichNewSong(c, info, &newSong) {
+			return
+		}
+		if err := store.CreateSong(c.Request.Context(), &newSong); err != nil {
+			logEntry(c).WithError(err).Error("Failed to create song in store")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to add song")
+			return
+		}
+		purgeCacheFor(c, cacheKeySongs)
+		writeSong(c, http.StatusCreated, newSong)
+	}
+}
+
+func updateStoredSong(store SongStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := parseSongID(c.Param("id"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
+			return
+		}
+		var patch Song
+		if err := c.ShouldBindJSON(&patch); err != nil {
+			c.JSON(http.StatusBadRequest, errorBody(err))
+			return
+		}
+		patch.OwnerID = nil // владелец не меняется через обновление
+
+		// Без транзакции между проверкой и записью: документные хранилища
+		// обновляют одну запись атомарно, владелец при этом не меняется
+		before, err := store.GetSong(c.Request.Context(), id)
+		if !storeFound(c, err) {
+			return
+		}
+		if !canModifySong(c, before) {
+			abortWithError(c, http.StatusForbidden, codeNotOwner, "You can only change your own songs")
+			return
+		}
+		after, err := store.UpdateSong(c.Request.Context(), id, patch)
+		if !storeFound(c, err) {
+			return
+		}
+		purgeCacheFor(c, cacheKeySongs)
+		writeSong(c, http.StatusOK, after)
+	}
+}
+
+func deleteStoredSong(store SongStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := parseSongID(c.Param("id"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
+			return
+		}
+		before, err := store.GetSong(c.Request.Context(), id)
+		if !storeFound(c, err) {
+			return
+		}
+		if !canModifySong(c, before) {
+			abortWithError(c, http.StatusForbidden, codeNotOwner, "You can only change your own songs")
+			return
+		}
+		if !storeFound(c, store.DeleteSong(c.Request.Context(), id)) {
+			return
+		}
+		purgeCacheFor(c, cacheKeySongs)
+		c.JSON(http.StatusOK, gin.H{"message": "Song deleted"})
+	}
+}
+
+func getStoredSongText(store SongStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := parseSongID(c.Param("id"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
+			return
+		}
+		// Внешнее хранилище не ведет журнал изменений
+		if c.Query("as_of") != "" {
+			abortWithError(c, http.StatusNotImplemented, codeNotImplemented, "Not supported by this storage backend")
+			return
+		}
+		song, err := store.GetSong(c.Request.Context(), id)
+		if !storeFound(c, err) {
+			return
+		}
+		respondLyrics(c, song)
+	}
+}
+
+// storeFound отвечает 404 или 500 на ошибку хранилища и возвращает false
+func storeFound(c *gin.Context, err error) bool {
+	if errors.Is(err, ErrSongNotFound) {
+		abortWithError(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return false
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Song store request failed")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Storage error")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoConfig - параметры экспериментального хранилища MongoDB
+type MongoConfig struct {
+	URI      string
+	Database string
+	Timeout  time.Duration // на подключение
+}
+
+// mongoSongStore хранит песни в коллекции songs. ID остаются целыми, как
+// в SQL: их выдает счетчик в коллекции counters.
+type mongoSongStore struct {
+	client   *mongo.Client
+	songs    *mongo.Collection
+	counters *mongo.Collection
+}
+
+// Документ песни; поля совпадают с JSON-ответом
+type mongoSong struct {
+	ID                int               `bson:"_id"`
+	Group             string            `bson:"group"`
+	SongName          string            `bson:"song"`
+	ReleaseDate       string            `bson:"releaseDate"`
+	Text              string            `bson:"text"`
+	Link              string            `bson:"link"`
+	LinkConfidence    *float64          `bson:"linkConfidence"`
+	Album             string            `bson:"album"`
+	AlbumID           *int              `bson:"albumId"`
+	AlbumPosition     int               `bson:"albumPosition"`
+	DurationMs        int               `bson:"durationMs"`
+	Explicit          bool              `bson:"explicit"`
+	OwnerID           *int              `bson:"ownerId"`
+	EnrichmentPending bool              `bson:"enrichmentPending"`
+	EnrichmentSources map[string]string `bson:"enrichmentSources"`
+	Listeners         int64             `bson:"listeners"`
+	Playcount         int64             `bson:"playcount"`
+	StatsUpdatedAt    *time.Time        `bson:"statsUpdatedAt"`
+}
+
+func NewMongoSongStore(ctx context.Context, cfg MongoConfig) (SongStore, error) {
+	if cfg.URI == "" {
+		return nil, errors.New("MONGO_URI must be set")
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	dep := dependencies.Track("mongodb", dependencyDatabase)
+	monitor := &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) { dep.Observe(e.Duration, nil) },
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			dep.Observe(e.Duration, errors.New(e.Failure))
+		},
+	}
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.URI).SetMonitor(monitor))
+	if err != nil {
+		return nil, fmt.Errorf("connect to mongodb: %w", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("ping mongodb: %w", err)
+	}
+	dep.SetProbe(func(ctx context.Context) error { return client.Ping(ctx, nil) })
+
+	database := client.Database(cfg.Database)
+	store := &mongoSongStore{
+		client:   client,
+		songs:    database.Collection("songs"),
+		counters: database.Collection("counters"),
+	}
+	_, err = store.songs.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "group", Value: 1}, {Key: "song", Value: 1}}})
+	if err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("create mongodb indexes: %w", err)
+	}
+	return store, nil
+}
+
+func (s *mongoSongStore) ListSongs(ctx context.Context, q SongQuery) ([]Song, error) {
+	filter := bson.D{}
+	f := q.Filter
+	for _, cond := range []struct {
+		key   string
+		value string
+	}{
+		{"group", f.Group}, {"song", f.SongName}, {"releaseDate", f.ReleaseDate.String()}, {"link", f.Link},
+	} {
+		if cond.value != "" {
+			filter = append(filter, bson.E{Key: cond.key, Value: cond.value})
+		}
+	}
+	if f.Explicit != nil {
+		filter = append(filter, bson.E{Key: "explicit", Value: *f.Explicit})
+	}
+	if f.OwnerID != nil {
+		filter = append(filter, bson.E{Key: "ownerId", Value: *f.OwnerID})
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(q.Limit))
+	if q.AfterID > 0 {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$gt", Value: q.AfterID}}})
+	} else if q.Offset > 0 {
+		opts.SetSkip(int64(q.Offset))
+	}
+
+	cursor, err := s.songs.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var docs []mongoSong
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	songs := make([]Song, len(docs))
+	for i, doc := range docs {
+		songs[i] = doc.song()
+	}
+	return songs, nil
+}
+
+func (s *mongoSongStore) GetSong(ctx context.Context, id int) (Song, error) {
+	var doc mongoSong
+	err := s.songs.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Song{}, ErrSongNotFound
+	}
+	if err != nil {
+		return Song{}, err
+	}
+	return doc.song(), nil
+}
+
+func (s *mongoSongStore) CreateSong(ctx context.Context, song *Song) error {
+	id, err := s.nextID(ctx, "songs")
+	if err != nil {
+		return err
+	}
+	song.ID = id
+	_, err = s.songs.InsertOne(ctx, newMongoSong(*song))
+	return err
+}
+
+func (s *mongoSongStore) UpdateSong(ctx context.Context, id int, patch Song) (Song, error) {
+	// Как Updates в GORM: пустые строки и нули не перезаписывают значения
+	set := bson.D{}
+	for _, field := range []struct {
+		key   string
+		value string
+	}{
+		{"group", patch.Group}, {"song", patch.SongName}, {"releaseDate", patch.ReleaseDate.String()},
+		{"text", patch.Text}, {"link", patch.Link}, {"album", patch.Album},
+	} {
+		if field.value != "" {
+			set = append(set, bson.E{Key: field.key, Value: field.value})
+		}
+	}
+	if patch.DurationMs != 0 {
+		set = append(set, bson.E{Key: "durationMs", Value: patch.DurationMs})
+	}
+	if patch.Explicit {
+		set = append(set, bson.E{Key: "explicit", Value: true})
+	}
+	if len(set) == 0 {
+		return s.GetSong(ctx, id)
+	}
+
+	var doc mongoSong
+	err := s.songs.FindOneAndUpdate(ctx, bson.D{{Key: "_id", Value: id}}, bson.D{{Key: "$set", Value: set}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Song{}, ErrSongNotFound
+	}
+	if err != nil {
+		return Song{}, err
+	}
+	return doc.song(), nil
+}
+
+func (s *mongoSongStore) DeleteSong(ctx context.Context, id int) error {
+	result, err := s.songs.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrSongNotFound
+	}
+	return nil
+}
+
+func (s *mongoSongStore) Close(ctx context.Context) error {
+	return s.client.Disconnect(ctx)
+}
+
+// nextID атомарно увеличивает счетчик коллекции
+func (s *mongoSongStore) nextID(ctx context.Context, name string) (int, error) {
+	var counter struct {
+		Seq int `bson:"seq"`
+	}
+	err := s.counters.FindOneAndUpdate(ctx,
+		bson.D{{Key: "_id", Value: name}},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "seq", Value: 1}}}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, fmt.Errorf("next %s id: %w", name, err)
+	}
+	return counter.Seq, nil
+}
+
+func newMongoSong(s Song) mongoSong {
+	return mongoSong{
+		ID: s.ID, Group: s.Group, SongName: s.SongName, ReleaseDate: s.ReleaseDate.String(), Text: s.Text,
+		Link: s.Link, LinkConfidence: s.LinkConfidence, Album: s.Album, AlbumID: s.AlbumID, AlbumPosition: s.AlbumPosition,
+		DurationMs: s.DurationMs, Explicit: s.Explicit, OwnerID: s.OwnerID,
+		EnrichmentPending: s.EnrichmentPending, EnrichmentSources: s.EnrichmentSources, Listeners: s.Listeners, Playcount: s.Playcount,
+		StatsUpdatedAt: s.StatsUpdatedAt,
+	}
+}
+
+func (d mongoSong) song() Song {
+	return Song{
+		ID: d.ID, Group: d.Group, SongName: d.SongName, ReleaseDate: providerReleaseDate(d.ReleaseDate), Text: d.Text,
+		Link: d.Link, LinkConfidence: d.LinkConfidence, Album: d.Album, AlbumID: d.AlbumID, AlbumPosition: d.AlbumPosition,
+		DurationMs: d.DurationMs, Explicit: d.Explicit, OwnerID: d.OwnerID,
+		EnrichmentPending: d.EnrichmentPending, EnrichmentSources: d.EnrichmentSources, Listeners: d.Listeners, Playcount: d.Playcount,
+		StatsUpdatedAt: d.StatsUpdatedAt,
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// sqlSongStore - SongStore поверх основной базы для клиентов помимо HTTP
+// (gRPC). Обработчики /songs из main.go работают с базой напрямую: им нужны
+// аудит и транзакции в контексте запроса.
+type sqlSongStore struct {
+	db *gorm.DB
+}
+
+func newSQLSongStore(db *gorm.DB) *sqlSongStore {
+	return &sqlSongStore{db: db}
+}
+
+func (s *sqlSongStore) ListSongs(ctx context.Context, q SongQuery) ([]Song, error) {
+	query := songFilterSet(q.Filter, "songs").Apply(s.db.WithContext(ctx).Model(&Song{})).Order("songs.id")
+	if q.AfterID > 0 {
+		query = query.Where("songs.id > ?", q.AfterID)
+	} else {
+		query = query.Offset(q.Offset)
+	}
+	var songs []Song
+	err := query.Limit(q.Limit).Find(&songs).Error
+	return songs, err
+}
+
+// GetSong возвращает песню вместе с перенесенным в архив текстом
+func (s *sqlSongStore) GetSong(ctx context.Context, id int) (Song, error) {
+	db := s.db.WithContext(ctx)
+	var song Song
+	if err := db.First(&song, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return song, ErrSongNotFound
+		}
+		return song, err
+	}
+	if song.Archived {
+		text, err := loadArchivedLyrics(db, song.ID)
+		if err != nil {
+			return song, err
+		}
+		song.Text = text
+	}
+	return song, nil
+}
+
+func (s *sqlSongStore) CreateSong(ctx context.Context, song *Song) error {
+	return s.db.WithContext(ctx).Create(song).Error
+}
+
+// UpdateSong поднимает версию песни, как PUT /songs/{id}; непустой
+// patch.Version сверяется с текущей, при расхождении - errVersionConflict
+func (s *sqlSongStore) UpdateSong(ctx context.Context, id int, patch Song) (Song, error) {
+	patch.ID = 0
+	var song Song
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var before Song
+		if err := tx.First(&before, id).Error; err != nil {
+			return err
+		}
+		var err error
+		song, err = applySongPatch(tx, before, patch)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return song, ErrSongNotFound
+	}
+	return song, err
+}
+
+func (s *sqlSongStore) DeleteSong(ctx context.Context, id int) error {
+	result := s.db.WithContext(ctx).Delete(&Song{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSongNotFound
+	}
+	return nil
+}
+
+// Close ничего не делает: подключением к базе владеет runServe
+func (s *sqlSongStore) Close(ctx context.Context) error {
+	return nil
+}
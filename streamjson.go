@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// songArrayWriter пишет JSON-массив песен по мере чтения: в памяти
+// остается одна порция, а не весь список. Реализует songExporter.
+type songArrayWriter struct {
+	out     gin.ResponseWriter
+	buf     []byte
+	started bool
+}
+
+func newSongArrayWriter(out gin.ResponseWriter) *songArrayWriter {
+	return &songArrayWriter{out: out}
+}
+
+func (w *songArrayWriter) WriteBatch(songs []Song) error {
+	buf := w.buf[:0]
+	var err error
+	for i := range songs {
+		if w.started {
+			buf = append(buf, ',')
+		} else {
+			buf = append(buf, '[')
+			w.started = true
+		}
+		if buf, err = appendSongElement(buf, &songs[i]); err != nil {
+			return err
+		}
+	}
+	w.buf = buf
+	if len(buf) == 0 {
+		return nil
+	}
+	if _, err := w.out.Write(buf); err != nil {
+		return err
+	}
+	w.out.Flush()
+	return nil
+}
+
+func (w *songArrayWriter) Close() error {
+	if !w.started {
+		_, err := w.out.WriteString("[]")
+		return err
+	}
+	_, err := w.out.WriteString("]")
+	return err
+}
+
+// readSongBatch читает из курсора до exportBatchSize песен; пустая порция -
+// курсор исчерпан
+func readSongBatch(rows *sql.Rows, scan func(song *Song) error) ([]Song, error) {
+	var songs []Song
+	for len(songs) < exportBatchSize && rows.Next() {
+		var song Song
+		if err := scan(&song); err != nil {
+			return nil, err
+		}
+		songs = append(songs, song)
+	}
+	return songs, rows.Err()
+}
+
+// streamSongs отдает список без LIMIT из курсора базы порциями по
+// exportBatchSize. Пустой список - как у постраничного ответа: 200 с [],
+// или 404 при EMPTY_SONGS_404 (writeNoSongs); ошибка после начала ответа
+// обрывает массив и остается в логе.
+func streamSongs(c *gin.Context, query *gorm.DB) {
+	rows, err := query.Rows()
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch songs from database")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch songs")
+		return
+	}
+	defer rows.Close()
+	scan := func(song *Song) error { return dbFor(c).ScanRows(rows, song) }
+
+	songs, err := readSongBatch(rows, scan)
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch songs from database")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch songs")
+		return
+	}
+	if len(songs) == 0 {
+		writeNoSongs(c)
+		return
+	}
+
+	c.Header("Content-Type", jsonContentType)
+	c.Status(http.StatusOK)
+	w := newSongArrayWriter(c.Writer)
+	for len(songs) > 0 {
+		if err := w.WriteBatch(restrictSongs(c, songs)); err != nil {
+			// Клиент отключился
+			logEntry(c).WithError(err).Debug("Song stream aborted")
+			return
+		}
+		if songs, err = readSongBatch(rows, scan); err != nil {
+			logEntry(c).WithError(err).Error("Failed to stream songs")
+			return
+		}
+	}
+	w.Close()
+}
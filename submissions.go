@@ -0,0 +1,562 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Статусы заявки на публикацию песни
+const (
+	submissionDraft    = "draft"    // артист еще редактирует
+	submissionPending  = "pending"  // в очереди модерации
+	submissionApproved = "approved" // опубликована как песня
+	submissionRejected = "rejected" // можно исправить и отправить снова
+)
+
+// Поля фильтров GET /admin/submissions
+var submissionFilterFields = FilterFields{
+	"status":   {Column: "status", Ops: []string{filterOpEq, filterOpNe}},
+	"artistId": {Column: "artist_id", Ops: filterOpsEq, Parse: parseIntFilter},
+}
+
+// Максимальный размер аудиофайла заявки; задает SUBMISSION_AUDIO_MAX_BYTES
+var submissionAudioLimit int64 = 20 << 20
+
+// Структура SongSubmission (песня, которую прислал подтвержденный артист).
+// До одобрения модератором в каталоге ее нет.
+type SongSubmission struct {
+	ID          int               `json:"id" gorm:"primaryKey"`
+	ArtistID    int               `json:"artistId" gorm:"not null;index"`
+	UserID      int               `json:"userId" gorm:"not null"`
+	SongName    string            `json:"song" gorm:"not null"`
+	ReleaseDate string            `json:"releaseDate"`
+	Text        string            `json:"text"`
+	Links       map[string]string `json:"links" gorm:"serializer:json"` // площадка -> ссылка
+	// Тип загруженного аудио; пусто - аудио нет
+	AudioType  string     `json:"audioType,omitempty"`
+	Status     string     `json:"status" gorm:"not null;default:draft;index"`
+	ReviewNote string     `json:"reviewNote,omitempty"`                      // причина отказа
+	SongID     *PublicID  `json:"songId,omitempty" extensions:"x-public-id"` // песня после одобрения
+	ReviewedAt *time.Time `json:"reviewedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// Структура SubmissionAudio (аудио заявки); отдельно, чтобы списки его не читали
+type SubmissionAudio struct {
+	SubmissionID int    `gorm:"primaryKey;autoIncrement:false"`
+	Data         []byte `gorm:"not null"`
+}
+
+// Тело запроса на создание и изменение черновика
+type SubmissionRequest struct {
+	SongName    string            `json:"song" binding:"required"`
+	ReleaseDate ReleaseDate       `json:"releaseDate" swaggertype:"string" example:"16.07.2006"`
+	Text        string            `json:"text"`
+	Links       map[string]string `json:"links"`
+}
+
+func (r SubmissionRequest) validate() error {
+	for platform, link := range r.Links {
+		if u, err := url.Parse(link); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid %s link", platform)
+		}
+	}
+	return nil
+}
+
+// editableArtist загружает профиль из пути и проверяет права на него.
+// При ошибке отвечает клиенту сам и возвращает false.
+func editableArtist(c *gin.Context) (Artist, bool) {
+	var artist Artist
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid artist ID")
+		return artist, false
+	}
+	if err := dbFor(c).First(&artist, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithError(c, http.StatusNotFound, codeNotFound, "Artist not found")
+			return artist, false
+		}
+		logEntry(c).WithError(err).Error("Failed to fetch artist")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch artist")
+		return artist, false
+	}
+	if !canEditArtist(c, artist) {
+		abortWithError(c, http.StatusForbidden, codeForbidden, "Only the verified artist can submit songs")
+		return artist, false
+	}
+	return artist, true
+}
+
+// artistSubmission загружает заявку артиста из пути
+func artistSubmission(c *gin.Context, artist Artist) (SongSubmission, bool) {
+	var sub SongSubmission
+	id, err := strconv.Atoi(c.Param("submissionId"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid submission ID")
+		return sub, false
+	}
+	if err := dbFor(c).First(&sub, "id = ? AND artist_id = ?", id, artist.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithError(c, http.StatusNotFound, codeNotFound, "Submission not found")
+			return sub, false
+		}
+		logEntry(c).WithError(err).Error("Failed to fetch submission")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch submission")
+		return sub, false
+	}
+	return sub, true
+}
+
+// Черновик и отклоненную заявку артист может менять; остальные ждут модератора или уже опубликованы
+func (s SongSubmission) editable() bool {
+	return s.Status == submissionDraft || s.Status == submissionRejected
+}
+
+// @Summary Create song submission
+// @Description Start a draft of a new song by a verified artist. Drafts are not visible in the catalogue until a moderator approves them.
+// @ID create-submission
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Artist ID"
+// @Param submission body SubmissionRequest true "Song name, release date, lyrics and streaming links"
+// @Success 201 {object} SongSubmission
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /artists/{id}/submissions [post]
+func CreateSubmission(c *gin.Context) {
+	artist, ok := editableArtist(c)
+	if !ok {
+		return
+	}
+	var req SubmissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	userID, _ := currentUserID(c)
+	sub := SongSubmission{
+		ArtistID: artist.ID, UserID: userID, SongName: req.SongName, ReleaseDate: req.ReleaseDate.String(),
+		Text: req.Text, Links: req.Links, Status: submissionDraft,
+	}
+	if err := dbFor(c).Create(&sub).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to create submission")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to create submission")
+		return
+	}
+	c.JSON(http.StatusCreated, sub)
+}
+
+// @Summary List song submissions
+// @Description List an artist's submissions with their moderation status.
+// @ID list-submissions
+// @Produce  json
+// @Param id path int true "Artist ID"
+// @Success 200 {array} SongSubmission
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /artists/{id}/submissions [get]
+func GetSubmissions(c *gin.Context) {
+	artist, ok := editableArtist(c)
+	if !ok {
+		return
+	}
+	subs := []SongSubmission{}
+	if err := dbFor(c).Where("artist_id = ?", artist.ID).Order("id DESC").Find(&subs).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch submissions")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch submissions")
+		return
+	}
+	c.JSON(http.StatusOK, subs)
+}
+
+// @Summary Update song submission
+// @Description Replace the contents of a draft or rejected submission. A rejected submission goes back to draft.
+// @ID update-submission
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Artist ID"
+// @Param submissionId path int true "Submission ID"
+// @Param submission body SubmissionRequest true "Song name, release date, lyrics and streaming links"
+// @Success 200 {object} SongSubmission
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /artists/{id}/submissions/{submissionId} [put]
+func UpdateSubmission(c *gin.Context) {
+	artist, ok := editableArtist(c)
+	if !ok {
+		return
+	}
+	sub, ok := artistSubmission(c, artist)
+	if !ok {
+		return
+	}
+	var req SubmissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	if !sub.editable() {
+		abortWithError(c, http.StatusConflict, codeConflict, "Submission can no longer be changed")
+		return
+	}
+	sub.SongName = req.SongName
+	sub.ReleaseDate = req.ReleaseDate.String()
+	sub.Text = req.Text
+	sub.Links = req.Links
+	sub.Status = submissionDraft
+	if err := dbFor(c).Save(&sub).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to update submission")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to update submission")
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// @Summary Upload submission audio
+// @Description Attach an audio file to a draft or rejected submission. The request body is the file itself with an audio/* Content-Type; a new upload replaces the previous one.
+// @ID upload-submission-audio
+// @Accept  audio/mpeg
+// @Produce  json
+// @Param id path int true "Artist ID"
+// @Param submissionId path int true "Submission ID"
+// @Success 200 {object} SongSubmission
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 413 {object} APIError
+// @Failure 415 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /artists/{id}/submissions/{submissionId}/audio [put]
+func UploadSubmissionAudio(c *gin.Context) {
+	artist, ok := editableArtist(c)
+	if !ok {
+		return
+	}
+	sub, ok := artistSubmission(c, artist)
+	if !ok {
+		return
+	}
+	if !sub.editable() {
+		abortWithError(c, http.StatusConflict, codeConflict, "Submission can no longer be changed")
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "audio/") {
+		abortWithError(c, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "Content-Type must be an audio type")
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, submissionAudioLimit))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		abortWithError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "Audio file is too large")
+		return
+	}
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Failed to read audio")
+		return
+	}
+	if len(data) == 0 {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Audio file is empty")
+		return
+	}
+
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		audio := SubmissionAudio{SubmissionID: sub.ID, Data: data}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "submission_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"data"}),
+		}).Create(&audio).Error
+		if err != nil {
+			return err
+		}
+		sub.AudioType = mediaType
+		return tx.Model(&sub).Update("audio_type", mediaType).Error
+	})
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to store submission audio")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to store audio")
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// @Summary Submit song for moderation
+// @Description Send a draft to the moderation queue. It can no longer be changed until a moderator rejects it.
+// @ID submit-submission
+// @Produce  json
+// @Param id path int true "Artist ID"
+// @Param submissionId path int true "Submission ID"
+// @Success 200 {object} SongSubmission
+// @Failure 400 {object} APIError
+// @Failure 401 {object} APIError
+// @Failure 403 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /artists/{id}/submissions/{submissionId}/submit [post]
+func SubmitSubmission(c *gin.Context) {
+	artist, ok := editableArtist(c)
+	if !ok {
+		return
+	}
+	sub, ok := artistSubmission(c, artist)
+	if !ok {
+		return
+	}
+	if sub.Status != submissionDraft {
+		abortWithError(c, http.StatusConflict, codeConflict, "Only drafts can be submitted")
+		return
+	}
+	sub.Status = submissionPending
+	sub.ReviewNote = ""
+	if err := dbFor(c).Model(&sub).Updates(map[string]interface{}{"status": sub.Status, "review_note": ""}).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to submit song")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to submit song")
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// pendingSubmission загружает заявку из очереди модерации
+func pendingSubmission(tx *gorm.DB, id int) (SongSubmission, error) {
+	var sub SongSubmission
+	if err := tx.First(&sub, id).Error; err != nil {
+		return sub, err
+	}
+	if sub.Status != submissionPending {
+		return sub, errSubmissionNotPending
+	}
+	return sub, nil
+}
+
+var errSubmissionNotPending = errors.New("submission is not pending")
+
+// @Summary List moderation queue
+// @Description List submissions by status, oldest first. Defaults to pending ones. Filters take an operator in brackets, e.g. status[ne]=draft.
+// @ID list-moderation-queue
+// @Produce  json
+// @Param status query string false "draft, pending, approved or rejected"
+// @Param artistId query int false "Only submissions of this artist"
+// @Success 200 {array} SongSubmission
+// @Failure 400 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/submissions [get]
+func GetModerationQueue(c *gin.Context) {
+	conds, err := submissionFilterFields.Parse(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	fs := NewFilterSet("").Conds(conds)
+	if !hasFilter(conds, "status") {
+		fs.Eq("status", submissionPending)
+	}
+	subs := []SongSubmission{}
+	if err := fs.Apply(dbFor(c).Model(&SongSubmission{})).Order("updated_at, id").Find(&subs).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch submissions")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch submissions")
+		return
+	}
+	c.JSON(http.StatusOK, subs)
+}
+
+// @Summary Get submission audio
+// @Description Download the audio attached to a submission.
+// @ID get-submission-audio
+// @Produce  audio/mpeg
+// @Param id path int true "Submission ID"
+// @Success 200 {file} binary
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/submissions/{id}/audio [get]
+func GetSubmissionAudio(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid submission ID")
+		return
+	}
+	var sub SongSubmission
+	var audio SubmissionAudio
+	err = dbFor(c).First(&sub, id).Error
+	if err == nil {
+		err = dbFor(c).First(&audio, "submission_id = ?", id).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Audio not found")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch submission audio")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch audio")
+		return
+	}
+	c.Data(http.StatusOK, sub.AudioType, audio.Data)
+}
+
+// @Summary Approve submission
+// @Description Publish a pending submission as a song owned by the artist's verified user. Its streaming links are stored with it. If the artist already has a song with this title, the submission stays pending and 409 is returned.
+// @ID approve-submission
+// @Produce  json
+// @Param id path int true "Submission ID"
+// @Success 200 {object} SongSubmission
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/submissions/{id}/approve [post]
+func ApproveSubmission(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid submission ID")
+		return
+	}
+	var sub SongSubmission
+	var song Song
+	err = inSongTx(c, func(w *songWrite) error {
+		tx := w.tx
+		var err error
+		if sub, err = pendingSubmission(tx, id); err != nil {
+			return err
+		}
+		var artist Artist
+		if err := tx.First(&artist, sub.ArtistID).Error; err != nil {
+			return err
+		}
+		song = Song{
+			Group: artist.Name, SongName: sub.SongName, ReleaseDate: providerReleaseDate(sub.ReleaseDate), Text: sub.Text,
+			Explicit: profanity.Contains(sub.Text), OwnerID: artist.OwnerID,
+		}
+		if err := tx.Create(&song).Error; err != nil {
+			return err
+		}
+		for platform, link := range sub.Links {
+			song.Links = append(song.Links, SongLink{SongID: song.ID, Platform: platform, URL: link})
+		}
+		if len(song.Links) > 0 {
+			if err := tx.Create(&song.Links).Error; err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		songID := PublicID(song.ID)
+		sub.Status, sub.SongID, sub.ReviewedAt = submissionApproved, &songID, &now
+		err = tx.Model(&sub).Updates(map[string]interface{}{
+			"status": sub.Status, "song_id": song.ID, "reviewed_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		// Ссылки прислал артист, искать их не нужно - только статистику
+		w.afterCommit(func() {
+			if err := enqueueStatsRefresh(c.Request.Context(), song.ID); err != nil {
+				componentEntry(c, componentEnrichment).WithError(err).Warn("Failed to queue Last.fm statistics refresh")
+			}
+			publishSongEventFor(c, songEventCreated, song)
+		})
+		return recordAudit(tx, c, auditEntitySong, song.ID, auditActionCreate, nil, song)
+	})
+	if !submissionReviewed(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// Тело запроса на отказ
+type RejectSubmissionRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// @Summary Reject submission
+// @Description Return a pending submission to the artist with a reason. The artist can edit it and submit again.
+// @ID reject-submission
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Submission ID"
+// @Param rejection body RejectSubmissionRequest true "Reason shown to the artist"
+// @Success 200 {object} SongSubmission
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/submissions/{id}/reject [post]
+func RejectSubmission(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid submission ID")
+		return
+	}
+	var req RejectSubmissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	var sub SongSubmission
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if sub, err = pendingSubmission(tx, id); err != nil {
+			return err
+		}
+		now := time.Now()
+		sub.Status, sub.ReviewNote, sub.ReviewedAt = submissionRejected, req.Reason, &now
+		return tx.Model(&sub).Updates(map[string]interface{}{
+			"status": sub.Status, "review_note": req.Reason, "reviewed_at": now,
+		}).Error
+	})
+	if !submissionReviewed(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// submissionReviewed отвечает клиенту на ошибку модерации; true - ошибки нет
+func submissionReviewed(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Submission not found")
+	case errors.Is(err, errSubmissionNotPending):
+		abortWithError(c, http.StatusConflict, codeConflict, "Submission is not awaiting moderation")
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		abortWithError(c, http.StatusConflict, codeSongExists, "Song already exists")
+	default:
+		logEntry(c).WithError(err).Error("Failed to review submission")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to review submission")
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Примерный расход памяти на запись сверх строк песни: элемент списка,
+// запись в map и остальные поля Song
+const songTextCacheEntryOverhead = 256
+
+// SongTextCacheConfig - кеш текстов песен в памяти процесса
+type SongTextCacheConfig struct {
+	MaxBytes int           // 0 - кеш выключен
+	TTL      time.Duration // сколько хранится запись; 0 - пока не вытеснена
+}
+
+// SongTextCache - LRU песен для GET /songs/:id/text, ограниченный по байтам.
+// Запись удаляется при изменении и удалении песни (publishSongEvent); другие
+// экземпляры об изменении не узнают, поэтому при нескольких экземплярах
+// устаревание ограничивает TTL.
+type SongTextCache struct {
+	cfg SongTextCacheConfig
+
+	mu      sync.Mutex
+	bytes   int
+	order   *list.List // в начале - недавно прочитанные
+	entries map[int]*list.Element
+
+	hits, misses, evictions uint64
+}
+
+type songTextCacheEntry struct {
+	song    Song
+	size    int
+	expires time.Time
+}
+
+// Кеш текстов в памяти; nil - выключен
+var songTextCache *SongTextCache
+
+// NewSongTextCache возвращает nil, если размер не задан
+func NewSongTextCache(cfg SongTextCacheConfig) *SongTextCache {
+	if cfg.MaxBytes <= 0 {
+		return nil
+	}
+	return &SongTextCache{cfg: cfg, order: list.New(), entries: map[int]*list.Element{}}
+}
+
+func songTextCacheSize(song Song) int {
+	return len(song.Text) + len(song.Group) + len(song.SongName) + len(song.Album) +
+		len(song.Link) + songTextCacheEntryOverhead
+}
+
+// Get возвращает песню и поднимает запись в начало списка
+func (tc *SongTextCache) Get(id int) (Song, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	el, ok := tc.entries[id]
+	if ok {
+		entry := el.Value.(*songTextCacheEntry)
+		if tc.cfg.TTL <= 0 || time.Now().Before(entry.expires) {
+			tc.hits++
+			tc.order.MoveToFront(el)
+			return entry.song, true
+		}
+		tc.remove(el)
+	}
+	tc.misses++
+	return Song{}, false
+}
+
+// Put сохраняет песню и вытесняет давно не читанные записи, пока не
+// хватит места. Песня больше всего кеша не сохраняется.
+func (tc *SongTextCache) Put(song Song) {
+	size := songTextCacheSize(song)
+	if size > tc.cfg.MaxBytes {
+		return
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if el, ok := tc.entries[song.ID]; ok {
+		tc.remove(el)
+	}
+	for tc.bytes+size > tc.cfg.MaxBytes {
+		tc.remove(tc.order.Back())
+		tc.evictions++
+	}
+	entry := &songTextCacheEntry{song: song, size: size}
+	if tc.cfg.TTL > 0 {
+		entry.expires = time.Now().Add(tc.cfg.TTL)
+	}
+	tc.entries[song.ID] = tc.order.PushFront(entry)
+	tc.bytes += size
+}
+
+// Invalidate удаляет песню из кеша
+func (tc *SongTextCache) Invalidate(id int) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if el, ok := tc.entries[id]; ok {
+		tc.remove(el)
+	}
+}
+
+// Clear удаляет все записи: после восстановления из выгрузки любая из них
+// может быть устаревшей
+func (tc *SongTextCache) Clear() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.order.Init()
+	tc.entries = map[int]*list.Element{}
+	tc.bytes = 0
+}
+
+// remove вызывается под tc.mu
+func (tc *SongTextCache) remove(el *list.Element) {
+	entry := tc.order.Remove(el).(*songTextCacheEntry)
+	delete(tc.entries, entry.song.ID)
+	tc.bytes -= entry.size
+}
+
+// write пишет метрики кеша для GET /metrics
+func (tc *SongTextCache) write(w *metricsWriter) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	counters := []struct {
+		name, help string
+		value      uint64
+	}{
+		{"musik_song_text_cache_hits_total", "Song text reads served from the in-process cache.", tc.hits},
+		{"musik_song_text_cache_misses_total", "Song text reads that went to the database.", tc.misses},
+		{"musik_song_text_cache_evictions_total", "Songs evicted from the in-process text cache to free space.", tc.evictions},
+	}
+	for _, m := range counters {
+		w.header(m.name, "counter", m.help)
+		w.sample(m.name, float64(m.value))
+	}
+	w.header("musik_song_text_cache_bytes", "gauge", "Approximate size of the in-process song text cache.")
+	w.sample("musik_song_text_cache_bytes", float64(tc.bytes))
+	w.header("musik_song_text_cache_entries", "gauge", "Songs in the in-process text cache.")
+	w.sample("musik_song_text_cache_entries", float64(len(tc.entries)))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const tracerName = "github.com/bubannnnnnn/musik_api"
+
+// TracingConfig - экспорт трасс по OTLP/HTTP. Адрес, заголовки, TLS и
+// таймаут экспортер сам берет из стандартных переменных OTEL_EXPORTER_OTLP_*.
+type TracingConfig struct {
+	Endpoint    string  // адрес коллектора из тех же переменных; пусто - трассировка выключена
+	ServiceName string  // service.name в ресурсах трасс
+	SampleRatio float64 // доля трасс, начатых этим сервисом; решение вызывающего соблюдается
+}
+
+// Провайдер трасс; nil - трассировка выключена
+var tracerProvider *sdktrace.TracerProvider
+
+// Заголовки W3C traceparent и baggage: ими контекст трассы приходит от
+// клиента, уходит во внешние API и сохраняется в фоновых задачах
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// SetupTracing создает провайдер с OTLP-экспортером и делает его глобальным
+func SetupTracing(ctx context.Context, cfg TracingConfig) error {
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to set up OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return fmt.Errorf("failed to describe trace resource: %w", err)
+	}
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(tracePropagator)
+	return nil
+}
+
+// ShutdownTracing отправляет накопленные спаны перед выходом
+func ShutdownTracing(ctx context.Context) error {
+	if tracerProvider == nil {
+		return nil
+	}
+	return tracerProvider.Shutdown(ctx)
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// traceHTTP оборачивает транспорт внешнего API: каждый вызов - клиентский
+// спан, а в запрос уходит traceparent
+func traceHTTP(base http.RoundTripper) http.RoundTripper {
+	if tracerProvider == nil {
+		return base
+	}
+	return otelhttp.NewTransport(base)
+}
+
+// traceParent сериализует контекст трассы для сохранения вместе с задачей;
+// пусто - трассы нет
+func traceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	tracePropagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// withTraceParent восстанавливает контекст трассы, сохраненный traceParent
+func withTraceParent(ctx context.Context, parent string) context.Context {
+	if parent == "" {
+		return ctx
+	}
+	return tracePropagator.Extract(ctx, propagation.MapCarrier{"traceparent": parent})
+}
+
+// tracingPlugin - плагин GORM: каждый запрос к базе - спан в трассе
+// HTTP-запроса или задачи, чей контекст передан через WithContext
+type tracingPlugin struct{}
+
+func (tracingPlugin) Name() string {
+	return "tracing"
+}
+
+func (tracingPlugin) Initialize(db *gorm.DB) error {
+	start := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			// Родительский контекст возвращается в finish: цепочка вызовов
+			// на одном *gorm.DB делит Statement
+			tx.InstanceSet("tracing:parent", tx.Statement.Context)
+			ctx, _ := tracer().Start(tx.Statement.Context, "gorm."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(semconv.DBSystemKey.String(tx.Dialector.Name())),
+			)
+			tx.Statement.Context = ctx
+		}
+	}
+	finish := func(tx *gorm.DB) {
+		parent, ok := tx.InstanceGet("tracing:parent")
+		if !ok {
+			return
+		}
+		span := trace.SpanFromContext(tx.Statement.Context)
+		tx.Statement.Context = parent.(context.Context)
+		defer span.End()
+		if !span.IsRecording() {
+			return
+		}
+		span.SetAttributes(
+			semconv.DBStatementKey.String(tx.Statement.SQL.String()),
+			semconv.DBSQLTableKey.String(tx.Statement.Table),
+		)
+		if err := tx.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Query().Before("gorm:query").Register("tracing:query_start", start("query")),
+		cb.Query().After("gorm:query").Register("tracing:query_finish", finish),
+		cb.Create().Before("gorm:create").Register("tracing:create_start", start("create")),
+		cb.Create().After("gorm:create").Register("tracing:create_finish", finish),
+		cb.Update().Before("gorm:update").Register("tracing:update_start", start("update")),
+		cb.Update().After("gorm:update").Register("tracing:update_finish", finish),
+		cb.Delete().Before("gorm:delete").Register("tracing:delete_start", start("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:delete_finish", finish),
+		cb.Row().Before("gorm:row").Register("tracing:row_start", start("row")),
+		cb.Row().After("gorm:row").Register("tracing:row_finish", finish),
+		cb.Raw().Before("gorm:raw").Register("tracing:raw_start", start("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:raw_finish", finish),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Структура User (Пользователь)
+type User struct {
+	ID           int       `json:"id" gorm:"primaryKey"`
+	Username     string    `json:"username" gorm:"uniqueIndex;not null"`
+	PasswordHash string    `json:"-" gorm:"not null"`
+	Role         Role      `json:"role" gorm:"not null;default:reader"`
+	Region       string    `json:"region"` // для правил REGION_RULES; пусто - регион из заголовка запроса
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Тело запроса на создание пользователя
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+	Role     Role   `json:"role" binding:"omitempty,oneof=admin editor reader"`
+}
+
+// @Summary Create user
+// @Description Create a user that can log in and obtain access tokens.
+// @ID create-user
+// @Accept  json
+// @Produce  json
+// @Param user body CreateUserRequest true "User credentials"
+// @Success 201 {object} User
+// @Failure 400 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/users [post]
+func CreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to hash password")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to create user")
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = RoleReader
+	}
+	user := User{Username: req.Username, PasswordHash: string(hash), Role: req.Role}
+	if err := dbFor(c).Create(&user).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to create user in database")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to create user")
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// Тело запроса на смену роли
+type RoleRequest struct {
+	Role Role `json:"role" binding:"required,oneof=admin editor reader"`
+}
+
+// @Summary Set user role
+// @Description Change the role of a user. Takes effect when the user obtains a new token.
+// @ID set-user-role
+// @Accept  json
+// @Produce  json
+// @Param id path int true "User ID"
+// @Param role body RoleRequest true "New role"
+// @Success 200 {object} User
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/users/{id}/role [put]
+func SetUserRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid user ID")
+		return
+	}
+
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+
+	var user User
+	db := dbFor(c)
+	if err := db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithError(c, http.StatusNotFound, codeNotFound, "User not found")
+		} else {
+			logEntry(c).WithError(err).Error("Failed to fetch user")
+			abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to update user")
+		}
+		return
+	}
+
+	if err := db.Model(&user).Update("role", req.Role).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to update user role")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to update user")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Проверки полей сверх встроенных в validator. Теги регистрируются в
+// валидаторе gin, поэтому работают и в ShouldBindJSON, и в validateSong.
+var customValidations = map[string]validator.Func{
+	"nocontrol": func(fl validator.FieldLevel) bool { return cleanText(fl.Field().String(), false) },
+	"lyrics":    func(fl validator.FieldLevel) bool { return cleanText(fl.Field().String(), true) },
+	"weblink":   func(fl validator.FieldLevel) bool { return isWebLink(fl.Field().String()) },
+}
+
+// cleanText сообщает, что строка - корректный UTF-8 без управляющих символов;
+// multiline разрешает переводы строк и табуляцию. encoding/json заменяет
+// неверные байты на U+FFFD, поэтому он тоже считается ошибкой кодировки.
+func cleanText(s string, multiline bool) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if r == utf8.RuneError {
+			return false
+		}
+		if multiline && (r == '\n' || r == '\r' || r == '\t') {
+			continue
+		}
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isWebLink - абсолютная ссылка http или https с хостом
+func isWebLink(s string) bool {
+	if strings.ContainsFunc(s, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) {
+		return false
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// fieldMessage - текст ошибки поля для человека
+func fieldMessage(fe validator.FieldError) string {
+	unit := ""
+	if fe.Kind() == reflect.String {
+		unit = " characters"
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "max", "lte":
+		return fmt.Sprintf("must be at most %s%s", fe.Param(), unit)
+	case "min", "gte":
+		return fmt.Sprintf("must be at least %s%s", fe.Param(), unit)
+	case "ne":
+		return "must not be " + fe.Param()
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	case "nocontrol":
+		return "must be valid UTF-8 without control characters"
+	case "lyrics":
+		return "must be valid UTF-8 without control characters other than line breaks and tabs"
+	case "weblink":
+		return "must be an http or https URL"
+	}
+	return "is invalid"
+}
+
+// invalidSongError - песня не прошла проверку. Текст перечисляет поля, как
+// в ошибках строк импорта и пакета; errorBody находит в нем ValidationErrors.
+type invalidSongError struct {
+	errs validator.ValidationErrors
+}
+
+func (e invalidSongError) Error() string {
+	msgs := make([]string, len(e.errs))
+	for i, fe := range e.errs {
+		msgs[i] = fieldPath(fe) + " " + fieldMessage(fe)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e invalidSongError) Unwrap() error { return e.errs }
+
+// validateSong проверяет песню из импорта, пакета, PATCH или gRPC по тем
+// же тегам binding, что и тело POST /songs
+func validateSong(song Song) error {
+	err := binding.Validator.ValidateStruct(song)
+	var invalid validator.ValidationErrors
+	if errors.As(err, &invalid) {
+		return invalidSongError{errs: invalid}
+	}
+	return err
+}
+
+// songsPage - страница списка песен
+type songsPage struct {
+	Page int `json:"page" form:"page,default=1" binding:"min=1"`
+	// Отрицательный limit - весь список потоком, см. GetSongs
+	Limit int `json:"limit" form:"limit,default=10" binding:"ne=0,max=100"`
+}
+
+// parseSongsPage читает page и limit списка песен. При ошибке отвечает
+// клиенту сам и возвращает false.
+func parseSongsPage(c *gin.Context) (songsPage, bool) {
+	var p songsPage
+	if err := c.ShouldBindQuery(&p); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return p, false
+	}
+	return p, true
+}
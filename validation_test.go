@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAddSongFieldValidation(t *testing.T) {
+	setupTestDB(t)
+	router := newTestRouter()
+
+	cases := []struct {
+		name  string
+		body  string
+		field string
+		rule  string
+	}{
+		{"link without scheme", `{"group":"Muse","song":"Hysteria","link":"example.com/hysteria"}`, "link", "weblink"},
+		{"link with other scheme", `{"group":"Muse","song":"Hysteria","link":"javascript:alert(1)"}`, "link", "weblink"},
+		{"long group", `{"group":"` + strings.Repeat("я", 201) + `","song":"Hysteria"}`, "group", "max"},
+		{"control character in song", `{"group":"Muse","song":"Hyste\u0000ria"}`, "song", "nocontrol"},
+		{"line break in group", `{"group":"Mu\nse","song":"Hysteria"}`, "group", "nocontrol"},
+		{"invalid UTF-8 in text", "{\"group\":\"Muse\",\"song\":\"Hysteria\",\"text\":\"It's bugging me\xff\"}", "text", "lyrics"},
+		{"negative duration", `{"group":"Muse","song":"Hysteria","durationMs":-1}`, "durationMs", "min"},
+	}
+	for _, tc := range cases {
+		w := doRequestAs(router, http.MethodPost, "/songs", tc.body, testAdminToken)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, w.Code, http.StatusBadRequest, w.Body.String())
+			continue
+		}
+		var body APIError
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: decode: %v", tc.name, err)
+		}
+		details, _ := json.Marshal(body.Details)
+		var fields []FieldError
+		json.Unmarshal(details, &fields)
+		if len(fields) != 1 || fields[0].Field != tc.field || fields[0].Rule != tc.rule || fields[0].Message == "" {
+			t.Errorf("%s: details %s, want %s failing %s", tc.name, details, tc.field, tc.rule)
+		}
+	}
+
+	// Переводы строк и табуляция в тексте песни допустимы
+	w := doRequestAs(router, http.MethodPost, "/songs", `{"group":"Muse","song":"Hysteria","text":"It's bugging me\n\tGrating me"}`, testAdminToken)
+	if w.Code == http.StatusBadRequest {
+		t.Errorf("multiline text rejected: %s", w.Body.String())
+	}
+}
+
+func TestGetSongsPageBounds(t *testing.T) {
+	setupTestDB(t)
+	seedGoldenSongs(t)
+	router := newTestRouter()
+
+	for _, query := range []string{"limit=101", "limit=0", "page=0", "page=-1", "limit=ten"} {
+		w := doRequest(router, http.MethodGet, "/songs?"+query, "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d: %s", query, w.Code, http.StatusBadRequest, w.Body.String())
+		}
+	}
+	for _, query := range []string{"limit=100", "limit=-1", "page=2&limit=1"} {
+		w := doRequest(router, http.MethodGet, "/songs?"+query, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status %d, want %d: %s", query, w.Code, http.StatusOK, w.Body.String())
+		}
+	}
+}
+
+func TestValidateSongMessage(t *testing.T) {
+	err := validateSong(Song{SongName: "Starlight", Link: "ftp://example.com/starlight"})
+	if err == nil || err.Error() != "group is required; link must be an http or https URL" {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	jobKindWebhookDelivery = "webhook_delivery"
+
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// События, на которые можно подписаться
+const (
+	songEventCreated = "song.created"
+	songEventUpdated = "song.updated"
+	songEventDeleted = "song.deleted"
+)
+
+var songEventTypes = []string{songEventCreated, songEventUpdated, songEventDeleted}
+
+// Структура Webhook (подписка внешнего получателя на события)
+type Webhook struct {
+	ID  int    `json:"id" gorm:"primaryKey"`
+	URL string `json:"url" gorm:"not null"`
+	// Ключ подписи тела; показывается только при создании
+	Secret    string        `json:"-" gorm:"not null"`
+	Filter    WebhookFilter `json:"filter" gorm:"embedded;embeddedPrefix:filter_"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// WebhookFilter - условия подписки; проверяются при публикации события.
+// Пустое поле не ограничивает, заполненные должны совпасть все.
+type WebhookFilter struct {
+	Events []string `json:"events" gorm:"serializer:json"` // song.created, song.updated, song.deleted
+	Artist string   `json:"artist"`                        // группа песни, без учета регистра
+	Genre  string   `json:"genre"`                         // один из тегов Last.fm песни
+}
+
+// Matches сообщает, нужно ли отправлять событие этому получателю
+func (f WebhookFilter) Matches(event string, song Song) bool {
+	if len(f.Events) > 0 && !containsString(f.Events, event) {
+		return false
+	}
+	if f.Artist != "" && !strings.EqualFold(f.Artist, song.Group) {
+		return false
+	}
+	if f.Genre != "" {
+		for _, tag := range song.Tags {
+			if strings.EqualFold(tag.Name, f.Genre) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (f WebhookFilter) validate() error {
+	for _, event := range f.Events {
+		if !containsString(songEventTypes, event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTP-клиент доставки; таймаут задает WEBHOOK_TIMEOUT
+var webhookHTTP = &http.Client{Timeout: 10 * time.Second}
+
+type webhookDeliveryPayload struct {
+	WebhookID  int             `json:"webhookId"`
+	Event      string          `json:"event"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// publishSongEvent передает событие клиентам /ws, сбрасывает кеш перед API и
+// ставит в очередь доставку подписчикам, чьи фильтры ему соответствуют.
+// Вызывается после фиксации транзакции.
+func publishSongEvent(ctx context.Context, db *gorm.DB, event string, song Song) error {
+	songEvents.Publish(SongEvent{Event: event, OccurredAt: time.Now(), Data: song})
+	if songTextCache != nil {
+		songTextCache.Invalidate(song.ID)
+	}
+	if err := purgeCache(ctx, cacheKeySongs); err != nil {
+		return err
+	}
+	if jobs == nil {
+		return nil
+	}
+	var hooks []Webhook
+	if err := db.WithContext(ctx).Find(&hooks).Error; err != nil {
+		return err
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+	// Теги нужны только для фильтра по жанру
+	for _, hook := range hooks {
+		if hook.Filter.Genre != "" && song.Tags == nil {
+			if err := db.WithContext(ctx).Where("song_id = ?", song.ID).Order("id").Find(&song.Tags).Error; err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	data, err := json.Marshal(publicSong(song))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, hook := range hooks {
+		if !hook.Filter.Matches(event, song) {
+			continue
+		}
+		payload := webhookDeliveryPayload{WebhookID: hook.ID, Event: event, OccurredAt: now, Data: data}
+		if err := jobs.Enqueue(ctx, jobKindWebhookDelivery, payload, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishSongEventFor публикует событие из обработчика подписчикам и
+// владельцу песни; ошибка только пишется в лог, потому что изменение уже сохранено
+func publishSongEventFor(c *gin.Context, event string, song Song) {
+	if err := publishSongEvent(c.Request.Context(), dbFor(c), event, song); err != nil {
+		logEntry(c).WithError(err).WithField("event", event).Warn("Failed to publish webhook event")
+	}
+	notifySongOwner(c, event, song)
+}
+
+// deliverWebhookJob - обработчик задачи webhook_delivery. Ответ не 2xx -
+// ошибка, задачу повторит очередь.
+func deliverWebhookJob(ctx context.Context, payload json.RawMessage) error {
+	var p webhookDeliveryPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	var hook Webhook
+	if err := GetDB().WithContext(ctx).First(&hook, p.WebhookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Подписку удалили, пока задача ждала очереди
+			return nil
+		}
+		return err
+	}
+
+	body, err := json.Marshal(gin.H{"event": p.Event, "occurredAt": p.OccurredAt, "data": p.Data})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, p.Event)
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(hook.Secret, body))
+
+	resp, err := webhookHTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("deliver webhook %d: %w", hook.ID, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("deliver webhook %d: status %d", hook.ID, resp.StatusCode)
+	}
+	return nil
+}
+
+// signWebhook - HMAC-SHA256 тела; получатель сверяет его со своим ключом
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Тело запроса на создание и изменение подписки
+type WebhookRequest struct {
+	URL    string        `json:"url" binding:"required"`
+	Filter WebhookFilter `json:"filter"`
+}
+
+// Ответ с новой подпиской; ключ подписи показывается только один раз
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+func bindWebhookRequest(c *gin.Context) (WebhookRequest, bool) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return req, false
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid webhook URL")
+		return req, false
+	}
+	if err := req.Filter.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return req, false
+	}
+	return req, true
+}
+
+// @Summary Create webhook
+// @Description Subscribe a URL to song events. Filters on event type, artist and genre are evaluated when an event is published. The signing secret is returned only once.
+// @ID create-webhook
+// @Accept  json
+// @Produce  json
+// @Param webhook body WebhookRequest true "Webhook URL and filters"
+// @Success 201 {object} CreatedWebhook
+// @Failure 400 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/webhooks [post]
+func CreateWebhook(c *gin.Context) {
+	req, ok := bindWebhookRequest(c)
+	if !ok {
+		return
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		logEntry(c).WithError(err).Error("Failed to generate webhook secret")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to create webhook")
+		return
+	}
+	hook := Webhook{URL: req.URL, Secret: hex.EncodeToString(b), Filter: req.Filter}
+	if err := dbFor(c).Create(&hook).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to create webhook")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to create webhook")
+		return
+	}
+	c.JSON(http.StatusCreated, CreatedWebhook{Webhook: hook, Secret: hook.Secret})
+}
+
+// @Summary List webhooks
+// @Description List webhook subscriptions with their filters.
+// @ID list-webhooks
+// @Produce  json
+// @Success 200 {array} Webhook
+// @Failure 500 {object} APIError
+// @Router /admin/webhooks [get]
+func GetWebhooks(c *gin.Context) {
+	var hooks []Webhook
+	if err := dbFor(c).Order("id").Find(&hooks).Error; err != nil {
+		logEntry(c).WithError(err).Error("Failed to fetch webhooks")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to fetch webhooks")
+		return
+	}
+	c.JSON(http.StatusOK, hooks)
+}
+
+// @Summary Update webhook
+// @Description Change a webhook's URL and filters. The signing secret stays the same.
+// @ID update-webhook
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Webhook ID"
+// @Param webhook body WebhookRequest true "Webhook URL and filters"
+// @Success 200 {object} Webhook
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/webhooks/{id} [put]
+func UpdateWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid webhook ID")
+		return
+	}
+	req, ok := bindWebhookRequest(c)
+	if !ok {
+		return
+	}
+	var hook Webhook
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&hook, id).Error; err != nil {
+			return err
+		}
+		hook.URL = req.URL
+		hook.Filter = req.Filter
+		return tx.Save(&hook).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to update webhook")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to update webhook")
+		return
+	}
+	c.JSON(http.StatusOK, hook)
+}
+
+// @Summary Delete webhook
+// @Description Delete a webhook subscription. Queued deliveries to it are dropped.
+// @ID delete-webhook
+// @Produce  json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} Message
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/webhooks/{id} [delete]
+func DeleteWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid webhook ID")
+		return
+	}
+	result := dbFor(c).Delete(&Webhook{}, id)
+	if result.Error != nil {
+		logEntry(c).WithError(result.Error).Error("Failed to delete webhook")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to delete webhook")
+		return
+	}
+	if result.RowsAffected == 0 {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "Webhook not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
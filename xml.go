@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/xml"
+	"sort"
+	"time"
+)
+
+// Песня в XML-ответе. Элементы называются так же, как поля JSON; карты
+// encoding/xml не умеет, поэтому источники и ссылки - списки с атрибутом.
+// Списки вложены через указатели: omitempty у пути a>b пустой a не убирает.
+type songXML struct {
+	XMLName           xml.Name          `xml:"song"`
+	ID                PublicID          `xml:"id"`
+	Group             string            `xml:"group"`
+	SongName          string            `xml:"song"`
+	ReleaseDate       string            `xml:"releaseDate"`
+	Text              string            `xml:"text"`
+	Link              string            `xml:"link"`
+	LinkConfidence    *float64          `xml:"linkConfidence,omitempty"`
+	Album             string            `xml:"album"`
+	AlbumID           *int              `xml:"albumId,omitempty"`
+	AlbumPosition     int               `xml:"albumPosition"`
+	DurationMs        int               `xml:"durationMs"`
+	Explicit          bool              `xml:"explicit"`
+	OwnerID           *int              `xml:"ownerId,omitempty"`
+	EnrichmentPending bool              `xml:"enrichmentPending"`
+	EnrichmentSources *enrichmentXML    `xml:"enrichmentSources,omitempty"`
+	Archived          bool              `xml:"archived"`
+	Listeners         int64             `xml:"listeners"`
+	Playcount         int64             `xml:"playcount"`
+	StatsUpdatedAt    *time.Time        `xml:"statsUpdatedAt,omitempty"`
+	Version           int               `xml:"version"`
+	Owner             *userXML          `xml:"owner,omitempty"`
+	Tags              *tagsXML          `xml:"tags,omitempty"`
+	Links             *platformLinksXML `xml:"links,omitempty"`
+}
+
+// <source field="text">genius</source>
+type enrichmentSourceXML struct {
+	Field    string `xml:"field,attr"`
+	Provider string `xml:",chardata"`
+}
+
+type enrichmentXML struct {
+	Sources []enrichmentSourceXML `xml:"source"`
+}
+
+type tagsXML struct {
+	Tags []string `xml:"tag"`
+}
+
+// <link platform="spotify">https://...</link>
+type platformLinkXML struct {
+	Platform string `xml:"platform,attr"`
+	URL      string `xml:",chardata"`
+}
+
+type platformLinksXML struct {
+	Links []platformLinkXML `xml:"link"`
+}
+
+type userXML struct {
+	ID        int       `xml:"id"`
+	Username  string    `xml:"username"`
+	Role      Role      `xml:"role"`
+	CreatedAt time.Time `xml:"createdAt"`
+}
+
+// Корневой элемент списка песен
+type songsXML struct {
+	XMLName xml.Name  `xml:"songs"`
+	Songs   []songXML `xml:"song"`
+}
+
+func newSongXML(s Song) songXML {
+	out := songXML{
+		ID:                PublicID(s.ID),
+		Group:             s.Group,
+		SongName:          s.SongName,
+		ReleaseDate:       s.ReleaseDate.String(),
+		Text:              s.Text,
+		Link:              s.Link,
+		LinkConfidence:    s.LinkConfidence,
+		Album:             s.Album,
+		AlbumID:           s.AlbumID,
+		AlbumPosition:     s.AlbumPosition,
+		DurationMs:        s.DurationMs,
+		Explicit:          s.Explicit,
+		OwnerID:           s.OwnerID,
+		EnrichmentPending: s.EnrichmentPending,
+		Archived:          s.Archived,
+		Listeners:         s.Listeners,
+		Playcount:         s.Playcount,
+		StatsUpdatedAt:    s.StatsUpdatedAt,
+		Version:           s.Version,
+	}
+	if len(s.EnrichmentSources) > 0 {
+		out.EnrichmentSources = &enrichmentXML{}
+		for field, provider := range s.EnrichmentSources {
+			out.EnrichmentSources.Sources = append(out.EnrichmentSources.Sources, enrichmentSourceXML{Field: field, Provider: provider})
+		}
+		// Порядок ключей карты случаен, в XML он должен быть постоянным
+		sources := out.EnrichmentSources.Sources
+		sort.Slice(sources, func(i, j int) bool { return sources[i].Field < sources[j].Field })
+	}
+	if s.Owner != nil {
+		out.Owner = &userXML{ID: s.Owner.ID, Username: s.Owner.Username, Role: s.Owner.Role, CreatedAt: s.Owner.CreatedAt}
+	}
+	if len(s.Tags) > 0 {
+		out.Tags = &tagsXML{}
+		for _, tag := range s.Tags {
+			out.Tags.Tags = append(out.Tags.Tags, tag.Name)
+		}
+	}
+	if len(s.Links) > 0 {
+		out.Links = &platformLinksXML{}
+		for _, link := range s.Links {
+			out.Links.Links = append(out.Links.Links, platformLinkXML{Platform: link.Platform, URL: link.URL})
+		}
+	}
+	return out
+}
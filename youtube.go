@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	youTubeAPIURL   = "https://www.googleapis.com/youtube/v3"
+	youTubeWatchURL = "https://www.youtube.com/watch?v="
+	youTubeResults  = 5
+)
+
+// Слова в названии видео, которые указывают не на оригинальную запись
+var youTubeNoiseWords = []string{"live", "cover", "karaoke", "remix", "instrumental", "reaction", "tutorial", "nightcore"}
+
+// YouTubeConfig - параметры поиска ссылок в YouTube Data API; без ключа
+// ссылки не ищутся
+type YouTubeConfig struct {
+	APIKey        string
+	APIURL        string
+	Timeout       time.Duration
+	MinConfidence float64 // совпадения с меньшей оценкой не сохраняются
+}
+
+// YouTubeClient находит видео песни, если источник не вернул ссылку
+type YouTubeClient struct {
+	cfg  YouTubeConfig
+	http *http.Client
+}
+
+// Клиент YouTube; nil - ссылки не ищутся
+var youtube *YouTubeClient
+
+func NewYouTubeClient(cfg YouTubeConfig) *YouTubeClient {
+	if cfg.APIKey == "" {
+		return nil
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = youTubeAPIURL
+	}
+	cfg.APIURL = strings.TrimSuffix(cfg.APIURL, "/")
+	return &YouTubeClient{cfg: cfg, http: trackHTTP(&http.Client{Timeout: cfg.Timeout}, "youtube", dependencyEnrichment)}
+}
+
+// YouTubeMatch - лучшее найденное видео
+type YouTubeMatch struct {
+	Link       string
+	Confidence float64
+}
+
+// Ответ /search, только нужные поля
+type youTubeSearchResponse struct {
+	Items []struct {
+		ID struct {
+			VideoID string `json:"videoId"`
+		} `json:"id"`
+		Snippet struct {
+			Title        string `json:"title"`
+			ChannelTitle string `json:"channelTitle"`
+		} `json:"snippet"`
+	} `json:"items"`
+}
+
+// FindVideo ищет "group – song" и возвращает видео с наибольшей оценкой.
+// ErrInfoNotFound - нет ни одного видео с оценкой не ниже MinConfidence.
+func (yc *YouTubeClient) FindVideo(ctx context.Context, group, song string) (YouTubeMatch, error) {
+	params := url.Values{
+		"part":       {"snippet"},
+		"type":       {"video"},
+		"maxResults": {strconv.Itoa(youTubeResults)},
+		"q":          {group + " – " + song},
+		"key":        {yc.cfg.APIKey},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, yc.cfg.APIURL+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return YouTubeMatch{}, fmt.Errorf("build youtube request: %w", err)
+	}
+	resp, err := yc.http.Do(req)
+	if err != nil {
+		return YouTubeMatch{}, fmt.Errorf("%w: youtube: %w", ErrInfoUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return YouTubeMatch{}, &InfoStatusError{StatusCode: resp.StatusCode}
+	}
+	var result youTubeSearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return YouTubeMatch{}, fmt.Errorf("decode youtube response: %w", err)
+	}
+
+	var best YouTubeMatch
+	for _, item := range result.Items {
+		if item.ID.VideoID == "" {
+			continue
+		}
+		score := youTubeConfidence(group, song, item.Snippet.Title, item.Snippet.ChannelTitle)
+		if score > best.Confidence {
+			best = YouTubeMatch{Link: youTubeWatchURL + item.ID.VideoID, Confidence: score}
+		}
+	}
+	if best.Link == "" || best.Confidence < yc.cfg.MinConfidence {
+		return YouTubeMatch{}, ErrInfoNotFound
+	}
+	return best, nil
+}
+
+// youTubeConfidence оценивает от 0 до 1, насколько видео похоже на запись
+// песни: слова названия песни в заголовке весят больше, исполнитель
+// засчитывается и по заголовку, и по каналу (Muse, MuseVEVO, Muse - Topic)
+func youTubeConfidence(group, song, title, channel string) float64 {
+	titleWords := searchWords(title)
+	inTitle := make(map[string]bool, len(titleWords))
+	for _, w := range titleWords {
+		inTitle[w] = true
+	}
+
+	songScore := wordsShare(searchWords(song), inTitle)
+	artistScore := wordsShare(searchWords(group), inTitle)
+	if strings.Contains(strings.Join(searchWords(channel), ""), strings.Join(searchWords(group), "")) {
+		artistScore = 1
+	}
+	score := 0.6*songScore + 0.4*artistScore
+
+	songWords := strings.Join(searchWords(song), " ")
+	for _, noise := range youTubeNoiseWords {
+		if inTitle[noise] && !strings.Contains(songWords, noise) {
+			score -= 0.3
+			break
+		}
+	}
+	return math.Round(math.Max(score, 0)*100) / 100
+}
+
+// searchWords - слова строки в нижнем регистре без знаков препинания
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func wordsShare(words []string, in map[string]bool) float64 {
+	if len(words) == 0 {
+		return 0
+	}
+	found := 0
+	for _, w := range words {
+		if in[w] {
+			found++
+		}
+	}
+	return float64(found) / float64(len(words))
+}
+
+// resolveYouTubeLink дописывает ссылку на YouTube, если источник ее не вернул.
+// Ссылка не обязательна: при ошибке песня сохраняется без нее.
+func resolveYouTubeLink(c *gin.Context, song *Song) {
+	if err := findYouTubeLink(c.Request.Context(), song); err != nil {
+		componentEntry(c, componentEnrichment).WithError(err).Warn("Failed to search YouTube")
+	}
+}
+
+// findYouTubeLink - то же без контекста запроса, для фоновых задач.
+// Ненайденное видео не считается ошибкой.
+func findYouTubeLink(ctx context.Context, song *Song) error {
+	if youtube == nil || song.Link != "" {
+		return nil
+	}
+	match, err := youtube.FindVideo(ctx, song.Group, song.SongName)
+	if errors.Is(err, ErrInfoNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	song.Link = match.Link
+	song.LinkConfidence = &match.Confidence
+	if song.EnrichmentSources == nil {
+		song.EnrichmentSources = map[string]string{}
+	}
+	song.EnrichmentSources[fieldLink] = "youtube"
+	return nil
+}
+
+// Тело запроса на исправление ссылки
+type LinkCorrection struct {
+	Link string `json:"link"` // пустая строка убирает неверную ссылку
+}
+
+// @Summary Correct song link
+// @Description Replace an automatically resolved YouTube link. The corrected link is stored without a confidence score. Publishes song.updated.
+// @ID correct-song-link
+// @Accept  json
+// @Produce  json
+// @Produce  xml
+// @Produce  application/vnd.api+json
+// @Param id path string true "Song ID, numeric or public form" extensions(x-public-id)
+// @Param link body LinkCorrection true "Correct link"
+// @Success 200 {object} Song
+// @Failure 400 {object} APIError
+// @Failure 404 {object} APIError
+// @Failure 409 {object} APIError
+// @Failure 500 {object} APIError
+// @Router /admin/songs/{id}/link [put]
+func CorrectSongLink(c *gin.Context) {
+	id, err := parseSongID(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid song ID")
+		return
+	}
+	var req LinkCorrection
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	if req.Link != "" {
+		if u, err := url.Parse(req.Link); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			abortWithError(c, http.StatusBadRequest, codeValidation, "Invalid link")
+			return
+		}
+	}
+
+	var after Song
+	err = inSongTx(c, func(w *songWrite) error {
+		var before Song
+		if err := w.tx.First(&before, id).Error; err != nil {
+			return err
+		}
+		var err error
+		after, err = applySongUpdate(w.tx, before, 0, map[string]interface{}{
+			"link": req.Link, "link_confidence": nil, "version": before.Version + 1,
+		}, true, false)
+		if err != nil {
+			return err
+		}
+		// Как после PUT: событие сбрасывает кеш текстов и кеши ответов
+		w.afterCommit(func() {
+			publishSongEventFor(c, songEventUpdated, after)
+			// Ссылки на другие площадки искались по старой ссылке
+			if err := enqueueLinksResolve(c.Request.Context(), id); err != nil {
+				componentEntry(c, componentEnrichment).WithError(err).Warn("Failed to queue streaming links resolution")
+			}
+		})
+		return recordAudit(w.tx, c, auditEntitySong, id, auditActionUpdate, before, after)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
+	if errors.Is(err, errVersionConflict) {
+		abortWithError(c, http.StatusConflict, codeVersionConflict, "Song was changed by someone else")
+		return
+	}
+	if err != nil {
+		logEntry(c).WithError(err).Error("Failed to correct song link")
+		abortWithError(c, http.StatusInternalServerError, codeInternal, "Failed to correct link")
+		return
+	}
+	writeSong(c, http.StatusOK, after)
+}
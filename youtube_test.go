@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCorrectSongLinkInvalidatesCaches(t *testing.T) {
+	conn := setupTestDB(t)
+	seedGoldenSongs(t)
+	router := newTestRouter()
+
+	var purged []string
+	purger := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		purged = append(purged, r.Header.Get(surrogateKeyHeader))
+	}))
+	t.Cleanup(purger.Close)
+	cachePurger = NewCachePurger(CacheConfig{PurgeURL: purger.URL, Timeout: time.Second})
+	songTextCache = NewSongTextCache(SongTextCacheConfig{MaxBytes: 1 << 20})
+	t.Cleanup(func() { cachePurger, songTextCache = nil, nil })
+
+	var cached Song
+	conn.First(&cached, 1)
+	songTextCache.Put(cached)
+	sub := songEvents.Subscribe(0, 10)
+	t.Cleanup(sub.Close)
+
+	const link = "https://www.youtube.com/watch?v=abc"
+	w := doRequestAs(router, http.MethodPut, "/admin/songs/"+encodeSongID(1)+"/link", `{"link":"`+link+`"}`, testAdminToken)
+	var song Song
+	if err := json.Unmarshal(w.Body.Bytes(), &song); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("correct link: status %d, body %s", w.Code, w.Body)
+	}
+	if song.Link != link || song.LinkConfidence != nil {
+		t.Errorf("song = %+v, want corrected link without confidence", song)
+	}
+
+	// Исправление ведет себя как PUT: кеши сброшены, событие опубликовано
+	if _, ok := songTextCache.Get(1); ok {
+		t.Error("song text cache still holds song 1")
+	}
+	if len(purged) != 1 || purged[0] != cacheKeySongs {
+		t.Errorf("purged keys = %v, want [%s]", purged, cacheKeySongs)
+	}
+	select {
+	case event := <-sub.C:
+		if event.Event != songEventUpdated || event.Data.Link != link {
+			t.Errorf("event = %s with link %q", event.Event, event.Data.Link)
+		}
+	case <-time.After(time.Second):
+		t.Error("song.updated not published")
+	}
+}